@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -17,7 +21,10 @@ import (
 	"rolecraft-ai/internal/config"
 	"rolecraft-ai/internal/database"
 	"rolecraft-ai/internal/models"
+	documentSvc "rolecraft-ai/internal/service/document"
 	promptSvc "rolecraft-ai/internal/service/prompt"
+	retrievalSvc "rolecraft-ai/internal/service/retrieval"
+	searchSvc "rolecraft-ai/internal/service/search"
 	workspaceSvc "rolecraft-ai/internal/service/workspace"
 )
 
@@ -59,9 +66,11 @@ func main() {
 		&models.User{},
 		&models.Workspace{},
 		&models.Role{},
+		&models.RoleKnowledgeBinding{},
 		&models.Company{},
 		&models.Work{},
 		&models.AgentRun{},
+		&models.EmbeddingUsage{},
 		&models.CompanyExport{},
 		&models.RoleInstall{},
 		&models.Skill{},
@@ -69,6 +78,13 @@ func main() {
 		&models.Folder{},
 		&models.ChatSession{},
 		&models.Message{},
+		&models.VectorRecord{},
+		&models.DocumentChunk{},
+		&models.DocumentVersion{},
+		&models.DocumentTag{},
+		&models.IngestionJob{},
+		&models.UploadSession{},
+		&models.UploadPart{},
 	); err != nil {
 		log.Fatalf("Failed to auto migrate database schema: %v", err)
 	}
@@ -83,9 +99,34 @@ func main() {
 		}
 	}
 
+	// 旧版本的标签只保存在文档元数据中，补写到 DocumentTag
+	if migrated, err := documentSvc.BackfillTags(db); err != nil {
+		log.Fatalf("Failed to migrate document tags: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Migrated tags of %d documents", migrated)
+	}
+	// 旧版本把公司文档的向量写在上传者的集合中，移到公司集合
+	if moved, err := retrievalSvc.MoveCompanyVectors(db); err != nil {
+		log.Fatalf("Failed to migrate company vectors: %v", err)
+	} else if moved > 0 {
+		log.Printf("Moved %d company document vectors", moved)
+	}
+	// 全文检索索引（需以 -tags sqlite_fts5 构建才能启用 FTS5，否则退化为 LIKE 匹配）
+	searchIndex := searchSvc.NewIndex(db)
+	if err := searchIndex.Ensure(); err != nil {
+		log.Fatalf("Failed to initialize search index: %v", err)
+	}
+	if !searchIndex.FTS() {
+		log.Printf("SQLite FTS5 is unavailable, full-text search falls back to LIKE matching")
+	}
+
+	// 进程生命周期：收到中断或终止信号时停止接收请求，并停止后台任务
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	workspaceRunner := workspaceSvc.NewRunner(db, cfg)
 	workspaceScheduler := workspaceSvc.NewScheduler(db, workspaceRunner, 30*time.Second)
-	workspaceScheduler.Start(context.Background())
+	workspaceScheduler.Start(ctx)
 	defer workspaceScheduler.Stop()
 
 	// 设置 Gin 模式
@@ -158,6 +199,8 @@ func main() {
 			authorized.PUT("/roles/:id", roleHandler.Update)
 			authorized.DELETE("/roles/:id", roleHandler.Delete)
 			authorized.POST("/roles/:id/chat", roleHandler.Chat)
+			authorized.GET("/roles/:id/knowledge", roleHandler.GetKnowledge)
+			authorized.PUT("/roles/:id/knowledge", roleHandler.UpdateKnowledge)
 
 			// 公司
 			companyHandler := handler.NewCompanyHandler(db)
@@ -179,6 +222,7 @@ func main() {
 			authorized.DELETE("/workspaces/:id", workHandler.Delete)
 			authorized.POST("/workspaces/:id/run", workHandler.Run)
 			authorized.POST("/workspaces/batch/run", workHandler.BatchRun)
+			authorized.POST("/workspaces/schedule/preview", workHandler.PreviewSchedule)
 			authorized.GET("/workspaces/:id/runs", workHandler.ListRuns)
 			authorized.GET("/workspaces/:id/runs/:runId", workHandler.GetRun)
 			// 兼容旧命名 /works
@@ -188,17 +232,33 @@ func main() {
 			authorized.DELETE("/works/:id", workHandler.Delete)
 			authorized.POST("/works/:id/run", workHandler.Run)
 			authorized.POST("/works/batch/run", workHandler.BatchRun)
+			authorized.POST("/works/schedule/preview", workHandler.PreviewSchedule)
 			authorized.GET("/works/:id/runs", workHandler.ListRuns)
 			authorized.GET("/works/:id/runs/:runId", workHandler.GetRun)
 
 			// 文档
 			docHandler := handler.NewDocumentHandler(db)
+			docHandler.Start(ctx)
+			defer docHandler.Stop()
 			authorized.GET("/documents", docHandler.List)
 			authorized.POST("/documents", docHandler.Upload)
 			authorized.POST("/documents/search", docHandler.Search)
+			authorized.GET("/documents/tags", docHandler.ListTags)
+			authorized.POST("/documents/import-url", docHandler.ImportURL)
+			authorized.POST("/documents/rechunk", docHandler.Rechunk)
+			authorized.POST("/documents/uploads", docHandler.InitUpload)
+			authorized.GET("/documents/uploads/:id", docHandler.GetUpload)
+			authorized.PUT("/documents/uploads/:id/parts/:number", docHandler.UploadPart)
+			authorized.POST("/documents/uploads/:id/complete", docHandler.CompleteUpload)
+			authorized.DELETE("/documents/uploads/:id", docHandler.AbortUpload)
 			authorized.GET("/documents/:id", docHandler.Get)
 			authorized.GET("/documents/:id/status", docHandler.GetStatus)
+			authorized.POST("/documents/:id/reprocess", docHandler.Reprocess)
+			authorized.GET("/documents/:id/versions", docHandler.ListVersions)
+			authorized.GET("/documents/:id/versions/diff", docHandler.DiffVersions)
+			authorized.POST("/documents/:id/versions/:version/restore", docHandler.RestoreVersion)
 			authorized.GET("/documents/:id/preview", docHandler.Preview)
+			authorized.GET("/documents/:id/chunks", docHandler.Chunks)
 			authorized.GET("/documents/:id/download", docHandler.Download)
 			authorized.PUT("/documents/:id", docHandler.Update)
 			authorized.DELETE("/documents/:id", docHandler.Delete)
@@ -211,6 +271,11 @@ func main() {
 			// 文件夹
 			authorized.GET("/folders", docHandler.ListFolders)
 			authorized.POST("/folders", docHandler.CreateFolder)
+			authorized.GET("/folders/tree", docHandler.FolderTree)
+			authorized.GET("/folders/trash", docHandler.ListTrash)
+			authorized.GET("/folders/:id/path", docHandler.FolderPath)
+			authorized.PUT("/folders/:id", docHandler.UpdateFolder)
+			authorized.POST("/folders/:id/restore", docHandler.RestoreFolder)
 			authorized.DELETE("/folders/:id", docHandler.DeleteFolder)
 
 			// 对话
@@ -229,10 +294,14 @@ func main() {
 			authorized.POST("/chat-sessions/search", chatHandler.WorkspaceAuth(), chatHandler.SearchSessions)
 			authorized.PUT("/chat/:id/messages/:msgId", chatHandler.WorkspaceAuth(), chatHandler.UpdateMessage)
 			authorized.POST("/chat/:id/messages/:msgId/regenerate", chatHandler.WorkspaceAuth(), chatHandler.RegenerateMessage)
+			authorized.GET("/chat/:id/messages/:msgId/siblings", chatHandler.WorkspaceAuth(), chatHandler.ListMessageSiblings)
+			authorized.POST("/chat/:id/messages/:msgId/activate", chatHandler.WorkspaceAuth(), chatHandler.ActivateBranch)
 			authorized.POST("/chat/messages/:msgId/rate", chatHandler.WorkspaceAuth(), chatHandler.RateMessage)
+			authorized.GET("/chat/messages/:msgId/citations", chatHandler.WorkspaceAuth(), chatHandler.GetCitations)
 			authorized.POST("/chat/:id/complete", chatHandler.WorkspaceAuth(), chatHandler.Chat)
 			authorized.POST("/chat/:id/stream", chatHandler.WorkspaceAuth(), chatHandler.ChatStream)
 			authorized.POST("/chat/:id/stream-with-thinking", chatHandler.WorkspaceAuth(), chatHandler.ChatStreamWithThinking)
+			authorized.POST("/chat/:id/cancel", chatHandler.WorkspaceAuth(), chatHandler.CancelGeneration)
 
 			// 测试
 			testHandler := handler.NewTestHandler(db)
@@ -284,6 +353,7 @@ func main() {
 			authorized.GET("/analytics/cost/by-user", analyticsHandler.GetCostByUser)
 			authorized.GET("/analytics/cost/trend", analyticsHandler.GetCostTrend)
 			authorized.GET("/analytics/cost/prediction", analyticsHandler.GetCostPrediction)
+			authorized.GET("/analytics/pricing", analyticsHandler.GetPricingCatalog)
 			authorized.GET("/analytics/report", analyticsHandler.GenerateReport)
 			authorized.GET("/analytics/report/export", analyticsHandler.ExportReport)
 		}
@@ -294,9 +364,20 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
 	}
 }
 
@@ -3,7 +3,9 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,19 +14,31 @@ import (
 
 	"rolecraft-ai/internal/config"
 	"rolecraft-ai/internal/models"
+	documentSvc "rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/pricing"
 )
 
 // AnalyticsHandler 数据分析处理器
 type AnalyticsHandler struct {
-	db     *gorm.DB
-	config *config.Config
+	db      *gorm.DB
+	config  *config.Config
+	pricing *pricing.Catalog
 }
 
 // NewAnalyticsHandler 创建数据分析处理器
+// 价格目录文件（PRICING_CATALOG）无法读取或解析时终止启动，避免按错误的价格统计成本。
 func NewAnalyticsHandler(db *gorm.DB, cfg *config.Config) *AnalyticsHandler {
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	catalog, err := pricing.LoadCatalog(cfg.PricingCatalog)
+	if err != nil {
+		log.Fatalf("failed to load pricing catalog: %v", err)
+	}
 	return &AnalyticsHandler{
-		db:     db,
-		config: cfg,
+		db:      db,
+		config:  cfg,
+		pricing: catalog,
 	}
 }
 
@@ -97,9 +111,20 @@ type SensitiveWordStats struct {
 // CostStats 成本统计
 type CostStats struct {
 	TotalTokens       int64          `json:"totalTokens"`
-	TotalCost         float64        `json:"totalCost"` // 总成本 (元)
+	TotalCost         float64        `json:"totalCost"` // 总成本（价格目录币种，默认元）
+	Currency          string         `json:"currency"`
 	AverageCostPerDay float64        `json:"averageCostPerDay"`
 	TokenBreakdown    TokenBreakdown `json:"tokenBreakdown"`
+	ByModel           []CostByModel  `json:"byModel"`
+}
+
+// CostByModel 按模型分类成本
+type CostByModel struct {
+	ModelID         string  `json:"modelId"`
+	InputTokens     int64   `json:"inputTokens"`
+	OutputTokens    int64   `json:"outputTokens"`
+	EmbeddingTokens int64   `json:"embeddingTokens"`
+	Cost            float64 `json:"cost"`
 }
 
 // TokenBreakdown Token 使用明细
@@ -234,12 +259,6 @@ func (h *AnalyticsHandler) GetDashboardMetrics(c *gin.Context) {
 	var totalDocuments int64
 	h.db.Model(&models.Document{}).Count(&totalDocuments)
 
-	// 计算总成本和 Token 使用
-	var totalTokens int64
-	h.db.Model(&models.Message{}).Select("COALESCE(SUM(tokens_used), 0)").Scan(&totalTokens)
-
-	totalCost := float64(totalTokens) * 0.00002 // 假设每 Token 0.00002 元
-
 	// 平均评分
 	var avgRating float64
 	// 假设有 rating 字段，实际需要根据具体实现调整
@@ -248,8 +267,9 @@ func (h *AnalyticsHandler) GetDashboardMetrics(c *gin.Context) {
 	// 用户活跃度
 	userActivity := h.calculateUserActivity()
 
-	// 成本统计
+	// 成本统计（按模型价格计算）
 	costStats := h.calculateCostStats()
+	totalCost := costStats.TotalCost
 
 	// 质量统计
 	qualityStats := h.calculateQualityStats()
@@ -560,38 +580,35 @@ func (h *AnalyticsHandler) GetCostByRole(c *gin.Context) {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/v1/analytics/cost/by-user [get]
 func (h *AnalyticsHandler) GetCostByUser(c *gin.Context) {
-	// 按用户统计 Token 使用
-	type UserCost struct {
-		UserID     string
-		UserName   string
-		TokensUsed int64
-	}
-
-	var userCosts []UserCost
-	h.db.Table("messages AS m").
-		Select("cs.user_id as user_id, u.name as user_name, COALESCE(SUM(m.tokens_used), 0) as tokens_used").
-		Joins("JOIN chat_sessions cs ON m.session_id = cs.id").
-		Joins("JOIN users u ON cs.user_id = u.id").
-		Group("cs.user_id, u.name").
-		Order("tokens_used DESC").
-		Limit(10).
-		Scan(&userCosts)
+	// 按用户统计对话与工作区运行的 Token 使用
+	usage := h.summarizeUsage(h.collectUsage(usageGroupUser, nil, nil))
+	totals := usage.total()
 
-	var totalTokens int64
-	h.db.Model(&models.Message{}).Select("COALESCE(SUM(tokens_used), 0)").Scan(&totalTokens)
+	userIDs := make([]string, 0, len(usage))
+	for userID := range usage {
+		userIDs = append(userIDs, userID)
+	}
+	names := map[string]string{}
+	if len(userIDs) > 0 {
+		var users []models.User
+		h.db.Select("id, name").Where("id IN ?", userIDs).Find(&users)
+		for _, user := range users {
+			names[user.ID] = user.Name
+		}
+	}
 
 	costByUser := []CostByUser{}
-	for _, uc := range userCosts {
-		cost := float64(uc.TokensUsed) * 0.00002
+	for _, userID := range usage.keysByTokens(10) {
+		summary := usage[userID]
 		percent := 0.0
-		if totalTokens > 0 {
-			percent = float64(uc.TokensUsed) / float64(totalTokens) * 100
+		if totals.tokens() > 0 {
+			percent = float64(summary.tokens()) / float64(totals.tokens()) * 100
 		}
 		costByUser = append(costByUser, CostByUser{
-			UserID:     uc.UserID,
-			UserName:   uc.UserName,
-			TokensUsed: uc.TokensUsed,
-			Cost:       cost,
+			UserID:     userID,
+			UserName:   names[userID],
+			TokensUsed: summary.tokens(),
+			Cost:       summary.Cost,
 			Percent:    percent,
 		})
 	}
@@ -653,6 +670,7 @@ func (h *AnalyticsHandler) GetCostPrediction(c *gin.Context) {
 
 	avgDailyCost := totalCost / 30
 	avgDailyTokens := totalTokens / 30
+	growthRate, confidence := estimateCostGrowth(recentTrend)
 
 	var predictedDays int
 	var predictionPeriod string
@@ -664,15 +682,15 @@ func (h *AnalyticsHandler) GetCostPrediction(c *gin.Context) {
 		predictionPeriod = "month"
 	}
 
-	predictedCost := avgDailyCost * float64(predictedDays) * 1.1 // 假设 10% 增长
-	predictedTokens := int64(float64(avgDailyTokens) * float64(predictedDays) * 1.1)
+	predictedCost := avgDailyCost * float64(predictedDays) * (1 + growthRate)
+	predictedTokens := int64(float64(avgDailyTokens) * float64(predictedDays) * (1 + growthRate))
 
 	prediction := CostPrediction{
 		PredictedCost:    predictedCost,
 		PredictedTokens:  predictedTokens,
 		PredictionPeriod: predictionPeriod,
-		ConfidenceLevel:  0.85,
-		GrowthRate:       0.10,
+		ConfidenceLevel:  confidence,
+		GrowthRate:       growthRate,
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -804,15 +822,8 @@ func (h *AnalyticsHandler) calculateUserActivity() *UserActivityStats {
 
 // calculateCostStats 计算成本统计
 func (h *AnalyticsHandler) calculateCostStats() *CostStats {
-	var totalTokens int64
-	h.db.Model(&models.Message{}).Select("COALESCE(SUM(tokens_used), 0)").Scan(&totalTokens)
-
-	// 按类型统计 Token
-	var inputTokens, outputTokens, embeddingTokens int64
-	// 简化处理，假设所有消息都是输出
-	outputTokens = totalTokens
-
-	totalCost := float64(totalTokens) * 0.00002
+	rows := h.collectUsage(usageGroupNone, nil, nil)
+	totals := h.summarizeUsage(rows).total()
 
 	// 平均每日成本
 	var avgCostPerDay float64
@@ -820,19 +831,21 @@ func (h *AnalyticsHandler) calculateCostStats() *CostStats {
 	if h.db.Order("created_at ASC").First(&earliestMessage).Error == nil {
 		days := int(time.Since(earliestMessage.CreatedAt).Hours() / 24)
 		if days > 0 {
-			avgCostPerDay = totalCost / float64(days)
+			avgCostPerDay = totals.Cost / float64(days)
 		}
 	}
 
 	return &CostStats{
-		TotalTokens:       totalTokens,
-		TotalCost:         totalCost,
+		TotalTokens:       totals.tokens(),
+		TotalCost:         totals.Cost,
+		Currency:          h.pricing.Currency,
 		AverageCostPerDay: avgCostPerDay,
 		TokenBreakdown: TokenBreakdown{
-			InputTokens:     inputTokens,
-			OutputTokens:    outputTokens,
-			EmbeddingTokens: embeddingTokens,
+			InputTokens:     totals.InputTokens,
+			OutputTokens:    totals.OutputTokens,
+			EmbeddingTokens: totals.EmbeddingTokens,
 		},
+		ByModel: h.costByModel(rows),
 	}
 }
 
@@ -851,37 +864,38 @@ func (h *AnalyticsHandler) calculateQualityStats() *ConversationQualityStats {
 
 // getTopRolesByUsage 获取使用最多的角色
 func (h *AnalyticsHandler) getTopRolesByUsage(limit int) []CostByRole {
-	type RoleUsage struct {
-		RoleID     string
-		RoleName   string
-		TokensUsed int64
-	}
-
-	var roleUsages []RoleUsage
-	h.db.Model(&models.Message{}).
-		Select("cs.role_id as role_id, r.name as role_name, COALESCE(SUM(m.tokens_used), 0) as tokens_used").
-		Joins("JOIN chat_sessions cs ON m.session_id = cs.id").
-		Joins("JOIN roles r ON cs.role_id = r.id").
-		Group("cs.role_id, r.name").
-		Order("tokens_used DESC").
-		Limit(limit).
-		Scan(&roleUsages)
+	usage := h.summarizeUsage(h.collectUsage(usageGroupRole, nil, nil))
+	totals := usage.total()
 
-	var totalTokens int64
-	h.db.Model(&models.Message{}).Select("COALESCE(SUM(tokens_used), 0)").Scan(&totalTokens)
+	roleIDs := make([]string, 0, len(usage))
+	for roleID := range usage {
+		roleIDs = append(roleIDs, roleID)
+	}
+	names := map[string]string{}
+	if len(roleIDs) > 0 {
+		var roles []models.Role
+		h.db.Select("id, name").Where("id IN ?", roleIDs).Find(&roles)
+		for _, role := range roles {
+			names[role.ID] = role.Name
+		}
+	}
 
 	costByRole := []CostByRole{}
-	for _, ru := range roleUsages {
-		cost := float64(ru.TokensUsed) * 0.00002
+	for _, roleID := range usage.keysByTokens(limit) {
+		name, ok := names[roleID]
+		if !ok {
+			continue
+		}
+		summary := usage[roleID]
 		percent := 0.0
-		if totalTokens > 0 {
-			percent = float64(ru.TokensUsed) / float64(totalTokens) * 100
+		if totals.tokens() > 0 {
+			percent = float64(summary.tokens()) / float64(totals.tokens()) * 100
 		}
 		costByRole = append(costByRole, CostByRole{
-			RoleID:     ru.RoleID,
-			RoleName:   ru.RoleName,
-			TokensUsed: ru.TokensUsed,
-			Cost:       cost,
+			RoleID:     roleID,
+			RoleName:   name,
+			TokensUsed: summary.tokens(),
+			Cost:       summary.Cost,
 			Percent:    percent,
 		})
 	}
@@ -889,28 +903,27 @@ func (h *AnalyticsHandler) getTopRolesByUsage(limit int) []CostByRole {
 	return costByRole
 }
 
-// getCostTrend 获取成本趋势
+// getCostTrend 获取成本趋势：一次查询窗口内按天分组的用量，没有用量的日期记为 0
 func (h *AnalyticsHandler) getCostTrend(days int) []CostTrend {
 	trend := []CostTrend{}
+	if days <= 0 {
+		return trend
+	}
 	now := time.Now()
-
-	for i := days - 1; i >= 0; i-- {
-		dayStart := now.AddDate(0, 0, -i)
-		dayStart = time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), 0, 0, 0, 0, dayStart.Location())
-		dayEnd := dayStart.AddDate(0, 0, 1)
-
-		var tokens int64
-		h.db.Model(&models.Message{}).
-			Where("created_at >= ? AND created_at < ?", dayStart, dayEnd).
-			Select("COALESCE(SUM(tokens_used), 0)").
-			Scan(&tokens)
-
-		cost := float64(tokens) * 0.00002
-
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -(days - 1))
+	end := start.AddDate(0, 0, days)
+	daily := h.summarizeUsage(h.collectUsage(usageGroupDay, &start, &end))
+
+	for i := 0; i < days; i++ {
+		date := start.AddDate(0, 0, i).Format("2006-01-02")
+		var totals costSummary
+		if summary, ok := daily[date]; ok {
+			totals = *summary
+		}
 		trend = append(trend, CostTrend{
-			Date:   dayStart.Format("2006-01-02"),
-			Cost:   cost,
-			Tokens: tokens,
+			Date:   date,
+			Cost:   totals.Cost,
+			Tokens: totals.tokens(),
 		})
 	}
 
@@ -1083,3 +1096,275 @@ func formatMetricValue(value float64, unit string) string {
 		return fmt.Sprintf("%.1f", value)
 	}
 }
+
+// ===== 成本计算 =====
+
+const (
+	usageGroupNone = ""
+	usageGroupRole = "role"
+	usageGroupUser = "user"
+	usageGroupDay  = "day" // 按本地日期（YYYY-MM-DD）分组
+)
+
+// tokenUsage 按分组、模型与公司聚合的 Token 用量
+type tokenUsage struct {
+	GroupKey         string
+	ModelID          string
+	CompanyID        string
+	PromptTokens     int64
+	CompletionTokens int64
+	TokensUsed       int64
+	EmbeddingTokens  int64
+}
+
+// split 返回输入 / 输出 Token；早期数据仅记录总量时计为输出
+func (u tokenUsage) split() (int64, int64) {
+	if u.PromptTokens+u.CompletionTokens == 0 {
+		return 0, u.TokensUsed
+	}
+	return u.PromptTokens, u.CompletionTokens
+}
+
+// costSummary 成本汇总
+type costSummary struct {
+	InputTokens     int64
+	OutputTokens    int64
+	EmbeddingTokens int64
+	Cost            float64
+}
+
+func (s costSummary) tokens() int64 {
+	return s.InputTokens + s.OutputTokens + s.EmbeddingTokens
+}
+
+// usageSummaries 按分组键汇总的成本
+type usageSummaries map[string]*costSummary
+
+func (u usageSummaries) total() costSummary {
+	var total costSummary
+	for _, summary := range u {
+		total.InputTokens += summary.InputTokens
+		total.OutputTokens += summary.OutputTokens
+		total.EmbeddingTokens += summary.EmbeddingTokens
+		total.Cost += summary.Cost
+	}
+	return total
+}
+
+// keysByTokens 按 Token 用量降序返回分组键，limit <= 0 表示不限制
+func (u usageSummaries) keysByTokens(limit int) []string {
+	keys := make([]string, 0, len(u))
+	for key := range u {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ti, tj := u[keys[i]].tokens(), u[keys[j]].tokens()
+		if ti != tj {
+			return ti > tj
+		}
+		return keys[i] < keys[j]
+	})
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+// collectUsage 聚合对话消息（按角色所属公司计价）、工作区运行与向量化的 Token 用量。
+// 按角色分组时仅统计对话消息；since / until 为空表示不限时间。
+func (h *AnalyticsHandler) collectUsage(groupBy string, since, until *time.Time) []tokenUsage {
+	groupExpr := "''"
+	switch groupBy {
+	case usageGroupRole:
+		groupExpr = "cs.role_id"
+	case usageGroupUser:
+		groupExpr = "cs.user_id"
+	case usageGroupDay:
+		groupExpr = "date(m.created_at, 'localtime')"
+	}
+
+	var rows []tokenUsage
+	query := h.db.Table("messages AS m").
+		Select(groupExpr+" AS group_key, COALESCE(m.model_id, '') AS model_id, COALESCE(r.company_id, '') AS company_id, "+
+			"COALESCE(SUM(m.prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(m.completion_tokens), 0) AS completion_tokens, "+
+			"COALESCE(SUM(m.tokens_used), 0) AS tokens_used").
+		Joins("LEFT JOIN chat_sessions cs ON m.session_id = cs.id").
+		Joins("LEFT JOIN roles r ON cs.role_id = r.id").
+		Where("m.tokens_used > 0 OR m.prompt_tokens > 0 OR m.completion_tokens > 0")
+	if since != nil {
+		query = query.Where("m.created_at >= ?", *since)
+	}
+	if until != nil {
+		query = query.Where("m.created_at < ?", *until)
+	}
+	query.Group("group_key, m.model_id, r.company_id").Scan(&rows)
+
+	if groupBy == usageGroupRole {
+		return rows
+	}
+
+	// 工作区运行与向量化记录都带有 user_id / created_at，按同样的方式分组
+	runGroupExpr := "''"
+	switch groupBy {
+	case usageGroupUser:
+		runGroupExpr = "user_id"
+	case usageGroupDay:
+		runGroupExpr = "date(created_at, 'localtime')"
+	}
+	if h.db.Migrator().HasTable(&models.AgentRun{}) {
+		var runRows []tokenUsage
+		runQuery := h.db.Table("agent_runs").
+			Select(runGroupExpr+" AS group_key, COALESCE(model_id, '') AS model_id, COALESCE(company_id, '') AS company_id, "+
+				"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, "+
+				"COALESCE(SUM(tokens_used), 0) AS tokens_used").
+			Where("tokens_used > 0")
+		if since != nil {
+			runQuery = runQuery.Where("created_at >= ?", *since)
+		}
+		if until != nil {
+			runQuery = runQuery.Where("created_at < ?", *until)
+		}
+		runQuery.Group("group_key, model_id, company_id").Scan(&runRows)
+		rows = append(rows, runRows...)
+	}
+	if h.db.Migrator().HasTable(&models.EmbeddingUsage{}) {
+		var embedRows []tokenUsage
+		embedQuery := h.db.Table("embedding_usages").
+			Select(runGroupExpr+" AS group_key, COALESCE(model_id, '') AS model_id, COALESCE(company_id, '') AS company_id, "+
+				"COALESCE(SUM(tokens), 0) AS embedding_tokens").
+			Where("tokens > 0")
+		if since != nil {
+			embedQuery = embedQuery.Where("created_at >= ?", *since)
+		}
+		if until != nil {
+			embedQuery = embedQuery.Where("created_at < ?", *until)
+		}
+		embedQuery.Group("group_key, model_id, company_id").Scan(&embedRows)
+		rows = append(rows, embedRows...)
+	}
+	return rows
+}
+
+// summarizeUsage 按价格目录计算每个分组的成本
+func (h *AnalyticsHandler) summarizeUsage(rows []tokenUsage) usageSummaries {
+	summaries := usageSummaries{}
+	for _, row := range rows {
+		summary, ok := summaries[row.GroupKey]
+		if !ok {
+			summary = &costSummary{}
+			summaries[row.GroupKey] = summary
+		}
+		input, output := row.split()
+		summary.InputTokens += input
+		summary.OutputTokens += output
+		summary.EmbeddingTokens += row.EmbeddingTokens
+		summary.Cost += h.pricing.Lookup(row.CompanyID, row.ModelID).Cost(input, output, row.EmbeddingTokens)
+	}
+	return summaries
+}
+
+// costByModel 按模型汇总成本，按成本降序
+func (h *AnalyticsHandler) costByModel(rows []tokenUsage) []CostByModel {
+	byModel := map[string]*CostByModel{}
+	for _, row := range rows {
+		modelID := row.ModelID
+		if modelID == "" {
+			modelID = "unknown"
+		}
+		item, ok := byModel[modelID]
+		if !ok {
+			item = &CostByModel{ModelID: modelID}
+			byModel[modelID] = item
+		}
+		input, output := row.split()
+		item.InputTokens += input
+		item.OutputTokens += output
+		item.EmbeddingTokens += row.EmbeddingTokens
+		item.Cost += h.pricing.Lookup(row.CompanyID, row.ModelID).Cost(input, output, row.EmbeddingTokens)
+	}
+
+	result := make([]CostByModel, 0, len(byModel))
+	for _, item := range byModel {
+		result = append(result, *item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cost != result[j].Cost {
+			return result[i].Cost > result[j].Cost
+		}
+		return result[i].ModelID < result[j].ModelID
+	})
+	return result
+}
+
+// estimateCostGrowth 比较前后半段的日均成本估算增长率，并按有数据的天数给出置信度
+func estimateCostGrowth(trend []CostTrend) (float64, float64) {
+	if len(trend) < 2 {
+		return 0, 0.3
+	}
+	half := len(trend) / 2
+	var earlier, later float64
+	activeDays := 0
+	for i, point := range trend {
+		if point.Tokens > 0 {
+			activeDays++
+		}
+		if i < half {
+			earlier += point.Cost
+		} else {
+			later += point.Cost
+		}
+	}
+	earlier /= float64(half)
+	later /= float64(len(trend) - half)
+
+	growth := 0.0
+	if earlier > 0 {
+		growth = (later - earlier) / earlier
+	}
+	if growth > 1 {
+		growth = 1
+	}
+	if growth < -0.5 {
+		growth = -0.5
+	}
+
+	confidence := 0.3 + 0.65*float64(activeDays)/float64(len(trend))
+	return growth, confidence
+}
+
+// GetPricingCatalog 获取模型价格目录
+// @Summary 获取模型价格目录
+// @Description 返回每个模型的输入 / 输出 / 向量化价格（每百万 Token），公司成员可按公司查看覆盖后的价格
+// @Tags 数据分析
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param companyId query string false "公司 ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/analytics/pricing [get]
+func (h *AnalyticsHandler) GetPricingCatalog(c *gin.Context) {
+	companyID := strings.TrimSpace(c.Query("companyId"))
+	if companyID != "" {
+		userId, _ := c.Get("userId")
+		userIdStr, _ := userId.(string)
+		if userIdStr == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		if !documentSvc.IsCompanyMember(h.db, userIdStr, companyID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no access to this company"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"currency":      h.pricing.Currency,
+			"tokensPerUnit": pricing.TokensPerUnit,
+			"default":       h.pricing.Default,
+			"models":        h.pricing.ForCompany(companyID),
+		},
+	})
+}
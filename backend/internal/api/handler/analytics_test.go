@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -28,6 +31,8 @@ func setupAnalyticsTestDB(t *testing.T) *gorm.DB {
 		&models.ChatSession{},
 		&models.Message{},
 		&models.Document{},
+		&models.EmbeddingUsage{},
+		&models.Company{},
 	); err != nil {
 		t.Fatalf("failed to migrate test db: %v", err)
 	}
@@ -137,3 +142,172 @@ func TestGetCostByUser(t *testing.T) {
 	assert.True(t, ok)
 	assert.NotEmpty(t, items)
 }
+
+func TestGetCostStatsUsesPricingCatalog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupAnalyticsTestDB(t)
+	analyticsHandler := handler.NewAnalyticsHandler(db, &config.Config{})
+
+	session := models.ChatSession{ID: "session-1", UserID: "user-1", Title: "pricing"}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatalf("failed to seed session: %v", err)
+	}
+	messages := []models.Message{
+		{ID: "msg-1", SessionID: session.ID, Role: "assistant", Content: "a", ModelID: "openai/gpt-4o", PromptTokens: 1000000, CompletionTokens: 500000, TokensUsed: 1500000},
+		{ID: "msg-2", SessionID: session.ID, Role: "assistant", Content: "b", ModelID: "mock-v1", PromptTokens: 200, CompletionTokens: 100, TokensUsed: 300},
+		{ID: "msg-3", SessionID: session.ID, Role: "assistant", Content: "c", TokensUsed: 1000000},
+	}
+	if err := db.Create(&messages).Error; err != nil {
+		t.Fatalf("failed to seed messages: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/analytics/cost", nil)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = req
+
+	analyticsHandler.GetCostStats(ctx)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var payload struct {
+		Data handler.CostStats `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &payload))
+
+	stats := payload.Data
+	assert.Equal(t, "CNY", stats.Currency)
+	assert.Equal(t, int64(2500300), stats.TotalTokens)
+	assert.Equal(t, int64(1000200), stats.TokenBreakdown.InputTokens)
+	assert.Equal(t, int64(1500100), stats.TokenBreakdown.OutputTokens)
+	// gpt-4o: 1M*18 + 0.5M*72 = 54；未记录模型与拆分的旧数据按默认输出价 14.4；mock 免费
+	assert.InDelta(t, 68.4, stats.TotalCost, 1e-6)
+	if assert.Len(t, stats.ByModel, 3) {
+		assert.Equal(t, "openai/gpt-4o", stats.ByModel[0].ModelID)
+		assert.InDelta(t, 54, stats.ByModel[0].Cost, 1e-6)
+	}
+}
+
+func TestGetCostTrendBucketsByDay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupAnalyticsTestDB(t)
+	analyticsHandler := handler.NewAnalyticsHandler(db, &config.Config{})
+
+	session := models.ChatSession{ID: "session-1", UserID: "user-1", Title: "trend"}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatalf("failed to seed session: %v", err)
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, now.Location())
+	messages := []models.Message{
+		{ID: "msg-1", SessionID: session.ID, Role: "assistant", Content: "a", TokensUsed: 100, CreatedAt: today},
+		{ID: "msg-2", SessionID: session.ID, Role: "assistant", Content: "b", TokensUsed: 50, CreatedAt: today},
+		{ID: "msg-3", SessionID: session.ID, Role: "assistant", Content: "c", TokensUsed: 30, CreatedAt: today.AddDate(0, 0, -2)},
+		{ID: "msg-4", SessionID: session.ID, Role: "assistant", Content: "d", TokensUsed: 999, CreatedAt: today.AddDate(0, 0, -10)},
+	}
+	if err := db.Create(&messages).Error; err != nil {
+		t.Fatalf("failed to seed messages: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/analytics/cost/trend?days=3", nil)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = req
+
+	analyticsHandler.GetCostTrend(ctx)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var payload struct {
+		Data []handler.CostTrend `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &payload))
+	if assert.Len(t, payload.Data, 3) {
+		assert.Equal(t, today.AddDate(0, 0, -2).Format("2006-01-02"), payload.Data[0].Date)
+		assert.Equal(t, int64(30), payload.Data[0].Tokens)
+		assert.Equal(t, int64(0), payload.Data[1].Tokens)
+		assert.Equal(t, today.Format("2006-01-02"), payload.Data[2].Date)
+		assert.Equal(t, int64(150), payload.Data[2].Tokens)
+		assert.Greater(t, payload.Data[2].Cost, 0.0)
+	}
+}
+
+func TestGetCostStatsIncludesEmbeddingUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupAnalyticsTestDB(t)
+	analyticsHandler := handler.NewAnalyticsHandler(db, &config.Config{})
+
+	usages := []models.EmbeddingUsage{
+		{ID: "e1", UserID: "user-1", DocumentID: "doc-1", Purpose: "document", ModelID: "text-embedding-3-large", Tokens: 1000000},
+		{ID: "e2", UserID: "user-1", Purpose: "query", ModelID: "text-embedding-3-large", Tokens: 1000000},
+	}
+	if err := db.Create(&usages).Error; err != nil {
+		t.Fatalf("failed to seed embedding usage: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/analytics/cost", nil)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = req
+
+	analyticsHandler.GetCostStats(ctx)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var payload struct {
+		Data handler.CostStats `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &payload))
+	stats := payload.Data
+	assert.Equal(t, int64(2000000), stats.TokenBreakdown.EmbeddingTokens)
+	assert.Equal(t, int64(2000000), stats.TotalTokens)
+	// text-embedding-3-large: 2M * 0.936
+	assert.InDelta(t, 1.872, stats.TotalCost, 1e-6)
+	if assert.Len(t, stats.ByModel, 1) {
+		assert.Equal(t, int64(2000000), stats.ByModel[0].EmbeddingTokens)
+	}
+}
+
+func TestGetPricingCatalogRequiresMembership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupAnalyticsTestDB(t)
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(path, []byte(`{"companies": {"acme": [{"model": "gpt-4o", "input": 1, "output": 4}]}}`), 0o600); err != nil {
+		t.Fatalf("failed to write catalog: %v", err)
+	}
+	analyticsHandler := handler.NewAnalyticsHandler(db, &config.Config{PricingCatalog: path})
+	if err := db.Create(&models.Company{ID: "acme", OwnerID: "owner", Name: "Acme"}).Error; err != nil {
+		t.Fatalf("failed to seed company: %v", err)
+	}
+
+	get := func(userID string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/pricing?companyId=acme", nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", userID)
+		analyticsHandler.GetPricingCatalog(ctx)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, get("stranger").Code)
+
+	w := get("owner")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var payload struct {
+		Data struct {
+			Models []struct {
+				Model string  `json:"model"`
+				Input float64 `json:"input"`
+			} `json:"models"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &payload))
+	found := false
+	for _, price := range payload.Data.Models {
+		if price.Model == "gpt-4o" {
+			found = true
+			assert.Equal(t, 1.0, price.Input)
+		}
+	}
+	assert.True(t, found)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -13,7 +14,13 @@ import (
 
 	"rolecraft-ai/internal/config"
 	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/ai"
 	"rolecraft-ai/internal/service/anythingllm"
+	"rolecraft-ai/internal/service/conversation"
+	documentSvc "rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/retrieval"
+	"rolecraft-ai/internal/service/search"
+	"rolecraft-ai/internal/service/storage"
 	"rolecraft-ai/internal/service/thinking"
 )
 
@@ -23,6 +30,13 @@ type ChatHandler struct {
 	config      *config.Config
 	thinkingSvc *thinking.Service
 	anything    *anythingllm.Orchestrator
+	mockAI      *ai.MockAIClient
+	history     *conversation.HistoryBuilder
+	generations *conversation.Generations
+	search      *search.Index
+	summarizer  *conversation.Summarizer
+	retrieval   *retrieval.Service
+	blobs       storage.BlobStore
 }
 
 // NewChatHandler 创建对话处理器
@@ -30,6 +44,7 @@ func NewChatHandler(db *gorm.DB, cfg *config.Config) *ChatHandler {
 	if cfg == nil {
 		cfg = &config.Config{}
 	}
+	index := search.NewIndex(db)
 	return &ChatHandler{
 		db:          db,
 		config:      cfg,
@@ -39,9 +54,31 @@ func NewChatHandler(db *gorm.DB, cfg *config.Config) *ChatHandler {
 			DefaultModel:    cfg.OpenRouterModel,
 			OpenRouterKey:   cfg.OpenRouterKey,
 		}),
+		mockAI:      ai.NewMockAIClient(),
+		history:     conversation.NewHistoryBuilder(db, newSummaryProvider(cfg)),
+		generations: conversation.NewGenerations(),
+		search:      index,
+		summarizer:  conversation.NewSummarizer(db, newSummaryProvider(cfg)),
+		retrieval:   retrieval.NewService(db, index, retrieval.DenseConfig(db, cfg.OpenAIKey)),
+		blobs:       newBlobStore(),
 	}
 }
 
+// newSummaryProvider 选择用于历史摘要、会话标题与概要的模型（直连，避免写入 AnythingLLM 会话记录）
+func newSummaryProvider(cfg *config.Config) ai.ChatProvider {
+	if key := strings.TrimSpace(cfg.OpenRouterKey); key != "" {
+		return ai.NewOpenRouterClient(ai.OpenRouterConfig{
+			APIKey:  key,
+			BaseURL: strings.TrimSpace(cfg.OpenRouterURL),
+			Model:   anythingllm.NormalizeWorkspaceModel(cfg.OpenRouterModel),
+		})
+	}
+	if key := strings.TrimSpace(cfg.OpenAIKey); key != "" {
+		return ai.NewOpenAIClient(ai.OpenAIConfig{APIKey: key})
+	}
+	return nil
+}
+
 // CreateSessionRequest 创建会话请求
 type CreateSessionRequest struct {
 	RoleID          string                 `json:"roleId" binding:"required"`
@@ -80,11 +117,35 @@ const (
 	ChatModeAgent ChatMode = "agent"
 )
 
-type AnythingLLMResult struct {
+// ProviderResult 对话提供方返回结果
+type ProviderResult struct {
 	Content  string
 	Sources  []map[string]interface{}
 	Thoughts []string
-	Type     string
+	Provider string
+	Model    string
+	Usage    ai.Usage
+	Passages []documentSvc.Passage // 本轮提示词中带编号的知识库片段
+
+	Interrupted bool // 生成被取消或客户端断开，内容不完整
+}
+
+// chatPrompt 本轮发送给模型的消息及其中引用的知识库片段
+type chatPrompt struct {
+	Messages []ai.ChatMessage
+	Passages []documentSvc.Passage
+}
+
+// sourceList 助手消息的来源：回答中引用到的知识库片段在前，其后为提供方返回的来源
+func (r *ProviderResult) sourceList() []map[string]interface{} {
+	sources := []map[string]interface{}{}
+	if r == nil {
+		return sources
+	}
+	for _, passage := range documentSvc.CitedPassages(r.Content, r.Passages) {
+		sources = append(sources, passage.Source())
+	}
+	return append(sources, r.Sources...)
 }
 
 // ListSessions 获取对话会话列表
@@ -139,6 +200,10 @@ func (h *ChatHandler) CreateSession(c *gin.Context) {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	// 默认标题会在首轮问答后自动生成
+	if !conversation.IsPlaceholderTitle(title) {
+		session.TitleSource = conversation.TitleSourceUser
+	}
 
 	// 存储 AnythingLLM Slug
 	if req.AnythingLLMSlug != "" {
@@ -172,8 +237,12 @@ func (h *ChatHandler) GetSession(c *gin.Context) {
 		return
 	}
 
-	var messages []models.Message
-	h.db.Where("session_id = ?", sessionId).Order("created_at ASC").Find(&messages)
+	// 仅返回当前活动分支上的消息
+	messages, err := conversation.ActivePath(h.db, &session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -285,11 +354,8 @@ func (h *ChatHandler) resolveRuntimeProvider(session models.ChatSession) string
 }
 
 func (h *ChatHandler) resolveRuntimeModel(session models.ChatSession) string {
-	cfg := h.parseSessionModelConfig(session)
-	for _, key := range []string{"model", "modelId", "chatModel"} {
-		if value, ok := cfg[key].(string); ok && strings.TrimSpace(value) != "" {
-			return strings.TrimSpace(value)
-		}
+	if model := h.resolveSessionModel(session); model != "" {
+		return model
 	}
 	if strings.TrimSpace(h.config.OpenRouterModel) != "" {
 		return strings.TrimSpace(h.config.OpenRouterModel)
@@ -297,32 +363,210 @@ func (h *ChatHandler) resolveRuntimeModel(session models.ChatSession) string {
 	return ""
 }
 
-// callAnythingLLM 调用 AnythingLLM Chat API
-func (h *ChatHandler) callAnythingLLMWithMode(session models.ChatSession, slug, message string, mode ChatMode, sessionID string) (*AnythingLLMResult, error) {
-	if h.anything == nil || !h.anything.Enabled() {
-		return nil, fmt.Errorf("anythingllm is not configured")
+// resolveChatProvider 按会话配置选择对话提供方
+// 已配置 AnythingLLM 时默认经由 Workspace 调用（底层模型由 resolveRuntimeProvider 决定），
+// 否则直连 OpenRouter / OpenAI，均不可用时回退到 Mock。
+func (h *ChatHandler) resolveChatProvider(userID string, session *models.ChatSession, mode ChatMode) (ai.ChatProvider, error) {
+	runtimeProvider := h.resolveRuntimeProvider(*session)
+	anythingEnabled := h.anything != nil && h.anything.Enabled()
+
+	switch ai.NormalizeProviderName(runtimeProvider) {
+	case ai.ProviderMock:
+		return h.mockAI, nil
+	case ai.ProviderAnythingLLM:
+		if !anythingEnabled {
+			return nil, fmt.Errorf("anythingllm is not configured")
+		}
+		return h.newAnythingLLMProvider(userID, session, mode, "")
+	case ai.ProviderOpenAI:
+		if !anythingEnabled && strings.TrimSpace(h.config.OpenAIKey) != "" {
+			return h.newOpenAIProvider(*session), nil
+		}
 	}
-	modeValue := "chat"
-	if mode == ChatModeAgent {
-		modeValue = "agent"
+
+	if anythingEnabled {
+		return h.newAnythingLLMProvider(userID, session, mode, runtimeProvider)
 	}
-	result, err := h.anything.Chat(context.Background(), anythingllm.ChatPayload{
+	if strings.TrimSpace(h.config.OpenRouterKey) != "" {
+		return ai.NewOpenRouterClient(ai.OpenRouterConfig{
+			APIKey:  strings.TrimSpace(h.config.OpenRouterKey),
+			BaseURL: strings.TrimSpace(h.config.OpenRouterURL),
+			Model:   anythingllm.NormalizeWorkspaceModel(h.resolveRuntimeModel(*session)),
+		}), nil
+	}
+	if strings.TrimSpace(h.config.OpenAIKey) != "" {
+		return h.newOpenAIProvider(*session), nil
+	}
+	return h.mockAI, nil
+}
+
+func (h *ChatHandler) newAnythingLLMProvider(userID string, session *models.ChatSession, mode ChatMode, runtimeProvider string) (ai.ChatProvider, error) {
+	slug, err := h.ensureAnythingLLMWorkspace(userID, session)
+	if err != nil {
+		return nil, err
+	}
+	return ai.NewAnythingLLMProvider(h.anything, ai.AnythingLLMProviderConfig{
 		WorkspaceSlug: slug,
-		Message:       message,
-		Mode:          modeValue,
-		Model:         h.resolveRuntimeModel(session),
-		Provider:      h.resolveRuntimeProvider(session),
-		SessionID:     sessionID,
+		SessionID:     session.ID,
+		Mode:          string(mode),
+		Model:         h.resolveRuntimeModel(*session),
+		Provider:      runtimeProvider,
+	}), nil
+}
+
+func (h *ChatHandler) newOpenAIProvider(session models.ChatSession) ai.ChatProvider {
+	return ai.NewOpenAIClient(ai.OpenAIConfig{
+		APIKey: strings.TrimSpace(h.config.OpenAIKey),
+		Model:  h.resolveSessionModel(session),
 	})
+}
+
+// completeChat 调用对话提供方并整理结果
+func (h *ChatHandler) completeChat(ctx context.Context, provider ai.ChatProvider, session models.ChatSession, prompt chatPrompt) (*ProviderResult, error) {
+	resp, err := provider.ChatCompletion(ctx, prompt.Messages, h.resolveTemperature(session))
 	if err != nil {
 		return nil, err
 	}
-	return &AnythingLLMResult{
-		Content:  result.Content,
-		Sources:  result.Sources,
-		Thoughts: result.Thoughts,
-		Type:     result.Type,
-	}, nil
+	result := &ProviderResult{
+		Content:  ai.ResponseContent(resp),
+		Sources:  resp.Sources,
+		Thoughts: resp.Thoughts,
+		Provider: provider.Name(),
+		Model:    resp.Model,
+		Usage:    resp.Usage,
+		Passages: prompt.Passages,
+	}
+	h.fillUsage(result, session, prompt.Messages)
+	return result, nil
+}
+
+// fillUsage 提供方未返回用量或模型时按本地估算补齐
+func (h *ChatHandler) fillUsage(result *ProviderResult, session models.ChatSession, messages []ai.ChatMessage) {
+	if result.Usage.IsZero() {
+		result.Usage = ai.EstimateUsage(messages, result.Content)
+	}
+	if result.Usage.TotalTokens == 0 {
+		result.Usage.TotalTokens = result.Usage.PromptTokens + result.Usage.CompletionTokens
+	}
+	if result.Model == "" {
+		result.Model = anythingllm.NormalizeWorkspaceModel(h.resolveRuntimeModel(session))
+	}
+}
+
+// applyUsage 将用量、模型与提供方写入助手消息
+func applyUsage(msg *models.Message, result *ProviderResult) {
+	msg.PromptTokens = result.Usage.PromptTokens
+	msg.CompletionTokens = result.Usage.CompletionTokens
+	msg.TokensUsed = result.Usage.TotalTokens
+	msg.ModelID = result.Model
+	msg.Provider = result.Provider
+}
+
+// saveAssistantReply 将助手回复保存为 parentID 的子消息，并设为活动分支末端
+func (h *ChatHandler) saveAssistantReply(session *models.ChatSession, mode ChatMode, result *ProviderResult, parentID string) (models.Message, error) {
+	msg := models.Message{
+		ID:        models.NewUUID(),
+		Role:      "assistant",
+		Content:   result.Content,
+		Sources:   buildAssistantSources(mode, result),
+		CreatedAt: time.Now(),
+	}
+	applyUsage(&msg, result)
+	if result.Interrupted {
+		msg.Status = "interrupted"
+	}
+	if err := conversation.AppendMessage(h.db, session, &msg, parentID); err != nil {
+		return msg, err
+	}
+	h.db.Model(session).Update("updated_at", time.Now())
+	h.summarizer.Schedule(session.ID)
+	return msg, nil
+}
+
+// respondCancelled 非流式接口的生成被取消时返回 409；与流式接口一致，已生成的部分保存为 interrupted 回复，
+// 随 data.assistantMessage 返回（没有生成内容时不保存）
+func (h *ChatHandler) respondCancelled(c *gin.Context, session *models.ChatSession, mode ChatMode, result *ProviderResult, parentID string, data gin.H) {
+	if result != nil && result.Content != "" {
+		result.Interrupted = true
+		if msg, err := h.saveAssistantReply(session, mode, result, parentID); err == nil {
+			data["assistantMessage"] = msg
+		}
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error": "generation cancelled",
+		"data":  data,
+	})
+}
+
+// streamChat 以流式方式调用提供方，每收到增量文本即回调 onDelta。
+// 不支持流式的提供方退化为一次性输出；出错时仍返回已生成的部分内容。
+func (h *ChatHandler) streamChat(ctx context.Context, provider ai.ChatProvider, session models.ChatSession, prompt chatPrompt, onDelta func(string)) (*ProviderResult, error) {
+	streaming, ok := provider.(ai.StreamingChatProvider)
+	if !ok {
+		result, err := h.completeChat(ctx, provider, session, prompt)
+		if err != nil {
+			return nil, err
+		}
+		if result.Content != "" {
+			onDelta(result.Content)
+		}
+		return result, nil
+	}
+
+	chunks, errs := streaming.ChatCompletionStream(ctx, prompt.Messages, h.resolveTemperature(session))
+
+	result := &ProviderResult{Provider: provider.Name(), Passages: prompt.Passages}
+	var content strings.Builder
+	for chunk := range chunks {
+		if chunk == nil {
+			continue
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if len(chunk.Sources) > 0 {
+			result.Sources = chunk.Sources
+		}
+		if len(chunk.Thoughts) > 0 {
+			result.Thoughts = chunk.Thoughts
+		}
+		if chunk.Usage != nil {
+			result.Usage = *chunk.Usage
+		}
+		if delta := ai.ChunkContent(chunk); delta != "" {
+			content.WriteString(delta)
+			onDelta(delta)
+		}
+	}
+	result.Content = strings.TrimSpace(content.String())
+	h.fillUsage(result, session, prompt.Messages)
+
+	if err := <-errs; err != nil {
+		return result, err
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// resolveSessionModel 仅返回会话显式配置的模型
+func (h *ChatHandler) resolveSessionModel(session models.ChatSession) string {
+	cfg := h.parseSessionModelConfig(session)
+	for _, key := range []string{"model", "modelId", "chatModel"} {
+		if value, ok := cfg[key].(string); ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func (h *ChatHandler) resolveTemperature(session models.ChatSession) float64 {
+	cfg := h.parseSessionModelConfig(session)
+	if value, ok := cfg["temperature"].(float64); ok && value >= 0 && value <= 2 {
+		return value
+	}
+	return 0.7
 }
 
 func (h *ChatHandler) parseSessionModelConfig(session models.ChatSession) map[string]interface{} {
@@ -357,11 +601,8 @@ func (h *ChatHandler) resolveChatMode(session models.ChatSession) ChatMode {
 	return ChatModeChat
 }
 
-func buildAssistantSources(mode ChatMode, result *AnythingLLMResult) models.JSON {
-	sources := []map[string]interface{}{}
-	if result != nil && len(result.Sources) > 0 {
-		sources = result.Sources
-	}
+func buildAssistantSources(mode ChatMode, result *ProviderResult) models.JSON {
+	sources := result.sourceList()
 	thoughts := []string{}
 	if result != nil && len(result.Thoughts) > 0 {
 		thoughts = result.Thoughts
@@ -374,24 +615,86 @@ func buildAssistantSources(mode ChatMode, result *AnythingLLMResult) models.JSON
 	return models.ToJSON(payload)
 }
 
-func (h *ChatHandler) buildKnowledgeContext(userID string, session models.ChatSession) string {
+// doneMeta 流式结束事件附带的元信息
+func doneMeta(mode ChatMode, result *ProviderResult) map[string]interface{} {
+	meta := map[string]interface{}{"mode": string(mode)}
+	if result != nil {
+		meta["sources"] = result.sourceList()
+		meta["thoughts"] = result.Thoughts
+	}
+	return meta
+}
+
+// knowledgePassageLimit 每轮写入提示词的知识库片段数
+const knowledgePassageLimit = 6
+
+// knowledgeScopeRole 会话使用所选角色绑定的知识来源
+const knowledgeScopeRole = "role"
+
+// knowledgeFilters 解析会话的知识库范围，返回的 bool 表示是否检索：
+// none 不检索；folder:<id> 检索该文件夹及其子文件夹；role 或未设置时使用会话角色绑定的知识来源
+// （角色没有绑定时不检索）；其他值检索全部文档
+func (h *ChatHandler) knowledgeFilters(session models.ChatSession) (retrieval.Filters, bool) {
 	cfg := h.parseSessionModelConfig(session)
 	scope, _ := cfg["knowledgeScope"].(string)
-	if scope == "" || scope == "none" {
-		return ""
+	switch {
+	case scope == "none":
+		return retrieval.Filters{}, false
+	case scope == "" || scope == knowledgeScopeRole:
+		sources, err := retrieval.RoleScope(h.db, session.RoleID)
+		if err != nil || sources == nil {
+			return retrieval.Filters{}, false
+		}
+		return retrieval.Filters{Sources: sources}, true
+	case strings.HasPrefix(scope, "folder:"):
+		folderID := ""
+		if id := strings.TrimPrefix(scope, "folder:"); id != "" && id != "default" {
+			folderID = id
+		}
+		// 文件夹范围包含其子文件夹
+		return retrieval.Filters{FolderID: folderID, IncludeSubfolders: true}, true
+	default:
+		return retrieval.Filters{}, true
+	}
+}
+
+// buildKnowledgeContext 在会话的知识库范围内检索与问题相关的分块，编号后写入提示词；
+// 未检索到片段时退化为列出范围内的文档名称
+func (h *ChatHandler) buildKnowledgeContext(ctx context.Context, userID string, session models.ChatSession, question string) (string, []documentSvc.Passage) {
+	filters, ok := h.knowledgeFilters(session)
+	if !ok {
+		return "", nil
 	}
 
-	query := h.db.Model(&models.Document{}).Where("user_id = ? AND status = ?", userID, "completed")
-	if strings.HasPrefix(scope, "folder:") {
-		folderID := strings.TrimPrefix(scope, "folder:")
-		if folderID != "" && folderID != "default" {
-			query = query.Where("folder_id = ?", folderID)
+	result, err := h.retrieval.Search(ctx, retrieval.Request{
+		UserID:  userID,
+		Query:   question,
+		Filters: filters,
+		Limit:   knowledgePassageLimit,
+	})
+	if err == nil && len(result.Chunks) > 0 {
+		passages := make([]documentSvc.Passage, len(result.Chunks))
+		for i, hit := range result.Chunks {
+			passages[i] = hit.Passage(i + 1)
 		}
+		var b strings.Builder
+		b.WriteString("可参考知识库片段（引用片段内容时在句末标注对应编号，如 [1]；片段未涉及的内容不要标注）：\n")
+		for _, p := range passages {
+			b.WriteString(fmt.Sprintf("[%d] 《%s》", p.Marker, p.DocumentName))
+			if location := passageLocation(p); location != "" {
+				b.WriteString(" ")
+				b.WriteString(location)
+			}
+			b.WriteString("\n")
+			b.WriteString(p.Content)
+			b.WriteString("\n\n")
+		}
+		return b.String(), passages
 	}
 
-	var docs []models.Document
-	if err := query.Order("updated_at DESC").Limit(8).Find(&docs).Error; err != nil || len(docs) == 0 {
-		return ""
+	docs, err := h.retrieval.Documents(userID, filters, 8)
+	if err != nil || len(docs) == 0 {
+		return "", nil
 	}
 
 	var b strings.Builder
@@ -399,7 +702,22 @@ func (h *ChatHandler) buildKnowledgeContext(userID string, session models.ChatSe
 	for i, d := range docs {
 		b.WriteString(fmt.Sprintf("%d. %s (%s)\n", i+1, d.Name, d.FileType))
 	}
-	return b.String()
+	return b.String(), nil
+}
+
+// passageLocation 片段在文档中的位置说明：页码 / 工作表与标题路径
+func passageLocation(p documentSvc.Passage) string {
+	var parts []string
+	switch {
+	case p.Sheet != "":
+		parts = append(parts, "工作表 "+p.Sheet)
+	case p.Page > 0:
+		parts = append(parts, fmt.Sprintf("第 %d 页", p.Page))
+	}
+	if p.HeadingPath != "" && p.HeadingPath != p.Sheet {
+		parts = append(parts, p.HeadingPath)
+	}
+	return strings.Join(parts, "，")
 }
 
 func clipText(value string, limit int) string {
@@ -429,7 +747,7 @@ func (h *ChatHandler) buildAttachmentContext(userID string, attachments []string
 	b.WriteString("本轮用户上传并指定参考的文档内容：\n")
 
 	for i, doc := range docs {
-		content, err := (&DocumentHandler{}).extractPreviewContent(doc)
+		content, err := extractDocumentText(context.Background(), h.blobs, doc)
 		if err != nil {
 			b.WriteString(fmt.Sprintf("%d. %s (%s)\n内容提取失败，优先按文档标题和已有知识检索回答。\n\n", i+1, doc.Name, doc.FileType))
 			continue
@@ -447,7 +765,7 @@ func (h *ChatHandler) buildAttachmentContext(userID string, attachments []string
 	return b.String()
 }
 
-func (h *ChatHandler) buildComposedMessage(userID string, session models.ChatSession, userMessage string, attachments []string) string {
+func (h *ChatHandler) buildComposedMessage(ctx context.Context, userID string, session models.ChatSession, userMessage string, attachments []string) (string, []documentSvc.Passage) {
 	var role models.Role
 	rolePrompt := ""
 	if err := h.db.Where("id = ? AND user_id = ?", session.RoleID, userID).First(&role).Error; err == nil {
@@ -455,13 +773,12 @@ func (h *ChatHandler) buildComposedMessage(userID string, session models.ChatSes
 	}
 	cfg := h.parseSessionModelConfig(session)
 	chatMode, _ := cfg["chatMode"].(string)
-	kbContext := h.buildKnowledgeContext(userID, session)
+	kbContext, passages := h.buildKnowledgeContext(ctx, userID, session, userMessage)
 	attachmentContext := h.buildAttachmentContext(userID, attachments)
 
-	// Deep mode: use AnythingLLM agent invocation so web-browsing skill can be called.
+	// Deep mode: AnythingLLM provider runs it as an agent invocation so web-browsing skill can be called.
 	if chatMode == "deep" {
 		var b strings.Builder
-		b.WriteString("@agent ")
 		if rolePrompt != "" {
 			b.WriteString("角色设定：")
 			b.WriteString(rolePrompt)
@@ -478,11 +795,11 @@ func (h *ChatHandler) buildComposedMessage(userID string, session models.ChatSes
 		b.WriteString("请优先联网搜索最新信息，并给出可点击来源链接。\n")
 		b.WriteString("用户问题：")
 		b.WriteString(userMessage)
-		return b.String()
+		return b.String(), passages
 	}
 
 	if rolePrompt == "" && kbContext == "" && attachmentContext == "" {
-		return userMessage
+		return userMessage, nil
 	}
 
 	var b strings.Builder
@@ -502,7 +819,23 @@ func (h *ChatHandler) buildComposedMessage(userID string, session models.ChatSes
 	b.WriteString("请遵循角色设定，并优先利用知识库信息回答。\n\n")
 	b.WriteString("用户问题：\n")
 	b.WriteString(userMessage)
-	return b.String()
+	return b.String(), passages
+}
+
+// buildChatMessages 组装本轮请求的消息列表：按模型上下文窗口带上历史轮次，
+// 更早的轮次以滚动摘要形式提供。
+func (h *ChatHandler) buildChatMessages(ctx context.Context, userID string, session *models.ChatSession, current models.Message, attachments []string) chatPrompt {
+	prompt, passages := h.buildComposedMessage(ctx, userID, *session, current.Content, attachments)
+	messages, err := h.history.Build(ctx, conversation.HistoryRequest{
+		Session: session,
+		Current: current,
+		Prompt:  prompt,
+		Model:   h.resolveRuntimeModel(*session),
+	})
+	if err != nil {
+		messages = []ai.ChatMessage{{Role: "user", Content: prompt}}
+	}
+	return chatPrompt{Messages: messages, Passages: passages}
 }
 
 // Chat 发送消息（普通响应）- 集成 AnythingLLM
@@ -523,51 +856,50 @@ func (h *ChatHandler) Chat(c *gin.Context) {
 		return
 	}
 
-	// 保存用户消息
+	// 保存用户消息（追加到当前活动分支）
 	userMsg := models.Message{
 		ID:        models.NewUUID(),
-		SessionID: session.ID,
 		Role:      "user",
 		Content:   req.Content,
 		CreatedAt: time.Now(),
 	}
-	h.db.Create(&userMsg)
+	if err := conversation.AppendToActive(h.db, &session, &userMsg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save message"})
+		return
+	}
 
-	// 获取 AnythingLLM Slug
-	var assistantContent string
-	composedMessage := h.buildComposedMessage(userIDStr, session, req.Content, req.Attachments)
-	slug, err := h.ensureAnythingLLMWorkspace(userIDStr, &session)
+	// 选择对话提供方
+	mode := h.resolveChatMode(session)
+	provider, err := h.resolveChatProvider(userIDStr, &session, mode)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "anythingllm workspace not configured: " + err.Error(),
+			"error": "chat provider not available: " + err.Error(),
 		})
 		return
 	}
 
-	// 调用 AnythingLLM API
-	mode := h.resolveChatMode(session)
-	aiResult, err := h.callAnythingLLMWithMode(session, slug, composedMessage, mode, session.ID)
+	// 调用模型（可通过 POST /chat/:id/cancel 中止）；按流式读取，取消时保留已生成的部分
+	ctx, release := h.generations.Start(c.Request.Context(), session.ID, userMsg.ID)
+	defer release()
+	prompt := h.buildChatMessages(ctx, userIDStr, &session, userMsg, req.Attachments)
+	aiResult, err := h.streamChat(ctx, provider, session, prompt, func(string) {})
+	if conversation.Cancelled(ctx) {
+		h.respondCancelled(c, &session, mode, aiResult, userMsg.ID, gin.H{"userMessage": userMsg})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "anythingllm API error: " + err.Error(),
+			"error": provider.Name() + " API error: " + err.Error(),
 		})
 		return
 	}
-	assistantContent = aiResult.Content
 
 	// 保存助手消息
-	assistantMsg := models.Message{
-		ID:        models.NewUUID(),
-		SessionID: session.ID,
-		Role:      "assistant",
-		Content:   assistantContent,
-		Sources:   buildAssistantSources(mode, aiResult),
-		CreatedAt: time.Now(),
+	assistantMsg, err := h.saveAssistantReply(&session, mode, aiResult, userMsg.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save message"})
+		return
 	}
-	h.db.Create(&assistantMsg)
-
-	// 更新会话时间
-	h.db.Model(&session).Update("updated_at", time.Now())
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -597,21 +929,24 @@ func (h *ChatHandler) ChatStream(c *gin.Context) {
 		return
 	}
 
-	// 保存用户消息
+	// 保存用户消息（追加到当前活动分支）
 	userMsg := models.Message{
 		ID:        models.NewUUID(),
-		SessionID: session.ID,
 		Role:      "user",
 		Content:   req.Content,
 		CreatedAt: time.Now(),
 	}
-	h.db.Create(&userMsg)
+	if err := conversation.AppendToActive(h.db, &session, &userMsg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save message"})
+		return
+	}
 
-	// 获取 AnythingLLM Slug
-	slug, err := h.ensureAnythingLLMWorkspace(userIDStr, &session)
+	// 选择对话提供方
+	mode := h.resolveChatMode(session)
+	provider, err := h.resolveChatProvider(userIDStr, &session, mode)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "anythingllm workspace not configured: " + err.Error(),
+			"error": "chat provider not available: " + err.Error(),
 		})
 		return
 	}
@@ -628,45 +963,43 @@ func (h *ChatHandler) ChatStream(c *gin.Context) {
 		return
 	}
 
-	// 为保证稳定，服务端统一调用 chat API，再以 SSE 输出给前端。
-	mode := h.resolveChatMode(session)
-	aiResult, err := h.callAnythingLLMWithMode(
-		session,
-		slug,
-		h.buildComposedMessage(userIDStr, session, req.Content, req.Attachments),
-		mode,
-		session.ID,
-	)
-	if err != nil {
-		data := map[string]interface{}{"error": err.Error(), "done": true}
+	// 生成按会话与用户消息登记，可通过 POST /chat/:id/cancel 中止；
+	// 客户端断开时 Request.Context 取消，上游生成同样随之中止
+	clientCtx := c.Request.Context()
+	ctx, release := h.generations.Start(clientCtx, session.ID, userMsg.ID)
+	defer release()
+	writeEvent := func(data map[string]interface{}) {
+		if clientCtx.Err() != nil {
+			return
+		}
 		jsonData, _ := json.Marshal(data)
 		fmt.Fprintf(c.Writer, "data: %s\n\n", jsonData)
 		flusher.Flush()
-		return
 	}
-	assistantContent := aiResult.Content
 
-	var fullContent strings.Builder
-	fullContent.WriteString(assistantContent)
-	data := map[string]interface{}{"content": assistantContent, "done": false}
-	jsonData, _ := json.Marshal(data)
-	fmt.Fprintf(c.Writer, "data: %s\n\n", jsonData)
-	flusher.Flush()
+	aiResult, err := h.streamChat(
+		ctx,
+		provider,
+		session,
+		h.buildChatMessages(ctx, userIDStr, &session, userMsg, req.Attachments),
+		func(delta string) {
+			writeEvent(map[string]interface{}{"content": delta, "done": false})
+		},
+	)
 
-	// 保存完整的助手消息
+	// 保存助手消息（被取消或客户端中途断开时保留已生成部分，并标记为 interrupted）
+	interrupted := ctx.Err() != nil
 	assistantMessageID := ""
-	if fullContent.Len() > 0 {
-		assistantMsg := models.Message{
-			ID:        models.NewUUID(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Content:   fullContent.String(),
-			Sources:   buildAssistantSources(mode, aiResult),
-			CreatedAt: time.Now(),
+	if aiResult != nil && aiResult.Content != "" && (err == nil || interrupted) {
+		aiResult.Interrupted = interrupted
+		if assistantMsg, saveErr := h.saveAssistantReply(&session, mode, aiResult, userMsg.ID); saveErr == nil {
+			assistantMessageID = assistantMsg.ID
 		}
-		h.db.Create(&assistantMsg)
-		h.db.Model(&session).Update("updated_at", time.Now())
-		assistantMessageID = assistantMsg.ID
+	}
+
+	if err != nil && !interrupted {
+		writeEvent(map[string]interface{}{"error": err.Error(), "done": true})
+		return
 	}
 
 	// 统一由服务端发送最终 done 事件，并附带真实 message ID
@@ -676,14 +1009,65 @@ func (h *ChatHandler) ChatStream(c *gin.Context) {
 	if assistantMessageID != "" {
 		doneData["assistantMessageId"] = assistantMessageID
 	}
-	doneData["meta"] = map[string]interface{}{
-		"mode":     string(mode),
-		"sources":  aiResult.Sources,
-		"thoughts": aiResult.Thoughts,
+	if interrupted {
+		doneData["interrupted"] = true
 	}
-	doneJSON, _ := json.Marshal(doneData)
-	fmt.Fprintf(c.Writer, "data: %s\n\n", doneJSON)
-	flusher.Flush()
+	doneData["meta"] = doneMeta(mode, aiResult)
+	writeEvent(doneData)
+}
+
+// CancelGenerationRequest 取消生成请求
+type CancelGenerationRequest struct {
+	MessageID string `json:"messageId"` // 可选：按用户消息取消，为空时取消会话中最近一次生成
+}
+
+// CancelGeneration 中止进行中的回复生成
+// @Summary 取消生成
+// @Description 中止会话中进行中的回复生成（含上游模型调用），已生成的部分会保存并标记为 interrupted
+// @Tags 对话
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "会话 ID"
+// @Param request body CancelGenerationRequest false "要取消的用户消息"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string "会话不存在"
+// @Router /api/v1/chat/{id}/cancel [post]
+func (h *ChatHandler) CancelGeneration(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	sessionId := c.Param("id")
+
+	var req CancelGenerationRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var session models.ChatSession
+	if result := h.db.Where("id = ? AND user_id = ?", sessionId, userId).First(&session); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	key := session.ID
+	if strings.TrimSpace(req.MessageID) != "" {
+		var msg models.Message
+		if result := h.db.Where("id = ? AND session_id = ?", req.MessageID, session.ID).First(&msg); result.Error != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+		key = msg.ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"cancelled": h.generations.Cancel(key),
+		},
+	})
 }
 
 // SyncSession 从 AnythingLLM 同步对话历史
@@ -744,7 +1128,8 @@ func (h *ChatHandler) DeleteMessage(c *gin.Context) {
 		return
 	}
 
-	if result := h.db.Delete(&msg); result.Error != nil {
+	// 子消息改挂到被删除消息的父消息下，保持分支连贯
+	if err := conversation.RemoveMessage(h.db, &session, msg); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete message"})
 		return
 	}
@@ -826,6 +1211,15 @@ func (h *ChatHandler) SwitchRole(c *gin.Context) {
 	session.RoleID = req.RoleID
 	session.UpdatedAt = time.Now()
 
+	// 知识库范围随角色切换：新角色绑定了知识来源时，会话改用角色知识库
+	cfg := h.parseSessionModelConfig(session)
+	scope, _ := cfg["knowledgeScope"].(string)
+	if sources, err := retrieval.RoleScope(h.db, role.ID); err == nil && sources != nil && scope != knowledgeScopeRole {
+		cfg["knowledgeScope"] = knowledgeScopeRole
+		scope = knowledgeScopeRole
+		session.ModelConfig = models.ToJSON(cfg)
+	}
+
 	if result := h.db.Save(&session); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to switch role"})
 		return
@@ -834,21 +1228,21 @@ func (h *ChatHandler) SwitchRole(c *gin.Context) {
 	// 添加系统消息记录角色切换
 	systemMsg := models.Message{
 		ID:        models.NewUUID(),
-		SessionID: session.ID,
 		Role:      "system",
 		Content:   "角色已切换",
 		CreatedAt: time.Now(),
 	}
-	h.db.Create(&systemMsg)
+	_ = conversation.AppendToActive(h.db, &session, &systemMsg)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
-			"sessionId":   session.ID,
-			"oldRoleId":   oldRoleID,
-			"newRoleId":   req.RoleID,
-			"newRoleName": role.Name,
+			"sessionId":      session.ID,
+			"oldRoleId":      oldRoleID,
+			"newRoleId":      req.RoleID,
+			"newRoleName":    role.Name,
+			"knowledgeScope": scope,
 		},
 	})
 }
@@ -908,6 +1302,7 @@ func (h *ChatHandler) UpdateSessionTitle(c *gin.Context) {
 	}
 
 	session.Title = req.Title
+	session.TitleSource = conversation.TitleSourceUser
 	session.UpdatedAt = time.Now()
 
 	if result := h.db.Save(&session); result.Error != nil {
@@ -1115,8 +1510,9 @@ func (h *ChatHandler) ExportSession(c *gin.Context) {
 		return
 	}
 
-	var messages []models.Message
-	if result := h.db.Where("session_id = ?", sessionId).Order("created_at ASC").Find(&messages); result.Error != nil {
+	// 仅导出当前活动分支
+	messages, err := conversation.ActivePath(h.db, &session)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
 		return
 	}
@@ -1198,12 +1594,15 @@ func (h *ChatHandler) exportToJSON(session models.ChatSession, messages []models
 
 // UpdateMessageRequest 更新消息请求
 type UpdateMessageRequest struct {
-	Content string `json:"content" binding:"required"`
+	Content    string `json:"content" binding:"required"`
+	Regenerate bool   `json:"regenerate"` // 同时为编辑后的消息生成回复
 }
 
-// UpdateMessage 更新消息（编辑用户消息）
+// UpdateMessage 编辑用户消息
+// 编辑不会覆盖原消息，而是在同一父消息下新建分支并切换过去，原分支及其后续轮次保留。
 func (h *ChatHandler) UpdateMessage(c *gin.Context) {
 	userId, _ := c.Get("userId")
+	userIDStr, _ := userId.(string)
 	sessionId := c.Param("id")
 	messageId := c.Param("msgId")
 
@@ -1219,8 +1618,11 @@ func (h *ChatHandler) UpdateMessage(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
 		return
 	}
+	if err := conversation.EnsureTree(h.db, &session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		return
+	}
 
-	// 更新消息
 	var msg models.Message
 	if result := h.db.Where("id = ? AND session_id = ?", messageId, sessionId).First(&msg); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
@@ -1233,21 +1635,61 @@ func (h *ChatHandler) UpdateMessage(c *gin.Context) {
 		return
 	}
 
-	msg.Content = req.Content
-	msg.IsEdited = true
-	msg.UpdatedAt = time.Now()
-	if result := h.db.Save(&msg); result.Error != nil {
+	edited := models.Message{
+		ID:        models.NewUUID(),
+		Role:      "user",
+		Content:   req.Content,
+		IsEdited:  true,
+		CreatedAt: time.Now(),
+	}
+	if err := conversation.AppendMessage(h.db, &session, &edited, msg.ParentID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update message"})
 		return
 	}
 
+	data := gin.H{
+		"messageId":    edited.ID,
+		"content":      edited.Content,
+		"parentId":     edited.ParentID,
+		"siblingIndex": edited.SiblingIndex,
+		"message":      edited,
+	}
+
+	if req.Regenerate {
+		mode := h.resolveChatMode(session)
+		provider, err := h.resolveChatProvider(userIDStr, &session, mode)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "chat provider not available: " + err.Error(),
+			})
+			return
+		}
+		ctx, release := h.generations.Start(c.Request.Context(), session.ID, edited.ID)
+		defer release()
+		prompt := h.buildChatMessages(ctx, userIDStr, &session, edited, nil)
+		aiResult, err := h.streamChat(ctx, provider, session, prompt, func(string) {})
+		if conversation.Cancelled(ctx) {
+			h.respondCancelled(c, &session, mode, aiResult, edited.ID, data)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": provider.Name() + " API error: " + err.Error(),
+			})
+			return
+		}
+		assistantMsg, err := h.saveAssistantReply(&session, mode, aiResult, edited.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save message"})
+			return
+		}
+		data["assistantMessage"] = assistantMsg
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
-		"data": gin.H{
-			"messageId": msg.ID,
-			"content":   msg.Content,
-		},
+		"data":    data,
 	})
 }
 
@@ -1257,6 +1699,7 @@ type RegenerateMessageRequest struct {
 }
 
 // RegenerateMessage 重新生成 AI 回复
+// 新回复作为原回复的兄弟分支保存并设为活动分支，原回复保留，可通过分支切换找回。
 func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
 	userID := c.GetString("userId")
 	if userID == "" {
@@ -1273,6 +1716,10 @@ func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
 		return
 	}
+	if err := conversation.EnsureTree(h.db, &session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		return
+	}
 
 	// 找到要重新生成的消息
 	var msg models.Message
@@ -1285,41 +1732,149 @@ func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
 		return
 	}
 
-	// 找到最后一条用户消息
-	var lastUserMsg models.Message
-	if result := h.db.Where("session_id = ? AND role = 'user' AND created_at <= ?", sessionId, msg.CreatedAt).
-		Order("created_at DESC").First(&lastUserMsg); result.Error != nil {
+	// 找到该回复所在分支上最近的一条用户消息
+	ancestors, err := conversation.Ancestors(h.db, &session, msg.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		return
+	}
+	var lastUserMsg *models.Message
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if ancestors[i].Role == "user" {
+			lastUserMsg = &ancestors[i]
+			break
+		}
+	}
+	if lastUserMsg == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "no user message found"})
 		return
 	}
 
-	content := lastUserMsg.Content
+	// 选择对话提供方
+	mode := h.resolveChatMode(session)
+	provider, err := h.resolveChatProvider(userID, &session, mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "chat provider not available: " + err.Error(),
+		})
+		return
+	}
+	ctx, release := h.generations.Start(c.Request.Context(), session.ID, msg.ID)
+	defer release()
+	prompt := h.buildChatMessages(ctx, userID, &session, *lastUserMsg, nil)
+	aiResult, err := h.streamChat(ctx, provider, session, prompt, func(string) {})
+	if conversation.Cancelled(ctx) {
+		h.respondCancelled(c, &session, mode, aiResult, msg.ParentID, gin.H{"previousMessageId": msg.ID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": provider.Name() + " API error: " + err.Error(),
+		})
+		return
+	}
 
-	// 获取 AnythingLLM Slug
-	var assistantContent string
-	var aiResult *AnythingLLMResult
-	slug, err := h.ensureAnythingLLMWorkspace(userID, &session)
+	// 作为原回复的兄弟分支保存
+	assistantMsg, err := h.saveAssistantReply(&session, mode, aiResult, msg.ParentID)
 	if err != nil {
-		assistantContent = h.callMockAI(content)
-	} else {
-		composed := h.buildComposedMessage(userID, session, content, nil)
-		mode := h.resolveChatMode(session)
-		aiResult, err = h.callAnythingLLMWithMode(session, slug, composed, mode, session.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "anythingllm API error: " + err.Error(),
-			})
-			return
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save regenerated message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"assistantMessage":  assistantMsg,
+			"previousMessageId": msg.ID,
+		},
+	})
+}
+
+// ListMessageSiblings 获取消息的全部分支
+// @Summary 获取消息分支
+// @Description 列出与指定消息同一父消息下的所有分支（重新生成或编辑产生），并标记当前活动分支
+// @Tags 对话
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "会话 ID"
+// @Param msgId path string true "消息 ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string "会话或消息不存在"
+// @Router /api/v1/chat/{id}/messages/{msgId}/siblings [get]
+func (h *ChatHandler) ListMessageSiblings(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	sessionId := c.Param("id")
+	messageId := c.Param("msgId")
+
+	var session models.ChatSession
+	if result := h.db.Where("id = ? AND user_id = ?", sessionId, userId).First(&session); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	siblings, err := conversation.Siblings(h.db, &session, messageId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+
+	path, err := conversation.ActivePath(h.db, &session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		return
+	}
+	onPath := make(map[string]bool, len(path))
+	for _, msg := range path {
+		onPath[msg.ID] = true
+	}
+	activeID := ""
+	for _, sibling := range siblings {
+		if onPath[sibling.ID] {
+			activeID = sibling.ID
+			break
 		}
-		assistantContent = aiResult.Content
 	}
 
-	// 更新或创建新的助手消息
-	msg.Content = assistantContent
-	msg.Sources = buildAssistantSources(h.resolveChatMode(session), aiResult)
-	msg.CreatedAt = time.Now()
-	if err := h.db.Save(&msg).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save regenerated message"})
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"siblings": siblings,
+			"activeId": activeID,
+		},
+	})
+}
+
+// ActivateBranch 切换活动分支
+// @Summary 切换活动分支
+// @Description 切换到包含指定消息的分支（沿最新的后续消息延伸到末端），返回新的活动路径
+// @Tags 对话
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "会话 ID"
+// @Param msgId path string true "消息 ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string "会话或消息不存在"
+// @Router /api/v1/chat/{id}/messages/{msgId}/activate [post]
+func (h *ChatHandler) ActivateBranch(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	sessionId := c.Param("id")
+	messageId := c.Param("msgId")
+
+	var session models.ChatSession
+	if result := h.db.Where("id = ? AND user_id = ?", sessionId, userId).First(&session); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	messages, err := conversation.ActivateBranch(h.db, &session, messageId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to switch branch"})
 		return
 	}
 
@@ -1327,7 +1882,8 @@ func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
-			"assistantMessage": msg,
+			"activeLeafId": session.ActiveLeafID,
+			"messages":     messages,
 		},
 	})
 }
@@ -1409,43 +1965,245 @@ func (h *ChatHandler) RateMessage(c *gin.Context) {
 	})
 }
 
+// Citation 回答中引用标记对应的原文片段
+type Citation struct {
+	Marker       int     `json:"marker"`
+	DocumentID   string  `json:"documentId"`
+	DocumentName string  `json:"documentName"`
+	ChunkID      string  `json:"chunkId"`
+	HeadingPath  string  `json:"headingPath"`
+	Page         int     `json:"page,omitempty"`
+	Sheet        string  `json:"sheet,omitempty"`
+	StartOffset  int     `json:"startOffset"`
+	EndOffset    int     `json:"endOffset"`
+	Score        float64 `json:"score"`
+	Passage      string  `json:"passage"`
+	Highlighted  string  `json:"highlighted"` // 已转义的 HTML 片段，与提问相关的词以 <mark> 标注
+	Stale        bool    `json:"stale"`       // 文档已删除或重新处理，无法还原原文
+}
+
+// GetCitations 将助手消息中的引用标记解析为原文片段
+// @Summary 获取消息引用
+// @Description 将助手回复中的 [n] 引用标记解析回知识库文档中的片段，并高亮与提问相关的词
+// @Tags 对话
+// @Produce json
+// @Security BearerAuth
+// @Param msgId path string true "消息 ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string "消息不存在"
+// @Router /api/v1/chat/messages/{msgId}/citations [get]
+func (h *ChatHandler) GetCitations(c *gin.Context) {
+	userID := c.GetString("userId")
+	messageId := c.Param("msgId")
+
+	var msg models.Message
+	if err := h.db.Where("id = ?", messageId).First(&msg).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	var count int64
+	h.db.Model(&models.ChatSession{}).Where("id = ? AND user_id = ?", msg.SessionID, userID).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+
+	var meta struct {
+		Sources []map[string]interface{} `json:"sources"`
+	}
+	if msg.Sources != "" {
+		json.Unmarshal([]byte(msg.Sources), &meta)
+	}
+
+	// 以提问中的检索词高亮片段
+	var terms []string
+	if msg.ParentID != "" {
+		var parent models.Message
+		if err := h.db.Select("content").Where("id = ?", msg.ParentID).First(&parent).Error; err == nil {
+			terms = documentSvc.QueryTerms(parent.Content)
+		}
+	}
+
+	citations := []Citation{}
+	for _, source := range meta.Sources {
+		if kind, _ := source["type"].(string); kind != "chunk" {
+			continue
+		}
+		citations = append(citations, h.resolveCitation(userID, source, terms))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"messageId": msg.ID,
+			"citations": citations,
+		},
+	})
+}
+
+// resolveCitation 按分块 ID 还原引用的片段；分块已被重新生成时按字符偏移在新分块中定位
+func (h *ChatHandler) resolveCitation(userID string, source map[string]interface{}, terms []string) Citation {
+	var passage documentSvc.Passage
+	if raw, err := json.Marshal(source); err == nil {
+		json.Unmarshal(raw, &passage)
+	}
+	title, _ := source["title"].(string)
+	citation := Citation{
+		Marker:       passage.Marker,
+		DocumentID:   passage.DocumentID,
+		DocumentName: title,
+		ChunkID:      passage.ChunkID,
+		HeadingPath:  passage.HeadingPath,
+		Page:         passage.Page,
+		Sheet:        passage.Sheet,
+		StartOffset:  passage.StartOffset,
+		EndOffset:    passage.EndOffset,
+		Score:        passage.Score,
+		Stale:        true,
+	}
+
+	var doc models.Document
+	// 引用可能来自角色绑定的公司知识库中其他成员的文档
+	if err := h.db.Select("id, name").Where("id = ?", passage.DocumentID).
+		Where(documentSvc.AccessibleSQL, userID, userID).First(&doc).Error; err != nil {
+		return citation
+	}
+	citation.DocumentName = doc.Name
+
+	var chunk models.DocumentChunk
+	err := h.db.Where("id = ? AND document_id = ?", passage.ChunkID, doc.ID).First(&chunk).Error
+	if err != nil {
+		err = h.db.Where("document_id = ? AND start_offset <= ? AND end_offset >= ?", doc.ID, passage.StartOffset, passage.EndOffset).
+			Order("ordinal").First(&chunk).Error
+	}
+	if err != nil {
+		return citation
+	}
+
+	// 原分块仍在时即为整块；否则截取新分块中与原偏移对应的部分
+	runes := []rune(chunk.Content)
+	from := min(max(passage.StartOffset-chunk.StartOffset, 0), len(runes))
+	to := min(max(passage.EndOffset-chunk.StartOffset, from), len(runes))
+	citation.ChunkID = chunk.ID
+	citation.Passage = string(runes[from:to])
+	citation.Highlighted = search.Highlight(citation.Passage, terms)
+	citation.Stale = false
+	return citation
+}
+
 // SearchSessionsRequest 搜索会话请求
 type SearchSessionsRequest struct {
-	Query string `json:"query" binding:"required"`
+	Query    string     `json:"query" binding:"required"`
+	Role     string     `json:"role"`     // 仅匹配该角色的消息：user/assistant/system
+	From     *time.Time `json:"from"`     // 消息创建时间下限
+	To       *time.Time `json:"to"`       // 消息创建时间上限
+	Archived *bool      `json:"archived"` // 按归档状态过滤，不传表示不限
+	Limit    int        `json:"limit"`    // 返回的会话数量上限
 }
 
-// SearchSessions 搜索会话（基于消息内容）
+// SessionSearchResult 会话搜索结果
+type SessionSearchResult struct {
+	models.ChatSession
+	HighlightedTitle   string       `json:"highlightedTitle,omitempty"`   // 高亮后的标题，已转义的 HTML 片段
+	HighlightedSummary string       `json:"highlightedSummary,omitempty"` // 概要命中时的高亮片段，已转义的 HTML 片段
+	Score              float64      `json:"score"`
+	Matches            []search.Hit `json:"matches"` // 命中的消息片段，messageId 可用于定位
+}
+
+// 每个会话最多返回的命中消息数
+const maxMatchesPerSession = 5
+
+// SearchSessions 搜索会话（全文检索消息内容、会话标题与概要，按相关度排序）
 func (h *ChatHandler) SearchSessions(c *gin.Context) {
-	userId, _ := c.Get("userId")
+	userID := c.GetString("userId")
+	if userID == "" {
+		if v, ok := c.Get("userId"); ok {
+			userID = fmt.Sprint(v)
+		}
+	}
 
 	var req SearchSessionsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	limit := req.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	hits, err := h.search.Search(search.Options{
+		UserID:   userID,
+		Query:    req.Query,
+		Kinds:    []string{search.KindSession, search.KindMessage},
+		Role:     req.Role,
+		From:     req.From,
+		To:       req.To,
+		Archived: req.Archived,
+		Limit:    limit * maxMatchesPerSession * 4,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search sessions"})
+		return
+	}
+
+	// 按会话聚合，会话顺序取其最相关的命中
+	var order []string
+	grouped := map[string]*SessionSearchResult{}
+	for _, hit := range hits {
+		result, ok := grouped[hit.SessionID]
+		if !ok {
+			if len(order) >= limit {
+				continue
+			}
+			result = &SessionSearchResult{Score: hit.Score, Matches: []search.Hit{}}
+			grouped[hit.SessionID] = result
+			order = append(order, hit.SessionID)
+		}
+		if hit.Kind == search.KindSession {
+			result.HighlightedTitle = hit.Title
+			if strings.Contains(hit.Snippet, "<mark>") {
+				result.HighlightedSummary = hit.Snippet
+			}
+			continue
+		}
+		if len(result.Matches) < maxMatchesPerSession {
+			result.Matches = append(result.Matches, hit)
+		}
+	}
 
-	// 搜索包含关键词的会话
 	var sessions []models.ChatSession
-	query := "%" + req.Query + "%"
-
-	// 通过消息内容搜索会话
-	var messageSessionIDs []string
-	h.db.Table("messages").
-		Where("session_id IN (SELECT id FROM chat_sessions WHERE user_id = ?)", userId).
-		Where("content LIKE ?", query).
-		Distinct("session_id").
-		Pluck("session_id", &messageSessionIDs)
-
-	// 通过标题搜索会话
-	h.db.Where("user_id = ? AND title LIKE ?", userId, query).
-		Or("id IN ?", messageSessionIDs).
-		Order("updated_at DESC").
-		Find(&sessions)
+	if len(order) > 0 {
+		if err := h.db.Where("user_id = ? AND id IN ?", userID, order).Find(&sessions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search sessions"})
+			return
+		}
+	}
+	byID := make(map[string]models.ChatSession, len(sessions))
+	for _, session := range sessions {
+		byID[session.ID] = session
+	}
+
+	terms := search.Terms(req.Query)
+	results := make([]SessionSearchResult, 0, len(order))
+	for _, id := range order {
+		session, ok := byID[id]
+		if !ok {
+			continue
+		}
+		result := grouped[id]
+		result.ChatSession = session
+		if result.HighlightedTitle == "" {
+			result.HighlightedTitle = search.Highlight(session.Title, terms)
+		}
+		results = append(results, *result)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
-		"data":    sessions,
+		"data":    results,
 	})
 }
 
@@ -1466,15 +2224,17 @@ func (h *ChatHandler) ChatStreamWithThinking(c *gin.Context) {
 		return
 	}
 
-	// 保存用户消息
+	// 保存用户消息（追加到当前活动分支）
 	userMsg := models.Message{
 		ID:        models.NewUUID(),
-		SessionID: session.ID,
 		Role:      "user",
 		Content:   req.Content,
 		CreatedAt: time.Now(),
 	}
-	h.db.Create(&userMsg)
+	if err := conversation.AppendToActive(h.db, &session, &userMsg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save message"})
+		return
+	}
 
 	// 设置 SSE 响应头
 	c.Header("Content-Type", "text/event-stream")
@@ -1510,39 +2270,40 @@ func (h *ChatHandler) ChatStreamWithThinking(c *gin.Context) {
 
 	// 获取实际响应（stream-with-thinking endpoint 固定按 agent 模式执行，避免会话配置落库延迟导致模式漂移）
 	var assistantContent string
-	var aiResult *AnythingLLMResult
 	mode := ChatModeAgent
 	userIDStr, _ := userId.(string)
-	slug, err := h.ensureAnythingLLMWorkspace(userIDStr, &session)
+	provider, err := h.resolveChatProvider(userIDStr, &session, mode)
 	if err != nil {
 		jsonData, _ := json.Marshal(map[string]interface{}{
 			"type": "error",
-			"data": map[string]string{"message": "anythingllm workspace not configured: " + err.Error()},
+			"data": map[string]string{"message": "chat provider not available: " + err.Error()},
 		})
 		fmt.Fprintf(c.Writer, "data: %s\n\n", jsonData)
 		flusher.Flush()
 		return
-	} else {
-		// 调用 AnythingLLM API
-		composed := h.buildComposedMessage(userIDStr, session, req.Content, req.Attachments)
-		composed = strings.TrimSpace(composed)
-		if !strings.HasPrefix(composed, "@agent") {
-			composed = "@agent " + composed
-		}
-		aiResult, err = h.callAnythingLLMWithMode(session, slug, composed, mode, session.ID)
-		if err != nil {
-			// 发送错误
-			jsonData, _ := json.Marshal(map[string]interface{}{
-				"type": "error",
-				"data": map[string]string{"message": err.Error()},
-			})
-			fmt.Fprintf(c.Writer, "data: %s\n\n", jsonData)
-			flusher.Flush()
-			return
-		}
-		assistantContent = aiResult.Content
 	}
 
+	// 调用模型（AnythingLLM 提供方会以 @agent 方式调用）；可通过 POST /chat/:id/cancel 中止
+	ctx, release := h.generations.Start(c.Request.Context(), session.ID, userMsg.ID)
+	defer release()
+	prompt := h.buildChatMessages(ctx, userIDStr, &session, userMsg, req.Attachments)
+	aiResult, err := h.streamChat(ctx, provider, session, prompt, func(string) {})
+	interrupted := ctx.Err() != nil
+	if err != nil && !interrupted {
+		// 发送错误
+		jsonData, _ := json.Marshal(map[string]interface{}{
+			"type": "error",
+			"data": map[string]string{"message": err.Error()},
+		})
+		fmt.Fprintf(c.Writer, "data: %s\n\n", jsonData)
+		flusher.Flush()
+		return
+	}
+	if aiResult == nil {
+		aiResult = &ProviderResult{Provider: provider.Name()}
+	}
+	assistantContent = aiResult.Content
+
 	// 步骤 5: 得出结论
 	sender.AddThinkingStep(thinking.ThinkingConclude, "综合以上分析得出结论")
 
@@ -1552,20 +2313,13 @@ func (h *ChatHandler) ChatStreamWithThinking(c *gin.Context) {
 	// 发送最终答案
 	sender.SendAnswer(assistantContent)
 
-	// 保存完整的助手消息
+	// 保存助手消息（被中止时保存已生成部分并标记为 interrupted）
 	assistantMessageID := ""
 	if assistantContent != "" {
-		assistantMsg := models.Message{
-			ID:        models.NewUUID(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Content:   assistantContent,
-			Sources:   buildAssistantSources(mode, aiResult),
-			CreatedAt: time.Now(),
+		aiResult.Interrupted = interrupted
+		if assistantMsg, err := h.saveAssistantReply(&session, mode, aiResult, userMsg.ID); err == nil {
+			assistantMessageID = assistantMsg.ID
 		}
-		h.db.Create(&assistantMsg)
-		h.db.Model(&session).Update("updated_at", time.Now())
-		assistantMessageID = assistantMsg.ID
 	}
 
 	// 发送完成标记（附带真实消息 ID，便于前端替换临时 ID）
@@ -1576,22 +2330,15 @@ func (h *ChatHandler) ChatStreamWithThinking(c *gin.Context) {
 	if assistantMessageID != "" {
 		doneChunk["assistantMessageId"] = assistantMessageID
 	}
-	doneChunk["meta"] = map[string]interface{}{
-		"mode":     string(mode),
-		"sources":  aiResult.Sources,
-		"thoughts": aiResult.Thoughts,
+	if interrupted {
+		doneChunk["interrupted"] = true
 	}
+	doneChunk["meta"] = doneMeta(mode, aiResult)
 	jsonData, _ := json.Marshal(doneChunk)
 	fmt.Fprintf(c.Writer, "data: %s\n\n", jsonData)
 	flusher.Flush()
 }
 
-// callMockAI 调用 Mock AI（当 AnythingLLM 未配置时使用）
-func (h *ChatHandler) callMockAI(message string) string {
-	// 简单的 Mock AI 回复
-	return "你好！我是 Mock AI 助手。我现在可以回答你的问题：" + message
-}
-
 // truncateString 截断字符串（辅助函数）
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
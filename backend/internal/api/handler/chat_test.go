@@ -2,19 +2,26 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
 	"rolecraft-ai/internal/api/handler"
 	"rolecraft-ai/internal/config"
 	"rolecraft-ai/internal/models"
+	documentSvc "rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/retrieval"
+	"rolecraft-ai/internal/service/search"
 )
 
 // TestUpdateMessage 测试编辑消息
@@ -71,11 +78,28 @@ func TestUpdateMessage(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		// 验证数据库更新
+		var response struct {
+			Data struct {
+				MessageID string `json:"messageId"`
+			} `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotEqual(t, message.ID, response.Data.MessageID)
+
+		// 编辑生成新的兄弟分支，原消息保留
 		var updatedMsg models.Message
-		db.First(&updatedMsg, "id = ?", message.ID)
+		db.First(&updatedMsg, "id = ?", response.Data.MessageID)
 		assert.Equal(t, "Updated content", updatedMsg.Content)
 		assert.True(t, updatedMsg.IsEdited)
+		assert.Equal(t, 1, updatedMsg.SiblingIndex)
+
+		var original models.Message
+		db.First(&original, "id = ?", message.ID)
+		assert.Equal(t, "Original content", original.Content)
+
+		var refreshed models.ChatSession
+		db.First(&refreshed, "id = ?", session.ID)
+		assert.Equal(t, updatedMsg.ID, refreshed.ActiveLeafID)
 	})
 
 	// 测试不能编辑 AI 消息
@@ -292,9 +316,78 @@ func TestRegenerateMessage(t *testing.T) {
 		chatHandler.RegenerateMessage(ctx)
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var refreshed models.Message
-		db.First(&refreshed, "id = ?", assistantMsg.ID)
-		assert.NotEqual(t, "old answer", refreshed.Content)
+		// 原回复保留，新回复作为兄弟分支成为活动分支
+		var original models.Message
+		db.First(&original, "id = ?", assistantMsg.ID)
+		assert.Equal(t, "old answer", original.Content)
+
+		var response struct {
+			Data struct {
+				AssistantMessage models.Message `json:"assistantMessage"`
+			} `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		regenerated := response.Data.AssistantMessage
+		assert.NotEqual(t, assistantMsg.ID, regenerated.ID)
+		assert.Equal(t, userMsg.ID, regenerated.ParentID)
+		assert.Equal(t, 1, regenerated.SiblingIndex)
+	})
+
+	t.Run("List siblings and switch branch", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request, _ = http.NewRequest("GET", "/api/v1/chat/"+session.ID+"/messages/"+assistantMsg.ID+"/siblings", nil)
+		ctx.Set("userId", user.ID)
+		ctx.Params = []gin.Param{
+			{Key: "id", Value: session.ID},
+			{Key: "msgId", Value: assistantMsg.ID},
+		}
+
+		chatHandler.ListMessageSiblings(ctx)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var siblings struct {
+			Data struct {
+				Siblings []models.Message `json:"siblings"`
+				ActiveID string           `json:"activeId"`
+			} `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &siblings))
+		assert.Len(t, siblings.Data.Siblings, 2)
+		assert.NotEqual(t, assistantMsg.ID, siblings.Data.ActiveID)
+
+		w = httptest.NewRecorder()
+		ctx, _ = gin.CreateTestContext(w)
+		ctx.Request, _ = http.NewRequest("POST", "/api/v1/chat/"+session.ID+"/messages/"+assistantMsg.ID+"/activate", nil)
+		ctx.Set("userId", user.ID)
+		ctx.Params = []gin.Param{
+			{Key: "id", Value: session.ID},
+			{Key: "msgId", Value: assistantMsg.ID},
+		}
+
+		chatHandler.ActivateBranch(ctx)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// 会话详情只返回活动路径
+		w = httptest.NewRecorder()
+		ctx, _ = gin.CreateTestContext(w)
+		ctx.Request, _ = http.NewRequest("GET", "/api/v1/chat-sessions/"+session.ID, nil)
+		ctx.Set("userId", user.ID)
+		ctx.Params = []gin.Param{{Key: "id", Value: session.ID}}
+
+		chatHandler.GetSession(ctx)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var detail struct {
+			Data struct {
+				Messages []models.Message `json:"messages"`
+			} `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+		if assert.Len(t, detail.Data.Messages, 2) {
+			assert.Equal(t, "old answer", detail.Data.Messages[1].Content)
+			assert.Equal(t, 2, detail.Data.Messages[1].SiblingCount)
+		}
 	})
 }
 
@@ -362,6 +455,140 @@ func TestRateMessage(t *testing.T) {
 	})
 }
 
+func TestChatWithoutAnythingLLM(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := setupTestDB(t)
+	db.AutoMigrate(&models.Role{}, &models.Document{})
+	chatHandler := handler.NewChatHandler(db, &config.Config{})
+
+	user := models.User{ID: "provider-user", Email: "provider@example.com", PasswordHash: "hashed"}
+	db.Create(&user)
+
+	mockSession := models.ChatSession{
+		ID:          "provider-mock-session",
+		UserID:      user.ID,
+		Title:       "Mock",
+		ModelConfig: models.JSON(`{"provider":"mock"}`),
+	}
+	defaultSession := models.ChatSession{ID: "provider-default-session", UserID: user.ID, Title: "Default"}
+	anythingSession := models.ChatSession{
+		ID:          "provider-anything-session",
+		UserID:      user.ID,
+		Title:       "AnythingLLM",
+		ModelConfig: models.JSON(`{"provider":"anythingllm"}`),
+	}
+	db.Create(&mockSession)
+	db.Create(&defaultSession)
+	db.Create(&anythingSession)
+
+	send := func(sessionID string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"content": "你好"})
+		req, _ := http.NewRequest("POST", "/api/v1/chat/"+sessionID+"/complete", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", user.ID)
+		ctx.Params = []gin.Param{{Key: "id", Value: sessionID}}
+
+		chatHandler.Chat(ctx)
+		return w
+	}
+
+	t.Run("explicit mock provider", func(t *testing.T) {
+		w := send(mockSession.ID)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var count int64
+		db.Model(&models.Message{}).Where("session_id = ? AND role = ?", mockSession.ID, "assistant").Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		var assistant models.Message
+		db.Where("session_id = ? AND role = ?", mockSession.ID, "assistant").First(&assistant)
+		assert.Equal(t, "mock", assistant.Provider)
+		assert.Equal(t, "mock-v1", assistant.ModelID)
+		assert.Greater(t, assistant.PromptTokens, 0)
+		assert.Greater(t, assistant.CompletionTokens, 0)
+		assert.Equal(t, assistant.PromptTokens+assistant.CompletionTokens, assistant.TokensUsed)
+	})
+
+	t.Run("default provider falls back to mock", func(t *testing.T) {
+		w := send(defaultSession.ID)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "anythingllm")
+	})
+
+	t.Run("explicit anythingllm provider requires configuration", func(t *testing.T) {
+		w := send(anythingSession.ID)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "anythingllm is not configured")
+	})
+}
+
+// TestChatStream 测试流式对话逐块输出
+func TestChatStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := setupTestDB(t)
+	db.AutoMigrate(&models.Role{}, &models.Document{})
+	chatHandler := handler.NewChatHandler(db, &config.Config{})
+
+	user := models.User{ID: "stream-user", Email: "stream@example.com", PasswordHash: "hashed"}
+	db.Create(&user)
+	session := models.ChatSession{
+		ID:          "stream-session",
+		UserID:      user.ID,
+		Title:       "Stream",
+		ModelConfig: models.JSON(`{"provider":"mock"}`),
+	}
+	db.Create(&session)
+
+	body, _ := json.Marshal(map[string]string{"content": "你好"})
+	req, _ := http.NewRequest("POST", "/api/v1/chat/"+session.ID+"/stream", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = req
+	ctx.Set("userId", user.ID)
+	ctx.Params = []gin.Param{{Key: "id", Value: session.ID}}
+
+	chatHandler.ChatStream(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var deltas []string
+	var done map[string]interface{}
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		if event["done"] == true {
+			done = event
+			continue
+		}
+		deltas = append(deltas, event["content"].(string))
+	}
+
+	assert.Greater(t, len(deltas), 1, "reply should arrive in several chunks")
+	if assert.NotNil(t, done) {
+		assert.Nil(t, done["error"])
+		messageID, _ := done["assistantMessageId"].(string)
+		assert.NotEmpty(t, messageID)
+
+		var saved models.Message
+		assert.NoError(t, db.First(&saved, "id = ?", messageID).Error)
+		assert.Equal(t, strings.TrimSpace(strings.Join(deltas, "")), saved.Content)
+		assert.Greater(t, saved.TokensUsed, 0)
+		assert.Equal(t, "mock", saved.Provider)
+	}
+}
+
 // setupTestDB 创建测试数据库
 func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
@@ -374,3 +601,316 @@ func setupTestDB(t *testing.T) *gorm.DB {
 
 	return db
 }
+
+func TestCancelGeneration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := setupTestDB(t)
+	db.AutoMigrate(&models.Role{}, &models.Document{})
+	// 流式生成与取消请求并发访问同一个内存库
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	chatHandler := handler.NewChatHandler(db, &config.Config{})
+
+	user := models.User{ID: "cancel-user", Email: "cancel@example.com", PasswordHash: "hashed"}
+	db.Create(&user)
+	session := models.ChatSession{
+		ID:          "cancel-session",
+		UserID:      user.ID,
+		Title:       "Cancel",
+		ModelConfig: models.JSON(`{"provider":"mock"}`),
+	}
+	db.Create(&session)
+
+	body, _ := json.Marshal(map[string]string{"content": "帮我写一篇营销文案"})
+	streamReq, _ := http.NewRequest("POST", "/api/v1/chat/"+session.ID+"/stream", bytes.NewBuffer(body))
+	streamReq.Header.Set("Content-Type", "application/json")
+
+	streamRecorder := httptest.NewRecorder()
+	streamCtx, _ := gin.CreateTestContext(streamRecorder)
+	streamCtx.Request = streamReq
+	streamCtx.Set("userId", user.ID)
+	streamCtx.Params = []gin.Param{{Key: "id", Value: session.ID}}
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		chatHandler.ChatStream(streamCtx)
+	}()
+
+	cancel := func() bool {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request, _ = http.NewRequest("POST", "/api/v1/chat/"+session.ID+"/cancel", nil)
+		ctx.Set("userId", user.ID)
+		ctx.Params = []gin.Param{{Key: "id", Value: session.ID}}
+		chatHandler.CancelGeneration(ctx)
+
+		var response struct {
+			Data struct {
+				Cancelled bool `json:"cancelled"`
+			} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data.Cancelled
+	}
+
+	// 等待生成输出一部分后再取消
+	time.Sleep(300 * time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for !cancel() {
+		if time.Now().After(deadline) {
+			t.Fatal("generation never became cancellable")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(3 * time.Second):
+		t.Fatal("stream did not stop after cancel")
+	}
+
+	var done map[string]interface{}
+	for _, line := range strings.Split(streamRecorder.Body.String(), "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err == nil && event["done"] == true {
+			done = event
+		}
+	}
+	if assert.NotNil(t, done) {
+		assert.Equal(t, true, done["interrupted"])
+		assert.Nil(t, done["error"])
+
+		messageID, _ := done["assistantMessageId"].(string)
+		var saved models.Message
+		if assert.NoError(t, db.First(&saved, "id = ?", messageID).Error) {
+			assert.Equal(t, "interrupted", saved.Status)
+			assert.NotEmpty(t, saved.Content)
+		}
+	}
+
+	assert.False(t, cancel(), "nothing left to cancel")
+}
+
+func TestCancelRegeneration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := setupTestDB(t)
+	db.AutoMigrate(&models.Role{}, &models.Document{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	chatHandler := handler.NewChatHandler(db, &config.Config{})
+
+	session := models.ChatSession{ID: "cancel-regen-session", UserID: "cancel-regen-user", Title: "Regen", ModelConfig: models.JSON(`{"provider":"mock"}`)}
+	db.Create(&session)
+	db.Create(&models.Message{ID: "cancel-regen-q", SessionID: session.ID, Role: "user", Content: "帮我写一篇营销文案"})
+	db.Create(&models.Message{ID: "cancel-regen-a", SessionID: session.ID, Role: "assistant", Content: "old answer"})
+
+	cancel := func() bool {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request, _ = http.NewRequest("POST", "/api/v1/chat/"+session.ID+"/cancel", nil)
+		ctx.Set("userId", session.UserID)
+		ctx.Params = []gin.Param{{Key: "id", Value: session.ID}}
+		chatHandler.CancelGeneration(ctx)
+		return strings.Contains(w.Body.String(), `"cancelled":true`)
+	}
+
+	// 非流式的发送、重新生成与编辑后重新生成被中止时返回 409，而不是上游调用错误；
+	// 与流式接口一致，已生成的部分保存为 interrupted 回复
+	run := func(fn func(*gin.Context), method, msgID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request, _ = http.NewRequest(method, "/api/v1/chat/"+session.ID+"/messages/"+msgID, bytes.NewBufferString(body))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+		ctx.Set("userId", session.UserID)
+		ctx.Params = []gin.Param{{Key: "id", Value: session.ID}, {Key: "msgId", Value: msgID}}
+
+		finished := make(chan struct{})
+		go func() {
+			defer close(finished)
+			fn(ctx)
+		}()
+		// 等待生成输出一部分后再取消
+		time.Sleep(300 * time.Millisecond)
+		deadline := time.Now().Add(2 * time.Second)
+		for !cancel() {
+			if time.Now().After(deadline) {
+				t.Fatal("generation never became cancellable")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		<-finished
+		return w
+	}
+
+	interrupted := func(w *httptest.ResponseRecorder) models.Message {
+		t.Helper()
+		require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+		var response struct {
+			Error string `json:"error"`
+			Data  struct {
+				AssistantMessage models.Message `json:"assistantMessage"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "generation cancelled", response.Error)
+		var saved models.Message
+		require.NoError(t, db.First(&saved, "id = ?", response.Data.AssistantMessage.ID).Error)
+		assert.Equal(t, "interrupted", saved.Status)
+		assert.NotEmpty(t, saved.Content)
+		return saved
+	}
+
+	regenerated := interrupted(run(chatHandler.RegenerateMessage, "POST", "cancel-regen-a", `{}`))
+	assert.Equal(t, "cancel-regen-q", regenerated.ParentID)
+	edited := interrupted(run(chatHandler.UpdateMessage, "PUT", "cancel-regen-q", `{"content":"帮我写一篇营销文案","regenerate":true}`))
+	assert.NotEqual(t, "cancel-regen-q", edited.ParentID)
+	sent := interrupted(run(chatHandler.Chat, "POST", "", `{"content":"帮我写一篇营销文案"}`))
+	assert.NotEmpty(t, sent.ParentID)
+
+	var assistants int64
+	db.Model(&models.Message{}).Where("session_id = ? AND role = ?", session.ID, "assistant").Count(&assistants)
+	assert.Equal(t, int64(4), assistants, "each cancelled generation saves its partial reply")
+}
+
+func TestSearchSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := setupTestDB(t)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	chatHandler := handler.NewChatHandler(db, &config.Config{})
+
+	user := models.User{ID: "search-user", Email: "search@example.com", PasswordHash: "hashed"}
+	db.Create(&user)
+	db.Create(&models.ChatSession{ID: "search-a", UserID: user.ID, Title: "周报助手"})
+	db.Create(&models.ChatSession{ID: "search-b", UserID: user.ID, Title: "闲聊", ModelConfig: `{"isArchived":true}`})
+	db.Create(&models.Message{ID: "search-a1", SessionID: "search-a", Role: "user", Content: "帮我写一份项目周报"})
+	db.Create(&models.Message{ID: "search-a2", SessionID: "search-a", Role: "assistant", Content: "这是本周的项目周报草稿"})
+	db.Create(&models.Message{ID: "search-b1", SessionID: "search-b", Role: "user", Content: "上次的项目周报放哪了"})
+
+	search := func(body string) []map[string]interface{} {
+		req, _ := http.NewRequest("POST", "/api/v1/chat-sessions/search", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", user.ID)
+
+		chatHandler.SearchSessions(ctx)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data
+	}
+
+	results := search(`{"query":"项目周报"}`)
+	assert.Len(t, results, 2)
+
+	results = search(`{"query":"项目 周报","role":"assistant","archived":false}`)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "search-a", results[0]["id"])
+		assert.Equal(t, "<mark>周报</mark>助手", results[0]["highlightedTitle"])
+		matches := results[0]["matches"].([]interface{})
+		if assert.Len(t, matches, 1) {
+			match := matches[0].(map[string]interface{})
+			assert.Equal(t, "search-a2", match["messageId"])
+			assert.Contains(t, match["snippet"], "<mark>")
+		}
+	}
+
+	results = search(`{"query":"项目周报","archived":true}`)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "search-b", results[0]["id"])
+	}
+}
+
+func TestGetCitations(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	chatHandler := handler.NewChatHandler(db, &config.Config{})
+	doc := uploadDocument(t, db, docHandler, "cite-user", "handbook.md",
+		"# 员工手册\n\n总则说明。\n\n## 假期\n\n年假按工龄计算。\n")
+
+	result, err := retrieval.NewService(db, search.NewIndex(db), retrieval.Config{}).Search(context.Background(), retrieval.Request{
+		UserID: "cite-user",
+		Query:  "年假怎么算",
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Chunks, 1)
+	passages := []documentSvc.Passage{result.Chunks[0].Passage(1)}
+
+	session := models.ChatSession{ID: "cite-session", UserID: "cite-user", Title: "Cite"}
+	db.Create(&session)
+	question := models.Message{ID: "cite-question", SessionID: session.ID, Role: "user", Content: "年假怎么算"}
+	answer := models.Message{
+		ID:        "cite-answer",
+		SessionID: session.ID,
+		ParentID:  question.ID,
+		Role:      "assistant",
+		Content:   "年假按工龄计算[1]。",
+		Sources: models.ToJSON(map[string]interface{}{
+			"mode":    "chat",
+			"sources": []map[string]interface{}{passages[0].Source(), {"title": "外部来源", "url": "https://example.com"}},
+		}),
+	}
+	db.Create(&question)
+	db.Create(&answer)
+
+	get := func(userID string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/v1/chat/messages/"+answer.ID+"/citations", nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Params = gin.Params{{Key: "msgId", Value: answer.ID}}
+		ctx.Set("userId", userID)
+		chatHandler.GetCitations(ctx)
+		return w
+	}
+	citations := func() []handler.Citation {
+		w := get("cite-user")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Data struct {
+				Citations []handler.Citation `json:"citations"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data.Citations
+	}
+
+	got := citations()
+	require.Len(t, got, 1)
+	assert.Equal(t, 1, got[0].Marker)
+	assert.Equal(t, doc.ID, got[0].DocumentID)
+	assert.Equal(t, "handbook.md", got[0].DocumentName)
+	assert.Equal(t, "员工手册 > 假期", got[0].HeadingPath)
+	assert.Equal(t, "## 假期\n\n年假按工龄计算。", got[0].Passage)
+	assert.Contains(t, got[0].Highlighted, "<mark>年假</mark>")
+	assert.False(t, got[0].Stale)
+
+	// 重新分块后按偏移在新分块中定位
+	_, err = documentSvc.ReplaceChunks(db, doc.ID, []documentSvc.Chunk{
+		{Content: "# 员工手册\n\n总则说明。\n\n## 假期\n\n年假按工龄计算。", Start: 0, End: 30},
+	})
+	require.NoError(t, err)
+	got = citations()
+	require.Len(t, got, 1)
+	assert.NotEqual(t, passages[0].ChunkID, got[0].ChunkID)
+	assert.Equal(t, "## 假期\n\n年假按工龄计算。", got[0].Passage)
+
+	db.Where("document_id = ?", doc.ID).Delete(&models.DocumentChunk{})
+	got = citations()
+	require.Len(t, got, 1)
+	assert.True(t, got[0].Stale)
+	assert.Empty(t, got[0].Passage)
+
+	assert.Equal(t, http.StatusNotFound, get("other-user").Code)
+}
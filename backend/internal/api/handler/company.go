@@ -13,6 +13,7 @@ import (
 	"gorm.io/gorm"
 
 	"rolecraft-ai/internal/models"
+	documentSvc "rolecraft-ai/internal/service/document"
 )
 
 type CompanyHandler struct {
@@ -24,8 +25,9 @@ func NewCompanyHandler(db *gorm.DB) *CompanyHandler {
 }
 
 type CompanyRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
+	Name          string  `json:"name" binding:"required"`
+	Description   string  `json:"description"`
+	ChunkStrategy *string `json:"chunkStrategy"` // 公司文档的默认分块策略，不传时保持不变
 }
 
 type CompanyExportRequest struct {
@@ -417,6 +419,14 @@ func (h *CompanyHandler) Create(c *gin.Context) {
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
+	if req.ChunkStrategy != nil {
+		strategy, err := documentSvc.NormalizeChunkStrategy(*req.ChunkStrategy)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		company.ChunkStrategy = strategy
+	}
 
 	if err := h.db.Create(&company).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -647,6 +657,14 @@ func (h *CompanyHandler) Update(c *gin.Context) {
 
 	company.Name = req.Name
 	company.Description = req.Description
+	if req.ChunkStrategy != nil {
+		strategy, err := documentSvc.NormalizeChunkStrategy(*req.ChunkStrategy)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		company.ChunkStrategy = strategy
+	}
 	company.UpdatedAt = time.Now()
 
 	if err := h.db.Save(&company).Error; err != nil {
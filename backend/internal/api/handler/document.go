@@ -1,19 +1,18 @@
 package handler
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
 	"crypto/sha256"
-	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -25,6 +24,13 @@ import (
 
 	"rolecraft-ai/internal/models"
 	"rolecraft-ai/internal/service/anythingllm"
+	documentSvc "rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/ingest"
+	"rolecraft-ai/internal/service/retrieval"
+	"rolecraft-ai/internal/service/search"
+	"rolecraft-ai/internal/service/storage"
+	"rolecraft-ai/internal/service/upload"
+	"rolecraft-ai/internal/service/webimport"
 )
 
 // AnythingLLMConfig AnythingLLM 配置
@@ -37,20 +43,18 @@ type AnythingLLMConfig struct {
 // DocumentHandler 文档处理器
 type DocumentHandler struct {
 	db          *gorm.DB
-	uploadDir   string
+	blobs       storage.BlobStore
+	uploads     *upload.Manager
 	maxFileSize int64
 	config      AnythingLLMConfig
 	anything    *anythingllm.Orchestrator
+	retrieval   *retrieval.Service
+	ingest      *ingest.Queue
+	importer    *webimport.Importer
 }
 
-// NewDocumentHandler 创建文档处理器
+// NewDocumentHandler 创建文档处理器；后台任务（入库队列、网页刷新、过期上传清理）需调用 Start 启动
 func NewDocumentHandler(db *gorm.DB) *DocumentHandler {
-	uploadDir := os.Getenv("UPLOAD_DIR")
-	if uploadDir == "" {
-		uploadDir = "./uploads"
-	}
-	os.MkdirAll(uploadDir, 0755)
-
 	// AnythingLLM 配置
 	anythingBase := firstNonEmpty(os.Getenv("ANYTHINGLLM_BASE_URL"), os.Getenv("ANYTHINGLLM_URL"))
 	anythingKey := firstNonEmpty(os.Getenv("ANYTHINGLLM_API_KEY"), os.Getenv("ANYTHINGLLM_KEY"))
@@ -60,9 +64,10 @@ func NewDocumentHandler(db *gorm.DB) *DocumentHandler {
 		Workspace: os.Getenv("ANYTHINGLLM_WORKSPACE"),
 	}
 
-	return &DocumentHandler{
+	index := search.NewIndex(db)
+	h := &DocumentHandler{
 		db:          db,
-		uploadDir:   uploadDir,
+		blobs:       newBlobStore(),
 		maxFileSize: 50 * 1024 * 1024,
 		config:      config,
 		anything: anythingllm.NewOrchestrator(anythingBase, anythingKey, anythingllm.OrchestratorConfig{
@@ -71,7 +76,57 @@ func NewDocumentHandler(db *gorm.DB) *DocumentHandler {
 			OpenRouterKey:   os.Getenv("OPENROUTER_KEY"),
 			TavilyKey:       firstNonEmpty(os.Getenv("ANYTHINGLLM_TAVILY_API_KEY"), os.Getenv("TAVILY_API_KEY")),
 		}),
+		retrieval: retrieval.NewService(db, index, retrieval.DenseConfig(db, os.Getenv("OPENAI_API_KEY"))),
+	}
+
+	// 入库队列
+	deps := ingest.Dependencies{
+		Processor: documentSvc.NewProcessor(documentSvc.ProcessorConfig{}),
+		Retrieval: h.retrieval,
+		Index:     index,
+		Blobs:     h.blobs,
+	}
+	if h.anythingLLMEnabled() {
+		deps.Sync = h.syncToAnythingLLM
+	}
+	workers, _ := strconv.Atoi(os.Getenv("INGEST_WORKERS"))
+	h.ingest = ingest.NewQueue(db, deps, ingest.Config{Workers: workers})
+
+	// 网页导入与定期刷新；URL_IMPORT_ALLOW_PRIVATE=true 时允许抓取内网地址
+	h.importer = webimport.NewImporter(db, h.ingest, webimport.Config{
+		Blobs: h.blobs,
+		Fetcher: webimport.FetcherConfig{
+			MaxBytes:     h.maxFileSize,
+			AllowPrivate: os.Getenv("URL_IMPORT_ALLOW_PRIVATE") == "true",
+		},
+	})
+
+	// 大文件分片上传，过期未完成的会话由后台清理
+	h.uploads = upload.NewManager(db, h.blobs, upload.Config{})
+	return h
+}
+
+// Start 启动入库队列（恢复租约已过期的任务）、网页定期刷新与过期上传清理；ctx 结束时停止
+func (h *DocumentHandler) Start(ctx context.Context) {
+	h.ingest.Start(ctx)
+	h.importer.Start(ctx)
+	h.uploads.Start(ctx)
+}
+
+// Stop 停止后台任务并等待执行中的任务退出
+func (h *DocumentHandler) Stop() {
+	h.uploads.Stop()
+	h.importer.Stop()
+	h.ingest.Stop()
+}
+
+// newBlobStore 按环境变量创建上传文件存储，见 storage.FromEnv；配置错误时终止启动
+func newBlobStore() storage.BlobStore {
+	blobs, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to configure file storage: %v", err)
 	}
+	return blobs
 }
 
 func firstNonEmpty(values ...string) string {
@@ -138,51 +193,73 @@ var allowedTypes = map[string]bool{
 	".csv":  true,
 	".txt":  true,
 	".md":   true,
+	".zip":  true, // 上传时展开为文件夹与文档
+	".eml":  true,
+	".mbox": true, // 上传时拆分为单封邮件
 }
 
 // List 获取文档列表 (支持多条件过滤)
 func (h *DocumentHandler) List(c *gin.Context) {
 	userId, _ := c.Get("userId")
+	userIdStr, _ := userId.(string)
+
+	// 默认不含回收站中的文档，trashed=true 时只列出回收站中的文档；
+	// 其余条件为分面过滤，多个取值以逗号分隔，命中任一即可
+	scope := documentSvc.DocumentScope(h.db, userIdStr, c.Query("trashed") == "true")
+	filter := documentFilter(map[string]string{
+		"tags":     c.Query("tags"),
+		"type":     c.Query("type"),
+		"status":   c.Query("status"),
+		"folder":   c.Query("folder"),
+		"company":  c.Query("companyId"),
+		"work":     c.Query("workId"),
+		"dateFrom": c.Query("dateFrom"),
+		"dateTo":   c.Query("dateTo"),
+	})
 
 	var documents []models.Document
-	query := h.db.Where("user_id = ?", userId)
-
-	// 多条件过滤
-	if status := c.Query("status"); status != "" {
-		query = query.Where("status = ?", status)
+	query := filter.Apply(scope())
+	if result := query.Order("created_at DESC").Find(&documents); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
 	}
-
-	if fileType := c.Query("type"); fileType != "" {
-		query = query.Where("file_type = ?", fileType)
+	facets, err := documentSvc.ComputeFacets(h.db, scope, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	if folderID := c.Query("folder"); folderID != "" {
-		query = query.Where("folder_id = ?", folderID)
-	}
-	if companyID := c.Query("companyId"); companyID != "" {
-		query = query.Where("company_id = ?", companyID)
-	}
-	if workID := c.Query("workId"); workID != "" {
-		query = query.Where("work_id = ?", workID)
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    documents,
+		"facets":  facets,
+	})
+}
 
-	// 日期范围过滤
-	if dateFrom := c.Query("dateFrom"); dateFrom != "" {
-		query = query.Where("created_at >= ?", dateFrom)
+// ListTags 列出当前用户的全部标签及带有该标签的文档数
+func (h *DocumentHandler) ListTags(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
 	}
-	if dateTo := c.Query("dateTo"); dateTo != "" {
-		query = query.Where("created_at <= ?", dateTo)
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
 	}
 
-	if result := query.Order("created_at DESC").Find(&documents); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	tags, err := documentSvc.ListTags(h.db, userIdStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
-		"data":    documents,
+		"data":    tags,
 	})
 }
 
@@ -203,6 +280,14 @@ func (h *DocumentHandler) Upload(c *gin.Context) {
 	folderID := c.PostForm("folderId")
 	companyID := c.PostForm("companyId")
 	workID := c.PostForm("workId")
+	if folderID != "" && !h.activeFolderExists(userIdStr, folderID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "folder not found"})
+		return
+	}
+	if companyID != "" && !documentSvc.IsCompanyMember(h.db, userIdStr, companyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this company"})
+		return
+	}
 
 	// 支持多文件上传
 	form, err := c.MultipartForm()
@@ -224,8 +309,19 @@ func (h *DocumentHandler) Upload(c *gin.Context) {
 	}
 
 	var uploadedDocs []models.Document
+	var skipped []documentSvc.SkippedEntry
 
 	for _, fileHeader := range files {
+		// 压缩包与邮件展开为多个文档，未导入的条目随响应返回
+		if isExpandedType(strings.ToLower(filepath.Ext(fileHeader.Filename))) {
+			docs, entries, err := h.expandUpload(c.Request.Context(), fileHeader, userIdStr, folderID, companyID, workID)
+			uploadedDocs = append(uploadedDocs, docs...)
+			skipped = append(skipped, entries...)
+			if err != nil {
+				skipped = append(skipped, documentSvc.SkippedEntry{Path: fileHeader.Filename, Reason: err.Error()})
+			}
+			continue
+		}
 		doc, err := h.processSingleFile(fileHeader, userIdStr, folderID, companyID, workID)
 		if err != nil {
 			continue // 跳过失败的文件
@@ -234,24 +330,97 @@ func (h *DocumentHandler) Upload(c *gin.Context) {
 	}
 
 	if len(uploadedDocs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no files uploaded successfully"})
+		response := gin.H{"error": "no files uploaded successfully"}
+		if len(skipped) > 0 {
+			response["skipped"] = skipped
+		}
+		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
 	// 如果是单文件，返回单个对象；多文件返回数组
+	response := gin.H{
+		"code":    200,
+		"message": "documents uploaded and processing",
+		"data":    uploadedDocs,
+	}
 	if len(uploadedDocs) == 1 {
-		c.JSON(http.StatusCreated, gin.H{
-			"code":    200,
-			"message": "document uploaded and processing",
-			"data":    uploadedDocs[0],
-		})
-	} else {
-		c.JSON(http.StatusCreated, gin.H{
-			"code":    200,
-			"message": "documents uploaded and processing",
-			"data":    uploadedDocs,
-		})
+		response["message"] = "document uploaded and processing"
+		response["data"] = uploadedDocs[0]
+	}
+	if len(skipped) > 0 {
+		response["skipped"] = skipped
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// ImportURL 导入网页（或 sitemap 中的全部页面）：提取正文转为 Markdown 文档后进入入库队列；
+// refreshInterval（分钟）大于 0 时定期重新抓取，内容变化时生成新版本
+func (h *DocumentHandler) ImportURL(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req struct {
+		URL             string `json:"url" binding:"required"`
+		FolderID        string `json:"folderId"`
+		CompanyID       string `json:"companyId"`
+		WorkID          string `json:"workId"`
+		RefreshInterval int    `json:"refreshInterval"` // 分钟，0 表示不自动刷新
+		Sitemap         bool   `json:"sitemap"`         // 强制按 sitemap 解析
+		MaxPages        int    `json:"maxPages"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RefreshInterval < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refreshInterval must not be negative"})
+		return
+	}
+	if req.FolderID != "" && !h.activeFolderExists(userIdStr, req.FolderID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "folder not found"})
+		return
+	}
+	if req.CompanyID != "" && !documentSvc.IsCompanyMember(h.db, userIdStr, req.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this company"})
+		return
+	}
+
+	result, err := h.importer.Import(c.Request.Context(), webimport.Request{
+		URL:             req.URL,
+		UserID:          userIdStr,
+		CompanyID:       req.CompanyID,
+		WorkID:          req.WorkID,
+		FolderID:        req.FolderID,
+		RefreshInterval: req.RefreshInterval,
+		Sitemap:         req.Sitemap,
+		MaxPages:        req.MaxPages,
+	})
+	if err != nil {
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, webimport.ErrInvalidURL), errors.Is(err, webimport.ErrBlockedAddress):
+			status = http.StatusBadRequest
+		case errors.Is(err, webimport.ErrUnsupportedContent), errors.Is(err, webimport.ErrNoContent), errors.Is(err, webimport.ErrTooLarge):
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
 	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    200,
+		"message": "url imported and processing",
+		"data":    result,
+	})
 }
 
 // processSingleFile 处理单个文件上传
@@ -271,141 +440,180 @@ func (h *DocumentHandler) processSingleFile(fileHeader *multipart.FileHeader, us
 		return nil, fmt.Errorf("file type not allowed")
 	}
 
-	// 生成临时文件 ID
+	// 生成文件 ID，原文件保留在文件存储中，供重新处理和版本恢复使用；写入时同步计算内容哈希
+	ctx := context.Background()
 	fileId := models.NewUUID()
-	fileName := fileId + ext
-	tempFilePath := filepath.Join(h.uploadDir, "temp_"+fileName)
+	filePath := fileId + ext
 
-	// 临时保存到本地
-	dst, err := os.Create(tempFilePath)
-	if err != nil {
+	hasher := sha256.New()
+	if err := h.blobs.Put(ctx, filePath, io.TeeReader(file, hasher), fileHeader.Size, fileHeader.Header.Get("Content-Type")); err != nil {
 		return nil, err
 	}
-	defer dst.Close()
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
 
-	if _, err := io.Copy(dst, file); err != nil {
-		os.Remove(tempFilePath)
-		return nil, err
+	return h.registerFile(ctx, fileId, filePath, fileHeader.Filename, fileHeader.Size, contentHash, userIdStr, folderID, companyID, workID, fileAttributes{})
+}
+
+// fileAttributes 登记文档时附加的属性
+type fileAttributes struct {
+	ParentID string                 // 所属的父文档，如附件所在的邮件
+	Metadata map[string]interface{} // 合并到文档元数据的字段
+}
+
+// registerFile 把已写入文件存储的文件登记为文档：内容重复时删除文件并返回已有文档，
+// 同一文件夹下的同名文件追加为新版本，否则创建文档；随后加入入库队列
+func (h *DocumentHandler) registerFile(ctx context.Context, fileId, filePath, fileName string, fileSize int64, contentHash, userIdStr, folderID, companyID, workID string, attrs fileAttributes) (*models.Document, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+
+	// 上传者自己在同一归属（个人或同一公司）下内容相同的文件直接返回已有文档；
+	// 不复用其他用户的文档，否则上传者拿到的是自己无法查看的文档
+	var existing models.Document
+	if err := h.db.Where("content_hash = ? AND user_id = ? AND COALESCE(company_id, '') = ? AND trashed_at IS NULL", contentHash, userIdStr, companyID).
+		Order("created_at ASC").First(&existing).Error; err == nil {
+		h.blobs.Delete(ctx, filePath)
+		existing.Duplicate = true
+		return &existing, nil
+	}
+
+	// 同一文件夹下归属相同（公司、作品）的同名文件作为已有文档的新版本
+	var current models.Document
+	if err := h.db.Where("user_id = ? AND folder_id = ? AND name = ? AND COALESCE(company_id, '') = ? AND COALESCE(work_id, '') = ? AND trashed_at IS NULL",
+		userIdStr, folderID, fileName, companyID, workID).
+		Order("created_at ASC").First(&current).Error; err == nil {
+		if _, err := documentSvc.AddVersion(h.db, &current, models.DocumentVersion{
+			Name:        fileName,
+			FileType:    ext[1:],
+			FileSize:    fileSize,
+			FilePath:    filePath,
+			ContentHash: contentHash,
+			CreatedBy:   userIdStr,
+		}); err != nil {
+			h.blobs.Delete(ctx, filePath)
+			return nil, err
+		}
+		if attrs.ParentID != "" || len(attrs.Metadata) > 0 {
+			updates := map[string]interface{}{"metadata": mergeMetadata(current.Metadata, attrs.Metadata)}
+			if attrs.ParentID != "" {
+				updates["parent_id"] = attrs.ParentID
+			}
+			if err := h.db.Model(&current).UpdateColumns(updates).Error; err != nil {
+				log.Printf("failed to update attributes of document %s: %v", current.ID, err)
+			}
+		}
+		if _, err := h.ingest.Restart(current.ID, current.UserID); err != nil {
+			log.Printf("failed to enqueue document %s: %v", current.ID, err)
+		}
+		current.Status = "processing"
+		return &current, nil
 	}
 
 	// 创建文档记录
 	document := models.Document{
-		ID:        fileId,
-		UserID:    userIdStr,
-		CompanyID: companyID,
-		WorkID:    workID,
-		Name:      fileHeader.Filename,
-		FileType:  ext[1:],
-		FilePath:  tempFilePath,
-		FileSize:  fileHeader.Size,
-		Status:    "processing",
-		FolderID:  folderID,
-		CreatedAt: time.Now(),
+		ID:          fileId,
+		UserID:      userIdStr,
+		CompanyID:   companyID,
+		WorkID:      workID,
+		Name:        fileName,
+		FileType:    ext[1:],
+		FilePath:    filePath,
+		FileSize:    fileSize,
+		ContentHash: contentHash,
+		Version:     1,
+		Status:      "processing",
+		FolderID:    folderID,
+		ParentID:    attrs.ParentID,
+		CreatedAt:   time.Now(),
+	}
+	if len(attrs.Metadata) > 0 {
+		document.Metadata = mergeMetadata("", attrs.Metadata)
 	}
 
 	if result := h.db.Create(&document); result.Error != nil {
-		os.Remove(tempFilePath)
+		h.blobs.Delete(ctx, filePath)
 		return nil, result.Error
 	}
+	if err := documentSvc.EnsureInitialVersion(h.db, &document); err != nil {
+		log.Printf("failed to record initial version of document %s: %v", document.ID, err)
+	}
 
-	// 异步处理文档上传到 AnythingLLM
-	go h.processDocumentAsync(document.ID, tempFilePath, userIdStr)
+	// 加入入库队列，由后台 worker 依次执行解析、分块、向量化、索引与同步
+	if _, err := h.ingest.Enqueue(document.ID, userIdStr); err != nil {
+		log.Printf("failed to enqueue document %s: %v", document.ID, err)
+	}
 
 	return &document, nil
 }
 
-// processDocumentAsync 异步处理文档上传到 AnythingLLM
-func (h *DocumentHandler) processDocumentAsync(docId, tempFilePath, userId string) {
-	if !h.anythingLLMEnabled() {
-		targetPath := filepath.Join(h.uploadDir, docId+filepath.Ext(tempFilePath))
-		finalPath := tempFilePath
-		if err := os.Rename(tempFilePath, targetPath); err == nil {
-			finalPath = targetPath
-		}
-		h.updateDocumentStatusWithMetadata(docId, "completed", finalPath, map[string]interface{}{
-			"processingMode": "local",
-		})
-		return
+// mergeMetadata 把字段合并到已有的文档元数据
+func mergeMetadata(metadata models.JSON, values map[string]interface{}) models.JSON {
+	merged := map[string]interface{}{}
+	if metadata != "" {
+		json.Unmarshal([]byte(metadata), &merged)
+	}
+	if merged == nil {
+		merged = map[string]interface{}{}
 	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return models.ToJSON(merged)
+}
 
-	// 1. 上传到 AnythingLLM
-	anythingLLMFileId, hash, err := h.uploadToAnythingLLM(tempFilePath, userId)
-	if err != nil {
-		h.updateDocumentStatus(docId, "failed", err.Error())
-		os.Remove(tempFilePath)
-		return
+// syncToAnythingLLM 入库同步阶段：上传文档到 AnythingLLM 并更新工作空间 embeddings
+func (h *DocumentHandler) syncToAnythingLLM(ctx context.Context, doc models.Document) (map[string]interface{}, error) {
+	// 重新处理时先移除之前同步的文件，避免工作空间中出现重复文档
+	var metadata map[string]interface{}
+	if doc.Metadata != "" {
+		json.Unmarshal([]byte(doc.Metadata), &metadata)
+	}
+	if previous, ok := metadata["anythingLLMFileId"].(string); ok && previous != "" {
+		if err := h.deleteFromAnythingLLM(previous, doc.UserID); err != nil {
+			log.Printf("failed to remove previous anythingllm document %s: %v", previous, err)
+		}
 	}
 
-	// 2. 等待处理完成并更新 embeddings
-	err = h.updateEmbeddings(userId)
+	fileBytes, err := storage.ReadAll(ctx, h.blobs, doc.FilePath)
 	if err != nil {
-		h.updateDocumentStatus(docId, "failed", "embedding update failed: "+err.Error())
-		os.Remove(tempFilePath)
-		return
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
-
-	// 3. 更新文档状态为 completed
-	finalFilePath := filepath.Join(h.uploadDir, docId+filepath.Ext(tempFilePath))
-	err = os.Rename(tempFilePath, finalFilePath)
+	anythingLLMFileId, err := h.uploadToAnythingLLM(path.Base(doc.FilePath), fileBytes, doc.UserID)
 	if err != nil {
-		h.updateDocumentStatusWithMetadata(docId, "completed", "", map[string]interface{}{
-			"anythingLLMFileId": anythingLLMFileId,
-			"anythingLLMHash":   hash,
-		})
-		return
+		return nil, err
 	}
-
-	h.updateDocumentStatusWithMetadata(docId, "completed", finalFilePath, map[string]interface{}{
+	hash := doc.ContentHash
+	if hash == "" {
+		sum := sha256.Sum256(fileBytes)
+		hash = hex.EncodeToString(sum[:])
+	}
+	if err := h.updateEmbeddings(doc.UserID); err != nil {
+		return nil, fmt.Errorf("embedding update failed: %w", err)
+	}
+	return map[string]interface{}{
+		"processingMode":    "anythingllm",
 		"anythingLLMFileId": anythingLLMFileId,
 		"anythingLLMHash":   hash,
-	})
+	}, nil
 }
 
-// uploadToAnythingLLM 上传文档到 AnythingLLM
-func (h *DocumentHandler) uploadToAnythingLLM(filePath, userId string) (string, string, error) {
+// uploadToAnythingLLM 上传文档到 AnythingLLM，返回其文件 ID
+func (h *DocumentHandler) uploadToAnythingLLM(fileName string, fileBytes []byte, userId string) (string, error) {
 	if !h.anythingLLMEnabled() {
-		return "", "", fmt.Errorf("anythingllm is not configured")
-	}
-	fileBytes, err := os.ReadFile(filePath)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to read file: %w", err)
+		return "", fmt.Errorf("anythingllm is not configured")
 	}
 
 	workspaceSlug := h.resolveWorkspaceSlug(userId)
 	if strings.TrimSpace(workspaceSlug) == "" {
-		return "", "", fmt.Errorf("failed to resolve workspace slug")
-	}
-
-	fileId, err := h.anything.UploadDocumentToWorkspace(context.Background(), workspaceSlug, filepath.Base(filePath), fileBytes)
-	if err != nil {
-		return "", "", err
-	}
-	if strings.TrimSpace(fileId) == "" {
-		fileId = filepath.Base(filePath)
-	}
-
-	hash, err := h.calculateFileHash(filePath)
-	if err != nil {
-		hash = ""
+		return "", fmt.Errorf("failed to resolve workspace slug")
 	}
 
-	return fileId, hash, nil
-}
-
-// calculateFileHash 计算文件 SHA256 hash
-func (h *DocumentHandler) calculateFileHash(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+	fileId, err := h.anything.UploadDocumentToWorkspace(context.Background(), workspaceSlug, fileName, fileBytes)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
+	if strings.TrimSpace(fileId) == "" {
+		fileId = fileName
 	}
-
-	return hex.EncodeToString(hash.Sum(nil)), nil
+	return fileId, nil
 }
 
 // updateEmbeddings 更新 AnythingLLM 工作空间的 embeddings
@@ -420,48 +628,7 @@ func (h *DocumentHandler) updateEmbeddings(workspace string) error {
 	return h.anything.UpdateEmbeddings(context.Background(), workspaceSlug, nil, nil)
 }
 
-// updateDocumentStatus 更新文档状态
-func (h *DocumentHandler) updateDocumentStatus(docId, status, errorMessage string) {
-	h.db.Model(&models.Document{}).Where("id = ?", docId).Updates(map[string]interface{}{
-		"status":        status,
-		"error_message": errorMessage,
-		"updated_at":    time.Now(),
-	})
-}
-
-// updateDocumentStatusWithMetadata 更新文档状态和元数据
-func (h *DocumentHandler) updateDocumentStatusWithMetadata(docId, status, filePath string, metadata map[string]interface{}) {
-	updateData := map[string]interface{}{
-		"status":     status,
-		"updated_at": time.Now(),
-	}
-
-	if filePath != "" {
-		updateData["file_path"] = filePath
-	}
-
-	if metadata != nil {
-		var doc models.Document
-		if err := h.db.Where("id = ?", docId).First(&doc).Error; err == nil {
-			var existingMetadata map[string]interface{}
-			if doc.Metadata != "" {
-				json.Unmarshal([]byte(doc.Metadata), &existingMetadata)
-			}
-			if existingMetadata == nil {
-				existingMetadata = make(map[string]interface{})
-			}
-			for k, v := range metadata {
-				existingMetadata[k] = v
-			}
-			data, _ := json.Marshal(existingMetadata)
-			updateData["metadata"] = models.JSON(data)
-		}
-	}
-
-	h.db.Model(&models.Document{}).Where("id = ?", docId).Updates(updateData)
-}
-
-// Search 高级搜索 (支持多条件、高亮、排序)
+// Search 高级搜索：关键词与向量混合检索分块并按文档分组（支持过滤、高亮、排序）
 func (h *DocumentHandler) Search(c *gin.Context) {
 	userId, exists := c.Get("userId")
 	if !exists {
@@ -476,9 +643,9 @@ func (h *DocumentHandler) Search(c *gin.Context) {
 
 	var req struct {
 		Query     string            `json:"query"`
-		TopN      int               `json:"topN"`
-		Filters   map[string]string `json:"filters"`
-		SortBy    string            `json:"sortBy"`
+		TopN      int               `json:"topN"`    // 返回的文档数上限
+		Filters   map[string]string `json:"filters"` // tags/type/status/folder/company/work（逗号分隔多个取值）与 dateFrom/dateTo
+		SortBy    string            `json:"sortBy"`  // relevance/name/size/created
 		SortOrder string            `json:"sortOrder"`
 	}
 
@@ -488,112 +655,137 @@ func (h *DocumentHandler) Search(c *gin.Context) {
 	}
 
 	startTime := time.Now()
+	query := strings.TrimSpace(req.Query)
+	filter := documentFilter(req.Filters)
+	scope := documentSvc.DocumentScope(h.db, userIdStr, false)
 
-	// 1. 向量搜索 (如果有查询)
-	var vectorResults []interface{}
-	if req.Query != "" {
-		results, err := h.vectorSearch(req.Query, req.TopN, userIdStr)
+	// 1. 无查询词时按过滤条件列出文档
+	if query == "" {
+		var documents []models.Document
+		if err := filter.Apply(scope()).Order("created_at DESC").Find(&documents).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		facets, err := documentSvc.ComputeFacets(h.db, scope, filter)
 		if err != nil {
-			// 向量搜索失败，降级到文本搜索
-			vectorResults = nil
-		} else {
-			vectorResults = results
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		sortDocuments(documents, req.SortBy, req.SortOrder)
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "success",
+			"data": gin.H{
+				"query":         req.Query,
+				"documents":     h.highlightResults(documents, "", nil),
+				"total":         len(documents),
+				"facets":        facets,
+				"searchTimeMs":  time.Since(startTime).Milliseconds(),
+				"keywordHits":   0,
+				"vectorResults": 0,
+			},
+		})
+		return
 	}
 
-	// 2. 数据库搜索
-	var documents []models.Document
-	query := h.db.Where("user_id = ?", userIdStr)
-
-	// 应用过滤器
-	if req.Filters != nil {
-		if fileType, ok := req.Filters["type"]; ok && fileType != "" {
-			query = query.Where("file_type = ?", fileType)
-		}
-		if status, ok := req.Filters["status"]; ok && status != "" {
-			query = query.Where("status = ?", status)
-		}
-		if folderID, ok := req.Filters["folder"]; ok && folderID != "" {
-			query = query.Where("folder_id = ?", folderID)
-		}
+	// 2. 混合检索分块；分面过滤在命中的文档上进行，使分面计数覆盖全部命中文档
+	result, err := h.retrieval.Search(c.Request.Context(), retrieval.Request{
+		UserID: userIdStr,
+		Query:  query,
+		Limit:  100,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// 文本搜索
-	if req.Query != "" {
-		query = query.Where("name LIKE ?", "%"+req.Query+"%")
+	// 3. 按文档分组的顺序读取满足过滤条件的文档
+	groups := make(map[string]retrieval.DocumentHits, len(result.Documents))
+	ids := make([]string, 0, len(result.Documents))
+	for _, group := range result.Documents {
+		groups[group.DocumentID] = group
+		ids = append(ids, group.DocumentID)
 	}
-
-	// 排序
-	switch req.SortBy {
-	case "name":
-		if req.SortOrder == "asc" {
-			query = query.Order("name ASC")
-		} else {
-			query = query.Order("name DESC")
-		}
-	case "size":
-		if req.SortOrder == "asc" {
-			query = query.Order("file_size ASC")
-		} else {
-			query = query.Order("file_size DESC")
-		}
-	case "relevance":
-		// 相关度排序在内存中处理
-	default:
-		query = query.Order("created_at DESC")
+	hits := func() *gorm.DB { return scope().Where("id IN ?", ids) }
+	var found []models.Document
+	if err := filter.Apply(hits()).Find(&found).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-
-	if result := query.Find(&documents); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	facets, err := documentSvc.ComputeFacets(h.db, hits, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	// 3. 计算相似度分数 (如果有向量搜索结果)
-	if vectorResults != nil && len(vectorResults) > 0 {
-		docMap := make(map[string]*models.Document)
-		for i := range documents {
-			docMap[documents[i].ID] = &documents[i]
-		}
-
-		// 为匹配的文档添加相似度分数
-		for _, vr := range vectorResults {
-			if vrMap, ok := vr.(map[string]interface{}); ok {
-				if id, ok := vrMap["id"].(string); ok {
-					if doc, exists := docMap[id]; exists {
-						if score, ok := vrMap["score"].(float64); ok {
-							doc.Similarity = score
-						}
-					}
-				}
-			}
-		}
-
-		// 按相关度排序
-		if req.SortBy == "relevance" {
-			sortByRelevance(documents)
+	byID := make(map[string]models.Document, len(found))
+	for _, doc := range found {
+		byID[doc.ID] = doc
+	}
+	documents := make([]models.Document, 0, len(found))
+	for _, id := range ids {
+		if doc, ok := byID[id]; ok {
+			doc.Similarity = groups[id].Score
+			documents = append(documents, doc)
 		}
 	}
-
-	// 4. 高亮搜索结果
-	highlightedDocs := h.highlightResults(documents, req.Query)
-
-	elapsed := time.Since(startTime)
+	if req.TopN > 0 && len(documents) > req.TopN {
+		documents = documents[:req.TopN]
+	}
+	sortDocuments(documents, req.SortBy, req.SortOrder)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
 			"query":         req.Query,
-			"documents":     highlightedDocs,
+			"documents":     h.highlightResults(documents, query, groups),
 			"total":         len(documents),
-			"searchTimeMs":  elapsed.Milliseconds(),
-			"vectorResults": len(vectorResults),
+			"facets":        facets,
+			"searchTimeMs":  time.Since(startTime).Milliseconds(),
+			"keywordHits":   result.KeywordHits,
+			"vectorResults": result.VectorHits,
 		},
 	})
 }
 
-// highlightResults 高亮搜索结果
-func (h *DocumentHandler) highlightResults(docs []models.Document, query string) []map[string]interface{} {
+// documentFilter 把逗号分隔的过滤参数（tags/type/status/folder/company/work）与日期范围转为分面过滤条件
+func documentFilter(raw map[string]string) documentSvc.Filter {
+	return documentSvc.Filter{
+		Tags:       documentSvc.SplitValues(raw["tags"]),
+		FileTypes:  documentSvc.SplitValues(raw["type"]),
+		Statuses:   documentSvc.SplitValues(raw["status"]),
+		FolderIDs:  documentSvc.SplitValues(raw["folder"]),
+		CompanyIDs: documentSvc.SplitValues(raw["company"]),
+		WorkIDs:    documentSvc.SplitValues(raw["work"]),
+		DateFrom:   strings.TrimSpace(raw["dateFrom"]),
+		DateTo:     strings.TrimSpace(raw["dateTo"]),
+	}
+}
+
+// sortDocuments 按名称 / 大小 / 创建时间排序；relevance 或未指定时保持原有顺序
+func sortDocuments(docs []models.Document, sortBy, sortOrder string) {
+	asc := sortOrder == "asc"
+	var less func(a, b models.Document) bool
+	switch sortBy {
+	case "name":
+		less = func(a, b models.Document) bool { return a.Name < b.Name }
+	case "size":
+		less = func(a, b models.Document) bool { return a.FileSize < b.FileSize }
+	case "created":
+		less = func(a, b models.Document) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	default:
+		return
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		if asc {
+			return less(docs[i], docs[j])
+		}
+		return less(docs[j], docs[i])
+	})
+}
+
+// highlightResults 高亮搜索结果，附带命中的分块
+func (h *DocumentHandler) highlightResults(docs []models.Document, query string, groups map[string]retrieval.DocumentHits) []map[string]interface{} {
 	result := make([]map[string]interface{}, len(docs))
 
 	for i, doc := range docs {
@@ -609,9 +801,14 @@ func (h *DocumentHandler) highlightResults(docs []models.Document, query string)
 			"similarity": doc.Similarity,
 		}
 
-		// 添加高亮名称
+		// 添加高亮名称、最佳分块片段与命中分块（高亮字段均为已转义的 HTML 片段）
 		if query != "" {
-			docMap["highlightedName"] = h.highlightText(doc.Name, query)
+			docMap["highlightedName"] = search.Highlight(doc.Name, documentSvc.QueryTerms(query))
+			if group, ok := groups[doc.ID]; ok && len(group.Chunks) > 0 {
+				docMap["snippet"] = group.Chunks[0].Snippet
+				docMap["textScore"] = group.Chunks[0].KeywordScore
+				docMap["chunks"] = group.Chunks
+			}
 		}
 
 		result[i] = docMap
@@ -620,27 +817,6 @@ func (h *DocumentHandler) highlightResults(docs []models.Document, query string)
 	return result
 }
 
-// highlightText 高亮文本中的关键词
-func (h *DocumentHandler) highlightText(text, query string) string {
-	if query == "" {
-		return text
-	}
-
-	// 简单的高亮标记 (前端会渲染)
-	return strings.ReplaceAll(text, query, "<mark>"+query+"</mark>")
-}
-
-// sortByRelevance 按相关度排序
-func sortByRelevance(docs []models.Document) {
-	for i := 0; i < len(docs)-1; i++ {
-		for j := i + 1; j < len(docs); j++ {
-			if docs[i].Similarity < docs[j].Similarity {
-				docs[i], docs[j] = docs[j], docs[i]
-			}
-		}
-	}
-}
-
 // Get 获取文档详情
 func (h *DocumentHandler) Get(c *gin.Context) {
 	userId, exists := c.Get("userId")
@@ -711,8 +887,8 @@ func (h *DocumentHandler) Update(c *gin.Context) {
 		updateData["folder_id"] = req.FolderID
 	}
 
-	// 更新元数据 (标签、描述等)
-	if req.Description != "" || len(req.Tags) > 0 {
+	// 更新元数据 (描述等)
+	if req.Description != "" {
 		var metadata map[string]interface{}
 		if document.Metadata != "" {
 			json.Unmarshal([]byte(document.Metadata), &metadata)
@@ -721,15 +897,11 @@ func (h *DocumentHandler) Update(c *gin.Context) {
 			metadata = make(map[string]interface{})
 		}
 
-		if req.Description != "" {
-			metadata["description"] = req.Description
-		}
-		if len(req.Tags) > 0 {
-			metadata["tags"] = req.Tags
-		}
+		metadata["description"] = req.Description
 
 		data, _ := json.Marshal(metadata)
 		updateData["metadata"] = models.JSON(data)
+		document.Metadata = models.JSON(data)
 	}
 
 	updateData["updated_at"] = time.Now()
@@ -739,6 +911,14 @@ func (h *DocumentHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// 标签同时写入 DocumentTag，供标签列表与过滤使用
+	if len(req.Tags) > 0 {
+		if err := documentSvc.SetTags(h.db, &document, req.Tags); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// 重新加载文档
 	h.db.First(&document, docId)
 
@@ -770,21 +950,43 @@ func (h *DocumentHandler) GetStatus(c *gin.Context) {
 		return
 	}
 
+	job, err := h.ingest.LatestJob(document.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := gin.H{
+		"id":        document.ID,
+		"status":    document.Status,
+		"progress":  calculateProgress(document, job),
+		"message":   getStatusMessage(document, job),
+		"updatedAt": document.UpdatedAt,
+	}
+	if job != nil {
+		data["job"] = gin.H{
+			"id":          job.ID,
+			"status":      job.Status,
+			"stage":       job.Stage,
+			"stages":      ingest.Stages(job),
+			"attempts":    job.Attempts,
+			"maxAttempts": job.MaxAttempts,
+			"lastError":   job.LastError,
+			"nextRunAt":   job.NextRunAt,
+			"startedAt":   job.StartedAt,
+			"finishedAt":  job.FinishedAt,
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
-		"data": gin.H{
-			"id":        document.ID,
-			"status":    document.Status,
-			"progress":  calculateProgress(document.Status),
-			"message":   getStatusMessage(document),
-			"updatedAt": document.UpdatedAt,
-		},
+		"data":    data,
 	})
 }
 
-// Delete 删除文档
-func (h *DocumentHandler) Delete(c *gin.Context) {
+// Reprocess 重新执行文档的入库流程（解析、分块、向量化、索引与同步）
+func (h *DocumentHandler) Reprocess(c *gin.Context) {
 	userId, exists := c.Get("userId")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
@@ -803,25 +1005,440 @@ func (h *DocumentHandler) Delete(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
 		return
 	}
-
-	// 1. 从 AnythingLLM 删除文档
-	var metadata map[string]interface{}
-	if document.Metadata != "" {
-		json.Unmarshal([]byte(document.Metadata), &metadata)
+	if document.FilePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "document file is missing"})
+		return
 	}
 
-	if anythingLLMFileId, ok := metadata["anythingLLMFileId"].(string); ok {
-		h.deleteFromAnythingLLM(anythingLLMFileId, userIdStr)
+	job, err := h.ingest.Enqueue(document.ID, userIdStr)
+	if errors.Is(err, ingest.ErrJobActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "document is already being processed"})
+		return
 	}
-
-	// 2. 删除本地文件
-	if document.FilePath != "" {
-		os.Remove(document.FilePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// 3. 删除数据库记录
-	if result := h.db.Delete(&document); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    200,
+		"message": "document reprocessing",
+		"data":    job,
+	})
+}
+
+// Rechunk 按当前生效的分块策略重新分块选中的文档（只重新分块与向量化，不重新同步）
+//
+// 可按 ids、folderId（含子文件夹）、companyId 选择文档，均不传时为全部已完成的文档；
+// strategy 只处理现有分块由该策略生成的文档，outdated=true 只处理现有分块策略与当前配置不一致的文档。
+// 已在处理中的文档跳过。
+func (h *DocumentHandler) Rechunk(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req struct {
+		IDs       []string `json:"ids"`
+		FolderID  string   `json:"folderId"`
+		CompanyID string   `json:"companyId"`
+		Strategy  string   `json:"strategy"`
+		Outdated  bool     `json:"outdated"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Strategy != "" {
+		strategy, err := documentSvc.NormalizeChunkStrategy(req.Strategy)
+		if err != nil || strategy == documentSvc.ChunkAuto {
+			c.JSON(http.StatusBadRequest, gin.H{"error": documentSvc.ErrUnknownChunkStrategy.Error()})
+			return
+		}
+		req.Strategy = strategy
+	}
+
+	query := h.db.Where("user_id = ? AND trashed_at IS NULL AND status = ? AND file_path <> ''", userIdStr, "completed")
+	if len(req.IDs) > 0 {
+		query = query.Where("id IN ?", req.IDs)
+	}
+	if req.FolderID != "" {
+		folders, err := documentSvc.FolderSubtree(h.db, userIdStr, req.FolderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("folder_id IN ?", folders)
+	}
+	if req.CompanyID != "" {
+		query = query.Where("company_id = ?", req.CompanyID)
+	}
+	var docs []models.Document
+	if err := query.Find(&docs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Strategy != "" || req.Outdated {
+		filtered, err := h.filterByChunkStrategy(docs, req.Strategy, req.Outdated)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		docs = filtered
+	}
+
+	queued, skipped := []string{}, []string{}
+	for _, doc := range docs {
+		if _, err := h.ingest.Rechunk(doc.ID, userIdStr); err != nil {
+			if !errors.Is(err, ingest.ErrJobActive) {
+				log.Printf("failed to rechunk document %s: %v", doc.ID, err)
+			}
+			skipped = append(skipped, doc.ID)
+			continue
+		}
+		queued = append(queued, doc.ID)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    200,
+		"message": "documents rechunking",
+		"data": gin.H{
+			"queued":  queued,
+			"skipped": skipped,
+		},
+	})
+}
+
+// filterByChunkStrategy 按现有分块的策略筛选文档；没有分块的文档不参与比较。
+// 早于分块策略记录的分块由 markdown 策略生成
+func (h *DocumentHandler) filterByChunkStrategy(docs []models.Document, strategy string, outdated bool) ([]models.Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	var rows []struct {
+		DocumentID string
+		Strategy   string
+	}
+	if err := h.db.Model(&models.DocumentChunk{}).
+		Select("document_id, MAX(strategy) AS strategy").
+		Where("document_id IN ?", ids).
+		Group("document_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	current := make(map[string]string, len(rows))
+	for _, row := range rows {
+		if row.Strategy == "" {
+			row.Strategy = documentSvc.ChunkMarkdown
+		}
+		current[row.DocumentID] = row.Strategy
+	}
+
+	var resolved map[string]string
+	if outdated {
+		var err error
+		if resolved, err = documentSvc.ResolveChunkStrategies(h.db, docs); err != nil {
+			return nil, err
+		}
+	}
+
+	var kept []models.Document
+	for _, doc := range docs {
+		used, ok := current[doc.ID]
+		if !ok || (strategy != "" && used != strategy) || (outdated && used == resolved[doc.ID]) {
+			continue
+		}
+		kept = append(kept, doc)
+	}
+	return kept, nil
+}
+
+// Chunks 获取文档分块及其位置信息（按序号排列，支持 offset / limit 分页）
+func (h *DocumentHandler) Chunks(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	docId := c.Param("id")
+
+	var document models.Document
+	if result := h.db.Where("id = ? AND user_id = ?", docId, userIdStr).First(&document); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+
+	offset, limit := 0, 100
+	if raw := strings.TrimSpace(c.Query("offset")); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value >= 0 {
+			offset = value
+		}
+	}
+	if raw := strings.TrimSpace(c.Query("limit")); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 && value <= 500 {
+			limit = value
+		}
+	}
+
+	var total int64
+	h.db.Model(&models.DocumentChunk{}).Where("document_id = ?", docId).Count(&total)
+
+	var chunks []models.DocumentChunk
+	if err := h.db.Where("document_id = ?", docId).
+		Order("ordinal ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&chunks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"documentId": docId,
+			"total":      total,
+			"offset":     offset,
+			"limit":      limit,
+			"chunks":     chunks,
+		},
+	})
+}
+
+// ListVersions 获取文档的版本历史（按版本号倒序）
+func (h *DocumentHandler) ListVersions(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	docId := c.Param("id")
+
+	var document models.Document
+	if result := h.db.Where("id = ? AND user_id = ?", docId, userIdStr).First(&document); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+	if err := documentSvc.EnsureInitialVersion(h.db, &document); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	versions, err := documentSvc.ListVersions(h.db, document.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"documentId":     document.ID,
+			"currentVersion": document.Version,
+			"versions":       versions,
+		},
+	})
+}
+
+// DiffVersions 比较两个版本的提取文本（from 默认为当前版本的上一版本，to 默认为当前版本）
+func (h *DocumentHandler) DiffVersions(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	docId := c.Param("id")
+
+	var document models.Document
+	if result := h.db.Where("id = ? AND user_id = ?", docId, userIdStr).First(&document); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+
+	to := document.Version
+	if raw := strings.TrimSpace(c.Query("to")); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+		to = value
+	}
+	from := to - 1
+	if raw := strings.TrimSpace(c.Query("from")); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+		from = value
+	}
+
+	var versions [2]*models.DocumentVersion
+	var texts [2]string
+	for i, number := range []int{from, to} {
+		version, err := documentSvc.GetVersion(h.db, document.ID, number)
+		if errors.Is(err, documentSvc.ErrVersionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("version %d not found", number)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		text, err := extractDocumentText(c.Request.Context(), h.blobs, models.Document{FileType: version.FileType, FilePath: version.FilePath})
+		if errors.Is(err, documentSvc.ErrLegacyFormat) || errors.Is(err, documentSvc.ErrUnsupportedType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "diff not supported for this file type"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse file content"})
+			return
+		}
+		versions[i], texts[i] = version, text
+	}
+
+	diff := documentSvc.DiffText(texts[0], texts[1], 3)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"from":    versions[0],
+			"to":      versions[1],
+			"added":   diff.Added,
+			"removed": diff.Removed,
+			"hunks":   diff.Hunks,
+			"unified": diff.Unified(),
+		},
+	})
+}
+
+// RestoreVersion 以指定版本的文件创建一个新版本，并重新入库
+func (h *DocumentHandler) RestoreVersion(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	docId := c.Param("id")
+
+	var document models.Document
+	if result := h.db.Where("id = ? AND user_id = ?", docId, userIdStr).First(&document); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return
+	}
+	if number == document.Version {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version is already current"})
+		return
+	}
+	target, err := documentSvc.GetVersion(h.db, document.ID, number)
+	if errors.Is(err, documentSvc.ErrVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "version not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.blobs.Stat(c.Request.Context(), target.FilePath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "version file not found"})
+		return
+	}
+
+	version, err := documentSvc.AddVersion(h.db, &document, models.DocumentVersion{
+		Name:         target.Name,
+		FileType:     target.FileType,
+		FileSize:     target.FileSize,
+		FilePath:     target.FilePath,
+		ContentHash:  target.ContentHash,
+		RestoredFrom: target.Version,
+		CreatedBy:    userIdStr,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.ingest.Restart(document.ID, document.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	document.Status = "processing"
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "version restored",
+		"data": gin.H{
+			"document": document,
+			"version":  version,
+		},
+	})
+}
+
+// Delete 删除文档
+func (h *DocumentHandler) Delete(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	docId := c.Param("id")
+
+	var document models.Document
+	if result := h.db.Where("id = ? AND user_id = ?", docId, userIdStr).First(&document); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+
+	if err := h.removeDocument(c.Request.Context(), userIdStr, document); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -831,6 +1448,52 @@ func (h *DocumentHandler) Delete(c *gin.Context) {
 	})
 }
 
+// removeDocument 彻底删除文档：先在事务中删除入库任务、版本、标签、分块与文档记录，并把子文档（如邮件附件）解除关联；
+// 提交后再清理向量、存储中的文件（含历史版本）与 AnythingLLM 中的副本，避免数据库删除失败时文件已丢失
+func (h *DocumentHandler) removeDocument(ctx context.Context, userID string, document models.Document) error {
+	// 向量所在集合与文件列表都依赖文档及版本记录，须在删除前读取
+	vectors := h.retrieval.DocumentVectors(userID, document.ID)
+	files := documentSvc.VersionFiles(h.db, document)
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := ingest.DeleteJobs(tx, document.ID); err != nil {
+			return err
+		}
+		if err := documentSvc.DeleteVersions(tx, document.ID); err != nil {
+			return err
+		}
+		if err := documentSvc.DeleteTags(tx, document.ID); err != nil {
+			return err
+		}
+		if err := documentSvc.DeleteChunks(tx, document.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Document{}).Where("parent_id = ?", document.ID).Update("parent_id", "").Error; err != nil {
+			return err
+		}
+		return tx.Delete(&document).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	h.retrieval.RemoveVectors(ctx, vectors)
+	for _, key := range files {
+		if err := h.blobs.Delete(ctx, key); err != nil {
+			log.Printf("failed to delete file %s of document %s: %v", key, document.ID, err)
+		}
+	}
+
+	var metadata map[string]interface{}
+	if document.Metadata != "" {
+		json.Unmarshal([]byte(document.Metadata), &metadata)
+	}
+	if anythingLLMFileId, ok := metadata["anythingLLMFileId"].(string); ok {
+		h.deleteFromAnythingLLM(anythingLLMFileId, userID)
+	}
+	return nil
+}
+
 // BatchDelete 批量删除文档
 func (h *DocumentHandler) BatchDelete(c *gin.Context) {
 	userId, exists := c.Get("userId")
@@ -866,23 +1529,7 @@ func (h *DocumentHandler) BatchDelete(c *gin.Context) {
 
 	// 批量删除
 	for _, doc := range documents {
-		// 从 AnythingLLM 删除
-		var metadata map[string]interface{}
-		if doc.Metadata != "" {
-			json.Unmarshal([]byte(doc.Metadata), &metadata)
-		}
-
-		if anythingLLMFileId, ok := metadata["anythingLLMFileId"].(string); ok {
-			h.deleteFromAnythingLLM(anythingLLMFileId, userIdStr)
-		}
-
-		// 删除本地文件
-		if doc.FilePath != "" {
-			os.Remove(doc.FilePath)
-		}
-
-		// 删除数据库记录
-		h.db.Delete(&doc)
+		h.removeDocument(c.Request.Context(), userIdStr, doc)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -965,21 +1612,11 @@ func (h *DocumentHandler) BatchUpdateTags(c *gin.Context) {
 	}
 
 	// 批量更新
-	for _, doc := range documents {
-		var metadata map[string]interface{}
-		if doc.Metadata != "" {
-			json.Unmarshal([]byte(doc.Metadata), &metadata)
-		}
-		if metadata == nil {
-			metadata = make(map[string]interface{})
+	for i := range documents {
+		if err := documentSvc.SetTags(h.db, &documents[i], req.Tags); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		metadata["tags"] = req.Tags
-
-		data, _ := json.Marshal(metadata)
-		h.db.Model(&doc).Updates(map[string]interface{}{
-			"metadata":   models.JSON(data),
-			"updated_at": time.Now(),
-		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -991,27 +1628,6 @@ func (h *DocumentHandler) BatchUpdateTags(c *gin.Context) {
 	})
 }
 
-type sharedStringsXML struct {
-	SI []struct {
-		T string `xml:"t"`
-		R []struct {
-			T string `xml:"t"`
-		} `xml:"r"`
-	} `xml:"si"`
-}
-
-type worksheetXML struct {
-	Rows []struct {
-		Cells []struct {
-			T  string `xml:"t,attr"`
-			V  string `xml:"v"`
-			IS struct {
-				T string `xml:"t"`
-			} `xml:"is"`
-		} `xml:"c"`
-	} `xml:"sheetData>row"`
-}
-
 func truncatePreviewText(text string) string {
 	const maxRunes = 12000
 	runes := []rune(text)
@@ -1021,210 +1637,40 @@ func truncatePreviewText(text string) string {
 	return string(runes[:maxRunes]) + "\n\n...（预览已截断）"
 }
 
-func readZipEntryContent(zr *zip.ReadCloser, name string) ([]byte, error) {
-	for _, f := range zr.File {
-		if f.Name != name {
-			continue
-		}
-		rc, err := f.Open()
-		if err != nil {
-			return nil, err
-		}
-		defer rc.Close()
-		return io.ReadAll(rc)
-	}
-	return nil, fmt.Errorf("zip entry not found: %s", name)
-}
-
-func extractXMLText(raw []byte) string {
-	decoder := xml.NewDecoder(bytes.NewReader(raw))
-	var parts []string
-	for {
-		tok, err := decoder.Token()
-		if err != nil {
-			break
-		}
-		charData, ok := tok.(xml.CharData)
-		if !ok {
-			continue
-		}
-		fragment := strings.TrimSpace(string(charData))
-		if fragment != "" {
-			parts = append(parts, fragment)
-		}
-	}
-	return strings.Join(parts, " ")
-}
-
-func parseSharedStrings(raw []byte) []string {
-	var sst sharedStringsXML
-	if err := xml.Unmarshal(raw, &sst); err != nil {
-		return nil
+// extractDocument 读取并解析文档，预览、对话附件、分块与全文索引共用
+func extractDocument(ctx context.Context, blobs storage.BlobStore, document models.Document) (*documentSvc.Extraction, error) {
+	if document.FilePath == "" {
+		return nil, fmt.Errorf("file not found")
 	}
-	out := make([]string, 0, len(sst.SI))
-	for _, si := range sst.SI {
-		if si.T != "" {
-			out = append(out, strings.TrimSpace(si.T))
-			continue
-		}
-		var runParts []string
-		for _, r := range si.R {
-			if strings.TrimSpace(r.T) != "" {
-				runParts = append(runParts, strings.TrimSpace(r.T))
-			}
-		}
-		out = append(out, strings.Join(runParts, ""))
+	data, err := storage.ReadAll(ctx, blobs, document.FilePath)
+	if err != nil {
+		return nil, err
 	}
-	return out
+	return documentSvc.Extract(document.FileType, data)
 }
 
-func parseWorksheetPreview(raw []byte, sharedStrings []string) string {
-	var ws worksheetXML
-	if err := xml.Unmarshal(raw, &ws); err != nil {
-		return extractXMLText(raw)
-	}
-
-	lines := make([]string, 0, len(ws.Rows))
-	for _, row := range ws.Rows {
-		cells := make([]string, 0, len(row.Cells))
-		for _, cell := range row.Cells {
-			value := strings.TrimSpace(cell.V)
-			if cell.T == "inlineStr" && strings.TrimSpace(cell.IS.T) != "" {
-				value = strings.TrimSpace(cell.IS.T)
-			}
-			if cell.T == "s" && value != "" {
-				if idx, err := strconv.Atoi(value); err == nil && idx >= 0 && idx < len(sharedStrings) {
-					value = sharedStrings[idx]
-				}
-			}
-			if value != "" {
-				cells = append(cells, value)
-			}
-		}
-		if len(cells) > 0 {
-			lines = append(lines, strings.Join(cells, " | "))
-		}
+// extractDocumentText 读取并解析文档全文
+func extractDocumentText(ctx context.Context, blobs storage.BlobStore, document models.Document) (string, error) {
+	extraction, err := extractDocument(ctx, blobs, document)
+	if err != nil {
+		return "", err
 	}
-	return strings.Join(lines, "\n")
+	return extraction.Text, nil
 }
 
-func (h *DocumentHandler) extractPreviewContent(document models.Document) (string, error) {
-	if document.FilePath == "" {
-		return "", fmt.Errorf("file not found")
-	}
-
-	switch document.FileType {
-	case "txt", "md":
-		content, err := os.ReadFile(document.FilePath)
-		if err != nil {
-			return "", err
-		}
-		return truncatePreviewText(string(content)), nil
-	case "csv":
-		file, err := os.Open(document.FilePath)
-		if err != nil {
-			return "", err
-		}
-		defer file.Close()
-		reader := csv.NewReader(file)
-		rows, err := reader.ReadAll()
-		if err != nil {
-			return "", err
-		}
-		var lines []string
-		for _, row := range rows {
-			lines = append(lines, strings.Join(row, " | "))
-		}
-		return truncatePreviewText(strings.Join(lines, "\n")), nil
-	case "docx":
-		zr, err := zip.OpenReader(document.FilePath)
-		if err != nil {
-			return "", err
-		}
-		defer zr.Close()
-		raw, err := readZipEntryContent(zr, "word/document.xml")
-		if err != nil {
-			return "", err
-		}
-		return truncatePreviewText(extractXMLText(raw)), nil
-	case "xlsx":
-		zr, err := zip.OpenReader(document.FilePath)
-		if err != nil {
-			return "", err
-		}
-		defer zr.Close()
-
-		shared := []string{}
-		if raw, err := readZipEntryContent(zr, "xl/sharedStrings.xml"); err == nil {
-			shared = parseSharedStrings(raw)
-		}
-
-		var sheetNames []string
-		for _, f := range zr.File {
-			if strings.HasPrefix(f.Name, "xl/worksheets/") && strings.HasSuffix(f.Name, ".xml") {
-				sheetNames = append(sheetNames, f.Name)
-			}
-		}
-		sort.Strings(sheetNames)
-		if len(sheetNames) == 0 {
-			return "表格中未发现可预览内容。", nil
-		}
-
-		var sections []string
-		for idx, name := range sheetNames {
-			raw, err := readZipEntryContent(zr, name)
-			if err != nil {
-				continue
-			}
-			body := strings.TrimSpace(parseWorksheetPreview(raw, shared))
-			if body == "" {
-				continue
-			}
-			sections = append(sections, fmt.Sprintf("工作表 %d\n%s", idx+1, body))
-		}
-		if len(sections) == 0 {
-			return "表格中未发现可预览内容。", nil
-		}
-		return truncatePreviewText(strings.Join(sections, "\n\n")), nil
-	case "pptx":
-		zr, err := zip.OpenReader(document.FilePath)
-		if err != nil {
-			return "", err
-		}
-		defer zr.Close()
-
-		var slideNames []string
-		for _, f := range zr.File {
-			if strings.HasPrefix(f.Name, "ppt/slides/slide") && strings.HasSuffix(f.Name, ".xml") {
-				slideNames = append(slideNames, f.Name)
-			}
-		}
-		sort.Strings(slideNames)
-		if len(slideNames) == 0 {
-			return "演示文稿中未发现可预览内容。", nil
-		}
-
-		var slides []string
-		for idx, name := range slideNames {
-			raw, err := readZipEntryContent(zr, name)
-			if err != nil {
-				continue
-			}
-			body := strings.TrimSpace(extractXMLText(raw))
-			if body == "" {
-				continue
-			}
-			slides = append(slides, fmt.Sprintf("第 %d 页\n%s", idx+1, body))
-		}
-		if len(slides) == 0 {
-			return "演示文稿中未发现可预览内容。", nil
-		}
-		return truncatePreviewText(strings.Join(slides, "\n\n")), nil
-	case "doc", "xls", "ppt":
+func (h *DocumentHandler) extractPreviewContent(ctx context.Context, document models.Document) (string, error) {
+	text, err := extractDocumentText(ctx, h.blobs, document)
+	switch {
+	case errors.Is(err, documentSvc.ErrLegacyFormat):
 		return "该旧版 Office 格式暂不支持在线解析，请下载后查看，建议转换为 docx/xlsx/pptx。", nil
-	default:
+	case errors.Is(err, documentSvc.ErrUnsupportedType):
 		return "", fmt.Errorf("preview not supported for this file type")
+	case err != nil:
+		return "", err
+	case strings.TrimSpace(text) == "":
+		return "文档中未发现可预览内容。", nil
 	}
+	return truncatePreviewText(text), nil
 }
 
 // Preview 预览文档内容
@@ -1251,14 +1697,14 @@ func (h *DocumentHandler) Preview(c *gin.Context) {
 	// 根据文件类型返回不同内容
 	switch document.FileType {
 	case "pdf":
-		// PDF 文件返回文件流
-		if document.FilePath != "" {
-			http.ServeFile(c.Writer, c.Request, document.FilePath)
-		} else {
-			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		// PDF 文件默认返回文件流，format=text 时返回提取的文本
+		if c.Query("format") != "text" {
+			h.serveBlob(c, document, "inline")
+			break
 		}
+		fallthrough
 	case "txt", "md", "csv", "doc", "docx", "xls", "xlsx", "ppt", "pptx":
-		content, err := h.extractPreviewContent(document)
+		content, err := h.extractPreviewContent(c.Request.Context(), document)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse file content"})
 			return
@@ -1296,14 +1742,31 @@ func (h *DocumentHandler) Download(c *gin.Context) {
 		return
 	}
 
+	c.Header("Content-Type", "application/octet-stream")
+	h.serveBlob(c, document, "attachment")
+}
+
+// serveBlob 从文件存储流式返回文档原文件，支持 Range 请求（断点续传、PDF 分段加载）
+func (h *DocumentHandler) serveBlob(c *gin.Context, document models.Document, disposition string) {
 	if document.FilePath == "" {
 		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 		return
 	}
+	obj, err := h.blobs.Open(c.Request.Context(), document.FilePath)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+		return
+	}
+	defer obj.Close()
 
-	c.Header("Content-Disposition", "attachment; filename=\""+document.Name+"\"")
-	c.Header("Content-Type", "application/octet-stream")
-	http.ServeFile(c.Writer, c.Request, document.FilePath)
+	if disposition == "attachment" {
+		c.Header("Content-Disposition", "attachment; filename=\""+document.Name+"\"")
+	}
+	http.ServeContent(c.Writer, c.Request, document.Name, obj.Info().ModTime, obj)
 }
 
 // CreateFolder 创建文件夹
@@ -1320,19 +1783,31 @@ func (h *DocumentHandler) CreateFolder(c *gin.Context) {
 	}
 
 	var req struct {
-		Name     string `json:"name" binding:"required"`
-		ParentID string `json:"parentId"`
+		Name          string `json:"name" binding:"required"`
+		ParentID      string `json:"parentId"`
+		ChunkStrategy string `json:"chunkStrategy"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if req.ParentID != "" && !h.activeFolderExists(userIdStr, req.ParentID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "parent folder not found"})
+		return
+	}
+	strategy, err := documentSvc.NormalizeChunkStrategy(req.ChunkStrategy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	folder := models.Folder{
-		ID:       models.NewUUID(),
-		UserID:   userIdStr,
-		Name:     req.Name,
-		ParentID: req.ParentID,
+		ID:            models.NewUUID(),
+		UserID:        userIdStr,
+		Name:          req.Name,
+		ParentID:      req.ParentID,
+		ChunkStrategy: strategy,
 	}
 
 	if result := h.db.Create(&folder); result.Error != nil {
@@ -1347,6 +1822,33 @@ func (h *DocumentHandler) CreateFolder(c *gin.Context) {
 	})
 }
 
+// activeFolderExists 文件夹存在、属于该用户且不在回收站中
+func (h *DocumentHandler) activeFolderExists(userID, folderID string) bool {
+	var count int64
+	h.db.Model(&models.Folder{}).Where("id = ? AND user_id = ? AND trashed_at IS NULL", folderID, userID).Count(&count)
+	return count > 0
+}
+
+// folderDocumentCounts 统计各文件夹直接包含的文档数（不含回收站中的文档）
+func (h *DocumentHandler) folderDocumentCounts(userID string) (map[string]int64, error) {
+	var rows []struct {
+		FolderID string
+		Count    int64
+	}
+	err := h.db.Model(&models.Document{}).
+		Select("folder_id, COUNT(*) AS count").
+		Where("user_id = ? AND trashed_at IS NULL AND folder_id <> ''", userID).
+		Group("folder_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.FolderID] = row.Count
+	}
+	return counts, nil
+}
+
 // ListFolders 获取文件夹列表
 func (h *DocumentHandler) ListFolders(c *gin.Context) {
 	userId, exists := c.Get("userId")
@@ -1361,12 +1863,18 @@ func (h *DocumentHandler) ListFolders(c *gin.Context) {
 	}
 
 	var folders []models.Folder
-	if result := h.db.Where("user_id = ?", userIdStr).Order("created_at ASC").Find(&folders); result.Error != nil {
+	if result := h.db.Where("user_id = ? AND trashed_at IS NULL", userIdStr).Order("created_at ASC").Find(&folders); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
 
 	// 计算每个文件夹的文档数量
+	counts, err := h.folderDocumentCounts(userIdStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	type FolderWithCount struct {
 		models.Folder
 		DocumentCount int64 `json:"documentCount"`
@@ -1374,11 +1882,9 @@ func (h *DocumentHandler) ListFolders(c *gin.Context) {
 
 	foldersWithCount := make([]FolderWithCount, len(folders))
 	for i, folder := range folders {
-		var count int64
-		h.db.Model(&models.Document{}).Where("user_id = ? AND folder_id = ?", userIdStr, folder.ID).Count(&count)
 		foldersWithCount[i] = FolderWithCount{
 			Folder:        folder,
-			DocumentCount: count,
+			DocumentCount: counts[folder.ID],
 		}
 	}
 
@@ -1389,7 +1895,163 @@ func (h *DocumentHandler) ListFolders(c *gin.Context) {
 	})
 }
 
-// DeleteFolder 删除文件夹
+// FolderTree 获取文件夹树，root 参数指定子树根节点，每个节点带直接与累计文档数
+func (h *DocumentHandler) FolderTree(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	rootID := c.Query("root")
+	if rootID != "" && !h.activeFolderExists(userIdStr, rootID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+		return
+	}
+
+	var folders []models.Folder
+	if err := h.db.Where("user_id = ? AND trashed_at IS NULL", userIdStr).Order("name ASC").Find(&folders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	counts, err := h.folderDocumentCounts(userIdStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 未归档文档（不在任何文件夹中）单独计数
+	var unfiled int64
+	h.db.Model(&models.Document{}).Where("user_id = ? AND trashed_at IS NULL AND (folder_id = '' OR folder_id IS NULL)", userIdStr).Count(&unfiled)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"folders":         documentSvc.BuildFolderTree(folders, counts, rootID),
+			"unfiledDocCount": unfiled,
+		},
+	})
+}
+
+// FolderPath 获取文件夹的面包屑路径（从根目录到该文件夹）
+func (h *DocumentHandler) FolderPath(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	path, err := documentSvc.FolderPath(h.db, userIdStr, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(path) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    path,
+	})
+}
+
+// UpdateFolder 重命名或移动文件夹，parentId 为空字符串表示移到根目录
+func (h *DocumentHandler) UpdateFolder(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var folder models.Folder
+	if result := h.db.Where("id = ? AND user_id = ? AND trashed_at IS NULL", c.Param("id"), userIdStr).First(&folder); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+		return
+	}
+
+	var req struct {
+		Name          *string `json:"name"`
+		ParentID      *string `json:"parentId"`
+		ChunkStrategy *string `json:"chunkStrategy"` // 空字符串表示沿用上级配置
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updateData := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "folder name is required"})
+			return
+		}
+		updateData["name"] = name
+	}
+	if req.ParentID != nil && *req.ParentID != folder.ParentID {
+		parentID := *req.ParentID
+		if parentID != "" && parentID != folder.ID && !h.activeFolderExists(userIdStr, parentID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parent folder not found"})
+			return
+		}
+		if err := documentSvc.CheckFolderMove(h.db, userIdStr, folder.ID, parentID); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, documentSvc.ErrFolderCycle) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		updateData["parent_id"] = parentID
+	}
+	if req.ChunkStrategy != nil {
+		strategy, err := documentSvc.NormalizeChunkStrategy(*req.ChunkStrategy)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updateData["chunk_strategy"] = strategy
+	}
+
+	if len(updateData) > 0 {
+		if err := h.db.Model(&folder).Updates(updateData).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	h.db.First(&folder, "id = ?", folder.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    folder,
+	})
+}
+
+// DeleteFolder 删除文件夹及其全部子文件夹
+//
+// mode=trash（默认）移入回收站，可通过 RestoreFolder 恢复；mode=permanent 永久删除。
+// documents=include（默认）时文件夹中的文档随之进入回收站或被删除；
+// documents=move 时文档先移到被删除文件夹的上级目录。
 func (h *DocumentHandler) DeleteFolder(c *gin.Context) {
 	userId, exists := c.Get("userId")
 	if !exists {
@@ -1402,6 +2064,13 @@ func (h *DocumentHandler) DeleteFolder(c *gin.Context) {
 		return
 	}
 
+	mode := c.DefaultQuery("mode", "trash")
+	documents := c.DefaultQuery("documents", "include")
+	if (mode != "trash" && mode != "permanent") || (documents != "include" && documents != "move") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mode or documents option"})
+		return
+	}
+
 	folderId := c.Param("id")
 
 	var folder models.Folder
@@ -1409,14 +2078,205 @@ func (h *DocumentHandler) DeleteFolder(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
 		return
 	}
+	if mode == "trash" && folder.TrashedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "folder is already in trash"})
+		return
+	}
+
+	subtree, err := documentSvc.FolderSubtree(h.db, userIdStr, folder.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 1. 需要保留的文档移到上级目录
+	var moved int64
+	if documents == "move" {
+		result := h.db.Model(&models.Document{}).
+			Where("user_id = ? AND folder_id IN ? AND trashed_at IS NULL", userIdStr, subtree).
+			Update("folder_id", folder.ParentID)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+			return
+		}
+		moved = result.RowsAffected
+	}
+
+	// 2. 移入回收站：同一批次的文件夹和文档共用一个 TrashID，恢复时整体还原
+	if mode == "trash" {
+		now := time.Now()
+		trashID := models.NewUUID()
+		var trashedDocs int64
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.Document{}).
+				Where("user_id = ? AND folder_id IN ? AND trashed_at IS NULL", userIdStr, subtree).
+				Updates(map[string]interface{}{"trashed_at": now, "trash_id": trashID})
+			if result.Error != nil {
+				return result.Error
+			}
+			trashedDocs = result.RowsAffected
+			return tx.Model(&models.Folder{}).
+				Where("user_id = ? AND id IN ? AND trashed_at IS NULL", userIdStr, subtree).
+				Updates(map[string]interface{}{"trashed_at": now, "trash_id": trashID}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "success",
+			"data": gin.H{
+				"mode":      mode,
+				"folders":   len(subtree),
+				"documents": trashedDocs,
+				"moved":     moved,
+			},
+		})
+		return
+	}
+
+	// 3. 永久删除：子树中剩余的文档（含回收站中的）一并彻底删除
+	var docs []models.Document
+	if err := h.db.Where("user_id = ? AND folder_id IN ?", userIdStr, subtree).Find(&docs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, doc := range docs {
+		if err := h.removeDocument(c.Request.Context(), userIdStr, doc); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := h.db.Where("user_id = ? AND id IN ?", userIdStr, subtree).Delete(&models.Folder{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"mode":      mode,
+			"folders":   len(subtree),
+			"documents": len(docs),
+			"moved":     moved,
+		},
+	})
+}
+
+// ListTrash 列出回收站中的文件夹（每个删除批次只列出最上层的文件夹）
+func (h *DocumentHandler) ListTrash(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var trashed []models.Folder
+	if err := h.db.Where("user_id = ? AND trashed_at IS NOT NULL", userIdStr).Order("trashed_at DESC").Find(&trashed).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	batch := make(map[string]string, len(trashed))
+	for _, f := range trashed {
+		batch[f.ID] = f.TrashID
+	}
+
+	type TrashedFolder struct {
+		models.Folder
+		FolderCount   int   `json:"folderCount"`
+		DocumentCount int64 `json:"documentCount"`
+	}
+
+	items := []TrashedFolder{}
+	for _, f := range trashed {
+		if batch[f.ParentID] == f.TrashID {
+			continue
+		}
+		folderCount := 0
+		for _, other := range trashed {
+			if other.TrashID == f.TrashID {
+				folderCount++
+			}
+		}
+		var docCount int64
+		h.db.Model(&models.Document{}).Where("user_id = ? AND trash_id = ?", userIdStr, f.TrashID).Count(&docCount)
+		items = append(items, TrashedFolder{Folder: f, FolderCount: folderCount, DocumentCount: docCount})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    items,
+	})
+}
+
+// RestoreFolder 从回收站恢复文件夹及与其同批删除的子文件夹和文档；
+// 上级文件夹已不存在或仍在回收站中时恢复到根目录
+func (h *DocumentHandler) RestoreFolder(c *gin.Context) {
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userIdStr, ok := userId.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var folder models.Folder
+	if result := h.db.Where("id = ? AND user_id = ? AND trashed_at IS NOT NULL", c.Param("id"), userIdStr).First(&folder); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found in trash"})
+		return
+	}
+
+	// 同批次中上级文件夹不在本批次且已不可用的文件夹移到根目录
+	var batch []models.Folder
+	if err := h.db.Where("user_id = ? AND trash_id = ?", userIdStr, folder.TrashID).Find(&batch).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	inBatch := make(map[string]bool, len(batch))
+	for _, f := range batch {
+		inBatch[f.ID] = true
+	}
+	var orphans []string
+	for _, f := range batch {
+		if f.ParentID != "" && !inBatch[f.ParentID] && !h.activeFolderExists(userIdStr, f.ParentID) {
+			orphans = append(orphans, f.ID)
+		}
+	}
 
-	// 删除文件夹 (不删除文档，文档 folder_id 设为空)
-	h.db.Model(&models.Document{}).Where("folder_id = ?", folderId).Update("folder_id", nil)
-	h.db.Delete(&folder)
+	restore := map[string]interface{}{"trashed_at": nil, "trash_id": ""}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if len(orphans) > 0 {
+			if err := tx.Model(&models.Folder{}).Where("id IN ?", orphans).Update("parent_id", "").Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.Folder{}).Where("user_id = ? AND trash_id = ?", userIdStr, folder.TrashID).Updates(restore).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Document{}).Where("user_id = ? AND trash_id = ?", userIdStr, folder.TrashID).Updates(restore).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.db.First(&folder, "id = ?", folder.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
+		"data":    folder,
 	})
 }
 
@@ -1432,28 +2292,46 @@ func (h *DocumentHandler) deleteFromAnythingLLM(filename, workspace string) erro
 	return h.anything.RemoveDocument(context.Background(), workspaceSlug, filename)
 }
 
-// calculateProgress 根据状态计算进度百分比
-func calculateProgress(status string) int {
-	switch status {
-	case "pending":
-		return 0
-	case "processing":
-		return 50
-	case "completed":
-		return 100
-	case "failed":
+// calculateProgress 根据入库任务的阶段计算进度百分比，失败时返回 -1
+func calculateProgress(doc models.Document, job *models.IngestionJob) int {
+	switch {
+	case doc.Status == "failed":
 		return -1
+	case job != nil:
+		return ingest.Progress(job)
+	case doc.Status == "completed":
+		return 100
 	default:
 		return 0
 	}
 }
 
+// stageLabels 入库阶段的中文描述
+var stageLabels = map[string]string{
+	ingest.StageExtract: "正在解析文档内容...",
+	ingest.StageChunk:   "正在切分文档...",
+	ingest.StageEmbed:   "正在生成向量...",
+	ingest.StageIndex:   "正在建立全文索引...",
+	ingest.StageSync:    "正在同步到知识库...",
+}
+
 // getStatusMessage 获取状态描述信息
-func getStatusMessage(doc models.Document) string {
+func getStatusMessage(doc models.Document, job *models.IngestionJob) string {
 	switch doc.Status {
 	case "pending":
 		return "等待处理"
 	case "processing":
+		if job != nil {
+			switch job.Status {
+			case ingest.StatusQueued:
+				return "排队等待处理"
+			case ingest.StatusRetrying:
+				return fmt.Sprintf("处理出错，等待第 %d 次重试：%s", job.Attempts+1, job.LastError)
+			}
+			if label, ok := stageLabels[job.Stage]; ok {
+				return label
+			}
+		}
 		return "正在上传到知识库并建立索引..."
 	case "completed":
 		return "处理完成，可用于智能对话"
@@ -1466,15 +2344,3 @@ func getStatusMessage(doc models.Document) string {
 		return "未知状态"
 	}
 }
-
-// vectorSearch 调用 AnythingLLM 向量搜索 API
-func (h *DocumentHandler) vectorSearch(query string, topN int, workspace string) ([]interface{}, error) {
-	if !h.anythingLLMEnabled() {
-		return nil, fmt.Errorf("anythingllm is not configured")
-	}
-	workspaceSlug := h.resolveWorkspaceSlug(workspace)
-	if strings.TrimSpace(workspaceSlug) == "" {
-		return nil, fmt.Errorf("failed to resolve workspace slug")
-	}
-	return h.anything.VectorSearch(context.Background(), workspaceSlug, query, topN)
-}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"rolecraft-ai/internal/models"
+	documentSvc "rolecraft-ai/internal/service/document"
+)
+
+// 压缩包展开限制
+const (
+	maxArchiveEntries   = 1000
+	maxArchiveTotalSize = 500 << 20
+)
+
+// isExpandedType 上传时展开为多个文档的文件类型：zip 展开为文件夹树，eml 拆出附件，mbox 拆分为单封邮件
+func isExpandedType(ext string) bool {
+	return ext == ".zip" || ext == ".eml" || ext == ".mbox"
+}
+
+// archiveImport 展开一次上传的压缩包或邮箱文件，收集生成的文档与跳过的条目
+type archiveImport struct {
+	h         *DocumentHandler
+	ctx       context.Context
+	userID    string
+	companyID string
+	workID    string
+	folders   map[string]string // "父文件夹 ID/名称" -> 文件夹 ID
+	documents []models.Document
+	skipped   []documentSvc.SkippedEntry
+}
+
+// expandUpload 展开上传的 zip、eml 或 mbox 文件
+func (h *DocumentHandler) expandUpload(ctx context.Context, fileHeader *multipart.FileHeader, userIdStr, folderID, companyID, workID string) ([]models.Document, []documentSvc.SkippedEntry, error) {
+	name := filepath.Base(fileHeader.Filename)
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".eml" && fileHeader.Size > h.maxFileSize {
+		return nil, nil, fmt.Errorf("file too large")
+	}
+	if ext != ".eml" && fileHeader.Size > maxArchiveTotalSize {
+		return nil, nil, fmt.Errorf("file too large")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	im := &archiveImport{
+		h:         h,
+		ctx:       ctx,
+		userID:    userIdStr,
+		companyID: companyID,
+		workID:    workID,
+		folders:   map[string]string{},
+	}
+	switch ext {
+	case ".zip":
+		err = im.addZip(file, fileHeader.Size, name, folderID)
+	default:
+		var data []byte
+		if data, err = io.ReadAll(file); err == nil {
+			err = im.addEntry(name, name, folderID, data)
+		}
+	}
+	return im.documents, im.skipped, err
+}
+
+func (im *archiveImport) skip(entryPath, reason string) {
+	im.skipped = append(im.skipped, documentSvc.SkippedEntry{Path: entryPath, Reason: reason})
+}
+
+// folder 查找或创建 parentID 下的同名文件夹；重复上传同一压缩包时复用已有文件夹，同名文件成为新版本
+func (im *archiveImport) folder(parentID, name string) (string, error) {
+	cacheKey := parentID + "/" + name
+	if id, ok := im.folders[cacheKey]; ok {
+		return id, nil
+	}
+	var folder models.Folder
+	err := im.h.db.Where("user_id = ? AND parent_id = ? AND name = ? AND trashed_at IS NULL", im.userID, parentID, name).
+		Order("created_at ASC").First(&folder).Error
+	if err != nil {
+		folder = models.Folder{ID: models.NewUUID(), UserID: im.userID, Name: name, ParentID: parentID}
+		if err := im.h.db.Create(&folder).Error; err != nil {
+			return "", err
+		}
+	}
+	im.folders[cacheKey] = folder.ID
+	return folder.ID, nil
+}
+
+// addZip 以压缩包名称创建根文件夹，按目录结构创建子文件夹并导入其中的文件
+func (im *archiveImport) addZip(r io.ReaderAt, size int64, name, folderID string) error {
+	files, skipped, err := documentSvc.ReadZip(r, size, documentSvc.ArchiveLimits{
+		MaxEntries:   maxArchiveEntries,
+		MaxFileSize:  im.h.maxFileSize,
+		MaxTotalSize: maxArchiveTotalSize,
+	})
+	if err != nil {
+		return err
+	}
+	im.skipped = append(im.skipped, skipped...)
+	if len(files) == 0 {
+		return nil
+	}
+
+	rootID, err := im.folder(folderID, strings.TrimSuffix(name, filepath.Ext(name)))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		ext := strings.ToLower(path.Ext(f.Name()))
+		if !allowedTypes[ext] {
+			im.skip(f.Path, "file type not allowed")
+			continue
+		}
+		if ext == ".zip" {
+			im.skip(f.Path, "nested archives are not expanded")
+			continue
+		}
+		parentID := rootID
+		if dir := f.Dir(); dir != "" {
+			for _, segment := range strings.Split(dir, "/") {
+				if parentID, err = im.folder(parentID, segment); err != nil {
+					return err
+				}
+			}
+		}
+		rc, err := f.Open()
+		if err != nil {
+			im.skip(f.Path, err.Error())
+			continue
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			im.skip(f.Path, err.Error())
+			continue
+		}
+		if err := im.addEntry(f.Path, f.Name(), parentID, data); err != nil {
+			im.skip(f.Path, err.Error())
+		}
+	}
+	return nil
+}
+
+// addEntry 按类型导入单个文件：邮件拆出附件，mbox 拆分为单封邮件，其余直接登记为文档
+func (im *archiveImport) addEntry(entryPath, name, folderID string, data []byte) error {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".eml":
+		_, err := im.addEmail(entryPath, name, folderID, data)
+		return err
+	case ".mbox":
+		return im.addMbox(entryPath, name, folderID, data)
+	}
+	_, err := im.addFile(name, folderID, data, "", fileAttributes{})
+	return err
+}
+
+// addFile 写入文件存储并登记为文档
+func (im *archiveImport) addFile(name, folderID string, data []byte, contentType string, attrs fileAttributes) (*models.Document, error) {
+	fileId := models.NewUUID()
+	filePath := fileId + strings.ToLower(filepath.Ext(name))
+	if err := im.h.blobs.Put(im.ctx, filePath, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	doc, err := im.h.registerFile(im.ctx, fileId, filePath, name, int64(len(data)), hex.EncodeToString(sum[:]),
+		im.userID, folderID, im.companyID, im.workID, attrs)
+	if err != nil {
+		return nil, err
+	}
+	im.documents = append(im.documents, *doc)
+	return doc, nil
+}
+
+// addEmail 原邮件登记为文档，邮件头保存在元数据的 email 字段中；附件登记为以该邮件为父文档的子文档
+func (im *archiveImport) addEmail(entryPath, name, folderID string, data []byte) (*models.Document, error) {
+	email, err := documentSvc.ParseEmail(data)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := im.addFile(name, folderID, data, "message/rfc822", fileAttributes{
+		Metadata: map[string]interface{}{"email": email.Headers()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, attachment := range email.Attachments {
+		attachmentName := attachmentFileName(attachment, i+1)
+		attachmentPath := entryPath + "/" + attachmentName
+		ext := strings.ToLower(filepath.Ext(attachmentName))
+		switch {
+		case !allowedTypes[ext]:
+			im.skip(attachmentPath, "file type not allowed")
+		case ext == ".zip" || ext == ".mbox":
+			im.skip(attachmentPath, "nested archives are not expanded")
+		case int64(len(attachment.Data)) > im.h.maxFileSize:
+			im.skip(attachmentPath, "file too large")
+		default:
+			if _, err := im.addFile(attachmentName, folderID, attachment.Data, attachment.ContentType, fileAttributes{ParentID: doc.ID}); err != nil {
+				im.skip(attachmentPath, err.Error())
+			}
+		}
+	}
+	return doc, nil
+}
+
+// addMbox 以 mbox 名称创建文件夹，每封邮件按主题命名为单独的 eml 文档
+func (im *archiveImport) addMbox(entryPath, name, folderID string, data []byte) error {
+	messages := documentSvc.SplitMbox(data)
+	if len(messages) == 0 {
+		return fmt.Errorf("no messages found in mailbox")
+	}
+	mboxFolderID, err := im.folder(folderID, strings.TrimSuffix(name, filepath.Ext(name)))
+	if err != nil {
+		return err
+	}
+	used := map[string]int{}
+	for i, message := range messages {
+		messagePath := fmt.Sprintf("%s#%d", entryPath, i+1)
+		subject := ""
+		if email, err := documentSvc.ParseEmail(message); err == nil {
+			subject = safeFileName(email.Subject)
+		}
+		if subject == "" {
+			subject = fmt.Sprintf("message-%d", i+1)
+		}
+		// 同一邮箱中的同名邮件各自成为文档，而不是彼此的新版本
+		used[subject]++
+		if n := used[subject]; n > 1 {
+			subject = fmt.Sprintf("%s (%d)", subject, n)
+		}
+		if _, err := im.addEmail(messagePath, subject+".eml", mboxFolderID, message); err != nil {
+			im.skip(messagePath, err.Error())
+		}
+	}
+	return nil
+}
+
+// attachmentFileName 附件文件名；没有文件名时按内容类型推断扩展名
+func attachmentFileName(attachment documentSvc.Attachment, index int) string {
+	if name := safeFileName(attachment.Name); name != "" {
+		return name
+	}
+	ext := ""
+	if attachment.ContentType == "message/rfc822" {
+		ext = ".eml"
+	} else if exts, _ := mime.ExtensionsByType(attachment.ContentType); len(exts) > 0 {
+		ext = exts[0]
+	}
+	return fmt.Sprintf("attachment-%d%s", index, ext)
+}
+
+// safeFileName 去除路径分隔符与控制字符，并限制长度
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\':
+			return '_'
+		case r < 0x20 || r == 0x7f:
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for len(name) > 200 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
@@ -0,0 +1,1195 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/api/handler"
+	"rolecraft-ai/internal/models"
+	documentSvc "rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/ingest"
+)
+
+func setupDocumentHandler(t *testing.T) (*gorm.DB, *handler.DocumentHandler) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("UPLOAD_DIR", t.TempDir())
+	t.Setenv("ANYTHINGLLM_BASE_URL", "")
+	t.Setenv("ANYTHINGLLM_URL", "")
+	t.Setenv("ANYTHINGLLM_API_KEY", "")
+	t.Setenv("ANYTHINGLLM_KEY", "")
+	t.Setenv("OPENAI_API_KEY", "")
+
+	db := setupTestDB(t)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&models.Document{}, &models.DocumentChunk{}, &models.Folder{}, &models.DocumentVersion{}, &models.IngestionJob{},
+		&models.UploadSession{}, &models.UploadPart{}, &models.DocumentTag{}, &models.Company{}))
+	h := handler.NewDocumentHandler(db)
+	h.Start(context.Background())
+	t.Cleanup(h.Stop)
+	return db, h
+}
+
+// postDocument 调用上传接口，返回响应中的文档
+func postDocument(t *testing.T, h *handler.DocumentHandler, userID, filename, content string) models.Document {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	part.Write([]byte(content))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/api/v1/documents", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = req
+	ctx.Set("userId", userID)
+	h.Upload(ctx)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var resp struct {
+		Data models.Document `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Data
+}
+
+// uploadDocument 通过上传接口创建文档并等待本地处理完成
+func uploadDocument(t *testing.T, db *gorm.DB, h *handler.DocumentHandler, userID, filename, content string) models.Document {
+	t.Helper()
+	uploaded := postDocument(t, h, userID, filename, content)
+
+	var doc models.Document
+	require.Eventually(t, func() bool {
+		db.First(&doc, "id = ?", uploaded.ID)
+		return doc.Status == "completed" && doc.ChunkCount > 0
+	}, 5*time.Second, 20*time.Millisecond)
+	return doc
+}
+
+func TestDocumentChunks(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	doc := uploadDocument(t, db, docHandler, "doc-user", "handbook.md",
+		"# 员工手册\n\n总则说明。\n\n## 假期\n\n年假按工龄计算。\n")
+	assert.Equal(t, 2, doc.ChunkCount)
+
+	get := func(userID, query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/v1/documents/"+doc.ID+"/chunks"+query, nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Params = gin.Params{{Key: "id", Value: doc.ID}}
+		ctx.Set("userId", userID)
+		docHandler.Chunks(ctx)
+		return w
+	}
+
+	w := get("doc-user", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data struct {
+			Total  int                    `json:"total"`
+			Chunks []models.DocumentChunk `json:"chunks"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data.Chunks, 2)
+	assert.Equal(t, 2, resp.Data.Total)
+	second := resp.Data.Chunks[1]
+	assert.Equal(t, 1, second.Ordinal)
+	assert.Equal(t, "员工手册 > 假期", second.HeadingPath)
+	assert.Equal(t, "## 假期\n\n年假按工龄计算。", second.Content)
+	assert.Equal(t, 15, second.StartOffset)
+	assert.Greater(t, second.TokenCount, 0)
+
+	w = get("doc-user", "?offset=1&limit=1")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data.Chunks, 1)
+	assert.Equal(t, second.ID, resp.Data.Chunks[0].ID)
+
+	assert.Equal(t, http.StatusNotFound, get("other-user", "").Code)
+
+	// 删除文档时一并删除分块
+	req, _ := http.NewRequest("DELETE", "/api/v1/documents/"+doc.ID, nil)
+	dw := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(dw)
+	ctx.Request = req
+	ctx.Params = gin.Params{{Key: "id", Value: doc.ID}}
+	ctx.Set("userId", "doc-user")
+	docHandler.Delete(ctx)
+	require.Equal(t, http.StatusOK, dw.Code)
+
+	var remaining int64
+	db.Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&remaining)
+	assert.Zero(t, remaining)
+}
+
+func TestDocumentSearchReturnsChunkHits(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	handbook := uploadDocument(t, db, docHandler, "search-user", "handbook.md",
+		"# 员工手册\n\n总则说明。\n\n## 假期\n\n年假按工龄计算。\n")
+	uploadDocument(t, db, docHandler, "search-user", "expense.md", "# 报销\n\n报销需在 30 天内提交。\n")
+
+	search := func(payload map[string]interface{}) []map[string]interface{} {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/api/v1/documents/search", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", "search-user")
+		docHandler.Search(ctx)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Data struct {
+				Documents []map[string]interface{} `json:"documents"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data.Documents
+	}
+
+	docs := search(map[string]interface{}{"query": "年假"})
+	require.Len(t, docs, 1)
+	assert.Equal(t, handbook.ID, docs[0]["id"])
+	assert.Contains(t, docs[0]["snippet"], "<mark>年假</mark>")
+	chunks, _ := docs[0]["chunks"].([]interface{})
+	require.Len(t, chunks, 1)
+	assert.Equal(t, "员工手册 > 假期", chunks[0].(map[string]interface{})["headingPath"])
+
+	assert.Empty(t, search(map[string]interface{}{"query": "年假", "filters": map[string]string{"type": "pdf"}}))
+	assert.Len(t, search(map[string]interface{}{"sortBy": "name", "sortOrder": "asc"}), 2)
+}
+
+func TestDocumentReprocessAndStatus(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	doc := uploadDocument(t, db, docHandler, "job-user", "notes.md", "# 笔记\n\n第一版内容。\n")
+
+	call := func(fn func(*gin.Context), method, userID string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/api/v1/documents/"+doc.ID, nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Params = gin.Params{{Key: "id", Value: doc.ID}}
+		ctx.Set("userId", userID)
+		fn(ctx)
+		return w
+	}
+	status := func() map[string]interface{} {
+		w := call(docHandler.GetStatus, "GET", "job-user")
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data
+	}
+
+	data := status()
+	assert.Equal(t, float64(100), data["progress"])
+	job := data["job"].(map[string]interface{})
+	assert.Equal(t, "completed", job["status"])
+	stages := job["stages"].([]interface{})
+	require.Len(t, stages, 5)
+	assert.Equal(t, "extract", stages[0].(map[string]interface{})["name"])
+	assert.Equal(t, "skipped", stages[2].(map[string]interface{})["status"])
+
+	// 修改原文件后重新处理，分块随之更新
+	require.NoError(t, os.WriteFile(filepath.Join(os.Getenv("UPLOAD_DIR"), doc.FilePath), []byte("# 笔记\n\n第二版内容。\n\n## 附录\n\n补充说明。\n"), 0o644))
+	w := call(docHandler.Reprocess, "POST", "job-user")
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	require.Eventually(t, func() bool {
+		var stored models.Document
+		db.First(&stored, "id = ?", doc.ID)
+		return stored.Status == "completed" && stored.ChunkCount == 2
+	}, 5*time.Second, 20*time.Millisecond)
+
+	var jobs int64
+	db.Model(&models.IngestionJob{}).Where("document_id = ?", doc.ID).Count(&jobs)
+	assert.Equal(t, int64(2), jobs)
+
+	// 已有未结束的任务时拒绝重复提交
+	next := time.Now().Add(time.Hour)
+	require.NoError(t, db.Create(&models.IngestionJob{
+		ID: "pending-job", DocumentID: doc.ID, UserID: "job-user", Status: "retrying", NextRunAt: &next, MaxAttempts: 5,
+		CreatedAt: time.Now().Add(time.Minute),
+	}).Error)
+	assert.Equal(t, http.StatusConflict, call(docHandler.Reprocess, "POST", "job-user").Code)
+	assert.Equal(t, http.StatusNotFound, call(docHandler.Reprocess, "POST", "other-user").Code)
+
+	job = status()["job"].(map[string]interface{})
+	assert.Equal(t, "pending-job", job["id"])
+	assert.Equal(t, "retrying", job["status"])
+}
+
+func TestDocumentUploadCompanyAccess(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	require.NoError(t, db.Create(&models.Company{ID: "acme", OwnerID: "owner", Name: "Acme"}).Error)
+	sum := sha256.Sum256([]byte("# 机密\n"))
+	require.NoError(t, db.Create(&models.Document{
+		ID: "foreign", UserID: "someone", CompanyID: "acme", Name: "secret.md", ContentHash: hex.EncodeToString(sum[:]),
+	}).Error)
+
+	upload := func(userID, companyID, content string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("companyId", companyID)
+		part, _ := writer.CreateFormFile("file", "copy.md")
+		part.Write([]byte(content))
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/api/v1/documents", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", userID)
+		docHandler.Upload(ctx)
+		return w
+	}
+
+	// 不属于公司的用户不能上传到公司
+	assert.Equal(t, http.StatusForbidden, upload("stranger", "acme", "# 机密\n").Code)
+
+	// 公司内其他用户的相同文件不作为重复文档返回
+	w := upload("owner", "acme", "# 机密\n")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		Data models.Document `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Data.Duplicate)
+	assert.NotEqual(t, "foreign", resp.Data.ID)
+	assert.Equal(t, "owner", resp.Data.UserID)
+	companyDoc := resp.Data
+
+	// 个人上传与公司文档内容或名称相同时，既不去重也不追加为公司文档的新版本
+	personal := func(content string) models.Document {
+		w := upload("owner", "", content)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			Data models.Document `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data
+	}
+	first := personal("# 机密\n")
+	assert.False(t, first.Duplicate)
+	assert.NotEqual(t, companyDoc.ID, first.ID)
+	assert.Empty(t, first.CompanyID)
+	second := personal("# 个人版\n")
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, 2, second.Version)
+	var stored models.Document
+	require.NoError(t, db.First(&stored, "id = ?", companyDoc.ID).Error)
+	assert.Equal(t, 1, stored.Version)
+
+	// 反过来，公司上传同名文件只追加为公司文档的新版本
+	w = upload("owner", "acme", "# 公司版\n")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, companyDoc.ID, resp.Data.ID)
+	assert.Equal(t, "acme", resp.Data.CompanyID)
+}
+
+func TestDocumentUploadFolderAccess(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	const user = "folder-user"
+	trashed := time.Now()
+	require.NoError(t, db.Create(&[]models.Folder{
+		{ID: "foreign", UserID: "someone", Name: "foreign"},
+		{ID: "trashed", UserID: user, Name: "trashed", TrashedAt: &trashed},
+		{ID: "mine", UserID: user, Name: "mine"},
+	}).Error)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, _ := zw.Create("docs/readme.md")
+	f.Write([]byte("# Readme"))
+	require.NoError(t, zw.Close())
+
+	upload := func(folderID string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("folderId", folderID)
+		part, _ := writer.CreateFormFile("file", "bundle.zip")
+		part.Write(buf.Bytes())
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/api/v1/documents", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", user)
+		docHandler.Upload(ctx)
+		return w
+	}
+
+	// 其他用户的文件夹与回收站中的文件夹都不能作为上传目标，也不会在其下展开压缩包
+	for _, folderID := range []string{"foreign", "trashed", "missing"} {
+		assert.Equal(t, http.StatusBadRequest, upload(folderID).Code, folderID)
+	}
+	var folders, docs int64
+	db.Model(&models.Folder{}).Where("parent_id <> ''").Count(&folders)
+	db.Model(&models.Document{}).Count(&docs)
+	assert.Zero(t, folders)
+	assert.Zero(t, docs)
+
+	assert.Equal(t, http.StatusCreated, upload("mine").Code)
+	var bundle models.Folder
+	require.NoError(t, db.First(&bundle, "user_id = ? AND name = ?", user, "bundle").Error)
+	assert.Equal(t, "mine", bundle.ParentID)
+}
+
+func TestDocumentDedupeAndVersions(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	v1 := uploadDocument(t, db, docHandler, "ver-user", "report.md", "# 周报\n\n本周完成登录模块。\n")
+	assert.Equal(t, 1, v1.Version)
+	assert.NotEmpty(t, v1.ContentHash)
+
+	// 相同内容（无论文件名）返回已有文档
+	dup := postDocument(t, docHandler, "ver-user", "report-copy.md", "# 周报\n\n本周完成登录模块。\n")
+	assert.True(t, dup.Duplicate)
+	assert.Equal(t, v1.ID, dup.ID)
+	// 其他用户上传相同内容时各自独立
+	other := postDocument(t, docHandler, "other-user", "report.md", "# 周报\n\n本周完成登录模块。\n")
+	assert.False(t, other.Duplicate)
+	assert.NotEqual(t, v1.ID, other.ID)
+
+	// 同一文件夹下同名文件成为新版本，检索只使用当前版本
+	v2 := uploadDocument(t, db, docHandler, "ver-user", "report.md", "# 周报\n\n本周完成支付模块。\n\n下周计划联调。\n")
+	assert.Equal(t, v1.ID, v2.ID)
+	assert.Equal(t, 2, v2.Version)
+	var docs int64
+	db.Model(&models.Document{}).Where("user_id = ?", "ver-user").Count(&docs)
+	assert.Equal(t, int64(1), docs)
+	var stale int64
+	db.Model(&models.DocumentChunk{}).Where("document_id = ? AND content LIKE ?", v1.ID, "%登录%").Count(&stale)
+	assert.Zero(t, stale)
+
+	call := func(fn func(*gin.Context), method, target string, params gin.Params) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, target, nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Params = append(gin.Params{{Key: "id", Value: v1.ID}}, params...)
+		ctx.Set("userId", "ver-user")
+		fn(ctx)
+		return w
+	}
+
+	w := call(docHandler.ListVersions, "GET", "/api/v1/documents/"+v1.ID+"/versions", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data struct {
+			CurrentVersion int                      `json:"currentVersion"`
+			Versions       []models.DocumentVersion `json:"versions"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data.Versions, 2)
+	assert.Equal(t, 2, list.Data.CurrentVersion)
+	assert.Equal(t, 2, list.Data.Versions[0].Version)
+	assert.NotEqual(t, list.Data.Versions[0].ContentHash, list.Data.Versions[1].ContentHash)
+
+	w = call(docHandler.DiffVersions, "GET", "/api/v1/documents/"+v1.ID+"/versions/diff", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var diff struct {
+		Data struct {
+			Added   int    `json:"added"`
+			Removed int    `json:"removed"`
+			Unified string `json:"unified"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, 3, diff.Data.Added)
+	assert.Equal(t, 1, diff.Data.Removed)
+	assert.Contains(t, diff.Data.Unified, "-本周完成登录模块。\n+本周完成支付模块。")
+	assert.Equal(t, http.StatusNotFound, call(docHandler.DiffVersions, "GET", "/api/v1/documents/"+v1.ID+"/versions/diff?from=9", nil).Code)
+
+	// 恢复旧版本生成新版本并重新入库
+	assert.Equal(t, http.StatusBadRequest, call(docHandler.RestoreVersion, "POST", "/", gin.Params{{Key: "version", Value: "2"}}).Code)
+	w = call(docHandler.RestoreVersion, "POST", "/", gin.Params{{Key: "version", Value: "1"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var restored models.Document
+	require.Eventually(t, func() bool {
+		db.First(&restored, "id = ?", v1.ID)
+		return restored.Status == "completed" && restored.Version == 3
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, v1.ContentHash, restored.ContentHash)
+	var chunk models.DocumentChunk
+	require.NoError(t, db.Where("document_id = ?", v1.ID).First(&chunk).Error)
+	assert.Contains(t, chunk.Content, "登录模块")
+	var v3 models.DocumentVersion
+	require.NoError(t, db.Where("document_id = ? AND version = ?", v1.ID, 3).First(&v3).Error)
+	assert.Equal(t, 1, v3.RestoredFrom)
+
+	// 删除文档时删除全部版本文件
+	del := call(docHandler.Delete, "DELETE", "/", nil)
+	require.Equal(t, http.StatusOK, del.Code)
+	for _, path := range []string{v1.FilePath, v2.FilePath} {
+		_, err := os.Stat(filepath.Join(os.Getenv("UPLOAD_DIR"), path))
+		assert.True(t, os.IsNotExist(err), path)
+	}
+	var versions int64
+	db.Model(&models.DocumentVersion{}).Where("document_id = ?", v1.ID).Count(&versions)
+	assert.Zero(t, versions)
+}
+
+func TestDocumentDownloadRange(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	const content = "# 下载\n\n0123456789\n"
+	doc := uploadDocument(t, db, docHandler, "dl-user", "notes.md", content)
+	assert.False(t, filepath.IsAbs(doc.FilePath))
+
+	download := func(rangeHeader string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Params = gin.Params{{Key: "id", Value: doc.ID}}
+		ctx.Set("userId", "dl-user")
+		docHandler.Download(ctx)
+		return w
+	}
+
+	w := download("")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, content, w.Body.String())
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "notes.md")
+
+	w = download("bytes=10-13")
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "0123", w.Body.String())
+	assert.Equal(t, "bytes 10-13/"+strconv.Itoa(len(content)), w.Header().Get("Content-Range"))
+
+	// 原文件丢失时返回 404
+	require.NoError(t, os.Remove(filepath.Join(os.Getenv("UPLOAD_DIR"), doc.FilePath)))
+	assert.Equal(t, http.StatusNotFound, download("").Code)
+}
+
+func TestDocumentResumableUpload(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("userId", "resume-user") })
+	router.POST("/uploads", docHandler.InitUpload)
+	router.GET("/uploads/:id", docHandler.GetUpload)
+	router.PUT("/uploads/:id/parts/:number", docHandler.UploadPart)
+	router.POST("/uploads/:id/complete", docHandler.CompleteUpload)
+	router.DELETE("/uploads/:id", docHandler.AbortUpload)
+
+	send := func(method, target string, body []byte, header map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, target, bytes.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	digest := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+	var session struct {
+		Data struct {
+			ID            string `json:"id"`
+			TotalParts    int    `json:"totalParts"`
+			UploadedParts []int  `json:"uploadedParts"`
+		} `json:"data"`
+	}
+
+	const content = "# 大文件\n\n第一部分内容。\n\n## 第二节\n\n第二部分内容。\n"
+	init := func(name string) {
+		payload, _ := json.Marshal(map[string]interface{}{"fileName": name, "fileSize": len(content), "chunkSize": 16, "checksum": digest(content)})
+		w := send("POST", "/uploads", payload, nil)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	}
+	init("big.md")
+	parts := []string{}
+	for i := 0; i < len(content); i += 16 {
+		parts = append(parts, content[i:min(i+16, len(content))])
+	}
+	require.Equal(t, len(parts), session.Data.TotalParts)
+	id := session.Data.ID
+
+	payload, _ := json.Marshal(map[string]interface{}{"fileName": "tool.exe", "fileSize": 10})
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/uploads", payload, nil).Code)
+	// 文件夹与公司必须属于当前用户
+	payload, _ = json.Marshal(map[string]interface{}{"fileName": "big.md", "fileSize": 10, "folderId": "missing"})
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/uploads", payload, nil).Code)
+	require.NoError(t, db.Create(&models.Company{ID: "other-co", OwnerID: "someone"}).Error)
+	payload, _ = json.Marshal(map[string]interface{}{"fileName": "big.md", "fileSize": 10, "companyId": "other-co"})
+	assert.Equal(t, http.StatusForbidden, send("POST", "/uploads", payload, nil).Code)
+
+	putPart := func(n int, data string, checksum string) *httptest.ResponseRecorder {
+		return send("PUT", "/uploads/"+id+"/parts/"+strconv.Itoa(n), []byte(data), map[string]string{"X-Checksum-SHA256": checksum})
+	}
+	assert.Equal(t, http.StatusBadRequest, putPart(1, parts[0], digest("bad")).Code)
+	for n := 1; n < len(parts); n++ {
+		require.Equal(t, http.StatusOK, putPart(n, parts[n-1], digest(parts[n-1])).Code)
+	}
+
+	// 连接中断后查询已上传的分片并续传
+	assert.Equal(t, http.StatusConflict, send("POST", "/uploads/"+id+"/complete", nil, nil).Code)
+	w := send("GET", "/uploads/"+id, nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.Len(t, session.Data.UploadedParts, len(parts)-1)
+	last := len(parts)
+	require.Equal(t, http.StatusOK, putPart(last, parts[last-1], digest(parts[last-1])).Code)
+
+	w = send("POST", "/uploads/"+id+"/complete", nil, nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var completed struct {
+		Data models.Document `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &completed))
+	assert.Equal(t, "big.md", completed.Data.Name)
+	assert.Equal(t, digest(content), completed.Data.ContentHash)
+	assert.Equal(t, int64(len(content)), completed.Data.FileSize)
+	require.Eventually(t, func() bool {
+		var doc models.Document
+		db.First(&doc, "id = ?", completed.Data.ID)
+		return doc.Status == "completed" && doc.ChunkCount > 0
+	}, 5*time.Second, 20*time.Millisecond)
+	stored, err := os.ReadFile(filepath.Join(os.Getenv("UPLOAD_DIR"), completed.Data.FilePath))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(stored))
+
+	// 重复提交返回同一文档
+	w = send("POST", "/uploads/"+id+"/complete", nil, nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), completed.Data.ID)
+
+	// 取消上传删除会话
+	init("other.md")
+	id = session.Data.ID
+	require.Equal(t, http.StatusOK, putPart(1, parts[0], digest(parts[0])).Code)
+	require.Equal(t, http.StatusOK, send("DELETE", "/uploads/"+id, nil, nil).Code)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/uploads/"+id, nil, nil).Code)
+	var remaining int64
+	db.Model(&models.UploadPart{}).Count(&remaining)
+	assert.Zero(t, remaining)
+}
+
+func TestDocumentArchiveUpload(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	const user = "archive-user"
+
+	post := func(filename string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		part.Write(content)
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/api/v1/documents", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", user)
+		docHandler.Upload(ctx)
+		return w
+	}
+	type uploadResponse struct {
+		Data    []models.Document `json:"data"`
+		Skipped []struct {
+			Path   string `json:"path"`
+			Reason string `json:"reason"`
+		} `json:"skipped"`
+	}
+
+	email := "From: alice@example.com\r\nSubject: Plan\r\nMessage-ID: <plan@example.com>\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nsee attached plan\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=plan.txt\r\n\r\nattached plan body\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=tool.exe\r\n\r\nMZ\r\n" +
+		"--b--\r\n"
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"readme.md":            "# Readme",
+		"guides/setup.txt":     "setup guide",
+		"guides/run.sh":        "echo hi",
+		"mail/plan.eml":        email,
+		"nested/inner.zip":     "PK",
+		"__MACOSX/._readme.md": "meta",
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	require.NoError(t, zw.Close())
+
+	w := post("bundle.zip", buf.Bytes())
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp uploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	// 目录结构镜像为文件夹树：bundle/guides、bundle/mail
+	var folders []models.Folder
+	db.Where("user_id = ?", user).Find(&folders)
+	byName := map[string]models.Folder{}
+	for _, f := range folders {
+		byName[f.Name] = f
+	}
+	require.Len(t, folders, 3)
+	root := byName["bundle"]
+	assert.Equal(t, "", root.ParentID)
+	assert.Equal(t, root.ID, byName["guides"].ParentID)
+	assert.Equal(t, root.ID, byName["mail"].ParentID)
+
+	docs := map[string]models.Document{}
+	for _, d := range resp.Data {
+		docs[d.Name] = d
+	}
+	require.Len(t, docs, 4, w.Body.String())
+	assert.Equal(t, root.ID, docs["readme.md"].FolderID)
+	assert.Equal(t, byName["guides"].ID, docs["setup.txt"].FolderID)
+	assert.Equal(t, "eml", docs["plan.eml"].FileType)
+	assert.Equal(t, docs["plan.eml"].ID, docs["plan.txt"].ParentID)
+	assert.Equal(t, byName["mail"].ID, docs["plan.txt"].FolderID)
+
+	var metadata struct {
+		Email map[string]string `json:"email"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(docs["plan.eml"].Metadata), &metadata))
+	assert.Equal(t, "Plan", metadata.Email["subject"])
+	assert.Equal(t, "<plan@example.com>", metadata.Email["messageId"])
+
+	skipped := map[string]string{}
+	for _, entry := range resp.Skipped {
+		skipped[entry.Path] = entry.Reason
+	}
+	assert.Equal(t, map[string]string{
+		"guides/run.sh":          "file type not allowed",
+		"nested/inner.zip":       "nested archives are not expanded",
+		"mail/plan.eml/tool.exe": "file type not allowed",
+	}, skipped)
+
+	// 邮件与附件都进入入库队列
+	var plan models.Document
+	require.Eventually(t, func() bool {
+		db.First(&plan, "id = ?", docs["plan.eml"].ID)
+		return plan.Status == "completed"
+	}, 5*time.Second, 20*time.Millisecond)
+	var chunks []models.DocumentChunk
+	db.Where("document_id = ?", plan.ID).Find(&chunks)
+	require.NotEmpty(t, chunks)
+	assert.Contains(t, chunks[0].Content, "see attached plan")
+
+	// mbox 拆分为单封邮件，主题相同的邮件分别保存
+	mbox := "From alice@example.com Mon Mar  2 10:00:00 2026\nSubject: Weekly\n\nfirst week\n\n" +
+		"From bob@example.com Mon Mar  9 10:00:00 2026\nSubject: Weekly\n\nsecond week\n"
+	w = post("archive.mbox", []byte(mbox))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	resp = uploadResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 2)
+	assert.Equal(t, "Weekly.eml", resp.Data[0].Name)
+	assert.Equal(t, "Weekly (2).eml", resp.Data[1].Name)
+	var mboxFolder models.Folder
+	require.NoError(t, db.First(&mboxFolder, "user_id = ? AND name = ?", user, "archive").Error)
+	assert.Equal(t, mboxFolder.ID, resp.Data[0].FolderID)
+
+	// 只包含不支持文件的压缩包
+	buf.Reset()
+	zw = zip.NewWriter(&buf)
+	f, _ := zw.Create("tool.exe")
+	f.Write([]byte("MZ"))
+	require.NoError(t, zw.Close())
+	w = post("tools.zip", buf.Bytes())
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "tool.exe")
+}
+
+func TestDocumentDeleteOrder(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	const user = "delete-user"
+
+	email := "From: alice@example.com\r\nSubject: Budget\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nbudget attached\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=budget.txt\r\n\r\nbudget body\r\n" +
+		"--b--\r\n"
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "budget.eml")
+	require.NoError(t, err)
+	part.Write([]byte(email))
+	writer.Close()
+	req, _ := http.NewRequest("POST", "/api/v1/documents", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = req
+	ctx.Set("userId", user)
+	docHandler.Upload(ctx)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		Data []models.Document `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	docs := map[string]models.Document{}
+	for _, d := range resp.Data {
+		docs[d.Name] = d
+	}
+	mail, attachment := docs["budget.eml"], docs["budget.txt"]
+	require.Equal(t, mail.ID, attachment.ParentID)
+	require.Eventually(t, func() bool {
+		var pending int64
+		db.Model(&models.Document{}).Where("user_id = ? AND status <> ?", user, "completed").Count(&pending)
+		return pending == 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	remove := func(id string) int {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request, _ = http.NewRequest("DELETE", "/api/v1/documents/"+id, nil)
+		ctx.Params = gin.Params{{Key: "id", Value: id}}
+		ctx.Set("userId", user)
+		docHandler.Delete(ctx)
+		return w.Code
+	}
+	mailFile := filepath.Join(os.Getenv("UPLOAD_DIR"), mail.FilePath)
+
+	// 数据库删除失败时事务回滚，文件与版本、分块都保留
+	require.NoError(t, db.Exec("CREATE TRIGGER block_delete BEFORE DELETE ON documents BEGIN SELECT RAISE(ABORT, 'blocked'); END").Error)
+	assert.Equal(t, http.StatusInternalServerError, remove(mail.ID))
+	_, err = os.Stat(mailFile)
+	assert.NoError(t, err)
+	var versions, chunks int64
+	db.Model(&models.DocumentVersion{}).Where("document_id = ?", mail.ID).Count(&versions)
+	db.Model(&models.DocumentChunk{}).Where("document_id = ?", mail.ID).Count(&chunks)
+	assert.NotZero(t, versions)
+	assert.NotZero(t, chunks)
+	require.NoError(t, db.Exec("DROP TRIGGER block_delete").Error)
+
+	// 删除邮件后附件保留为独立文档
+	require.Equal(t, http.StatusOK, remove(mail.ID))
+	_, err = os.Stat(mailFile)
+	assert.True(t, os.IsNotExist(err))
+	var kept models.Document
+	require.NoError(t, db.First(&kept, "id = ?", attachment.ID).Error)
+	assert.Empty(t, kept.ParentID)
+	db.Model(&models.DocumentChunk{}).Where("document_id = ?", mail.ID).Count(&chunks)
+	assert.Zero(t, chunks)
+}
+
+func TestDocumentTagsAndFacets(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	const user = "facet-user"
+
+	call := func(fn func(*gin.Context), method, target, id string, body interface{}) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&payload).Encode(body)
+		}
+		req, _ := http.NewRequest(method, target, &payload)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		if id != "" {
+			ctx.Params = gin.Params{{Key: "id", Value: id}}
+		}
+		ctx.Set("userId", user)
+		fn(ctx)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w
+	}
+	type facetValue struct {
+		Value string `json:"value"`
+		Count int64  `json:"count"`
+	}
+	counts := func(values []facetValue) map[string]int64 {
+		out := map[string]int64{}
+		for _, v := range values {
+			out[v.Value] = v.Count
+		}
+		return out
+	}
+
+	handbook := uploadDocument(t, db, docHandler, user, "handbook.md", "# 员工手册\n\n年假按工龄计算。\n")
+	policy := uploadDocument(t, db, docHandler, user, "policy.txt", "年假需提前一周申请。")
+	expense := uploadDocument(t, db, docHandler, user, "expense.md", "报销需在 30 天内提交。")
+	require.NoError(t, db.Model(&models.Document{}).Where("id = ?", expense.ID).Update("company_id", "acme").Error)
+	// 旧版本写在元数据中的标签在启动时补写
+	legacy := models.Document{ID: models.NewUUID(), UserID: user, Name: "legacy.pdf", FileType: "pdf", Status: "failed",
+		Metadata: models.JSON(`{"tags":["归档"," 制度 "]}`)}
+	require.NoError(t, db.Create(&legacy).Error)
+	migrated, err := documentSvc.BackfillTags(db)
+	require.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+
+	call(docHandler.BatchUpdateTags, "PUT", "/", "", gin.H{"ids": []string{handbook.ID, policy.ID}, "tags": []string{"制度", "人事", "制度", " "}})
+	w := call(docHandler.Update, "PUT", "/", expense.ID, gin.H{"tags": []string{"财务"}, "description": "报销规定"})
+	var updated struct {
+		Data models.Document `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Contains(t, string(updated.Data.Metadata), "报销规定")
+	assert.Contains(t, string(updated.Data.Metadata), "财务")
+
+	var tags struct {
+		Data []documentSvc.TagCount `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(call(docHandler.ListTags, "GET", "/", "", nil).Body.Bytes(), &tags))
+	assert.Equal(t, []documentSvc.TagCount{{Tag: "制度", Count: 3}, {Tag: "人事", Count: 2}, {Tag: "归档", Count: 1}, {Tag: "财务", Count: 1}}, tags.Data)
+
+	type listResponse struct {
+		Data   []models.Document       `json:"data"`
+		Facets map[string][]facetValue `json:"facets"`
+	}
+	list := func(query string) listResponse {
+		var resp listResponse
+		require.NoError(t, json.Unmarshal(call(docHandler.List, "GET", "/api/v1/documents?"+query, "", nil).Body.Bytes(), &resp))
+		return resp
+	}
+
+	all := list("")
+	assert.Len(t, all.Data, 4)
+	assert.Equal(t, map[string]int64{"md": 2, "txt": 1, "pdf": 1}, counts(all.Facets["fileType"]))
+	assert.Equal(t, map[string]int64{"completed": 3, "failed": 1}, counts(all.Facets["status"]))
+	assert.Equal(t, map[string]int64{"acme": 1}, counts(all.Facets["company"]))
+
+	// 维度内取并集，维度间取交集；分面计数不受该维度自身过滤的影响
+	filtered := list("tags=制度&type=md,txt")
+	require.Len(t, filtered.Data, 2)
+	assert.ElementsMatch(t, []string{handbook.ID, policy.ID}, []string{filtered.Data[0].ID, filtered.Data[1].ID})
+	assert.Equal(t, map[string]int64{"md": 1, "txt": 1, "pdf": 1}, counts(filtered.Facets["fileType"]))
+	assert.Equal(t, map[string]int64{"制度": 2, "人事": 2, "财务": 1}, counts(filtered.Facets["tags"]))
+	assert.Len(t, list("tags=财务,归档").Data, 2)
+	assert.Len(t, list("companyId=acme&status=completed").Data, 1)
+	assert.Empty(t, list("tags=不存在").Data)
+
+	type searchResponse struct {
+		Data struct {
+			Documents []map[string]interface{} `json:"documents"`
+			Facets    map[string][]facetValue  `json:"facets"`
+		} `json:"data"`
+	}
+	search := func(payload gin.H) searchResponse {
+		var resp searchResponse
+		require.NoError(t, json.Unmarshal(call(docHandler.Search, "POST", "/", "", payload).Body.Bytes(), &resp))
+		return resp
+	}
+	hits := search(gin.H{"query": "年假"})
+	assert.Len(t, hits.Data.Documents, 2)
+	assert.Equal(t, map[string]int64{"md": 1, "txt": 1}, counts(hits.Data.Facets["fileType"]))
+	assert.Equal(t, map[string]int64{"制度": 2, "人事": 2}, counts(hits.Data.Facets["tags"]))
+	hits = search(gin.H{"query": "年假", "filters": gin.H{"type": "txt"}})
+	require.Len(t, hits.Data.Documents, 1)
+	assert.Equal(t, policy.ID, hits.Data.Documents[0]["id"])
+	assert.Equal(t, map[string]int64{"md": 1, "txt": 1}, counts(hits.Data.Facets["fileType"]))
+	assert.Len(t, search(gin.H{"filters": gin.H{"tags": "制度", "status": "failed"}}).Data.Documents, 1)
+
+	// 删除文档时移除其标签
+	call(docHandler.Delete, "DELETE", "/", legacy.ID, nil)
+	var remaining int64
+	db.Model(&models.DocumentTag{}).Where("document_id = ?", legacy.ID).Count(&remaining)
+	assert.Zero(t, remaining)
+}
+
+func TestFolderHierarchy(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	const user = "folder-user"
+
+	call := func(fn func(*gin.Context), method, target, id string, body interface{}) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&payload).Encode(body)
+		}
+		req, _ := http.NewRequest(method, target, &payload)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		if id != "" {
+			ctx.Params = gin.Params{{Key: "id", Value: id}}
+		}
+		ctx.Set("userId", user)
+		fn(ctx)
+		return w
+	}
+	create := func(name, parentID string) models.Folder {
+		w := call(docHandler.CreateFolder, "POST", "/", "", gin.H{"name": name, "parentId": parentID})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			Data models.Folder `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data
+	}
+
+	// a/b/c，a 与 c 中各有一个文档
+	a := create("产品", "")
+	b := create("需求", a.ID)
+	c := create("评审", b.ID)
+	assert.Equal(t, http.StatusBadRequest, call(docHandler.CreateFolder, "POST", "/", "", gin.H{"name": "x", "parentId": "missing"}).Code)
+	docA := models.Document{ID: models.NewUUID(), UserID: user, Name: "a.md", FolderID: a.ID, Status: "completed"}
+	docC := models.Document{ID: models.NewUUID(), UserID: user, Name: "c.md", FolderID: c.ID, Status: "completed"}
+	require.NoError(t, db.Create(&docA).Error)
+	require.NoError(t, db.Create(&docC).Error)
+
+	// 重命名与移动，移到自身子孙下时拒绝
+	assert.Equal(t, http.StatusBadRequest, call(docHandler.UpdateFolder, "PUT", "/", a.ID, gin.H{"parentId": c.ID}).Code)
+	assert.Equal(t, http.StatusBadRequest, call(docHandler.UpdateFolder, "PUT", "/", a.ID, gin.H{"parentId": a.ID}).Code)
+	w := call(docHandler.UpdateFolder, "PUT", "/", b.ID, gin.H{"name": "需求文档"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "需求文档")
+	require.Equal(t, http.StatusOK, call(docHandler.UpdateFolder, "PUT", "/", c.ID, gin.H{"parentId": ""}).Code)
+	require.Equal(t, http.StatusOK, call(docHandler.UpdateFolder, "PUT", "/", c.ID, gin.H{"parentId": b.ID}).Code)
+
+	// 面包屑
+	w = call(docHandler.FolderPath, "GET", "/", c.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var path struct {
+		Data []models.Folder `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &path))
+	require.Len(t, path.Data, 3)
+	assert.Equal(t, []string{a.ID, b.ID, c.ID}, []string{path.Data[0].ID, path.Data[1].ID, path.Data[2].ID})
+
+	// 子树与文档计数
+	w = call(docHandler.FolderTree, "GET", "/?root="+b.ID, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var tree struct {
+		Data struct {
+			Folders []struct {
+				ID                 string `json:"id"`
+				DocumentCount      int64  `json:"documentCount"`
+				TotalDocumentCount int64  `json:"totalDocumentCount"`
+				Children           []struct {
+					ID string `json:"id"`
+				} `json:"children"`
+			} `json:"folders"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	require.Len(t, tree.Data.Folders, 1)
+	assert.Equal(t, int64(0), tree.Data.Folders[0].DocumentCount)
+	assert.Equal(t, int64(1), tree.Data.Folders[0].TotalDocumentCount)
+	require.Len(t, tree.Data.Folders[0].Children, 1)
+	assert.Equal(t, c.ID, tree.Data.Folders[0].Children[0].ID)
+
+	// 移入回收站：子文件夹与文档一并隐藏
+	w = call(docHandler.DeleteFolder, "DELETE", "/", b.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = call(docHandler.ListFolders, "GET", "/", "", nil)
+	assert.Contains(t, w.Body.String(), a.ID)
+	assert.NotContains(t, w.Body.String(), c.ID)
+	w = call(docHandler.List, "GET", "/", "", nil)
+	assert.Contains(t, w.Body.String(), docA.ID)
+	assert.NotContains(t, w.Body.String(), docC.ID)
+	w = call(docHandler.ListTrash, "GET", "/", "", nil)
+	var trash struct {
+		Data []struct {
+			ID            string `json:"id"`
+			FolderCount   int    `json:"folderCount"`
+			DocumentCount int64  `json:"documentCount"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &trash))
+	require.Len(t, trash.Data, 1)
+	assert.Equal(t, b.ID, trash.Data[0].ID)
+	assert.Equal(t, 2, trash.Data[0].FolderCount)
+	assert.Equal(t, int64(1), trash.Data[0].DocumentCount)
+	assert.Equal(t, http.StatusConflict, call(docHandler.DeleteFolder, "DELETE", "/", b.ID, nil).Code)
+
+	// 上级文件夹也进入回收站后，恢复 b 时移到根目录
+	require.Equal(t, http.StatusOK, call(docHandler.DeleteFolder, "DELETE", "/", a.ID, nil).Code)
+	w = call(docHandler.RestoreFolder, "POST", "/", b.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var restoredB, restoredC models.Folder
+	var restoredDoc models.Document
+	db.First(&restoredB, "id = ?", b.ID)
+	db.First(&restoredC, "id = ?", c.ID)
+	db.First(&restoredDoc, "id = ?", docC.ID)
+	assert.Empty(t, restoredB.ParentID)
+	assert.Nil(t, restoredB.TrashedAt)
+	assert.Equal(t, b.ID, restoredC.ParentID)
+	assert.Nil(t, restoredC.TrashedAt)
+	assert.Nil(t, restoredDoc.TrashedAt)
+
+	// 永久删除并保留文档：文档移到上级目录（根目录）
+	w = call(docHandler.DeleteFolder, "DELETE", "/?mode=permanent&documents=move", b.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var folders int64
+	db.Model(&models.Folder{}).Where("id IN ?", []string{b.ID, c.ID}).Count(&folders)
+	assert.Zero(t, folders)
+	db.First(&restoredDoc, "id = ?", docC.ID)
+	assert.Empty(t, restoredDoc.FolderID)
+
+	// 永久删除回收站中的文件夹时其中的文档一并删除
+	require.Equal(t, http.StatusOK, call(docHandler.DeleteFolder, "DELETE", "/?mode=permanent", a.ID, nil).Code)
+	var docs int64
+	db.Model(&models.Document{}).Where("id = ?", docA.ID).Count(&docs)
+	assert.Zero(t, docs)
+	assert.Equal(t, http.StatusBadRequest, call(docHandler.DeleteFolder, "DELETE", "/?mode=archive", c.ID, nil).Code)
+}
+
+func TestDocumentImportURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>报销制度</title></head><body><nav>首页</nav>
+			<main><h1>报销制度</h1><p>差旅费用需在出差结束后十个工作日内提交报销申请。</p></main></body></html>`))
+	}))
+	defer server.Close()
+	t.Setenv("URL_IMPORT_ALLOW_PRIVATE", "true")
+	db, docHandler := setupDocumentHandler(t)
+
+	call := func(body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", "/api/v1/documents/import-url", bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", "import-user")
+		docHandler.ImportURL(ctx)
+		return w
+	}
+
+	w := call(gin.H{"url": server.URL + "/policy", "refreshInterval": 1440})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		Data struct {
+			Documents []models.Document `json:"documents"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data.Documents, 1)
+	assert.Equal(t, server.URL+"/policy", resp.Data.Documents[0].SourceURL)
+	assert.Equal(t, 1440, resp.Data.Documents[0].RefreshInterval)
+
+	// 导入的文档走正常入库流程
+	var doc models.Document
+	require.Eventually(t, func() bool {
+		db.First(&doc, "id = ?", resp.Data.Documents[0].ID)
+		return doc.Status == "completed" && doc.ChunkCount > 0
+	}, 5*time.Second, 20*time.Millisecond)
+	var chunk models.DocumentChunk
+	require.NoError(t, db.Where("document_id = ?", doc.ID).First(&chunk).Error)
+	assert.Contains(t, chunk.Content, "十个工作日")
+	assert.NotContains(t, chunk.Content, "首页")
+
+	assert.Equal(t, http.StatusBadRequest, call(gin.H{"url": "file:///etc/passwd"}).Code)
+	assert.Equal(t, http.StatusBadRequest, call(gin.H{"url": server.URL, "folderId": "missing"}).Code)
+	assert.Equal(t, http.StatusForbidden, call(gin.H{"url": server.URL, "companyId": "not-mine"}).Code)
+	assert.Equal(t, http.StatusBadGateway, call(gin.H{"url": "http://127.0.0.1:1/unreachable"}).Code)
+}
+
+func TestDocumentChunkStrategies(t *testing.T) {
+	db, docHandler := setupDocumentHandler(t)
+	const user = "chunk-user"
+
+	call := func(fn func(*gin.Context), id string, body interface{}) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		json.NewEncoder(&payload).Encode(body)
+		req, _ := http.NewRequest("POST", "/", &payload)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		if id != "" {
+			ctx.Params = gin.Params{{Key: "id", Value: id}}
+		}
+		ctx.Set("userId", user)
+		fn(ctx)
+		return w
+	}
+	strategies := func(documentID string) []string {
+		var used []string
+		db.Model(&models.DocumentChunk{}).Where("document_id = ?", documentID).Distinct().Pluck("strategy", &used)
+		return used
+	}
+	rechunk := func(body interface{}) []string {
+		w := call(docHandler.Rechunk, "", body)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		var resp struct {
+			Data struct {
+				Queued []string `json:"queued"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data.Queued
+	}
+
+	// 未配置时按文件类型选择策略
+	sheet := uploadDocument(t, db, docHandler, user, "sales.csv", "区域,金额\n华东,10\n华南,20\n")
+	notes := uploadDocument(t, db, docHandler, user, "notes.md", "# 笔记\n\n第一句。第二句。\n")
+	assert.Equal(t, []string{"table"}, strategies(sheet.ID))
+	assert.Equal(t, []string{"markdown"}, strategies(notes.ID))
+
+	assert.Equal(t, http.StatusBadRequest, call(docHandler.CreateFolder, "", gin.H{"name": "x", "chunkStrategy": "paragraph"}).Code)
+	w := call(docHandler.CreateFolder, "", gin.H{"name": "制度", "chunkStrategy": "sentence"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		Data models.Folder `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	w = call(docHandler.CreateFolder, "", gin.H{"name": "子目录", "parentId": created.Data.ID})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var child struct {
+		Data models.Folder `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &child))
+	require.NoError(t, db.Model(&models.Document{}).Where("id = ?", notes.ID).Update("folder_id", child.Data.ID).Error)
+
+	// 只重新分块策略与当前配置不一致的文档，子文件夹沿用上级配置
+	assert.Equal(t, []string{notes.ID}, rechunk(gin.H{"outdated": true}))
+	require.Eventually(t, func() bool {
+		used := strategies(notes.ID)
+		return len(used) == 1 && used[0] == "sentence"
+	}, 5*time.Second, 20*time.Millisecond)
+	var job models.IngestionJob
+	require.Eventually(t, func() bool {
+		db.Where("document_id = ?", notes.ID).Order("created_at DESC").First(&job)
+		return job.Status == "completed"
+	}, 5*time.Second, 20*time.Millisecond)
+	stages := ingest.Stages(&job)
+	assert.Equal(t, "completed", stages[1].Status)
+	assert.Equal(t, "skipped", stages[3].Status)
+	assert.Equal(t, "skipped", stages[4].Status)
+
+	assert.Empty(t, rechunk(gin.H{"outdated": true}))
+	assert.Equal(t, []string{sheet.ID}, rechunk(gin.H{"strategy": "table"}))
+	assert.Equal(t, http.StatusBadRequest, call(docHandler.Rechunk, "", gin.H{"strategy": "auto"}).Code)
+
+	// 清除文件夹配置后恢复按文件类型选择
+	w = call(docHandler.UpdateFolder, created.Data.ID, gin.H{"chunkStrategy": ""})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Eventually(t, func() bool {
+		var active int64
+		db.Model(&models.IngestionJob{}).Where("status <> ?", "completed").Count(&active)
+		return active == 0
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, []string{notes.ID}, rechunk(gin.H{"outdated": true, "folderId": created.Data.ID}))
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"rolecraft-ai/internal/models"
+	documentSvc "rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/upload"
+)
+
+// 分片上传：POST /documents/uploads 创建会话，PUT /documents/uploads/:id/parts/:number 上传分片
+// （请求体为分片内容，X-Checksum-SHA256 头为其 SHA-256），GET /documents/uploads/:id 查询已上传的分片以便续传，
+// POST /documents/uploads/:id/complete 合并为文档并进入入库队列，DELETE /documents/uploads/:id 取消上传
+
+// uploadSessionView 上传会话及已上传的分片序号
+type uploadSessionView struct {
+	models.UploadSession
+	UploadedParts []int `json:"uploadedParts"`
+}
+
+// uploadErrorStatus 分片上传错误对应的 HTTP 状态码
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, upload.ErrSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, upload.ErrNotUploading), errors.Is(err, upload.ErrIncomplete):
+		return http.StatusConflict
+	case errors.Is(err, upload.ErrInvalidSession), errors.Is(err, upload.ErrInvalidPart),
+		errors.Is(err, upload.ErrPartSize), errors.Is(err, upload.ErrChecksumRequired),
+		errors.Is(err, upload.ErrChecksumMismatch):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// uploadSession 读取当前用户的上传会话，失败时写入错误响应
+func (h *DocumentHandler) uploadSession(c *gin.Context) (*models.UploadSession, bool) {
+	userId, _ := c.Get("userId")
+	userIdStr, _ := userId.(string)
+	if userIdStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+	session, err := h.uploads.Get(c.Param("id"), userIdStr)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return session, true
+}
+
+func (h *DocumentHandler) uploadSessionView(session *models.UploadSession) (uploadSessionView, error) {
+	view := uploadSessionView{UploadSession: *session, UploadedParts: []int{}}
+	parts, err := h.uploads.Parts(session.ID)
+	for _, part := range parts {
+		view.UploadedParts = append(view.UploadedParts, part.Number)
+	}
+	return view, err
+}
+
+// InitUpload 创建分片上传会话
+func (h *DocumentHandler) InitUpload(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	userIdStr, _ := userId.(string)
+	if userIdStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req struct {
+		FileName  string `json:"fileName" binding:"required"`
+		FileSize  int64  `json:"fileSize" binding:"required"`
+		ChunkSize int64  `json:"chunkSize"` // 分片大小，默认 8MB
+		Checksum  string `json:"checksum"`  // 整个文件的 SHA-256（可选），合并时校验
+		FolderID  string `json:"folderId"`
+		CompanyID string `json:"companyId"`
+		WorkID    string `json:"workId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !allowedTypes[strings.ToLower(filepath.Ext(req.FileName))] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file type not allowed"})
+		return
+	}
+	// 压缩包与邮件需要在上传时展开，只能通过普通上传提交
+	if isExpandedType(strings.ToLower(filepath.Ext(req.FileName))) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "archives and mailboxes must be uploaded in a single request"})
+		return
+	}
+	if req.FolderID != "" && !h.activeFolderExists(userIdStr, req.FolderID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "folder not found"})
+		return
+	}
+	if req.CompanyID != "" && !documentSvc.IsCompanyMember(h.db, userIdStr, req.CompanyID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this company"})
+		return
+	}
+
+	session, err := h.uploads.Init(upload.InitRequest{
+		UserID:    userIdStr,
+		FileName:  req.FileName,
+		FileSize:  req.FileSize,
+		ChunkSize: req.ChunkSize,
+		Checksum:  req.Checksum,
+		FolderID:  req.FolderID,
+		CompanyID: req.CompanyID,
+		WorkID:    req.WorkID,
+	})
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    uploadSessionView{UploadSession: *session, UploadedParts: []int{}},
+	})
+}
+
+// GetUpload 查询上传会话，客户端据此跳过已上传的分片
+func (h *DocumentHandler) GetUpload(c *gin.Context) {
+	session, ok := h.uploadSession(c)
+	if !ok {
+		return
+	}
+	view, err := h.uploadSessionView(session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    view,
+	})
+}
+
+// UploadPart 上传一个分片，重复上传同一序号时覆盖
+func (h *DocumentHandler) UploadPart(c *gin.Context) {
+	session, ok := h.uploadSession(c)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid part number"})
+		return
+	}
+
+	part, err := h.uploads.PutPart(c.Request.Context(), session, number, c.Request.Body, c.GetHeader("X-Checksum-SHA256"))
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    part,
+	})
+}
+
+// CompleteUpload 合并全部分片并登记为文档；会话已完成时返回之前生成的文档
+func (h *DocumentHandler) CompleteUpload(c *gin.Context) {
+	session, ok := h.uploadSession(c)
+	if !ok {
+		return
+	}
+
+	var document models.Document
+	if session.Status == upload.StatusCompleted {
+		if err := h.db.First(&document, "id = ?", session.DocumentID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+	} else {
+		fileId := models.NewUUID()
+		filePath := fileId + strings.ToLower(filepath.Ext(session.FileName))
+		ctx := c.Request.Context()
+		err := h.uploads.Complete(ctx, session, filePath, func(hash string) (string, error) {
+			doc, err := h.registerFile(ctx, fileId, filePath, session.FileName, session.FileSize, hash,
+				session.UserID, session.FolderID, session.CompanyID, session.WorkID, fileAttributes{})
+			if err != nil {
+				return "", err
+			}
+			document = *doc
+			return doc.ID, nil
+		})
+		if err != nil {
+			c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    200,
+		"message": "document uploaded and processing",
+		"data":    document,
+	})
+}
+
+// AbortUpload 取消上传并删除已上传的分片
+func (h *DocumentHandler) AbortUpload(c *gin.Context) {
+	session, ok := h.uploadSession(c)
+	if !ok {
+		return
+	}
+	if err := h.uploads.Abort(c.Request.Context(), session); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+	})
+}
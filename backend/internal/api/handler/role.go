@@ -17,6 +17,7 @@ import (
 	"rolecraft-ai/internal/config"
 	"rolecraft-ai/internal/models"
 	"rolecraft-ai/internal/service/anythingllm"
+	"rolecraft-ai/internal/service/retrieval"
 )
 
 // RoleHandler 角色处理器
@@ -58,6 +59,22 @@ type CreateRoleRequest struct {
 	ModelConfig    map[string]interface{} `json:"modelConfig" example:"{\"temperature\":0.7}"`
 	IsTemplate     bool                   `json:"isTemplate" example:"false"`
 	IsPublic       bool                   `json:"isPublic" example:"false"`
+	// 知识绑定：创建时可选；更新时省略表示不修改，传空数组表示清空
+	KnowledgeBindings []KnowledgeBindingRequest `json:"knowledgeBindings"`
+}
+
+// KnowledgeBindingRequest 角色知识绑定
+type KnowledgeBindingRequest struct {
+	Type   string `json:"type" example:"folder"` // folder/document/tag/company
+	Target string `json:"target" example:""`     // 文件夹 ID / 文档 ID / 标签 / 公司 ID（公司为空时使用角色所属公司）
+}
+
+// KnowledgeBindingView 带名称的知识绑定，Missing 表示绑定的文件夹、文档或公司已不存在
+type KnowledgeBindingView struct {
+	Type    string `json:"type"`
+	Target  string `json:"target"`
+	Name    string `json:"name"`
+	Missing bool   `json:"missing,omitempty"`
 }
 
 type InstallRoleRequest struct {
@@ -171,8 +188,10 @@ type RoleExport struct {
 	Avatar         string                 `json:"avatar"`
 	ModelConfig    map[string]interface{} `json:"modelConfig"`
 	Skills         []string               `json:"skills"`
-	Version        string                 `json:"version"`
-	ExportedAt     time.Time              `json:"exportedAt"`
+	// 导入到其他账号时按名称匹配同名文件夹与文档
+	KnowledgeBindings []KnowledgeBindingView `json:"knowledgeBindings,omitempty"`
+	Version           string                 `json:"version"`
+	ExportedAt        time.Time              `json:"exportedAt"`
 }
 
 // EnhancedRoleTemplate 增强角色模板
@@ -255,6 +274,7 @@ func (h *RoleHandler) Get(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this role"})
 		return
 	}
+	role.KnowledgeBindings, _ = retrieval.RoleBindings(h.db, role.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -302,8 +322,20 @@ func (h *RoleHandler) Create(c *gin.Context) {
 		role.ModelConfig = models.JSON(configJSON)
 	}
 
-	if result := h.db.Create(&role); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	bindings, err := h.resolveKnowledgeBindings(userIDStr, role.CompanyID, req.KnowledgeBindings)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return createKnowledgeBindings(tx, &role, bindings)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -363,8 +395,26 @@ func (h *RoleHandler) Update(c *gin.Context) {
 		role.ModelConfig = models.JSON(configJSON)
 	}
 
-	if result := h.db.Save(&role); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	var bindings []models.RoleKnowledgeBinding
+	if req.KnowledgeBindings != nil {
+		var err error
+		if bindings, err = h.resolveKnowledgeBindings(userIDStr, role.CompanyID, req.KnowledgeBindings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		if req.KnowledgeBindings == nil {
+			return nil
+		}
+		return replaceKnowledgeBindings(tx, &role, bindings)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -398,6 +448,7 @@ func (h *RoleHandler) Delete(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
+	h.db.Where("role_id = ?", id).Delete(&models.RoleKnowledgeBinding{})
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -824,6 +875,10 @@ func (h *RoleHandler) ExportRole(c *gin.Context) {
 		}
 	}
 
+	if bindings, err := retrieval.RoleBindings(h.db, role.ID); err == nil && len(bindings) > 0 {
+		export.KnowledgeBindings = h.describeKnowledgeBindings(bindings)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
@@ -839,8 +894,12 @@ func (h *RoleHandler) ImportRole(c *gin.Context) {
 		return
 	}
 
+	userID, _ := c.Get("userId")
+	userIDStr, _ := userID.(string)
+
 	role := models.Role{
 		ID:             models.NewUUID(),
+		UserID:         userIDStr,
 		Name:           export.Name,
 		Description:    export.Description,
 		Category:       export.Category,
@@ -856,16 +915,33 @@ func (h *RoleHandler) ImportRole(c *gin.Context) {
 		role.ModelConfig = models.JSON(configJSON)
 	}
 
-	if result := h.db.Create(&role); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	// 导出的绑定指向导出方的文件夹和文档，按 ID 或名称映射到当前用户
+	matched, skipped := h.matchImportedBindings(userIDStr, export.KnowledgeBindings)
+	bindings, err := h.resolveKnowledgeBindings(userIDStr, role.CompanyID, matched)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return createKnowledgeBindings(tx, &role, bindings)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
 		"code":    200,
 		"message": "success",
 		"data":    role,
-	})
+	}
+	if len(skipped) > 0 {
+		response["skippedBindings"] = skipped
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 // GenerateShareLink 生成分享链接
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/retrieval"
+)
+
+// errInvalidBinding 知识绑定的类型或目标无效
+var errInvalidBinding = errors.New("invalid knowledge binding")
+
+// resolveKnowledgeBindings 校验知识绑定：文件夹、文档与公司必须属于当前用户，重复的绑定只保留一个
+func (h *RoleHandler) resolveKnowledgeBindings(userID, roleCompanyID string, reqs []KnowledgeBindingRequest) ([]models.RoleKnowledgeBinding, error) {
+	bindings := make([]models.RoleKnowledgeBinding, 0, len(reqs))
+	seen := map[string]bool{}
+	for _, req := range reqs {
+		kind := strings.ToLower(strings.TrimSpace(req.Type))
+		target := strings.TrimSpace(req.Target)
+		if kind == retrieval.BindingCompany && target == "" {
+			target = roleCompanyID
+		}
+		if target == "" {
+			return nil, fmt.Errorf("%w: %s target is required", errInvalidBinding, kind)
+		}
+
+		var count int64
+		switch kind {
+		case retrieval.BindingFolder:
+			h.db.Model(&models.Folder{}).Where("id = ? AND user_id = ? AND trashed_at IS NULL", target, userID).Count(&count)
+		case retrieval.BindingDocument:
+			h.db.Model(&models.Document{}).Where("id = ? AND user_id = ?", target, userID).Count(&count)
+		case retrieval.BindingCompany:
+			h.db.Model(&models.Company{}).Where("id = ? AND owner_id = ?", target, userID).Count(&count)
+		case retrieval.BindingTag:
+			count = 1
+		default:
+			return nil, fmt.Errorf("%w: unknown type %q", errInvalidBinding, req.Type)
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%w: %s %s not found", errInvalidBinding, kind, target)
+		}
+
+		if key := kind + ":" + target; !seen[key] {
+			seen[key] = true
+			bindings = append(bindings, models.RoleKnowledgeBinding{Type: kind, Target: target})
+		}
+	}
+	return bindings, nil
+}
+
+// replaceKnowledgeBindings 用 bindings 替换角色的全部知识绑定，并写回 role.KnowledgeBindings
+func replaceKnowledgeBindings(tx *gorm.DB, role *models.Role, bindings []models.RoleKnowledgeBinding) error {
+	if err := tx.Where("role_id = ?", role.ID).Delete(&models.RoleKnowledgeBinding{}).Error; err != nil {
+		return err
+	}
+	return createKnowledgeBindings(tx, role, bindings)
+}
+
+// createKnowledgeBindings 为新建的角色写入知识绑定；没有绑定时不访问绑定表
+func createKnowledgeBindings(tx *gorm.DB, role *models.Role, bindings []models.RoleKnowledgeBinding) error {
+	now := time.Now()
+	for i := range bindings {
+		bindings[i].ID = models.NewUUID()
+		bindings[i].RoleID = role.ID
+		// 保持绑定的先后顺序
+		bindings[i].CreatedAt = now.Add(time.Duration(i) * time.Microsecond)
+		if err := tx.Create(&bindings[i]).Error; err != nil {
+			return err
+		}
+	}
+	role.KnowledgeBindings = bindings
+	return nil
+}
+
+// describeKnowledgeBindings 为绑定补充文件夹、文档或公司的名称
+func (h *RoleHandler) describeKnowledgeBindings(bindings []models.RoleKnowledgeBinding) []KnowledgeBindingView {
+	views := make([]KnowledgeBindingView, 0, len(bindings))
+	for _, b := range bindings {
+		view := KnowledgeBindingView{Type: b.Type, Target: b.Target, Name: b.Target}
+		var names []string
+		switch b.Type {
+		case retrieval.BindingFolder:
+			h.db.Model(&models.Folder{}).Where("id = ? AND trashed_at IS NULL", b.Target).Limit(1).Pluck("name", &names)
+		case retrieval.BindingDocument:
+			h.db.Model(&models.Document{}).Where("id = ?", b.Target).Limit(1).Pluck("name", &names)
+		case retrieval.BindingCompany:
+			h.db.Model(&models.Company{}).Where("id = ?", b.Target).Limit(1).Pluck("name", &names)
+		default:
+			names = []string{b.Target}
+		}
+		if len(names) > 0 {
+			view.Name = names[0]
+		} else {
+			view.Missing = true
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// matchImportedBindings 把导出的绑定映射到当前用户：目标 ID 属于当前用户时直接使用，
+// 否则按名称匹配同名的文件夹、文档或公司（ID 完全匹配优先）；无法匹配的绑定跳过并返回
+func (h *RoleHandler) matchImportedBindings(userID string, views []KnowledgeBindingView) ([]KnowledgeBindingRequest, []KnowledgeBindingView) {
+	var matched []KnowledgeBindingRequest
+	var skipped []KnowledgeBindingView
+	for _, view := range views {
+		var ids []string
+		switch view.Type {
+		case retrieval.BindingTag:
+			ids = []string{view.Target}
+		case retrieval.BindingFolder:
+			h.db.Model(&models.Folder{}).Where("user_id = ? AND trashed_at IS NULL AND (id = ? OR name = ?)", userID, view.Target, view.Name).
+				Order(gorm.Expr("CASE WHEN id = ? THEN 0 ELSE 1 END", view.Target)).Limit(1).Pluck("id", &ids)
+		case retrieval.BindingDocument:
+			h.db.Model(&models.Document{}).Where("user_id = ? AND trashed_at IS NULL AND (id = ? OR name = ?)", userID, view.Target, view.Name).
+				Order(gorm.Expr("CASE WHEN id = ? THEN 0 ELSE 1 END", view.Target)).Limit(1).Pluck("id", &ids)
+		case retrieval.BindingCompany:
+			h.db.Model(&models.Company{}).Where("owner_id = ? AND (id = ? OR name = ?)", userID, view.Target, view.Name).
+				Order(gorm.Expr("CASE WHEN id = ? THEN 0 ELSE 1 END", view.Target)).Limit(1).Pluck("id", &ids)
+		}
+		if len(ids) == 0 || ids[0] == "" {
+			skipped = append(skipped, view)
+			continue
+		}
+		matched = append(matched, KnowledgeBindingRequest{Type: view.Type, Target: ids[0]})
+	}
+	return matched, skipped
+}
+
+// GetKnowledge 获取角色的知识绑定
+func (h *RoleHandler) GetKnowledge(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	userIDStr, _ := userID.(string)
+
+	var role models.Role
+	if result := h.db.First(&role, "id = ?", c.Param("id")); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+	if !h.canManageRole(userIDStr, role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this role"})
+		return
+	}
+
+	bindings, err := retrieval.RoleBindings(h.db, role.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    h.describeKnowledgeBindings(bindings),
+	})
+}
+
+// UpdateKnowledge 替换角色的知识绑定
+func (h *RoleHandler) UpdateKnowledge(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	userIDStr, _ := userID.(string)
+
+	var req struct {
+		Bindings []KnowledgeBindingRequest `json:"bindings"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role models.Role
+	if result := h.db.First(&role, "id = ?", c.Param("id")); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+	if !h.canManageRole(userIDStr, role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this role"})
+		return
+	}
+
+	bindings, err := h.resolveKnowledgeBindings(userIDStr, role.CompanyID, req.Bindings)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return replaceKnowledgeBindings(tx, &role, bindings)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    h.describeKnowledgeBindings(bindings),
+	})
+}
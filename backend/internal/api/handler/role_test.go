@@ -80,3 +80,120 @@ func TestRoleChatOwnership(t *testing.T) {
 		assert.Equal(t, float64(200), resp["code"])
 	})
 }
+
+func TestRoleKnowledgeBindings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupRoleTestDB(t)
+	assert.NoError(t, db.AutoMigrate(&models.RoleKnowledgeBinding{}, &models.Company{}, &models.Folder{}, &models.Document{},
+		&models.DocumentTag{}, &models.ChatSession{}, &models.Message{}))
+	roleHandler := handler.NewRoleHandler(db, &config.Config{})
+
+	assert.NoError(t, db.Create(&models.Company{ID: "acme", OwnerID: "user-a", Name: "Acme"}).Error)
+	assert.NoError(t, db.Create(&models.Folder{ID: "folder-hr", UserID: "user-a", Name: "人事"}).Error)
+	assert.NoError(t, db.Create(&models.Folder{ID: "folder-b", UserID: "user-b", Name: "他人"}).Error)
+	assert.NoError(t, db.Create(&models.Document{ID: "doc-guide", UserID: "user-a", Name: "指南.md"}).Error)
+
+	call := func(fn gin.HandlerFunc, userID, id string, body any) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", "/", bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", userID)
+		ctx.Params = []gin.Param{{Key: "id", Value: id}}
+		fn(ctx)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) map[string]any {
+		var resp map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// 只能绑定自己的文件夹，类型必须有效
+	w := call(roleHandler.Create, "user-a", "", map[string]any{
+		"name":              "HR",
+		"systemPrompt":      "你是 HR",
+		"knowledgeBindings": []map[string]string{{"type": "folder", "target": "folder-b"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = call(roleHandler.Create, "user-a", "", map[string]any{
+		"name":              "HR",
+		"systemPrompt":      "你是 HR",
+		"knowledgeBindings": []map[string]string{{"type": "website", "target": "x"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = call(roleHandler.Create, "user-a", "", map[string]any{
+		"name":         "HR",
+		"systemPrompt": "你是 HR",
+		"companyId":    "acme",
+		"knowledgeBindings": []map[string]string{
+			{"type": "folder", "target": "folder-hr"},
+			{"type": "tag", "target": " 制度 "},
+			{"type": "folder", "target": "folder-hr"},
+			{"type": "company"},
+		},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	data := decode(w)["data"].(map[string]any)
+	roleID := data["id"].(string)
+	assert.Len(t, data["knowledgeBindings"], 3)
+
+	var count int64
+	db.Model(&models.RoleKnowledgeBinding{}).Where("role_id = ?", roleID).Count(&count)
+	assert.Equal(t, int64(3), count)
+
+	// 替换绑定，并返回名称
+	w = call(roleHandler.UpdateKnowledge, "user-a", roleID, map[string]any{
+		"bindings": []map[string]string{{"type": "document", "target": "doc-guide"}, {"type": "folder", "target": "folder-hr"}},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = call(roleHandler.GetKnowledge, "user-a", roleID, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	views := decode(w)["data"].([]any)
+	assert.Len(t, views, 2)
+	assert.Equal(t, "指南.md", views[0].(map[string]any)["name"])
+	assert.Equal(t, "人事", views[1].(map[string]any)["name"])
+
+	w = call(roleHandler.GetKnowledge, "user-b", roleID, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 更新角色时不传绑定则保留原有绑定
+	w = call(roleHandler.Update, "user-a", roleID, map[string]any{"name": "HR 助手", "systemPrompt": "你是 HR"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.Model(&models.RoleKnowledgeBinding{}).Where("role_id = ?", roleID).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// 导出包含绑定；其他用户导入时按名称匹配，匹配不到的跳过
+	w = call(roleHandler.ExportRole, "user-a", roleID, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	export := decode(w)["data"].(map[string]any)
+	assert.Len(t, export["knowledgeBindings"], 2)
+
+	assert.NoError(t, db.Create(&models.Folder{ID: "folder-b-hr", UserID: "user-b", Name: "人事"}).Error)
+	w = call(roleHandler.ImportRole, "user-b", "", export)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	imported := decode(w)
+	importedID := imported["data"].(map[string]any)["id"].(string)
+	assert.Len(t, imported["skippedBindings"], 1)
+	var bindings []models.RoleKnowledgeBinding
+	db.Where("role_id = ?", importedID).Find(&bindings)
+	assert.Len(t, bindings, 1)
+	assert.Equal(t, "folder-b-hr", bindings[0].Target)
+
+	// 切换到绑定了知识来源的角色时，会话改用角色知识库
+	chatHandler := handler.NewChatHandler(db, &config.Config{})
+	plain := models.Role{ID: "role-plain", UserID: "user-a", Name: "通用"}
+	assert.NoError(t, db.Create(&plain).Error)
+	session := models.ChatSession{ID: "session-1", UserID: "user-a", RoleID: plain.ID,
+		ModelConfig: models.JSON(`{"knowledgeScope":"folder:default"}`)}
+	assert.NoError(t, db.Create(&session).Error)
+
+	w = call(chatHandler.SwitchRole, "user-a", session.ID, map[string]string{"roleId": roleID})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "role", decode(w)["data"].(map[string]any)["knowledgeScope"])
+	db.First(&session, "id = ?", session.ID)
+	assert.Contains(t, string(session.ModelConfig), `"knowledgeScope":"role"`)
+}
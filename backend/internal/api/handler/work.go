@@ -50,8 +50,8 @@ type WorkRequest struct {
 	Priority      string                 `json:"priority"`
 	RoleID        string                 `json:"roleId"`
 	Type          string                 `json:"type"`         // general/report/analyze
-	TriggerType   string                 `json:"triggerType"`  // manual/once/daily/interval_hours
-	TriggerValue  string                 `json:"triggerValue"` // 09:00 / 4 / RFC3339
+	TriggerType   string                 `json:"triggerType"`  // manual/once/daily/weekly/monthly/cron/interval_hours
+	TriggerValue  string                 `json:"triggerValue"` // 09:00 / mon,fri 09:00 / 1,last 09:00 / 0 9 * * 1-5 / 4 / RFC3339
 	Timezone      string                 `json:"timezone"`
 	AsyncStatus   string                 `json:"asyncStatus"`
 	InputSource   string                 `json:"inputSource"`
@@ -516,6 +516,43 @@ func (h *WorkHandler) BatchRun(c *gin.Context) {
 	})
 }
 
+// PreviewSchedule 预览触发配置接下来的触发时间，供保存前检查计划
+func (h *WorkHandler) PreviewSchedule(c *gin.Context) {
+	var req struct {
+		TriggerType  string `json:"triggerType" binding:"required"`
+		TriggerValue string `json:"triggerValue"`
+		Timezone     string `json:"timezone"`
+		Count        int    `json:"count"` // 返回的次数，默认 5，最多 50
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	count := req.Count
+	if count <= 0 {
+		count = 5
+	}
+	if count > 50 {
+		count = 50
+	}
+
+	timezone := workspaceSvc.NormalizeTimezone(req.Timezone)
+	runs, err := workspaceSvc.PreviewRuns(req.TriggerType, req.TriggerValue, timezone, time.Now(), count)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"timezone": timezone,
+			"runs":     runs,
+		},
+	})
+}
+
 // ListRuns 获取工作区任务执行记录
 func (h *WorkHandler) ListRuns(c *gin.Context) {
 	userID, _ := c.Get("userId")
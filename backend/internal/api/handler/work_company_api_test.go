@@ -260,3 +260,48 @@ func TestCompanyExportAPIs(t *testing.T) {
 	require.Equal(t, createResp.Data.ID, getResp.Data.ID)
 	require.NotEmpty(t, getResp.Data.Content)
 }
+
+func TestWorkSchedulePreview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupWorkCompanyAPITestDB(t)
+	workHandler := handler.NewWorkHandler(db, workspaceSvc.NewRunner(db, &config.Config{}))
+
+	preview := func(payload map[string]interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/workspaces/schedule/preview", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = req
+		ctx.Set("userId", "preview-user")
+		workHandler.PreviewSchedule(ctx)
+		return w
+	}
+
+	w := preview(map[string]interface{}{"triggerType": "weekly", "triggerValue": "mon,thu 09:30", "timezone": "Asia/Shanghai", "count": 4})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data struct {
+			Timezone string      `json:"timezone"`
+			Runs     []time.Time `json:"runs"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "Asia/Shanghai", resp.Data.Timezone)
+	require.Len(t, resp.Data.Runs, 4)
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	for i, run := range resp.Data.Runs {
+		local := run.In(shanghai)
+		require.Contains(t, []time.Weekday{time.Monday, time.Thursday}, local.Weekday())
+		require.Equal(t, 9, local.Hour())
+		require.Equal(t, 30, local.Minute())
+		if i > 0 {
+			require.True(t, run.After(resp.Data.Runs[i-1]))
+		}
+	}
+
+	w = preview(map[string]interface{}{"triggerType": "cron", "triggerValue": "61 * * * *"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = preview(map[string]interface{}{"triggerType": "daily", "triggerValue": "09:00", "timezone": "Mars/Olympus"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
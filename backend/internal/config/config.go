@@ -19,6 +19,7 @@ type Config struct {
 	MilvusAddr      string
 	AnythingLLMURL  string // AnythingLLM API URL
 	AnythingLLMKey  string // AnythingLLM API Key
+	PricingCatalog  string // 模型价格目录 JSON 文件路径，空则使用内置价格
 }
 
 // Load 加载配置
@@ -45,6 +46,7 @@ func Load() *Config {
 		MilvusAddr:      getEnv("MILVUS_ADDR", ""), // 可选，空则禁用
 		AnythingLLMURL:  normalizeAnythingLLMRootURL(anythingURL),
 		AnythingLLMKey:  anythingKey,
+		PricingCatalog:  getEnv("PRICING_CATALOG", ""),
 	}
 }
 
@@ -52,6 +52,17 @@ type Role struct {
 	IsPublic       bool      `json:"isPublic" gorm:"default:false"`
 	CreatedAt      time.Time `json:"createdAt"`
 	UpdatedAt      time.Time `json:"updatedAt"`
+
+	KnowledgeBindings []RoleKnowledgeBinding `json:"knowledgeBindings,omitempty" gorm:"-"` // 按需加载
+}
+
+// RoleKnowledgeBinding 角色绑定的知识来源，使用该角色的会话自动在这些来源中检索
+type RoleKnowledgeBinding struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	RoleID    string    `json:"roleId" gorm:"index;not null"`
+	Type      string    `json:"type"`   // folder/document/tag/company
+	Target    string    `json:"target"` // 文件夹 ID / 文档 ID / 标签 / 公司 ID
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 // Skill 技能
@@ -65,71 +76,186 @@ type Skill struct {
 
 // Document 文档 - 添加 AnythingLLM 关联
 type Document struct {
-	ID              string    `json:"id" gorm:"primaryKey"`
-	UserID          string    `json:"userId" gorm:"index;not null"`
-	CompanyID       string    `json:"companyId" gorm:"index"`
-	WorkID          string    `json:"workId" gorm:"index"`
-	Name            string    `json:"name"`
-	FileType        string    `json:"fileType"`
-	FileSize        int64     `json:"fileSize"`
-	FilePath        string    `json:"filePath"`                        // 临时存储路径
-	FolderID        string    `json:"folderId" gorm:"index"`           // 文件夹 ID
-	AnythingLLMHash string    `json:"anythingLLMHash" gorm:"index"`    // 新增：AnythingLLM 文档 hash
-	Status          string    `json:"status" gorm:"default:'pending'"` // pending/processing/completed/failed
-	ChunkCount      int       `json:"chunkCount"`
-	ErrorMessage    string    `json:"errorMessage"`
-	Similarity      float64   `json:"similarity" gorm:"-"` // 搜索相似度 (不存储到数据库)
-	Metadata        JSON      `json:"metadata" gorm:"type:text"`
-	CreatedAt       time.Time `json:"createdAt"`
-	UpdatedAt       time.Time `json:"updatedAt"`
+	ID              string     `json:"id" gorm:"primaryKey"`
+	UserID          string     `json:"userId" gorm:"index;not null"`
+	CompanyID       string     `json:"companyId" gorm:"index"`
+	WorkID          string     `json:"workId" gorm:"index"`
+	Name            string     `json:"name"`
+	FileType        string     `json:"fileType"`
+	FileSize        int64      `json:"fileSize"`
+	FilePath        string     `json:"filePath"`                        // 文件存储中的对象键（早期记录为本地文件路径）
+	FolderID        string     `json:"folderId" gorm:"index"`           // 文件夹 ID
+	ParentID        string     `json:"parentId,omitempty" gorm:"index"` // 父文档 ID，如邮件附件所属的邮件
+	AnythingLLMHash string     `json:"anythingLLMHash" gorm:"index"`    // 新增：AnythingLLM 文档 hash
+	ContentHash     string     `json:"contentHash" gorm:"index"`        // 当前版本文件内容的 SHA-256，用于去重
+	Version         int        `json:"version" gorm:"default:1"`        // 当前版本号
+	Status          string     `json:"status" gorm:"default:'pending'"` // pending/processing/completed/failed
+	ChunkCount      int        `json:"chunkCount"`
+	ErrorMessage    string     `json:"errorMessage"`
+	Similarity      float64    `json:"similarity" gorm:"-"`          // 搜索相似度 (不存储到数据库)
+	Duplicate       bool       `json:"duplicate,omitempty" gorm:"-"` // 上传内容与已有文档相同 (不存储到数据库)
+	Metadata        JSON       `json:"metadata" gorm:"type:text"`
+	TrashedAt       *time.Time `json:"trashedAt,omitempty" gorm:"index"` // 随文件夹移入回收站的时间
+	TrashID         string     `json:"-" gorm:"index"`
+	SourceURL       string     `json:"sourceUrl,omitempty" gorm:"index"` // 从网页导入时的来源地址
+	RefreshInterval int        `json:"refreshInterval,omitempty"`        // 自动重新抓取间隔（分钟），0 表示不刷新
+	LastFetchedAt   *time.Time `json:"lastFetchedAt,omitempty"`
+	NextRefreshAt   *time.Time `json:"nextRefreshAt,omitempty" gorm:"index"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// DocumentTag 文档标签，与 Document.Metadata 中的 tags 保持一致，供标签列表、计数与过滤使用
+type DocumentTag struct {
+	DocumentID string    `json:"documentId" gorm:"primaryKey"`
+	Tag        string    `json:"tag" gorm:"primaryKey;index"`
+	UserID     string    `json:"userId" gorm:"index;not null"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// DocumentChunk 文档分块，记录其在提取文本中的位置，供检索结果定位原文
+type DocumentChunk struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	DocumentID  string    `json:"documentId" gorm:"index:idx_document_chunks_order,priority:1;not null"`
+	Ordinal     int       `json:"ordinal" gorm:"index:idx_document_chunks_order,priority:2"`
+	Content     string    `json:"content" gorm:"type:text"`
+	TokenCount  int       `json:"tokenCount"`
+	Page        int       `json:"page,omitempty"`  // PDF 页码或幻灯片序号
+	Sheet       string    `json:"sheet,omitempty"` // 工作表名称
+	StartOffset int       `json:"startOffset"`     // 在提取文本中的起止字符偏移
+	EndOffset   int       `json:"endOffset"`
+	HeadingPath string    `json:"headingPath"`           // 所属标题路径，以 " > " 连接
+	Strategy    string    `json:"strategy" gorm:"index"` // 生成该分块的策略，用于按策略选择性重新分块
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// DocumentVersion 文档版本，每次上传或恢复生成一个版本；Document 的文件字段始终对应当前版本
+type DocumentVersion struct {
+	ID           string    `json:"id" gorm:"primaryKey"`
+	DocumentID   string    `json:"documentId" gorm:"index:idx_document_versions_order,priority:1;not null"`
+	Version      int       `json:"version" gorm:"index:idx_document_versions_order,priority:2"`
+	Name         string    `json:"name"`
+	FileType     string    `json:"fileType"`
+	FileSize     int64     `json:"fileSize"`
+	FilePath     string    `json:"filePath"`
+	ContentHash  string    `json:"contentHash"`
+	RestoredFrom int       `json:"restoredFrom,omitempty"` // 由哪个版本恢复而来
+	CreatedBy    string    `json:"createdBy"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// IngestionJob 文档入库任务，按阶段持久化执行状态，服务重启后从未完成的阶段继续
+type IngestionJob struct {
+	ID          string     `json:"id" gorm:"primaryKey"`
+	DocumentID  string     `json:"documentId" gorm:"index;not null"`
+	UserID      string     `json:"userId" gorm:"index;not null"`
+	Status      string     `json:"status" gorm:"index"`     // queued/running/retrying/completed/failed
+	Stage       string     `json:"stage"`                   // 当前（或失败时所在）阶段
+	Stages      JSON       `json:"stages" gorm:"type:text"` // 各阶段状态 JSON
+	Attempts    int        `json:"attempts"`                // 已失败次数
+	MaxAttempts int        `json:"maxAttempts"`             // 超过后不再重试
+	LastError   string     `json:"lastError"`               // 最近一次错误
+	NextRunAt   *time.Time `json:"nextRunAt" gorm:"index"`  // 排队或重试的执行时间
+	HeartbeatAt *time.Time `json:"heartbeatAt,omitempty"`   // 执行中的任务定期续租，超时未续租视为执行方已退出
+	StartedAt   *time.Time `json:"startedAt"`               // 首次开始执行时间
+	FinishedAt  *time.Time `json:"finishedAt"`              // 完成或最终失败时间
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// UploadSession 分片上传会话：客户端按固定大小逐片上传，全部分片到齐后合并为文档；过期未完成的会话由后台清理
+type UploadSession struct {
+	ID         string    `json:"id" gorm:"primaryKey"`
+	UserID     string    `json:"userId" gorm:"index;not null"`
+	FileName   string    `json:"fileName"`
+	FileSize   int64     `json:"fileSize"`               // 文件总大小（字节）
+	ChunkSize  int64     `json:"chunkSize"`              // 分片大小，最后一片可以更小
+	TotalParts int       `json:"totalParts"`             // 分片总数
+	Checksum   string    `json:"checksum,omitempty"`     // 整个文件的 SHA-256（可选），合并时校验
+	FolderID   string    `json:"folderId"`               // 完成后文档所在的文件夹
+	CompanyID  string    `json:"companyId"`              // 完成后文档归属的公司
+	WorkID     string    `json:"workId"`                 // 完成后文档关联的工作
+	Status     string    `json:"status" gorm:"index"`    // uploading/assembling/completed
+	DocumentID string    `json:"documentId,omitempty"`   // 合并生成的文档
+	ExpiresAt  time.Time `json:"expiresAt" gorm:"index"` // 超过该时间未完成的会话被清理，每次上传分片后顺延
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// UploadPart 已上传的分片
+type UploadPart struct {
+	SessionID string    `json:"-" gorm:"primaryKey"`
+	Number    int       `json:"number" gorm:"primaryKey;autoIncrement:false"` // 分片序号，从 1 开始
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum"` // 分片内容的 SHA-256
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 // Folder 文件夹
 type Folder struct {
-	ID        string    `json:"id" gorm:"primaryKey"`
-	UserID    string    `json:"userId" gorm:"index;not null"`
-	Name      string    `json:"name"`
-	ParentID  string    `json:"parentId" gorm:"index"` // 父文件夹 ID，空表示根目录
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID            string     `json:"id" gorm:"primaryKey"`
+	UserID        string     `json:"userId" gorm:"index;not null"`
+	Name          string     `json:"name"`
+	ParentID      string     `json:"parentId" gorm:"index"`            // 父文件夹 ID，空表示根目录
+	TrashedAt     *time.Time `json:"trashedAt,omitempty" gorm:"index"` // 移入回收站的时间，空表示正常
+	TrashID       string     `json:"-" gorm:"index"`                   // 同一次移入回收站操作的批次 ID，恢复时按批次还原
+	ChunkStrategy string     `json:"chunkStrategy,omitempty"`          // 文件夹内文档的分块策略，空表示沿用上级文件夹或公司配置
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
 }
 
 // ChatSession 对话会话 - 添加关联
 type ChatSession struct {
-	ID              string    `json:"id" gorm:"primaryKey"`
-	UserID          string    `json:"userId" gorm:"index;not null"`
-	RoleID          string    `json:"roleId" gorm:"index"`
-	Title           string    `json:"title"`
-	Mode            string    `json:"mode" gorm:"default:'quick'"`  // quick/task
-	AnythingLLMSlug string    `json:"anythingLLMSlug" gorm:"index"` // 新增：关联 Workspace
-	ModelConfig     JSON      `json:"modelConfig" gorm:"type:text"` // 新增：存储元数据（归档状态等）
-	CreatedAt       time.Time `json:"createdAt"`
-	UpdatedAt       time.Time `json:"updatedAt"`
+	ID                      string     `json:"id" gorm:"primaryKey"`
+	UserID                  string     `json:"userId" gorm:"index;not null"`
+	RoleID                  string     `json:"roleId" gorm:"index"`
+	Title                   string     `json:"title"`
+	Mode                    string     `json:"mode" gorm:"default:'quick'"`               // quick/task
+	AnythingLLMSlug         string     `json:"anythingLLMSlug" gorm:"index"`              // 新增：关联 Workspace
+	ModelConfig             JSON       `json:"modelConfig" gorm:"type:text"`              // 新增：存储元数据（归档状态等）
+	HistorySummary          string     `json:"historySummary,omitempty" gorm:"type:text"` // 超出上下文窗口的早期轮次的滚动摘要
+	HistorySummaryMessageID string     `json:"historySummaryMessageId,omitempty"`         // 最后一条被折叠进摘要的消息
+	ActiveLeafID            string     `json:"activeLeafId,omitempty"`                    // 当前分支的末端消息
+	TitleSource             string     `json:"titleSource,omitempty"`                     // user：用户指定；auto：自动生成；空表示默认标题
+	Summary                 string     `json:"summary,omitempty" gorm:"type:text"`        // 自动生成的会话概要（用于列表展示与检索）
+	SummaryMessageCount     int        `json:"-"`                                         // 生成概要时活动路径上的消息数
+	SummarizedAt            *time.Time `json:"summarizedAt,omitempty"`
+	CreatedAt               time.Time  `json:"createdAt"`
+	UpdatedAt               time.Time  `json:"updatedAt"`
 }
 
 // Message 消息
 type Message struct {
-	ID         string    `json:"id" gorm:"primaryKey"`
-	SessionID  string    `json:"sessionId" gorm:"index"`
-	Role       string    `json:"role"`
-	Content    string    `json:"content"`
-	Likes      int       `json:"likes" gorm:"default:0"`
-	Dislikes   int       `json:"dislikes" gorm:"default:0"`
-	IsEdited   bool      `json:"isEdited" gorm:"default:false"`
-	Sources    JSON      `json:"sources" gorm:"type:text"`
-	TokensUsed int       `json:"tokensUsed"`
-	UpdatedAt  time.Time `json:"updatedAt"`
-	CreatedAt  time.Time `json:"createdAt"`
+	ID               string    `json:"id" gorm:"primaryKey"`
+	SessionID        string    `json:"sessionId" gorm:"index"`
+	Role             string    `json:"role"`
+	Content          string    `json:"content"`
+	Likes            int       `json:"likes" gorm:"default:0"`
+	Dislikes         int       `json:"dislikes" gorm:"default:0"`
+	IsEdited         bool      `json:"isEdited" gorm:"default:false"`
+	Sources          JSON      `json:"sources" gorm:"type:text"`
+	TokensUsed       int       `json:"tokensUsed"` // prompt + completion
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	ModelID          string    `json:"modelId" gorm:"index"`
+	Provider         string    `json:"provider"`
+	ParentID         string    `json:"parentId" gorm:"index"` // 上一条消息，根消息为空
+	SiblingIndex     int       `json:"siblingIndex"`          // 同一父消息下的分支序号
+	SiblingCount     int       `json:"siblingCount" gorm:"-"` // 同级分支数（查询时填充）
+	Status           string    `json:"status,omitempty"`      // 空表示正常完成；interrupted 表示生成被中断，内容不完整
+	UpdatedAt        time.Time `json:"updatedAt"`
+	CreatedAt        time.Time `json:"createdAt"`
 }
 
 // Company 公司（组织空间）
 type Company struct {
-	ID          string    `json:"id" gorm:"primaryKey"`
-	OwnerID     string    `json:"ownerId" gorm:"index;not null"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
+	ID            string    `json:"id" gorm:"primaryKey"`
+	OwnerID       string    `json:"ownerId" gorm:"index;not null"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	ChunkStrategy string    `json:"chunkStrategy,omitempty"` // 公司文档的默认分块策略，空表示按文件类型选择
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
 }
 
 // Work 工作区任务（异步执行单元）
@@ -143,8 +269,8 @@ type Work struct {
 	Priority      string     `json:"priority" gorm:"default:'medium'"`
 	RoleID        string     `json:"roleId" gorm:"index"`
 	Type          string     `json:"type" gorm:"default:'general'"`           // general/report/analyze
-	TriggerType   string     `json:"triggerType" gorm:"default:'manual'"`     // manual/once/daily/interval_hours
-	TriggerValue  string     `json:"triggerValue"`                            // 例如 09:00 / 4 / 2026-03-01T09:00:00+08:00
+	TriggerType   string     `json:"triggerType" gorm:"default:'manual'"`     // manual/once/daily/weekly/monthly/cron/interval_hours
+	TriggerValue  string     `json:"triggerValue"`                            // 例如 09:00 / mon,fri 09:00 / 1,last 09:00 / 0 9 * * 1-5 / 4 / 2026-03-01T09:00:00+08:00
 	Timezone      string     `json:"timezone" gorm:"default:'Asia/Shanghai'"` // 时区
 	NextRunAt     *time.Time `json:"nextRunAt"`                               // 下次执行时间
 	LastRunAt     *time.Time `json:"lastRunAt"`                               // 最近执行时间
@@ -159,21 +285,37 @@ type Work struct {
 
 // AgentRun 多 Agent 协商执行记录
 type AgentRun struct {
-	ID            string     `json:"id" gorm:"primaryKey"`
-	WorkID        string     `json:"workId" gorm:"index;not null"`
-	UserID        string     `json:"userId" gorm:"index;not null"`
-	CompanyID     string     `json:"companyId" gorm:"index"`
-	TriggerSource string     `json:"triggerSource"`          // manual/scheduler
-	Status        string     `json:"status" gorm:"index"`    // running/completed/failed
-	Summary       string     `json:"summary"`                // 执行摘要
-	FinalAnswer   string     `json:"finalAnswer"`            // 最终答案
-	Confidence    float64    `json:"confidence"`             // 置信度
-	Trace         JSON       `json:"trace" gorm:"type:text"` // 协商轨迹 JSON
-	ErrorMessage  string     `json:"errorMessage"`           // 错误信息
-	StartedAt     *time.Time `json:"startedAt"`              // 开始时间
-	FinishedAt    *time.Time `json:"finishedAt"`             // 结束时间
-	CreatedAt     time.Time  `json:"createdAt"`
-	UpdatedAt     time.Time  `json:"updatedAt"`
+	ID               string     `json:"id" gorm:"primaryKey"`
+	WorkID           string     `json:"workId" gorm:"index;not null"`
+	UserID           string     `json:"userId" gorm:"index;not null"`
+	CompanyID        string     `json:"companyId" gorm:"index"`
+	TriggerSource    string     `json:"triggerSource"`          // manual/scheduler
+	Status           string     `json:"status" gorm:"index"`    // running/completed/failed
+	Summary          string     `json:"summary"`                // 执行摘要
+	FinalAnswer      string     `json:"finalAnswer"`            // 最终答案
+	Confidence       float64    `json:"confidence"`             // 置信度
+	Trace            JSON       `json:"trace" gorm:"type:text"` // 协商轨迹 JSON
+	ErrorMessage     string     `json:"errorMessage"`           // 错误信息
+	PromptTokens     int        `json:"promptTokens"`           // 各 Agent 步骤累计
+	CompletionTokens int        `json:"completionTokens"`
+	TokensUsed       int        `json:"tokensUsed"`
+	ModelID          string     `json:"modelId"`
+	StartedAt        *time.Time `json:"startedAt"`  // 开始时间
+	FinishedAt       *time.Time `json:"finishedAt"` // 结束时间
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
+
+// EmbeddingUsage 向量化调用的 Token 用量（文档分块入库与检索查询），供成本统计按向量化价格计价
+type EmbeddingUsage struct {
+	ID         string    `json:"id" gorm:"primaryKey"`
+	UserID     string    `json:"userId" gorm:"index;not null"`
+	CompanyID  string    `json:"companyId" gorm:"index"`
+	DocumentID string    `json:"documentId,omitempty" gorm:"index"` // 查询向量化时为空
+	Purpose    string    `json:"purpose"`                           // document/query
+	ModelID    string    `json:"modelId"`
+	Tokens     int       `json:"tokens"`
+	CreatedAt  time.Time `json:"createdAt" gorm:"index"`
 }
 
 // CompanyExport 公司交付导出归档
@@ -201,6 +343,17 @@ type RoleInstall struct {
 	CreatedAt       time.Time `json:"createdAt"`
 }
 
+// VectorRecord 内置向量库中的一条向量（按集合隔离，如 user/{id}、company/{id}）
+type VectorRecord struct {
+	Collection string    `json:"collection" gorm:"primaryKey"`
+	RefID      string    `json:"refId" gorm:"primaryKey"`
+	Dim        int       `json:"dim"`
+	Vector     []byte    `json:"-"` // float32 小端序
+	Metadata   JSON      `json:"metadata" gorm:"type:text"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
 // TableName 指定表名
 func (User) TableName() string        { return "users" }
 func (Workspace) TableName() string   { return "workspaces" }
@@ -216,7 +369,9 @@ func (AgentRun) TableName() string    { return "agent_runs" }
 func (CompanyExport) TableName() string {
 	return "company_exports"
 }
-func (RoleInstall) TableName() string { return "role_installs" }
+func (RoleInstall) TableName() string   { return "role_installs" }
+func (VectorRecord) TableName() string  { return "vector_records" }
+func (DocumentChunk) TableName() string { return "document_chunks" }
 
 // NewUUID 生成新 UUID 字符串
 func NewUUID() string {
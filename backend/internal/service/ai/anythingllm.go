@@ -0,0 +1,193 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"rolecraft-ai/internal/service/anythingllm"
+)
+
+// AnythingLLMProvider 将 AnythingLLM Workspace 适配为 ChatProvider
+type AnythingLLMProvider struct {
+	orchestrator *anythingllm.Orchestrator
+	slug         string
+	sessionID    string
+	mode         string
+	model        string
+	provider     string
+}
+
+// AnythingLLMProviderConfig 配置
+type AnythingLLMProviderConfig struct {
+	WorkspaceSlug string
+	SessionID     string // AnythingLLM 会话 ID，用于保持服务端上下文
+	Mode          string // chat / agent / query
+	Model         string // Workspace 使用的模型
+	Provider      string // Workspace 使用的底层 LLM 提供方（如 openrouter）
+}
+
+// NewAnythingLLMProvider 创建 AnythingLLM 适配器
+func NewAnythingLLMProvider(orchestrator *anythingllm.Orchestrator, config AnythingLLMProviderConfig) *AnythingLLMProvider {
+	return &AnythingLLMProvider{
+		orchestrator: orchestrator,
+		slug:         config.WorkspaceSlug,
+		sessionID:    config.SessionID,
+		mode:         config.Mode,
+		model:        config.Model,
+		provider:     config.Provider,
+	}
+}
+
+// Name 提供方名称
+func (p *AnythingLLMProvider) Name() string {
+	return ProviderAnythingLLM
+}
+
+// ChatCompletion 调用 AnythingLLM Workspace Chat
+// AnythingLLM 自行维护会话记忆，因此仅发送系统提示与最后一条用户消息。
+func (p *AnythingLLMProvider) ChatCompletion(ctx context.Context, messages []ChatMessage, temperature float64) (*ChatResponse, error) {
+	if p.orchestrator == nil || !p.orchestrator.Enabled() {
+		return nil, fmt.Errorf("anythingllm is not configured")
+	}
+
+	result, err := p.orchestrator.Chat(ctx, anythingllm.ChatPayload{
+		WorkspaceSlug: p.slug,
+		Message:       flattenMessages(messages),
+		Mode:          p.mode,
+		Model:         p.model,
+		Provider:      p.provider,
+		SessionID:     p.sessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ChatResponse{
+		ID:       fmt.Sprintf("anythingllm-%d", time.Now().UnixNano()),
+		Object:   "chat.completion",
+		Created:  time.Now().Unix(),
+		Model:    anythingllm.NormalizeWorkspaceModel(p.model),
+		Sources:  result.Sources,
+		Thoughts: result.Thoughts,
+	}
+	if usage := usageFromMetrics(result.Metrics); usage != nil {
+		resp.Usage = *usage
+	}
+	resp.Choices = append(resp.Choices, struct {
+		Index        int          `json:"index"`
+		Message      ChatMessage  `json:"message"`
+		Delta        *ChatMessage `json:"delta,omitempty"`
+		FinishReason string       `json:"finish_reason"`
+	}{
+		Index:        0,
+		Message:      ChatMessage{Role: "assistant", Content: result.Content},
+		FinishReason: "stop",
+	})
+	return resp, nil
+}
+
+// ChatCompletionStream 调用 AnythingLLM stream-chat，结束块携带 Sources / Thoughts
+func (p *AnythingLLMProvider) ChatCompletionStream(ctx context.Context, messages []ChatMessage, temperature float64) (<-chan *StreamChunk, <-chan error) {
+	chunkChan := make(chan *StreamChunk, 100)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(chunkChan)
+		defer close(errChan)
+
+		if p.orchestrator == nil || !p.orchestrator.Enabled() {
+			errChan <- fmt.Errorf("anythingllm is not configured")
+			return
+		}
+
+		id := fmt.Sprintf("anythingllm-%d", time.Now().UnixNano())
+		model := anythingllm.NormalizeWorkspaceModel(p.model)
+		result, err := p.orchestrator.StreamChat(ctx, anythingllm.ChatPayload{
+			WorkspaceSlug: p.slug,
+			Message:       flattenMessages(messages),
+			Mode:          p.mode,
+			Model:         p.model,
+			Provider:      p.provider,
+			SessionID:     p.sessionID,
+		}, func(delta string) {
+			sendChunk(ctx, chunkChan, newDeltaChunk(id, model, delta, ""))
+		})
+		if err != nil {
+			errChan <- err
+			return
+		}
+
+		final := newDeltaChunk(id, model, "", "stop")
+		final.Sources = result.Sources
+		final.Thoughts = result.Thoughts
+		final.Usage = usageFromMetrics(result.Metrics)
+		sendChunk(ctx, chunkChan, final)
+	}()
+
+	return chunkChan, errChan
+}
+
+// usageFromMetrics 转换 AnythingLLM 返回的用量，未返回时为 nil
+func usageFromMetrics(metrics *anythingllm.ChatMetrics) *Usage {
+	if metrics == nil {
+		return nil
+	}
+	return &Usage{
+		PromptTokens:     metrics.PromptTokens,
+		CompletionTokens: metrics.CompletionTokens,
+		TotalTokens:      metrics.TotalTokens,
+	}
+}
+
+// flattenMessages 将多轮消息压平为 AnythingLLM 可接受的单条消息：
+// 系统提示 + 对话历史 + 最后一条用户消息。
+func flattenMessages(messages []ChatMessage) string {
+	lastUserIdx := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			lastUserIdx = i
+			break
+		}
+	}
+
+	var system, history []string
+	for i, msg := range messages {
+		content := strings.TrimSpace(msg.Content)
+		if content == "" || i == lastUserIdx {
+			continue
+		}
+		switch msg.Role {
+		case "system":
+			system = append(system, content)
+		case "user":
+			history = append(history, "用户："+content)
+		case "assistant":
+			history = append(history, "助手："+content)
+		}
+	}
+	lastUser := ""
+	if lastUserIdx >= 0 {
+		lastUser = strings.TrimSpace(messages[lastUserIdx].Content)
+	}
+	if len(system) == 0 && len(history) == 0 {
+		return lastUser
+	}
+
+	var b strings.Builder
+	if len(system) > 0 {
+		b.WriteString(strings.Join(system, "\n\n"))
+		b.WriteString("\n\n")
+	}
+	if len(history) > 0 {
+		b.WriteString("对话历史：\n")
+		b.WriteString(strings.Join(history, "\n"))
+		b.WriteString("\n\n")
+	}
+	if lastUser != "" {
+		b.WriteString("用户问题：\n")
+		b.WriteString(lastUser)
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -47,6 +47,12 @@ type EmbeddingResponse struct {
 	} `json:"usage"`
 }
 
+// EmbeddingUsage 一次向量化请求的用量
+type EmbeddingUsage struct {
+	Model  string // 实际计费的模型
+	Tokens int
+}
+
 // NewEmbeddingClient 创建客户端
 func NewEmbeddingClient(config EmbeddingConfig) *EmbeddingClient {
 	baseURL := config.BaseURL
@@ -88,6 +94,13 @@ func (c *EmbeddingClient) EmbedText(ctx context.Context, text string) ([]float32
 
 // EmbedBatch 批量文本向量化
 func (c *EmbeddingClient) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings, _, err := c.EmbedBatchUsage(ctx, texts)
+	return embeddings, err
+}
+
+// EmbedBatchUsage 批量文本向量化，同时返回接口报告的 Token 用量
+func (c *EmbeddingClient) EmbedBatchUsage(ctx context.Context, texts []string) ([][]float32, EmbeddingUsage, error) {
+	usage := EmbeddingUsage{Model: c.model}
 	req := EmbeddingRequest{
 		Model: c.model,
 		Input: texts,
@@ -95,12 +108,12 @@ func (c *EmbeddingClient) EmbedBatch(ctx context.Context, texts []string) ([][]f
 
 	body, err := json.Marshal(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, usage, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/embeddings", bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, usage, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -108,18 +121,18 @@ func (c *EmbeddingClient) EmbedBatch(ctx context.Context, texts []string) ([][]f
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, usage, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(bodyBytes))
+		return nil, usage, fmt.Errorf("API error: %s - %s", resp.Status, string(bodyBytes))
 	}
 
 	var embResp EmbeddingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&embResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		return nil, usage, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	// 提取向量
@@ -127,6 +140,13 @@ func (c *EmbeddingClient) EmbedBatch(ctx context.Context, texts []string) ([][]f
 	for i, item := range embResp.Data {
 		embeddings[i] = item.Embedding
 	}
+	if embResp.Model != "" {
+		usage.Model = embResp.Model
+	}
+	usage.Tokens = embResp.Usage.TotalTokens
+	if usage.Tokens == 0 {
+		usage.Tokens = embResp.Usage.PromptTokens
+	}
 
-	return embeddings, nil
+	return embeddings, usage, nil
 }
@@ -48,10 +48,19 @@ func NewMockAIClient() *MockAIClient {
 	}
 }
 
+// Name 提供方名称
+func (m *MockAIClient) Name() string {
+	return ProviderMock
+}
+
 // ChatCompletion Mock 聊天完成
 func (m *MockAIClient) ChatCompletion(ctx context.Context, messages []ChatMessage, temperature float64) (*ChatResponse, error) {
 	// 模拟处理延迟
-	time.Sleep(500 * time.Millisecond)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(500 * time.Millisecond):
+	}
 
 	// 获取最后一条用户消息
 	var lastUserMessage string
@@ -92,15 +101,7 @@ func (m *MockAIClient) ChatCompletion(ctx context.Context, messages []ChatMessag
 				FinishReason: "stop",
 			},
 		},
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
-			PromptTokens:     10,
-			CompletionTokens: len([]rune(response)) / 4,
-			TotalTokens:      len([]rune(response)) / 4 + 10,
-		},
+		Usage: EstimateUsage(messages, response),
 	}, nil
 }
 
@@ -111,6 +112,7 @@ func (m *MockAIClient) ChatCompletionStream(ctx context.Context, messages []Chat
 
 	go func() {
 		defer close(chunkChan)
+		defer close(errChan)
 
 		// 获取回复
 		var lastUserMessage string
@@ -126,53 +128,37 @@ func (m *MockAIClient) ChatCompletionStream(ctx context.Context, messages []Chat
 		if len(responses) == 0 {
 			responses = m.responses["default"]
 		}
-		response := responses[rand.Intn(len(responses))]
+		response := []rune(responses[rand.Intn(len(responses))])
+		id := fmt.Sprintf("mock-%d", time.Now().UnixNano())
 
-		// 模拟流式输出
+		// 模拟流式输出（按字符切分，避免截断多字节字符）
 		chunkSize := 3
 		for i := 0; i < len(response); i += chunkSize {
 			end := i + chunkSize
 			if end > len(response) {
 				end = len(response)
 			}
-			chunk := response[i:end]
-
-			chunkChan <- &StreamChunk{
-				ID:      fmt.Sprintf("mock-%d", time.Now().UnixNano()),
-				Object:  "chat.completion.chunk",
-				Created: time.Now().Unix(),
-				Model:   "mock-v1",
-				Choices: []struct {
-					Index        int         `json:"index"`
-					Delta        ChatMessage `json:"delta"`
-					FinishReason string      `json:"finish_reason"`
-				}{
-					{
-						Index: 0,
-						Delta: ChatMessage{
-							Role:    "assistant",
-							Content: chunk,
-						},
-						FinishReason: "",
-					},
-				},
+
+			chunk := newDeltaChunk(id, "mock-v1", string(response[i:end]), "")
+			chunk.Created = time.Now().Unix()
+			if !sendChunk(ctx, chunkChan, chunk) {
+				errChan <- ctx.Err()
+				return
 			}
 
-			time.Sleep(50 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
 		}
 
 		// 发送结束标记
-		chunkChan <- &StreamChunk{
-			Choices: []struct {
-				Index        int         `json:"index"`
-				Delta        ChatMessage `json:"delta"`
-				FinishReason string      `json:"finish_reason"`
-			}{
-				{
-					FinishReason: "stop",
-				},
-			},
-		}
+		final := newDeltaChunk(id, "mock-v1", "", "stop")
+		usage := EstimateUsage(messages, string(response))
+		final.Usage = &usage
+		sendChunk(ctx, chunkChan, final)
 	}()
 
 	return chunkChan, errChan
@@ -39,6 +39,20 @@ type ChatRequest struct {
 	Temperature float64       `json:"temperature,omitempty"`
 	MaxTokens   int           `json:"max_tokens,omitempty"`
 	Stream      bool          `json:"stream,omitempty"`
+
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions 流式请求选项
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // 在最后一个数据块中返回 usage
+}
+
+// Usage Token 用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 // ChatResponse 聊天响应
@@ -53,11 +67,11 @@ type ChatResponse struct {
 		Delta        *ChatMessage `json:"delta,omitempty"`
 		FinishReason string       `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage Usage `json:"usage"`
+
+	// 以下字段仅由 AnythingLLM 等带检索能力的提供方填充
+	Sources  []map[string]interface{} `json:"sources,omitempty"`
+	Thoughts []string                 `json:"thoughts,omitempty"`
 }
 
 // StreamChunk 流式响应块
@@ -71,6 +85,11 @@ type StreamChunk struct {
 		Delta        ChatMessage  `json:"delta"`
 		FinishReason string       `json:"finish_reason"`
 	} `json:"choices"`
+
+	// 以下字段仅在结束块中填充（usage 需提供方支持）
+	Usage    *Usage                   `json:"usage,omitempty"`
+	Sources  []map[string]interface{} `json:"sources,omitempty"`
+	Thoughts []string                 `json:"thoughts,omitempty"`
 }
 
 // NewOpenAIClient 创建客户端
@@ -100,6 +119,11 @@ func NewOpenAIClient(config OpenAIConfig) *OpenAIClient {
 	}
 }
 
+// Name 提供方名称
+func (c *OpenAIClient) Name() string {
+	return ProviderOpenAI
+}
+
 // ChatCompletion 普通对话补全
 func (c *OpenAIClient) ChatCompletion(ctx context.Context, messages []ChatMessage, temperature float64) (*ChatResponse, error) {
 	req := ChatRequest{
@@ -142,8 +166,8 @@ func (c *OpenAIClient) ChatCompletion(ctx context.Context, messages []ChatMessag
 }
 
 // ChatCompletionStream 流式对话补全
-func (c *OpenAIClient) ChatCompletionStream(ctx context.Context, messages []ChatMessage, temperature float64) (<-chan StreamChunk, <-chan error) {
-	chunkChan := make(chan StreamChunk)
+func (c *OpenAIClient) ChatCompletionStream(ctx context.Context, messages []ChatMessage, temperature float64) (<-chan *StreamChunk, <-chan error) {
+	chunkChan := make(chan *StreamChunk, 100)
 	errChan := make(chan error, 1)
 
 	go func() {
@@ -155,6 +179,8 @@ func (c *OpenAIClient) ChatCompletionStream(ctx context.Context, messages []Chat
 			Messages:    messages,
 			Temperature: temperature,
 			Stream:      true,
+
+			StreamOptions: &StreamOptions{IncludeUsage: true},
 		}
 
 		body, err := json.Marshal(req)
@@ -170,9 +196,12 @@ func (c *OpenAIClient) ChatCompletionStream(ctx context.Context, messages []Chat
 		}
 
 		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Accept", "text/event-stream")
 		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
 
-		resp, err := c.httpClient.Do(httpReq)
+		// 流式响应时长不可预期，超时交由 ctx 控制
+		streamClient := &http.Client{Transport: c.httpClient.Transport}
+		resp, err := streamClient.Do(httpReq)
 		if err != nil {
 			errChan <- fmt.Errorf("failed to send request: %w", err)
 			return
@@ -185,23 +214,18 @@ func (c *OpenAIClient) ChatCompletionStream(ctx context.Context, messages []Chat
 			return
 		}
 
-		decoder := json.NewDecoder(resp.Body)
-		for {
+		err = readSSE(ctx, resp.Body, func(data []byte) error {
 			var chunk StreamChunk
-			if err := decoder.Decode(&chunk); err != nil {
-				if err == io.EOF {
-					return
-				}
-				errChan <- fmt.Errorf("failed to decode chunk: %w", err)
-				return
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				return fmt.Errorf("failed to decode chunk: %w", err)
 			}
-
-			// 检查是否结束
-			if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason == "stop" {
-				return
+			if !sendChunk(ctx, chunkChan, &chunk) {
+				return ctx.Err()
 			}
-
-			chunkChan <- chunk
+			return nil
+		})
+		if err != nil {
+			errChan <- err
 		}
 	}()
 
@@ -27,9 +27,14 @@ type OpenRouterConfig struct {
 
 // NewOpenRouterClient 创建 OpenRouter 客户端
 func NewOpenRouterClient(config OpenRouterConfig) *OpenRouterClient {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = "https://openrouter.ai/api/v1"
+	}
+
 	return &OpenRouterClient{
 		apiKey:  config.APIKey,
-		baseURL: config.BaseURL,
+		baseURL: baseURL,
 		model:   config.Model,
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second,
@@ -44,6 +49,8 @@ type OpenRouterRequest struct {
 	Temperature float64       `json:"temperature,omitempty"`
 	Stream      bool          `json:"stream,omitempty"`
 	MaxTokens   int           `json:"max_tokens,omitempty"`
+
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
 }
 
 // OpenRouterResponse OpenRouter 响应体
@@ -76,6 +83,12 @@ type OpenRouterStreamChunk struct {
 		Delta        ChatMessage `json:"delta"`
 		FinishReason string      `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Name 提供方名称
+func (c *OpenRouterClient) Name() string {
+	return ProviderOpenRouter
 }
 
 // ChatCompletion 聊天完成
@@ -167,6 +180,8 @@ func (c *OpenRouterClient) ChatCompletionStream(ctx context.Context, messages []
 		Temperature: temperature,
 		Stream:      true,
 		MaxTokens:   4096,
+
+		StreamOptions: &StreamOptions{IncludeUsage: true},
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -186,68 +201,52 @@ func (c *OpenRouterClient) ChatCompletionStream(ctx context.Context, messages []
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	req.Header.Set("HTTP-Referer", "https://rolecraft.ai")
 	req.Header.Set("X-Title", "RoleCraft AI")
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		errChan <- fmt.Errorf("failed to send request: %w", err)
-		close(chunkChan)
-		close(errChan)
-		return chunkChan, errChan
-	}
-
 	go func() {
-		defer resp.Body.Close()
 		defer close(chunkChan)
 		defer close(errChan)
 
+		// 流式响应时长不可预期，超时交由 ctx 控制
+		streamClient := &http.Client{Transport: c.httpClient.Transport}
+		resp, err := streamClient.Do(req)
+		if err != nil {
+			errChan <- fmt.Errorf("failed to send request: %w", err)
+			return
+		}
+		defer resp.Body.Close()
+
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
 			errChan <- fmt.Errorf("API error: status=%d, body=%s", resp.StatusCode, string(body))
 			return
 		}
 
-		decoder := json.NewDecoder(resp.Body)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				var chunk OpenRouterStreamChunk
-				if err := decoder.Decode(&chunk); err != nil {
-					if err == io.EOF {
-						return
-					}
-					errChan <- fmt.Errorf("failed to decode chunk: %w", err)
-					return
-				}
-
-				if len(chunk.Choices) > 0 {
-					streamChunk := &StreamChunk{
-						ID:      chunk.ID,
-						Object:  chunk.Object,
-						Created: chunk.Created,
-						Model:   chunk.Model,
-						Choices: []struct {
-							Index        int         `json:"index"`
-							Delta        ChatMessage `json:"delta"`
-							FinishReason string      `json:"finish_reason"`
-						}{
-							{
-								Index: 0,
-								Delta: ChatMessage{
-									Role:    "assistant",
-									Content: chunk.Choices[0].Delta.Content,
-								},
-								FinishReason: chunk.Choices[0].FinishReason,
-							},
-						},
-					}
-					chunkChan <- streamChunk
-				}
+		err = readSSE(ctx, resp.Body, func(data []byte) error {
+			var chunk OpenRouterStreamChunk
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				return fmt.Errorf("failed to decode chunk: %w", err)
+			}
+			if len(chunk.Choices) == 0 && chunk.Usage == nil {
+				return nil
+			}
+			content, finishReason := "", ""
+			if len(chunk.Choices) > 0 {
+				content, finishReason = chunk.Choices[0].Delta.Content, chunk.Choices[0].FinishReason
+			}
+			streamChunk := newDeltaChunk(chunk.ID, chunk.Model, content, finishReason)
+			streamChunk.Created = chunk.Created
+			streamChunk.Usage = chunk.Usage
+			if !sendChunk(ctx, chunkChan, streamChunk) {
+				return ctx.Err()
 			}
+			return nil
+		})
+		if err != nil {
+			errChan <- err
 		}
 	}()
 
@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"context"
+	"strings"
+)
+
+// 支持的对话提供方名称
+const (
+	ProviderAnythingLLM = "anythingllm"
+	ProviderOpenRouter  = "openrouter"
+	ProviderOpenAI      = "openai"
+	ProviderMock        = "mock"
+)
+
+// ChatProvider 对话模型提供方接口（OpenAI / OpenRouter / AnythingLLM / Mock）
+type ChatProvider interface {
+	// Name 提供方名称
+	Name() string
+
+	// ChatCompletion 普通对话补全
+	ChatCompletion(ctx context.Context, messages []ChatMessage, temperature float64) (*ChatResponse, error)
+}
+
+// ResponseContent 提取响应中的助手回复文本
+func ResponseContent(resp *ChatResponse) string {
+	if resp == nil || len(resp.Choices) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content)
+}
+
+// NormalizeProviderName 规范化提供方名称
+func NormalizeProviderName(name string) string {
+	raw := strings.ToLower(strings.TrimSpace(name))
+	switch raw {
+	case "anything", "anything-llm", "anythingllm":
+		return ProviderAnythingLLM
+	case "openrouter", "open-router":
+		return ProviderOpenRouter
+	case "openai", "open-ai":
+		return ProviderOpenAI
+	case "mock", "local":
+		return ProviderMock
+	default:
+		return raw
+	}
+}
+
+var (
+	_ StreamingChatProvider = (*OpenAIClient)(nil)
+	_ StreamingChatProvider = (*OpenRouterClient)(nil)
+	_ StreamingChatProvider = (*MockAIClient)(nil)
+	_ StreamingChatProvider = (*AnythingLLMProvider)(nil)
+)
@@ -47,6 +47,15 @@ func NewRAGService(config RAGConfig) *RAGService {
 
 // Retrieve 检索相关文档片段
 func (s *RAGService) Retrieve(ctx context.Context, query string, topK int) ([]SearchResult, error) {
+	return s.RetrieveFrom(ctx, "documents", query, topK)
+}
+
+// RetrieveFrom 在指定集合（如用户或公司知识库）中检索相关文档片段
+func (s *RAGService) RetrieveFrom(ctx context.Context, collection string, query string, topK int) ([]SearchResult, error) {
+	if s.embeddingClient == nil || s.vectorStore == nil {
+		return nil, fmt.Errorf("rag service is not configured")
+	}
+
 	// 1. 向量化查询
 	queryVector, err := s.embeddingClient.EmbedText(ctx, query)
 	if err != nil {
@@ -54,7 +63,7 @@ func (s *RAGService) Retrieve(ctx context.Context, query string, topK int) ([]Se
 	}
 
 	// 2. 在向量数据库中搜索
-	results, err := s.vectorStore.Search(ctx, "documents", queryVector, topK)
+	results, err := s.vectorStore.Search(ctx, collection, queryVector, topK)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search: %w", err)
 	}
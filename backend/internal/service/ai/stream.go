@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StreamingChatProvider 支持增量输出的对话提供方
+type StreamingChatProvider interface {
+	ChatProvider
+
+	// ChatCompletionStream 流式对话补全；chunk 通道关闭后从 error 通道读取最终错误（nil 表示正常结束）
+	ChatCompletionStream(ctx context.Context, messages []ChatMessage, temperature float64) (<-chan *StreamChunk, <-chan error)
+}
+
+// ChunkContent 提取流式数据块中的增量文本
+func ChunkContent(chunk *StreamChunk) string {
+	if chunk == nil || len(chunk.Choices) == 0 {
+		return ""
+	}
+	return chunk.Choices[0].Delta.Content
+}
+
+// newDeltaChunk 构造仅包含增量文本的数据块
+func newDeltaChunk(id, model, content, finishReason string) *StreamChunk {
+	chunk := &StreamChunk{
+		ID:     id,
+		Object: "chat.completion.chunk",
+		Model:  model,
+	}
+	chunk.Choices = append(chunk.Choices, struct {
+		Index        int         `json:"index"`
+		Delta        ChatMessage `json:"delta"`
+		FinishReason string      `json:"finish_reason"`
+	}{
+		Index:        0,
+		Delta:        ChatMessage{Role: "assistant", Content: content},
+		FinishReason: finishReason,
+	})
+	return chunk
+}
+
+// sendChunk 发送数据块，调用方取消时返回 false
+func sendChunk(ctx context.Context, ch chan<- *StreamChunk, chunk *StreamChunk) bool {
+	select {
+	case ch <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// readSSE 逐条读取 OpenAI 兼容的 SSE 数据（"data: {...}"），遇到 [DONE] 结束。
+// 兼容逐行输出 JSON 的非标准实现。
+func readSSE(ctx context.Context, body io.Reader, handle func(data []byte) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == ':' {
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("data:")) {
+			line = bytes.TrimSpace(line[len("data:"):])
+		} else if line[0] != '{' {
+			// event:/id:/retry: 等字段
+			continue
+		}
+		if strings.EqualFold(string(line), "[DONE]") {
+			return nil
+		}
+		if err := handle(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package ai
+
+import "rolecraft-ai/internal/service/document"
+
+// messageTokenOverhead 每条消息的格式开销（role、分隔符等）
+const messageTokenOverhead = 4
+
+// EstimateUsage 在提供方未返回 usage 时按本地规则估算 Token 用量
+func EstimateUsage(messages []ChatMessage, completion string) Usage {
+	usage := Usage{}
+	for _, msg := range messages {
+		usage.PromptTokens += document.CountTokens(msg.Content) + messageTokenOverhead
+	}
+	if completion != "" {
+		usage.CompletionTokens = document.CountTokens(completion)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// IsZero 提供方未返回任何用量
+func (u Usage) IsZero() bool {
+	return u.PromptTokens == 0 && u.CompletionTokens == 0 && u.TotalTokens == 0
+}
@@ -1,6 +1,7 @@
 package anythingllm
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -196,29 +197,38 @@ func (c *Client) Chat(userId, message, mode string) (string, error) {
 func (c *Client) StreamChat(userId, message, mode string, callback func(chunk string)) error {
 	slug := c.getWorkspaceSlug(userId)
 
-	reqBody := ChatRequest{
+	return c.StreamChatBySlug(context.Background(), slug, ChatRequest{
 		Message: message,
 		Mode:    mode,
-		Stream:  true,
-	}
+	}, func(chunk StreamChunk) {
+		if text := chunk.Text(); text != "" {
+			callback(text)
+		}
+	})
+}
 
+// StreamChatBySlug streams a chat response from the given workspace.
+// The callback receives every chunk, including the final one carrying sources.
+// Cancelling ctx aborts the upstream request.
+func (c *Client) StreamChatBySlug(ctx context.Context, slug string, reqBody ChatRequest, callback func(chunk StreamChunk)) error {
+	reqBody.Stream = true
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/workspace/%s/chat", c.BaseURL, slug)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(jsonData))
+	url := fmt.Sprintf("%s/workspace/%s/stream-chat", c.BaseURL, slug)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
 
-	client := &http.Client{
-		Timeout: 120 * time.Second,
-	}
+	// Streaming responses have no fixed duration; cancellation is driven by ctx.
+	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -231,20 +241,41 @@ func (c *Client) StreamChat(userId, message, mode string, callback func(chunk st
 		return fmt.Errorf("unexpected status: %d, body: %s", resp.StatusCode, string(body))
 	}
 
-	// Read SSE stream
-	decoder := json.NewDecoder(resp.Body)
-	for {
+	// Read SSE stream ("data: {...}" lines; plain JSON lines are accepted too)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("data:")) {
+			line = bytes.TrimSpace(line[len("data:"):])
+		} else if line[0] != '{' {
+			continue
+		}
+
 		var chunk StreamChunk
-		if err := decoder.Decode(&chunk); err != nil {
-			if err == io.EOF {
-				break
-			}
+		if err := json.Unmarshal(line, &chunk); err != nil {
 			return fmt.Errorf("failed to decode stream: %w", err)
 		}
+		if msg := chunk.ErrorMessage(); msg != "" {
+			return fmt.Errorf("api error: %s", msg)
+		}
+		if chunk.Type == "abort" {
+			return fmt.Errorf("stream aborted")
+		}
 
-		if chunk.Response != "" {
-			callback(chunk.Response)
+		callback(chunk)
+		if chunk.Close {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
+		return fmt.Errorf("failed to read stream: %w", err)
 	}
 
 	return nil
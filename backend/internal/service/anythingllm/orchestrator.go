@@ -47,6 +47,7 @@ type ChatResult struct {
 	Sources  []map[string]interface{}
 	Thoughts []string
 	Type     string
+	Metrics  *ChatMetrics // nil when the server does not report usage
 	Raw      map[string]interface{}
 }
 
@@ -334,7 +335,15 @@ func (o *Orchestrator) SyncWorkspaceRuntimeModel(ctx context.Context, slug, mode
 	return nil
 }
 
-func (o *Orchestrator) Chat(ctx context.Context, req ChatPayload) (*ChatResult, error) {
+type preparedChat struct {
+	slug    string
+	message string
+	mode    string // requested mode: chat/agent/query
+	apiMode string // mode sent to AnythingLLM: chat/query
+	model   string
+}
+
+func (o *Orchestrator) prepareChat(ctx context.Context, req ChatPayload) (*preparedChat, error) {
 	if !o.Enabled() {
 		return nil, fmt.Errorf("anythingllm is not configured")
 	}
@@ -378,6 +387,30 @@ func (o *Orchestrator) Chat(ctx context.Context, req ChatPayload) (*ChatResult,
 		}
 	}
 
+	return &preparedChat{
+		slug:    slug,
+		message: finalMessage,
+		mode:    mode,
+		apiMode: finalMode,
+		model:   model,
+	}, nil
+}
+
+func (o *Orchestrator) Chat(ctx context.Context, req ChatPayload) (*ChatResult, error) {
+	prepared, err := o.prepareChat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return o.chatPrepared(ctx, req, prepared)
+}
+
+func (o *Orchestrator) chatPrepared(ctx context.Context, req ChatPayload, prepared *preparedChat) (*ChatResult, error) {
+	slug := prepared.slug
+	mode := prepared.mode
+	finalMode := prepared.apiMode
+	finalMessage := prepared.message
+	model := prepared.model
+
 	payload := map[string]interface{}{
 		"message": finalMessage,
 		"mode":    finalMode,
@@ -420,6 +453,58 @@ func (o *Orchestrator) Chat(ctx context.Context, req ChatPayload) (*ChatResult,
 	return parseChatResult(body)
 }
 
+// StreamChat relays text deltas from the stream-chat endpoint to onDelta.
+// Agent invocations run over a websocket in AnythingLLM, so they fall back to a blocking chat.
+func (o *Orchestrator) StreamChat(ctx context.Context, req ChatPayload, onDelta func(delta string)) (*ChatResult, error) {
+	prepared, err := o.prepareChat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if prepared.mode == "agent" {
+		result, err := o.chatPrepared(ctx, req, prepared)
+		if err != nil {
+			return nil, err
+		}
+		if result.Content != "" {
+			onDelta(result.Content)
+		}
+		return result, nil
+	}
+
+	client := NewAnythingLLMClient(o.baseURL, o.apiKey)
+	var content strings.Builder
+	sources := []map[string]interface{}{}
+	var metrics *ChatMetrics
+	err = client.StreamChatBySlug(ctx, prepared.slug, ChatRequest{
+		Message:   prepared.message,
+		Mode:      prepared.apiMode,
+		SessionID: strings.TrimSpace(req.SessionID),
+	}, func(chunk StreamChunk) {
+		if text := chunk.Text(); text != "" {
+			content.WriteString(text)
+			onDelta(text)
+		}
+		if len(chunk.Sources) > 0 {
+			sources = chunk.Sources
+		}
+		if chunk.Metrics != nil {
+			metrics = chunk.Metrics
+		}
+	})
+	result := &ChatResult{
+		Content:  strings.TrimSpace(content.String()),
+		Sources:  sources,
+		Thoughts: []string{},
+		Type:     "textResponse",
+		Metrics:  metrics,
+	}
+	if err != nil {
+		// Keep what was generated before the stream failed or ctx was cancelled.
+		return result, err
+	}
+	return result, nil
+}
+
 func (o *Orchestrator) GetChatHistory(ctx context.Context, slug string, limit int) ([]map[string]interface{}, error) {
 	normalizedSlug, err := NormalizeWorkspaceSlug(slug)
 	if err != nil {
@@ -708,9 +793,12 @@ func (o *Orchestrator) doJSON(ctx context.Context, method, path string, payload
 		client := &http.Client{Timeout: timeout}
 		resp, err := client.Do(req)
 		if err != nil {
+			// Cancelled by the caller: do not retry.
+			if ctx.Err() != nil {
+				return 0, nil, ctx.Err()
+			}
 			lastErr = err
-			if attempt < 2 {
-				time.Sleep(time.Duration(attempt+1) * time.Second)
+			if attempt < 2 && sleepContext(ctx, time.Duration(attempt+1)*time.Second) {
 				continue
 			}
 			break
@@ -719,9 +807,11 @@ func (o *Orchestrator) doJSON(ctx context.Context, method, path string, payload
 		respBody, readErr := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if readErr != nil {
+			if ctx.Err() != nil {
+				return 0, nil, ctx.Err()
+			}
 			lastErr = readErr
-			if attempt < 2 {
-				time.Sleep(time.Duration(attempt+1) * time.Second)
+			if attempt < 2 && sleepContext(ctx, time.Duration(attempt+1)*time.Second) {
 				continue
 			}
 			break
@@ -729,18 +819,35 @@ func (o *Orchestrator) doJSON(ctx context.Context, method, path string, payload
 
 		if resp.StatusCode >= 500 && attempt < 2 {
 			lastErr = fmt.Errorf("server error: status=%d", resp.StatusCode)
-			time.Sleep(time.Duration(attempt+1) * time.Second)
-			continue
+			if sleepContext(ctx, time.Duration(attempt+1)*time.Second) {
+				continue
+			}
+			break
 		}
 		return resp.StatusCode, respBody, nil
 	}
 
+	if ctx.Err() != nil {
+		return 0, nil, ctx.Err()
+	}
 	if lastErr != nil {
 		return 0, nil, lastErr
 	}
 	return 0, nil, fmt.Errorf("request failed")
 }
 
+// sleepContext waits for d and reports false if ctx is cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
 func parseWorkspace(payload []byte) (*Workspace, error) {
 	var data map[string]interface{}
 	if err := json.Unmarshal(payload, &data); err != nil {
@@ -816,10 +923,30 @@ func parseChatResult(payload []byte) (*ChatResult, error) {
 		Thoughts: thoughts,
 		Sources:  sources,
 		Type:     getString(data, "type"),
+		Metrics:  parseChatMetrics(data["metrics"]),
 		Raw:      data,
 	}, nil
 }
 
+func parseChatMetrics(raw interface{}) *ChatMetrics {
+	data, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	metrics := &ChatMetrics{
+		PromptTokens:     int(toInt64Value(data["prompt_tokens"])),
+		CompletionTokens: int(toInt64Value(data["completion_tokens"])),
+		TotalTokens:      int(toInt64Value(data["total_tokens"])),
+	}
+	if metrics.TotalTokens == 0 {
+		metrics.TotalTokens = metrics.PromptTokens + metrics.CompletionTokens
+	}
+	if metrics.TotalTokens == 0 {
+		return nil
+	}
+	return metrics
+}
+
 func isAgentKeyError(payload []byte) bool {
 	text := strings.ToLower(strings.TrimSpace(string(payload)))
 	return strings.Contains(text, "openai api key must be provided to use agents")
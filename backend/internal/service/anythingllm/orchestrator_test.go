@@ -22,6 +22,11 @@ func TestChatAgentModeBuildsSessionPayload(t *testing.T) {
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
 			"response": "ok",
 			"type":     "textResponse",
+			"metrics": map[string]interface{}{
+				"prompt_tokens":     120,
+				"completion_tokens": 30,
+				"total_tokens":      150,
+			},
 		})
 	}))
 	defer server.Close()
@@ -39,6 +44,9 @@ func TestChatAgentModeBuildsSessionPayload(t *testing.T) {
 	if result.Content != "ok" {
 		t.Fatalf("unexpected content: %s", result.Content)
 	}
+	if result.Metrics == nil || result.Metrics.PromptTokens != 120 || result.Metrics.TotalTokens != 150 {
+		t.Fatalf("unexpected metrics: %+v", result.Metrics)
+	}
 	if seenPath != "/api/v1/workspace/abc_123/chat" {
 		t.Fatalf("unexpected path: %s", seenPath)
 	}
@@ -1,6 +1,9 @@
 package anythingllm
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Client represents the AnythingLLM API client
 type Client struct {
@@ -49,9 +52,10 @@ type GetWorkspaceResponse struct {
 
 // ChatRequest represents a chat request
 type ChatRequest struct {
-	Message string `json:"message"`
-	Mode    string `json:"mode,omitempty"` // "chat" or "query"
-	Stream  bool   `json:"stream,omitempty"`
+	Message   string `json:"message"`
+	Mode      string `json:"mode,omitempty"` // "chat" or "query"
+	Stream    bool   `json:"stream,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
 }
 
 // ChatResponse represents a chat response
@@ -66,9 +70,44 @@ type ChatResponse struct {
 
 // StreamChunk represents a streaming response chunk
 type StreamChunk struct {
-	ID       string `json:"id"`
-	Type     string `json:"type"`
-	Response string `json:"response"`
+	ID           string                   `json:"id"`
+	Type         string                   `json:"type"` // "textResponseChunk", "finalizeResponseStream", "abort"
+	Response     string                   `json:"response"`
+	TextResponse string                   `json:"textResponse"`
+	TextChunk    string                   `json:"textChunk"`
+	Sources      []map[string]interface{} `json:"sources,omitempty"`
+	Close        bool                     `json:"close"`
+	Error        interface{}              `json:"error,omitempty"`
+	Metrics      *ChatMetrics             `json:"metrics,omitempty"`
+}
+
+// ChatMetrics token usage reported by AnythingLLM (present since v1.2)
+type ChatMetrics struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Text returns the incremental text carried by the chunk
+func (c StreamChunk) Text() string {
+	for _, text := range []string{c.TextResponse, c.TextChunk, c.Response} {
+		if text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// ErrorMessage returns the error reported by the chunk, if any
+func (c StreamChunk) ErrorMessage() string {
+	switch typed := c.Error.(type) {
+	case string:
+		return typed
+	case nil, bool:
+		return ""
+	default:
+		return fmt.Sprint(typed)
+	}
 }
 
 // UploadDocumentResponse represents the response from uploading a document
@@ -14,10 +14,15 @@ import (
 )
 
 type AgentStep struct {
-	Agent      string `json:"agent"`
-	Purpose    string `json:"purpose"`
-	Output     string `json:"output"`
-	DurationMs int64  `json:"durationMs"`
+	Agent            string `json:"agent"`
+	Purpose          string `json:"purpose"`
+	Output           string `json:"output"`
+	DurationMs       int64  `json:"durationMs"`
+	PromptTokens     int    `json:"promptTokens"`
+	CompletionTokens int    `json:"completionTokens"`
+	TokensUsed       int    `json:"tokensUsed"`
+	Model            string `json:"model,omitempty"`
+	Provider         string `json:"provider,omitempty"`
 }
 
 type RunRequest struct {
@@ -61,63 +66,48 @@ func (o *Orchestrator) Run(ctx context.Context, req RunRequest) (*RunResult, err
 		"任务名称：%s\n任务类型：%s\n任务描述：%s\n输入源：%s\n汇报规则：%s\n请给出执行计划、里程碑和验收标准。",
 		req.TaskName, req.TaskType, req.TaskDescription, req.InputSource, req.ReportRule,
 	)
-	plannerOutput, plannerCost, err := o.ask(ctx, plannerSystemPrompt, plannerInput)
+	planner, err := o.ask(ctx, plannerSystemPrompt, plannerInput)
 	if err != nil {
 		return nil, err
 	}
-	plannerOutput = sanitizeText(plannerOutput)
-	steps = append(steps, AgentStep{
-		Agent:      "Planner",
-		Purpose:    "任务拆解与执行计划",
-		Output:     plannerOutput,
-		DurationMs: plannerCost,
-	})
+	planner.Agent = "Planner"
+	planner.Purpose = "任务拆解与执行计划"
+	plannerOutput := planner.Output
+	steps = append(steps, planner)
 
 	mode := strings.ToLower(strings.TrimSpace(req.ExecutionMode))
 	if mode != "parallel" {
 		mode = "serial"
 	}
 
-	var researcherOutput string
-	var researcherCost int64
-	var criticOutput string
-	var criticCost int64
+	var researcher, critic AgentStep
 	if mode == "parallel" {
-		researcherOutput, researcherCost, criticOutput, criticCost, err = o.runParallelPhase(ctx, plannerOutput)
+		researcher, critic, err = o.runParallelPhase(ctx, plannerOutput)
 	} else {
-		researcherOutput, researcherCost, criticOutput, criticCost, err = o.runSerialPhase(ctx, plannerOutput)
+		researcher, critic, err = o.runSerialPhase(ctx, plannerOutput)
 	}
 	if err != nil {
 		return nil, err
 	}
-	steps = append(steps, AgentStep{
-		Agent:      "Researcher",
-		Purpose:    "信息补充与证据检索",
-		Output:     sanitizeText(researcherOutput),
-		DurationMs: researcherCost,
-	})
-	steps = append(steps, AgentStep{
-		Agent:      "Critic",
-		Purpose:    "质量审查与反例校验",
-		Output:     sanitizeText(criticOutput),
-		DurationMs: criticCost,
-	})
+	researcher.Agent = "Researcher"
+	researcher.Purpose = "信息补充与证据检索"
+	critic.Agent = "Critic"
+	critic.Purpose = "质量审查与反例校验"
+	researcherOutput, criticOutput := researcher.Output, critic.Output
+	steps = append(steps, researcher, critic)
 
 	synthInput := fmt.Sprintf(
 		"任务信息：\n%s\n\nPlanner:\n%s\n\nResearcher:\n%s\n\nCritic:\n%s\n\n请输出 JSON：{\"summary\":\"\",\"finalAnswer\":\"\",\"confidence\":0.0,\"nextActions\":[],\"evidence\":[]}",
 		plannerInput, plannerOutput, researcherOutput, criticOutput,
 	)
-	synthOutput, synthCost, err := o.ask(ctx, synthesizerSystemPrompt, synthInput)
+	synth, err := o.ask(ctx, synthesizerSystemPrompt, synthInput)
 	if err != nil {
 		return nil, err
 	}
-	synthOutput = sanitizeText(synthOutput)
-	steps = append(steps, AgentStep{
-		Agent:      "Synthesizer",
-		Purpose:    "综合决议与结果产出",
-		Output:     synthOutput,
-		DurationMs: synthCost,
-	})
+	synth.Agent = "Synthesizer"
+	synth.Purpose = "综合决议与结果产出"
+	synthOutput := synth.Output
+	steps = append(steps, synth)
 
 	result := parseSynthResult(synthOutput)
 	if strings.TrimSpace(result.FinalAnswer) == "" {
@@ -135,33 +125,31 @@ func (o *Orchestrator) Run(ctx context.Context, req RunRequest) (*RunResult, err
 	return &result, nil
 }
 
-func (o *Orchestrator) runSerialPhase(ctx context.Context, plannerOutput string) (string, int64, string, int64, error) {
+func (o *Orchestrator) runSerialPhase(ctx context.Context, plannerOutput string) (AgentStep, AgentStep, error) {
 	researcherInput := fmt.Sprintf(
 		"任务上下文：\n%s\n\n请输出关键信息、外部依赖、可验证证据（可给出链接占位）和风险提示。",
 		plannerOutput,
 	)
-	researcherOutput, researcherCost, err := o.ask(ctx, researcherSystemPrompt, researcherInput)
+	researcher, err := o.ask(ctx, researcherSystemPrompt, researcherInput)
 	if err != nil {
-		return "", 0, "", 0, err
+		return AgentStep{}, AgentStep{}, err
 	}
-	researcherOutput = sanitizeText(researcherOutput)
 
 	criticInput := fmt.Sprintf(
 		"计划：\n%s\n\n研究结果：\n%s\n\n请指出漏洞、冲突、遗漏，并给出修正建议。",
-		plannerOutput, researcherOutput,
+		plannerOutput, researcher.Output,
 	)
-	criticOutput, criticCost, err := o.ask(ctx, criticSystemPrompt, criticInput)
+	critic, err := o.ask(ctx, criticSystemPrompt, criticInput)
 	if err != nil {
-		return "", 0, "", 0, err
+		return AgentStep{}, AgentStep{}, err
 	}
-	return researcherOutput, researcherCost, sanitizeText(criticOutput), criticCost, nil
+	return researcher, critic, nil
 }
 
-func (o *Orchestrator) runParallelPhase(ctx context.Context, plannerOutput string) (string, int64, string, int64, error) {
+func (o *Orchestrator) runParallelPhase(ctx context.Context, plannerOutput string) (AgentStep, AgentStep, error) {
 	type askResult struct {
-		output string
-		cost   int64
-		err    error
+		step AgentStep
+		err  error
 	}
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -175,12 +163,8 @@ func (o *Orchestrator) runParallelPhase(ctx context.Context, plannerOutput strin
 			"任务上下文：\n%s\n\n请输出关键信息、外部依赖、可验证证据（可给出链接占位）和风险提示。",
 			plannerOutput,
 		)
-		output, cost, err := o.ask(ctx, researcherSystemPrompt, researcherInput)
-		researcherCh <- askResult{
-			output: sanitizeText(output),
-			cost:   cost,
-			err:    err,
-		}
+		step, err := o.ask(ctx, researcherSystemPrompt, researcherInput)
+		researcherCh <- askResult{step: step, err: err}
 	}()
 
 	go func() {
@@ -189,12 +173,8 @@ func (o *Orchestrator) runParallelPhase(ctx context.Context, plannerOutput strin
 			"计划：\n%s\n\n请从反例和风险审查角度指出漏洞、冲突、遗漏，并给出修正建议。",
 			plannerOutput,
 		)
-		output, cost, err := o.ask(ctx, criticSystemPrompt, criticInput)
-		criticCh <- askResult{
-			output: sanitizeText(output),
-			cost:   cost,
-			err:    err,
-		}
+		step, err := o.ask(ctx, criticSystemPrompt, criticInput)
+		criticCh <- askResult{step: step, err: err}
 	}()
 
 	wg.Wait()
@@ -204,40 +184,79 @@ func (o *Orchestrator) runParallelPhase(ctx context.Context, plannerOutput strin
 	researcherRes := <-researcherCh
 	criticRes := <-criticCh
 	if researcherRes.err != nil {
-		return "", 0, "", 0, researcherRes.err
+		return AgentStep{}, AgentStep{}, researcherRes.err
 	}
 	if criticRes.err != nil {
-		return "", 0, "", 0, criticRes.err
+		return AgentStep{}, AgentStep{}, criticRes.err
 	}
-	return researcherRes.output, researcherRes.cost, criticRes.output, criticRes.cost, nil
+	return researcherRes.step, criticRes.step, nil
 }
 
-func (o *Orchestrator) ask(ctx context.Context, systemPrompt, userPrompt string) (string, int64, error) {
+// ask 调用模型完成单个 Agent 步骤，返回已清洗的输出、耗时与 Token 用量。
+// 提供方未返回用量时按本地估算；模型不可用或调用失败时降级为本地输出，不计用量。
+func (o *Orchestrator) ask(ctx context.Context, systemPrompt, userPrompt string) (AgentStep, error) {
 	start := time.Now()
+	messages := []ai.ChatMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: userPrompt},
+	}
 	if o.openrouter == nil {
 		mock := fmt.Sprintf("系统未配置大模型，使用降级输出。\n系统角色：%s\n用户输入：%s", systemPrompt, userPrompt)
-		return mock, time.Since(start).Milliseconds(), nil
+		return newAgentStep(sanitizeText(mock), start, ai.Usage{}, "", ai.ProviderMock), nil
 	}
 
 	callCtx, cancel := context.WithTimeout(ctx, 90*time.Second)
 	defer cancel()
 
-	resp, err := o.openrouter.ChatCompletion(callCtx, []ai.ChatMessage{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: userPrompt},
-	}, 0.2)
+	resp, err := o.openrouter.ChatCompletion(callCtx, messages, 0.2)
 	if err != nil {
 		fallback := fmt.Sprintf(
 			"模型调用失败，已降级为本地协商摘要。\n系统角色：%s\n任务输入：%s\n建议：先拆解任务、补充证据、进行风险复核，再汇总输出。",
 			clipText(systemPrompt, 48),
 			clipText(userPrompt, 220),
 		)
-		return fallback, time.Since(start).Milliseconds(), nil
+		return newAgentStep(sanitizeText(fallback), start, ai.Usage{}, "", ai.ProviderMock), nil
 	}
 	if len(resp.Choices) == 0 {
-		return "", 0, fmt.Errorf("empty llm response")
+		return AgentStep{}, fmt.Errorf("empty llm response")
+	}
+
+	output := strings.TrimSpace(resp.Choices[0].Message.Content)
+	usage := resp.Usage
+	if usage.IsZero() {
+		usage = ai.EstimateUsage(messages, output)
+	}
+	model := resp.Model
+	if model == "" {
+		model = o.openrouter.GetModel()
+	}
+	return newAgentStep(sanitizeText(output), start, usage, model, o.openrouter.Name()), nil
+}
+
+func newAgentStep(output string, start time.Time, usage ai.Usage, model, provider string) AgentStep {
+	total := usage.TotalTokens
+	if total == 0 {
+		total = usage.PromptTokens + usage.CompletionTokens
+	}
+	return AgentStep{
+		Output:           output,
+		DurationMs:       time.Since(start).Milliseconds(),
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TokensUsed:       total,
+		Model:            model,
+		Provider:         provider,
+	}
+}
+
+// TotalUsage 汇总各步骤的 Token 用量
+func (r *RunResult) TotalUsage() (promptTokens, completionTokens, total int) {
+	for _, step := range r.Steps {
+		promptTokens += step.PromptTokens
+		completionTokens += step.CompletionTokens
+		total += step.TokensUsed
 	}
-	return strings.TrimSpace(resp.Choices[0].Message.Content), time.Since(start).Milliseconds(), nil
+	return promptTokens, completionTokens, total
 }
 
 func parseSynthResult(raw string) RunResult {
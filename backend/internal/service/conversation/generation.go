@@ -0,0 +1,81 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrGenerationCancelled 生成被用户主动取消
+var ErrGenerationCancelled = errors.New("generation cancelled")
+
+// Generations 进行中的回复生成登记表
+// 每次生成可按会话 ID、消息 ID 等多个键登记，任一键都可用于取消。
+type Generations struct {
+	mu     sync.Mutex
+	nextID uint64
+	byKey  map[string]*generation
+}
+
+type generation struct {
+	id     uint64
+	cancel context.CancelCauseFunc
+}
+
+// NewGenerations 创建生成登记表
+func NewGenerations() *Generations {
+	return &Generations{byKey: map[string]*generation{}}
+}
+
+// Start 登记一次生成，返回派生自 parent 的 ctx；生成结束后必须调用 release。
+// 同一键上的新生成会覆盖旧登记（旧生成仍可通过其它键取消）。
+func (g *Generations) Start(parent context.Context, keys ...string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	g.mu.Lock()
+	g.nextID++
+	gen := &generation{id: g.nextID, cancel: cancel}
+	for _, key := range keys {
+		if key != "" {
+			g.byKey[key] = gen
+		}
+	}
+	g.mu.Unlock()
+
+	release := func() {
+		g.mu.Lock()
+		for _, key := range keys {
+			if current, ok := g.byKey[key]; ok && current.id == gen.id {
+				delete(g.byKey, key)
+			}
+		}
+		g.mu.Unlock()
+		cancel(nil)
+	}
+	return ctx, release
+}
+
+// Cancel 取消指定键上的生成，返回是否存在进行中的生成
+func (g *Generations) Cancel(key string) bool {
+	g.mu.Lock()
+	gen, ok := g.byKey[key]
+	g.mu.Unlock()
+	if !ok {
+		return false
+	}
+	gen.cancel(ErrGenerationCancelled)
+	return true
+}
+
+// Active 返回指定键上是否有进行中的生成
+func (g *Generations) Active(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.byKey[key]
+	return ok
+}
+
+// Cancelled 判断 ctx 是否因用户主动取消而结束（区别于客户端断开或超时）
+func Cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrGenerationCancelled)
+}
@@ -0,0 +1,50 @@
+package conversation
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGenerationsCancelByAnyKey(t *testing.T) {
+	generations := NewGenerations()
+
+	ctx, release := generations.Start(context.Background(), "session-1", "message-1")
+	if !generations.Active("session-1") || !generations.Active("message-1") {
+		t.Fatalf("generation should be registered under both keys")
+	}
+	if !generations.Cancel("message-1") {
+		t.Fatalf("expected cancel to find the generation")
+	}
+	if ctx.Err() == nil || !Cancelled(ctx) {
+		t.Fatalf("ctx should be cancelled by the user, got %v", context.Cause(ctx))
+	}
+
+	release()
+	if generations.Active("session-1") || generations.Cancel("session-1") {
+		t.Fatalf("released generation should be unregistered")
+	}
+}
+
+func TestGenerationsReleaseKeepsNewerRegistration(t *testing.T) {
+	generations := NewGenerations()
+
+	_, releaseOld := generations.Start(context.Background(), "session-1")
+	newCtx, releaseNew := generations.Start(context.Background(), "session-1")
+	defer releaseNew()
+
+	releaseOld()
+	if !generations.Active("session-1") {
+		t.Fatalf("releasing an older generation must not drop the newer one")
+	}
+
+	parent, cancelParent := context.WithCancel(context.Background())
+	disconnected, release := generations.Start(parent, "session-2")
+	defer release()
+	cancelParent()
+	if disconnected.Err() == nil || Cancelled(disconnected) {
+		t.Fatalf("client disconnect should not count as a user cancel")
+	}
+	if newCtx.Err() != nil {
+		t.Fatalf("unrelated generation cancelled")
+	}
+}
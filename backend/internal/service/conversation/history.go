@@ -0,0 +1,300 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/ai"
+	"rolecraft-ai/internal/service/document"
+)
+
+const (
+	// defaultContextWindow 未知模型的上下文窗口
+	defaultContextWindow = 8192
+	// maxCompletionReserve 为模型回复预留的最大 Token 数
+	maxCompletionReserve = 4096
+	// messageOverhead 每条消息的格式开销（role、分隔符等）
+	messageOverhead = 4
+	// summaryInputLimit 单次送入摘要模型的历史文本上限（字符）
+	summaryInputLimit = 24000
+)
+
+// contextWindows 常见模型的上下文窗口（按前缀匹配，越具体越靠前）
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4o", 128000},
+	{"gpt-4.1", 1000000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo", 16385},
+	{"o1", 128000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"claude", 200000},
+	{"gemini", 1000000},
+	{"deepseek", 64000},
+	{"qwen", 32768},
+	{"moonshot", 128000},
+	{"kimi", 128000},
+	{"glm", 128000},
+	{"mistral", 32768},
+	{"llama-3.1", 128000},
+	{"llama-3", 8192},
+	{"mock", 8192},
+}
+
+// ContextWindow 返回模型的上下文窗口大小（Token）
+// 支持 OpenRouter 风格的 "vendor/model" 名称。
+func ContextWindow(model string) int {
+	name := strings.ToLower(strings.TrimSpace(model))
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	name = strings.TrimSuffix(name, ":free")
+	for _, item := range contextWindows {
+		if strings.HasPrefix(name, item.prefix) {
+			return item.tokens
+		}
+	}
+	return defaultContextWindow
+}
+
+// HistoryBuilder 按模型上下文窗口组装对话历史
+// 装不下的早期轮次折叠进滚动摘要，并持久化到会话上。
+type HistoryBuilder struct {
+	db         *gorm.DB
+	counter    *document.Processor
+	summarizer ai.ChatProvider
+}
+
+// NewHistoryBuilder 创建历史组装器；summarizer 为空时使用抽取式摘要
+func NewHistoryBuilder(db *gorm.DB, summarizer ai.ChatProvider) *HistoryBuilder {
+	return &HistoryBuilder{
+		db:         db,
+		counter:    document.NewProcessor(document.ProcessorConfig{}),
+		summarizer: summarizer,
+	}
+}
+
+// HistoryRequest 组装请求
+type HistoryRequest struct {
+	Session *models.ChatSession
+	Current models.Message // 本轮用户消息，仅其之前的消息作为历史
+	Prompt  string         // 本轮实际发送的用户内容（含角色设定、知识库上下文）
+	Model   string
+	Window  int // 覆盖上下文窗口，0 表示按模型推断
+}
+
+// Build 返回发送给模型的消息列表：[摘要] + 历史轮次 + 本轮用户消息
+func (b *HistoryBuilder) Build(ctx context.Context, req HistoryRequest) ([]ai.ChatMessage, error) {
+	current := ai.ChatMessage{Role: "user", Content: req.Prompt}
+	if req.Session == nil {
+		return []ai.ChatMessage{current}, nil
+	}
+
+	history, err := b.loadHistory(req.Session, req.Current)
+	if err != nil {
+		return nil, err
+	}
+
+	window := req.Window
+	if window <= 0 {
+		window = ContextWindow(req.Model)
+	}
+	reserve := window / 4
+	if reserve > maxCompletionReserve {
+		reserve = maxCompletionReserve
+	}
+	budget := window - reserve - b.messageTokens(current.Content)
+	if budget <= 0 {
+		return []ai.ChatMessage{current}, nil
+	}
+
+	// 已被摘要覆盖的消息不再逐条发送。锚点不在本轮的活动路径上时
+	// （切换了分支或锚点已被删除），摘要不再适用，需按当前分支重新生成。
+	summary := ""
+	if anchor := req.Session.HistorySummaryMessageID; anchor != "" {
+		if idx := indexOfMessage(history, anchor); idx >= 0 {
+			summary = req.Session.HistorySummary
+			history = history[idx+1:]
+		}
+	}
+
+	summaryTokens := 0
+	if summary != "" {
+		summaryTokens = b.messageTokens(summary)
+	}
+	keepFrom := b.fitFrom(history, budget-summaryTokens)
+
+	summaryBudget := budget / 4
+	if keepFrom == 0 && summaryTokens > summaryBudget {
+		// 历史本身装得下，仅旧摘要过长
+		summary = b.clipTokensTail(summary, summaryBudget)
+	}
+	if keepFrom > 0 {
+		// 折叠时只保留一半预算内的近期轮次，避免此后每一轮都触发摘要
+		keepFrom = b.fitFrom(history, (budget-summaryBudget)/2)
+		if keepFrom == 0 {
+			keepFrom = 1
+		}
+		folded := history[:keepFrom]
+		summary = b.summarize(ctx, summary, folded, summaryBudget)
+		history = history[keepFrom:]
+
+		anchor := folded[len(folded)-1].ID
+		if err := b.db.Model(req.Session).Updates(map[string]interface{}{
+			"history_summary":            summary,
+			"history_summary_message_id": anchor,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("failed to persist history summary: %w", err)
+		}
+		req.Session.HistorySummary = summary
+		req.Session.HistorySummaryMessageID = anchor
+	}
+
+	messages := make([]ai.ChatMessage, 0, len(history)+2)
+	if summary != "" {
+		messages = append(messages, ai.ChatMessage{Role: "system", Content: "此前对话摘要：\n" + summary})
+	}
+	for _, msg := range history {
+		messages = append(messages, ai.ChatMessage{Role: msg.Role, Content: msg.Content})
+	}
+	return append(messages, current), nil
+}
+
+// loadHistory 加载活动路径上本轮之前的用户 / 助手消息（对话顺序）
+func (b *HistoryBuilder) loadHistory(session *models.ChatSession, current models.Message) ([]models.Message, error) {
+	messages, err := Ancestors(b.db, session, current.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %w", err)
+	}
+
+	history := messages[:0]
+	for _, msg := range messages {
+		if (msg.Role == "user" || msg.Role == "assistant") && strings.TrimSpace(msg.Content) != "" {
+			history = append(history, msg)
+		}
+	}
+	return history, nil
+}
+
+// fitFrom 从最新消息向前累计，返回预算内可保留的第一条消息下标
+func (b *HistoryBuilder) fitFrom(history []models.Message, budget int) int {
+	used := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		used += b.messageTokens(history[i].Content)
+		if used > budget {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (b *HistoryBuilder) messageTokens(content string) int {
+	return b.counter.CountTokens(content) + messageOverhead
+}
+
+// summarize 将旧摘要与新折叠的轮次合并为新摘要，模型不可用时退化为抽取式摘要
+func (b *HistoryBuilder) summarize(ctx context.Context, previous string, folded []models.Message, budget int) string {
+	transcript := formatTranscript(folded)
+
+	if b.summarizer != nil {
+		var prompt strings.Builder
+		prompt.WriteString("请将以下对话压缩为简洁的摘要，保留用户目标、关键事实、已达成的结论和未解决的问题，使用与对话相同的语言，不超过 300 字。\n\n")
+		if previous != "" {
+			prompt.WriteString("已有摘要：\n")
+			prompt.WriteString(previous)
+			prompt.WriteString("\n\n")
+		}
+		prompt.WriteString("新增对话：\n")
+		prompt.WriteString(clipRunes(transcript, summaryInputLimit))
+
+		resp, err := b.summarizer.ChatCompletion(ctx, []ai.ChatMessage{
+			{Role: "system", Content: "你是对话摘要助手，只输出摘要正文。"},
+			{Role: "user", Content: prompt.String()},
+		}, 0.2)
+		if err == nil {
+			if content := ai.ResponseContent(resp); content != "" {
+				return b.clipTokens(content, budget)
+			}
+		}
+	}
+
+	var fallback strings.Builder
+	if previous != "" {
+		fallback.WriteString(previous)
+		fallback.WriteString("\n")
+	}
+	for _, msg := range folded {
+		fallback.WriteString(roleLabel(msg.Role))
+		fallback.WriteString("：")
+		fallback.WriteString(clipRunes(singleLine(msg.Content), 120))
+		fallback.WriteString("\n")
+	}
+	// 超出预算时保留最新的内容
+	return b.clipTokensTail(strings.TrimSpace(fallback.String()), budget)
+}
+
+// clipTokens 截断文本尾部以适配 Token 预算
+func (b *HistoryBuilder) clipTokens(text string, budget int) string {
+	runes := []rune(text)
+	for len(runes) > 0 && b.counter.CountTokens(string(runes)) > budget {
+		runes = runes[:len(runes)*9/10]
+	}
+	return string(runes)
+}
+
+// clipTokensTail 按行丢弃文本开头部分以适配 Token 预算
+func (b *HistoryBuilder) clipTokensTail(text string, budget int) string {
+	lines := strings.Split(text, "\n")
+	for len(lines) > 1 && b.counter.CountTokens(strings.Join(lines, "\n")) > budget {
+		lines = lines[1:]
+	}
+	return b.clipTokens(strings.Join(lines, "\n"), budget)
+}
+
+func indexOfMessage(messages []models.Message, id string) int {
+	for i, msg := range messages {
+		if msg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func formatTranscript(messages []models.Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		b.WriteString(roleLabel(msg.Role))
+		b.WriteString("：")
+		b.WriteString(strings.TrimSpace(msg.Content))
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
+
+func roleLabel(role string) string {
+	if role == "assistant" {
+		return "助手"
+	}
+	return "用户"
+}
+
+func singleLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func clipRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "..."
+}
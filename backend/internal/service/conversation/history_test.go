@@ -0,0 +1,165 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/ai"
+)
+
+type stubSummarizer struct {
+	calls int
+}
+
+func (s *stubSummarizer) Name() string { return "stub" }
+
+func (s *stubSummarizer) ChatCompletion(ctx context.Context, messages []ai.ChatMessage, temperature float64) (*ai.ChatResponse, error) {
+	s.calls++
+	resp := &ai.ChatResponse{}
+	resp.Choices = append(resp.Choices, struct {
+		Index        int             `json:"index"`
+		Message      ai.ChatMessage  `json:"message"`
+		Delta        *ai.ChatMessage `json:"delta,omitempty"`
+		FinishReason string          `json:"finish_reason"`
+	}{Message: ai.ChatMessage{Role: "assistant", Content: fmt.Sprintf("summary-%d", s.calls)}})
+	return resp, nil
+}
+
+func setupHistoryDB(t *testing.T, turns int) (*gorm.DB, *models.ChatSession, models.Message) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ChatSession{}, &models.Message{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	session := &models.ChatSession{ID: "s1", UserID: "u1", Title: "history"}
+	db.Create(session)
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < turns; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		db.Create(&models.Message{
+			ID:        fmt.Sprintf("m%02d", i),
+			SessionID: session.ID,
+			Role:      role,
+			Content:   fmt.Sprintf("turn %d %s", i, strings.Repeat("word ", 40)),
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	current := models.Message{
+		ID:        "current",
+		SessionID: session.ID,
+		Role:      "user",
+		Content:   "latest question",
+		CreatedAt: base.Add(time.Duration(turns) * time.Minute),
+	}
+	db.Create(&current)
+	return db, session, current
+}
+
+func TestContextWindow(t *testing.T) {
+	cases := map[string]int{
+		"openai/gpt-4o-mini":               128000,
+		"anthropic/claude-3.5-sonnet":      200000,
+		"deepseek/deepseek-chat-v3.1:free": 64000,
+		"gpt-4":                            8192,
+		"unknown-model":                    defaultContextWindow,
+		"":                                 defaultContextWindow,
+	}
+	for model, want := range cases {
+		if got := ContextWindow(model); got != want {
+			t.Fatalf("ContextWindow(%q) = %d, want %d", model, got, want)
+		}
+	}
+}
+
+func TestBuildIncludesFullHistoryWhenItFits(t *testing.T) {
+	db, session, current := setupHistoryDB(t, 4)
+	builder := NewHistoryBuilder(db, &stubSummarizer{})
+
+	messages, err := builder.Build(context.Background(), HistoryRequest{
+		Session: session,
+		Current: current,
+		Prompt:  "composed prompt",
+		Model:   "gpt-4o",
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if len(messages) != 5 {
+		t.Fatalf("expected 4 history turns + current, got %d", len(messages))
+	}
+	if messages[0].Role != "user" || !strings.HasPrefix(messages[0].Content, "turn 0") {
+		t.Fatalf("unexpected first message: %+v", messages[0])
+	}
+	if last := messages[len(messages)-1]; last.Role != "user" || last.Content != "composed prompt" {
+		t.Fatalf("expected composed prompt last, got %+v", last)
+	}
+	if session.HistorySummary != "" {
+		t.Fatalf("summary should not be created when history fits")
+	}
+}
+
+func TestBuildCollapsesOlderTurnsIntoPersistedSummary(t *testing.T) {
+	db, session, current := setupHistoryDB(t, 20)
+	summarizer := &stubSummarizer{}
+	builder := NewHistoryBuilder(db, summarizer)
+
+	req := HistoryRequest{Session: session, Current: current, Prompt: "composed prompt", Window: 1200}
+	messages, err := builder.Build(context.Background(), req)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if summarizer.calls != 1 {
+		t.Fatalf("expected one summarization, got %d", summarizer.calls)
+	}
+	if messages[0].Role != "system" || !strings.Contains(messages[0].Content, "summary-1") {
+		t.Fatalf("expected summary first, got %+v", messages[0])
+	}
+	if len(messages) >= 22 {
+		t.Fatalf("expected older turns to be dropped, got %d messages", len(messages))
+	}
+
+	var stored models.ChatSession
+	db.First(&stored, "id = ?", session.ID)
+	if stored.HistorySummary != "summary-1" || stored.HistorySummaryMessageID == "" {
+		t.Fatalf("summary not persisted: %+v", stored)
+	}
+	// 第一条保留的历史紧跟在摘要锚点之后
+	if !strings.HasPrefix(messages[1].Content, "turn ") {
+		t.Fatalf("unexpected first kept turn: %+v", messages[1])
+	}
+
+	// 再次组装不应重复摘要
+	if _, err := builder.Build(context.Background(), HistoryRequest{Session: &stored, Current: current, Prompt: "composed prompt", Window: 1200}); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if summarizer.calls != 1 {
+		t.Fatalf("expected summary reuse, got %d calls", summarizer.calls)
+	}
+}
+
+func TestBuildFallsBackToExtractiveSummary(t *testing.T) {
+	db, session, current := setupHistoryDB(t, 20)
+	builder := NewHistoryBuilder(db, nil)
+
+	messages, err := builder.Build(context.Background(), HistoryRequest{Session: session, Current: current, Prompt: "composed prompt", Window: 1200})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if messages[0].Role != "system" || !strings.Contains(messages[0].Content, "助手：turn") {
+		t.Fatalf("expected extractive summary, got %+v", messages[0])
+	}
+}
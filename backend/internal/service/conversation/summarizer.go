@@ -0,0 +1,248 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/ai"
+)
+
+const (
+	// TitleSourceUser 标题由用户指定，不再自动生成
+	TitleSourceUser = "user"
+	// TitleSourceAuto 标题已自动生成
+	TitleSourceAuto = "auto"
+
+	// summaryRefreshEvery 活动路径新增多少条消息后刷新概要
+	summaryRefreshEvery = 6
+	// titleMaxRunes 自动标题的最大长度
+	titleMaxRunes = 30
+	// overviewMaxRunes 概要的最大长度
+	overviewMaxRunes = 300
+	// overviewInputLimit 送入模型的对话文本上限（字符），超出时保留最新部分
+	overviewInputLimit = 12000
+	summarizeTimeout   = 60 * time.Second
+)
+
+// IsPlaceholderTitle 判断是否为创建会话时的默认标题（可被自动标题替换）
+func IsPlaceholderTitle(title string) bool {
+	title = strings.TrimSpace(title)
+	switch strings.ToLower(title) {
+	case "", "新对话", "新会话", "new chat", "untitled":
+		return true
+	}
+	return strings.HasPrefix(title, "与 ") && strings.HasSuffix(title, " 的对话")
+}
+
+// Summarizer 在后台为会话生成标题与概要
+// 首轮问答完成后生成标题和概要，之后每新增 summaryRefreshEvery 条消息刷新一次概要。
+type Summarizer struct {
+	db       *gorm.DB
+	provider ai.ChatProvider
+
+	once    sync.Once
+	queue   chan string
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+// NewSummarizer 创建会话概要生成器；provider 为空时使用 MockAIClient
+func NewSummarizer(db *gorm.DB, provider ai.ChatProvider) *Summarizer {
+	if provider == nil {
+		provider = ai.NewMockAIClient()
+	}
+	return &Summarizer{
+		db:       db,
+		provider: provider,
+		queue:    make(chan string, 256),
+		pending:  map[string]bool{},
+	}
+}
+
+// Schedule 将会话加入后台队列；同一会话排队期间的重复请求会被合并
+func (s *Summarizer) Schedule(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	s.once.Do(func() { go s.work() })
+
+	s.mu.Lock()
+	if s.pending[sessionID] {
+		s.mu.Unlock()
+		return
+	}
+	s.pending[sessionID] = true
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- sessionID:
+	default:
+		// 队列已满时放弃本次刷新，下一轮对话会重新触发
+		s.mu.Lock()
+		delete(s.pending, sessionID)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Summarizer) work() {
+	for sessionID := range s.queue {
+		s.mu.Lock()
+		delete(s.pending, sessionID)
+		s.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), summarizeTimeout)
+		if err := s.Refresh(ctx, sessionID); err != nil {
+			log.Printf("session summary refresh failed: session=%s err=%v", sessionID, err)
+		}
+		cancel()
+	}
+}
+
+// Refresh 按需生成会话标题与概要：标题仅在仍为默认标题时生成一次，概要随对话增长刷新
+func (s *Summarizer) Refresh(ctx context.Context, sessionID string) error {
+	var session models.ChatSession
+	if err := s.db.Where("id = ?", sessionID).First(&session).Error; err != nil {
+		return err
+	}
+	path, err := ActivePath(s.db, &session)
+	if err != nil {
+		return err
+	}
+
+	var turns []models.Message
+	hasUser, hasAssistant := false, false
+	for _, msg := range path {
+		if strings.TrimSpace(msg.Content) == "" || (msg.Role != "user" && msg.Role != "assistant") {
+			continue
+		}
+		hasUser = hasUser || msg.Role == "user"
+		hasAssistant = hasAssistant || msg.Role == "assistant"
+		turns = append(turns, msg)
+	}
+	// 至少完成一轮问答
+	if !hasUser || !hasAssistant {
+		return nil
+	}
+
+	needTitle := session.TitleSource == "" && IsPlaceholderTitle(session.Title)
+	needSummary := session.Summary == "" || len(turns)-session.SummaryMessageCount >= summaryRefreshEvery
+	if !needTitle && !needSummary {
+		return nil
+	}
+
+	title, summary := s.generate(ctx, session.Summary, turns)
+	now := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// 不更新 updated_at，避免后台任务打乱会话列表顺序
+		if err := tx.Model(&models.ChatSession{}).Where("id = ?", session.ID).UpdateColumns(map[string]interface{}{
+			"summary":               summary,
+			"summary_message_count": len(turns),
+			"summarized_at":         now,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to save summary: %w", err)
+		}
+		if !needTitle || title == "" {
+			return nil
+		}
+		// 期间用户手动改过标题时不覆盖
+		if err := tx.Model(&models.ChatSession{}).Where("id = ? AND (title_source = '' OR title_source IS NULL)", session.ID).
+			UpdateColumns(map[string]interface{}{"title": title, "title_source": TitleSourceAuto}).Error; err != nil {
+			return fmt.Errorf("failed to save title: %w", err)
+		}
+		return nil
+	})
+}
+
+// generate 调用模型生成标题与概要；模型不可用或输出无法解析时退化为抽取式结果
+func (s *Summarizer) generate(ctx context.Context, previous string, turns []models.Message) (string, string) {
+	transcript := formatTranscript(turns)
+	if runes := []rune(transcript); len(runes) > overviewInputLimit {
+		transcript = "..." + string(runes[len(runes)-overviewInputLimit:])
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("请为以下对话生成一个简洁的标题（不超过 15 个字）和一段概要（不超过 150 字），")
+	prompt.WriteString("概要需覆盖用户目标与主要结论，使用与对话相同的语言。")
+	prompt.WriteString("只输出 JSON：{\"title\": \"...\", \"summary\": \"...\"}\n\n")
+	if previous != "" {
+		prompt.WriteString("已有概要：\n")
+		prompt.WriteString(previous)
+		prompt.WriteString("\n\n")
+	}
+	prompt.WriteString("对话：\n")
+	prompt.WriteString(transcript)
+
+	fallbackTitle, fallbackSummary := extractOverview(turns)
+	resp, err := s.provider.ChatCompletion(ctx, []ai.ChatMessage{
+		{Role: "system", Content: "你是对话整理助手，只输出 JSON。"},
+		{Role: "user", Content: prompt.String()},
+	}, 0.2)
+	if err != nil {
+		return fallbackTitle, fallbackSummary
+	}
+
+	var parsed struct {
+		Title   string `json:"title"`
+		Summary string `json:"summary"`
+	}
+	content := ai.ResponseContent(resp)
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end <= start || json.Unmarshal([]byte(content[start:end+1]), &parsed) != nil {
+		return fallbackTitle, fallbackSummary
+	}
+
+	title := cleanTitle(parsed.Title)
+	if title == "" {
+		title = fallbackTitle
+	}
+	summary := clipRunes(singleLine(parsed.Summary), overviewMaxRunes)
+	if summary == "" {
+		summary = fallbackSummary
+	}
+	return title, summary
+}
+
+// extractOverview 抽取式标题与概要：标题取首条用户消息，概要拼接首尾轮次
+func extractOverview(turns []models.Message) (string, string) {
+	var firstUser, lastUser, lastAssistant string
+	for _, msg := range turns {
+		content := singleLine(msg.Content)
+		if msg.Role == "user" {
+			if firstUser == "" {
+				firstUser = content
+			}
+			lastUser = content
+		} else {
+			lastAssistant = content
+		}
+	}
+
+	parts := []string{"用户：" + clipRunes(firstUser, 80)}
+	if lastUser != firstUser {
+		parts = append(parts, "最近："+clipRunes(lastUser, 80))
+	}
+	if lastAssistant != "" {
+		parts = append(parts, "助手："+clipRunes(lastAssistant, 100))
+	}
+	return cleanTitle(firstUser), clipRunes(strings.Join(parts, " "), overviewMaxRunes)
+}
+
+// cleanTitle 去掉模型常见的引号、书名号和结尾标点，并限制长度
+func cleanTitle(title string) string {
+	title = singleLine(title)
+	title = strings.Trim(title, " \"'“”‘’「」『』《》#*")
+	title = strings.TrimRight(title, "。.！!？?，,；;：:")
+	runes := []rune(title)
+	if len(runes) > titleMaxRunes {
+		title = string(runes[:titleMaxRunes])
+	}
+	return strings.TrimSpace(title)
+}
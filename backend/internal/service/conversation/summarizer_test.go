@@ -0,0 +1,113 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/ai"
+)
+
+type stubOverview struct {
+	content string
+	calls   int
+}
+
+func (s *stubOverview) Name() string { return "stub" }
+
+func (s *stubOverview) ChatCompletion(ctx context.Context, messages []ai.ChatMessage, temperature float64) (*ai.ChatResponse, error) {
+	s.calls++
+	resp := &ai.ChatResponse{}
+	resp.Choices = append(resp.Choices, struct {
+		Index        int             `json:"index"`
+		Message      ai.ChatMessage  `json:"message"`
+		Delta        *ai.ChatMessage `json:"delta,omitempty"`
+		FinishReason string          `json:"finish_reason"`
+	}{Message: ai.ChatMessage{Role: "assistant", Content: s.content}})
+	return resp, nil
+}
+
+func TestSummarizerTitlesAndRefreshes(t *testing.T) {
+	db, session, _ := setupHistoryDB(t, 2)
+	db.Model(session).Update("title", "新对话")
+
+	stub := &stubOverview{content: "```json\n{\"title\": \"《季度预算规划》\", \"summary\": \"用户在规划季度预算。\"}\n```"}
+	summarizer := NewSummarizer(db, stub)
+	if err := summarizer.Refresh(context.Background(), session.ID); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	var stored models.ChatSession
+	db.First(&stored, "id = ?", session.ID)
+	if stored.Title != "季度预算规划" || stored.TitleSource != TitleSourceAuto {
+		t.Fatalf("expected auto title, got %q (%s)", stored.Title, stored.TitleSource)
+	}
+	if stored.Summary != "用户在规划季度预算。" || stored.SummarizedAt == nil {
+		t.Fatalf("expected summary, got %q", stored.Summary)
+	}
+
+	// 对话增长不足时不重复调用模型
+	if err := summarizer.Refresh(context.Background(), session.ID); err != nil || stub.calls != 1 {
+		t.Fatalf("expected no refresh, calls=%d err=%v", stub.calls, err)
+	}
+
+	for i := 0; i < summaryRefreshEvery; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		msg := &models.Message{ID: fmt.Sprintf("more-%d", i), Role: role, Content: "more"}
+		if err := AppendToActive(db, &stored, msg); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	stub.content = `{"title": "另一个标题", "summary": "预算已拆分到月。"}`
+	if err := summarizer.Refresh(context.Background(), session.ID); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	db.First(&stored, "id = ?", session.ID)
+	if stub.calls != 2 || stored.Summary != "预算已拆分到月。" {
+		t.Fatalf("expected refreshed summary, calls=%d summary=%q", stub.calls, stored.Summary)
+	}
+	if stored.Title != "季度预算规划" {
+		t.Fatalf("auto title should only be generated once, got %q", stored.Title)
+	}
+}
+
+func TestSummarizerFallsBackToExtractiveOverview(t *testing.T) {
+	db, session, _ := setupHistoryDB(t, 2)
+	db.Model(session).Updates(map[string]interface{}{"title": "与 助手 的对话"})
+
+	// 未配置模型时使用 MockAIClient，其回复不是 JSON，退化为抽取式标题
+	summarizer := NewSummarizer(db, nil)
+	if err := summarizer.Refresh(context.Background(), session.ID); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	var stored models.ChatSession
+	db.First(&stored, "id = ?", session.ID)
+	if !strings.HasPrefix(stored.Title, "turn 0 word") || stored.TitleSource != TitleSourceAuto {
+		t.Fatalf("expected extractive title, got %q", stored.Title)
+	}
+	if !strings.Contains(stored.Summary, "用户：turn 0") {
+		t.Fatalf("expected extractive summary, got %q", stored.Summary)
+	}
+}
+
+func TestSummarizerKeepsUserTitle(t *testing.T) {
+	db, session, _ := setupHistoryDB(t, 2)
+	db.Model(session).Updates(map[string]interface{}{"title": "新对话", "title_source": TitleSourceUser})
+
+	summarizer := NewSummarizer(db, &stubOverview{content: `{"title": "自动标题", "summary": "概要"}`})
+	if err := summarizer.Refresh(context.Background(), session.ID); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	var stored models.ChatSession
+	db.First(&stored, "id = ?", session.ID)
+	if stored.Title != "新对话" || stored.Summary != "概要" {
+		t.Fatalf("user title must be kept, got %q / %q", stored.Title, stored.Summary)
+	}
+}
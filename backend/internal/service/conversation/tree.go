@@ -0,0 +1,276 @@
+package conversation
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+// 会话消息以树形存储：每条消息记录父消息与同级分支序号，
+// 会话的 ActiveLeafID 指向当前分支末端，从末端沿父指针回溯即为活动路径。
+// 重新生成、编辑消息都会新建兄弟分支，不再覆盖原消息。
+
+// EnsureTree 为分支功能上线前的旧会话补齐父指针：按创建时间串成单链，并将最后一条设为活动末端
+func EnsureTree(db *gorm.DB, session *models.ChatSession) error {
+	if session == nil || session.ActiveLeafID != "" {
+		return nil
+	}
+
+	var messages []models.Message
+	if err := db.Where("session_id = ?", session.ID).Order("created_at ASC").Find(&messages).Error; err != nil {
+		return fmt.Errorf("failed to load messages: %w", err)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	leaf := messages[len(messages)-1].ID
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := 1; i < len(messages); i++ {
+			if messages[i].ParentID != "" {
+				continue
+			}
+			if err := tx.Model(&models.Message{}).Where("id = ?", messages[i].ID).
+				UpdateColumns(map[string]interface{}{"parent_id": messages[i-1].ID, "sibling_index": 0}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.ChatSession{}).Where("id = ?", session.ID).UpdateColumn("active_leaf_id", leaf).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to link legacy messages: %w", err)
+	}
+	session.ActiveLeafID = leaf
+	return nil
+}
+
+// ActivePath 返回从根到活动末端的消息（对话顺序），并填充每条消息的同级分支数
+func ActivePath(db *gorm.DB, session *models.ChatSession) ([]models.Message, error) {
+	if err := EnsureTree(db, session); err != nil {
+		return nil, err
+	}
+	tree, err := loadTree(db, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return tree.pathTo(tree.resolveLeaf(session.ActiveLeafID)), nil
+}
+
+// Ancestors 返回消息之前的活动路径（不含消息本身，根在前）
+// messageID 为空或不存在时返回整个活动路径。
+func Ancestors(db *gorm.DB, session *models.ChatSession, messageID string) ([]models.Message, error) {
+	if err := EnsureTree(db, session); err != nil {
+		return nil, err
+	}
+	tree, err := loadTree(db, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if msg, ok := tree.byID[messageID]; ok {
+		return tree.pathTo(msg.ParentID), nil
+	}
+	return tree.pathTo(tree.resolveLeaf(session.ActiveLeafID)), nil
+}
+
+// AppendMessage 将消息挂到 parentID 之下，分配分支序号并设为活动末端
+func AppendMessage(db *gorm.DB, session *models.ChatSession, msg *models.Message, parentID string) error {
+	if err := EnsureTree(db, session); err != nil {
+		return err
+	}
+
+	msg.SessionID = session.ID
+	msg.ParentID = parentID
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var next int
+		if err := tx.Model(&models.Message{}).
+			Select("COALESCE(MAX(sibling_index), -1) + 1").
+			Where("session_id = ? AND parent_id = ?", session.ID, parentID).
+			Scan(&next).Error; err != nil {
+			return err
+		}
+		msg.SiblingIndex = next
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ChatSession{}).Where("id = ?", session.ID).UpdateColumn("active_leaf_id", msg.ID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to append message: %w", err)
+	}
+	session.ActiveLeafID = msg.ID
+	return nil
+}
+
+// AppendToActive 将消息追加到当前活动分支末尾
+func AppendToActive(db *gorm.DB, session *models.ChatSession, msg *models.Message) error {
+	if err := EnsureTree(db, session); err != nil {
+		return err
+	}
+	tree, err := loadTree(db, session.ID)
+	if err != nil {
+		return err
+	}
+	parentID := ""
+	if len(tree.byID) > 0 {
+		parentID = tree.resolveLeaf(session.ActiveLeafID)
+	}
+	return AppendMessage(db, session, msg, parentID)
+}
+
+// Siblings 返回与消息同一父消息下的全部分支（按分支序号排序）
+func Siblings(db *gorm.DB, session *models.ChatSession, messageID string) ([]models.Message, error) {
+	if err := EnsureTree(db, session); err != nil {
+		return nil, err
+	}
+	var msg models.Message
+	if err := db.Where("id = ? AND session_id = ?", messageID, session.ID).First(&msg).Error; err != nil {
+		return nil, err
+	}
+
+	var siblings []models.Message
+	if err := db.Where("session_id = ? AND parent_id = ?", session.ID, msg.ParentID).
+		Order("sibling_index ASC, created_at ASC").Find(&siblings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load siblings: %w", err)
+	}
+	for i := range siblings {
+		siblings[i].SiblingCount = len(siblings)
+	}
+	return siblings, nil
+}
+
+// ActivateBranch 切换到包含指定消息的分支：沿最新的子消息下探到末端，并返回新的活动路径
+func ActivateBranch(db *gorm.DB, session *models.ChatSession, messageID string) ([]models.Message, error) {
+	if err := EnsureTree(db, session); err != nil {
+		return nil, err
+	}
+	tree, err := loadTree(db, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := tree.byID[messageID]; !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	leaf := tree.descend(messageID)
+	if err := db.Model(&models.ChatSession{}).Where("id = ?", session.ID).UpdateColumn("active_leaf_id", leaf).Error; err != nil {
+		return nil, fmt.Errorf("failed to switch branch: %w", err)
+	}
+	session.ActiveLeafID = leaf
+	return tree.pathTo(leaf), nil
+}
+
+// RemoveMessage 删除单条消息：其子消息改挂到父消息下，必要时回退活动末端
+func RemoveMessage(db *gorm.DB, session *models.ChatSession, msg models.Message) error {
+	if err := EnsureTree(db, session); err != nil {
+		return err
+	}
+	if err := db.Where("id = ?", msg.ID).First(&msg).Error; err != nil {
+		return err
+	}
+
+	leaf := session.ActiveLeafID
+	if leaf == msg.ID {
+		leaf = msg.ParentID
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&msg).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Message{}).
+			Where("session_id = ? AND parent_id = ?", session.ID, msg.ID).
+			UpdateColumn("parent_id", msg.ParentID).Error; err != nil {
+			return err
+		}
+
+		// 重新编排父消息下的分支序号
+		var siblings []models.Message
+		if err := tx.Select("id").Where("session_id = ? AND parent_id = ?", session.ID, msg.ParentID).
+			Order("sibling_index ASC, created_at ASC").Find(&siblings).Error; err != nil {
+			return err
+		}
+		for i, sibling := range siblings {
+			if err := tx.Model(&models.Message{}).Where("id = ?", sibling.ID).UpdateColumn("sibling_index", i).Error; err != nil {
+				return err
+			}
+		}
+		if leaf == "" {
+			// 删除的是活动分支的根消息：回退到最新的剩余消息，避免被当作旧会话重新串链
+			var latest models.Message
+			if err := tx.Select("id").Where("session_id = ?", session.ID).Order("created_at DESC").Limit(1).Find(&latest).Error; err != nil {
+				return err
+			}
+			leaf = latest.ID
+		}
+		return tx.Model(&models.ChatSession{}).Where("id = ?", session.ID).UpdateColumn("active_leaf_id", leaf).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove message: %w", err)
+	}
+	session.ActiveLeafID = leaf
+	return nil
+}
+
+// messageTree 会话消息的内存索引
+type messageTree struct {
+	byID     map[string]models.Message
+	children map[string][]models.Message // parentID -> 按创建时间升序
+	latest   string
+}
+
+func loadTree(db *gorm.DB, sessionID string) (*messageTree, error) {
+	var messages []models.Message
+	if err := db.Where("session_id = ?", sessionID).Order("created_at ASC").Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+
+	tree := &messageTree{
+		byID:     make(map[string]models.Message, len(messages)),
+		children: map[string][]models.Message{},
+	}
+	for _, msg := range messages {
+		tree.byID[msg.ID] = msg
+		tree.children[msg.ParentID] = append(tree.children[msg.ParentID], msg)
+		tree.latest = msg.ID
+	}
+	return tree, nil
+}
+
+// resolveLeaf 活动末端缺失时回退到最新的消息
+func (t *messageTree) resolveLeaf(leaf string) string {
+	if _, ok := t.byID[leaf]; ok {
+		return leaf
+	}
+	return t.latest
+}
+
+// pathTo 返回从根到指定消息的路径（含该消息）
+func (t *messageTree) pathTo(id string) []models.Message {
+	path := []models.Message{}
+	for id != "" && len(path) <= len(t.byID) {
+		msg, ok := t.byID[id]
+		if !ok {
+			break
+		}
+		msg.SiblingCount = len(t.children[msg.ParentID])
+		path = append(path, msg)
+		id = msg.ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// descend 沿最新创建的子消息下探到末端
+func (t *messageTree) descend(id string) string {
+	for depth := 0; depth <= len(t.byID); depth++ {
+		children := t.children[id]
+		if len(children) == 0 {
+			break
+		}
+		id = children[len(children)-1].ID
+	}
+	return id
+}
@@ -0,0 +1,106 @@
+package conversation
+
+import (
+	"context"
+	"testing"
+
+	"rolecraft-ai/internal/models"
+)
+
+func TestEnsureTreeLinksLegacyMessages(t *testing.T) {
+	db, session, current := setupHistoryDB(t, 4)
+
+	path, err := ActivePath(db, session)
+	if err != nil {
+		t.Fatalf("active path: %v", err)
+	}
+	if len(path) != 5 || path[len(path)-1].ID != current.ID {
+		t.Fatalf("expected legacy messages as a single chain ending at current, got %d", len(path))
+	}
+	if path[0].ParentID != "" || path[1].ParentID != path[0].ID {
+		t.Fatalf("parent pointers not linked: %+v", path[:2])
+	}
+
+	var stored models.ChatSession
+	db.First(&stored, "id = ?", session.ID)
+	if stored.ActiveLeafID != current.ID {
+		t.Fatalf("active leaf not persisted: %q", stored.ActiveLeafID)
+	}
+}
+
+func TestBranchesFollowActivePath(t *testing.T) {
+	db, session, current := setupHistoryDB(t, 2)
+
+	first := &models.Message{ID: "answer-a", Role: "assistant", Content: "answer a"}
+	if err := AppendToActive(db, session, first); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	second := &models.Message{ID: "answer-b", Role: "assistant", Content: "answer b"}
+	if err := AppendMessage(db, session, second, current.ID); err != nil {
+		t.Fatalf("append sibling: %v", err)
+	}
+	if second.SiblingIndex != 1 || session.ActiveLeafID != second.ID {
+		t.Fatalf("sibling not activated: index=%d leaf=%s", second.SiblingIndex, session.ActiveLeafID)
+	}
+
+	siblings, err := Siblings(db, session, first.ID)
+	if err != nil || len(siblings) != 2 {
+		t.Fatalf("expected 2 siblings, got %d (%v)", len(siblings), err)
+	}
+
+	path, err := ActivateBranch(db, session, first.ID)
+	if err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	if last := path[len(path)-1]; last.ID != first.ID || last.SiblingCount != 2 {
+		t.Fatalf("expected path to end at first answer, got %+v", last)
+	}
+
+	// 历史只包含活动路径：在第一条回复后继续提问
+	next := &models.Message{ID: "follow-up", Role: "user", Content: "follow up"}
+	if err := AppendToActive(db, session, next); err != nil {
+		t.Fatalf("append follow-up: %v", err)
+	}
+	messages, err := NewHistoryBuilder(db, nil).Build(context.Background(), HistoryRequest{
+		Session: session,
+		Current: *next,
+		Prompt:  "follow up",
+		Model:   "gpt-4o",
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	for _, msg := range messages {
+		if msg.Content == "answer b" {
+			t.Fatalf("inactive branch leaked into history")
+		}
+	}
+	if messages[len(messages)-2].Content != "answer a" {
+		t.Fatalf("expected active answer before prompt, got %+v", messages[len(messages)-2])
+	}
+}
+
+func TestRemoveMessageReparentsChildren(t *testing.T) {
+	db, session, current := setupHistoryDB(t, 3)
+	if _, err := ActivePath(db, session); err != nil {
+		t.Fatalf("active path: %v", err)
+	}
+
+	if err := RemoveMessage(db, session, models.Message{ID: "m02"}); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	path, err := ActivePath(db, session)
+	if err != nil {
+		t.Fatalf("active path: %v", err)
+	}
+	if len(path) != 3 || path[2].ID != current.ID || path[2].ParentID != "m01" {
+		t.Fatalf("expected current reattached to m01, got %+v", path)
+	}
+
+	if err := RemoveMessage(db, session, current); err != nil {
+		t.Fatalf("remove leaf: %v", err)
+	}
+	if session.ActiveLeafID != "m01" {
+		t.Fatalf("expected leaf to fall back to parent, got %q", session.ActiveLeafID)
+	}
+}
@@ -0,0 +1,128 @@
+package document
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// ArchiveFile 压缩包中的文件
+type ArchiveFile struct {
+	Path string // 以 "/" 分隔的相对路径
+	Size int64  // 解压后的大小
+	file *zip.File
+}
+
+// Name 文件名（不含目录）
+func (f ArchiveFile) Name() string {
+	return path.Base(f.Path)
+}
+
+// Dir 所在目录，位于压缩包根目录时为空
+func (f ArchiveFile) Dir() string {
+	if dir := path.Dir(f.Path); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// Open 打开文件内容，读取量不超过声明的大小
+func (f ArchiveFile) Open() (io.ReadCloser, error) {
+	rc, err := f.file.Open()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, f.Size), rc}, nil
+}
+
+// SkippedEntry 未导入的条目及原因
+type SkippedEntry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ArchiveLimits 解压限制，防止压缩炸弹
+type ArchiveLimits struct {
+	MaxEntries   int   // 最多导入的文件数
+	MaxFileSize  int64 // 单个文件解压后的大小上限
+	MaxTotalSize int64 // 全部文件解压后的大小上限
+}
+
+// ReadZip 列出压缩包中可导入的文件。目录与系统生成的元数据（__MACOSX、.DS_Store）被忽略；
+// 加密、路径非法或超出限制的条目记入 skipped。未标记 UTF-8 且不是合法 UTF-8 的文件名按 GB18030 解码
+func ReadZip(r io.ReaderAt, size int64, limits ArchiveLimits) ([]ArchiveFile, []SkippedEntry, error) {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open zip archive: %w", err)
+	}
+	var files []ArchiveFile
+	var skipped []SkippedEntry
+	var total int64
+	for _, f := range reader.File {
+		name := archiveName(f)
+		if f.FileInfo().IsDir() || ignoredArchiveEntry(name) {
+			continue
+		}
+		clean, ok := cleanArchivePath(name)
+		switch {
+		case !ok:
+			skipped = append(skipped, SkippedEntry{Path: name, Reason: "invalid path"})
+		case f.Flags&0x1 != 0:
+			skipped = append(skipped, SkippedEntry{Path: clean, Reason: "encrypted entry"})
+		case limits.MaxFileSize > 0 && int64(f.UncompressedSize64) > limits.MaxFileSize:
+			skipped = append(skipped, SkippedEntry{Path: clean, Reason: "file too large"})
+		case limits.MaxEntries > 0 && len(files) >= limits.MaxEntries:
+			skipped = append(skipped, SkippedEntry{Path: clean, Reason: "too many files in archive"})
+		case limits.MaxTotalSize > 0 && total+int64(f.UncompressedSize64) > limits.MaxTotalSize:
+			skipped = append(skipped, SkippedEntry{Path: clean, Reason: "archive size limit exceeded"})
+		default:
+			total += int64(f.UncompressedSize64)
+			files = append(files, ArchiveFile{Path: clean, Size: int64(f.UncompressedSize64), file: f})
+		}
+	}
+	return files, skipped, nil
+}
+
+// archiveName 条目名称；Windows 下创建的中文压缩包通常使用 GBK 编码文件名
+func archiveName(f *zip.File) string {
+	if !f.NonUTF8 || utf8.ValidString(f.Name) {
+		return f.Name
+	}
+	if enc, _ := charset.Lookup("gb18030"); enc != nil {
+		if decoded, err := enc.NewDecoder().String(f.Name); err == nil {
+			return decoded
+		}
+	}
+	return strings.ToValidUTF8(f.Name, "_")
+}
+
+func ignoredArchiveEntry(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(name, "__MACOSX/") || base == ".DS_Store" || base == "Thumbs.db" || strings.HasPrefix(base, "._")
+}
+
+// cleanArchivePath 规范化条目路径，拒绝越出压缩包根目录的路径
+func cleanArchivePath(name string) (string, bool) {
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(name, "\\", "/"), "/") {
+		switch strings.TrimSpace(segment) {
+		case "", ".":
+			continue
+		case "..":
+			return "", false
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return "", false
+	}
+	return strings.Join(segments, "/"), true
+}
@@ -0,0 +1,74 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(header *zip.FileHeader, content string) {
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	add(&zip.FileHeader{Name: "docs/"}, "")
+	add(&zip.FileHeader{Name: "docs/a.md"}, "alpha")
+	add(&zip.FileHeader{Name: "docs/./sub/b.txt"}, "beta")
+	add(&zip.FileHeader{Name: "__MACOSX/docs/._a.md"}, "meta")
+	add(&zip.FileHeader{Name: "docs/.DS_Store"}, "meta")
+	add(&zip.FileHeader{Name: "../evil.md"}, "evil")
+	add(&zip.FileHeader{Name: "big.txt"}, "0123456789")
+	add(&zip.FileHeader{Name: "\xd6\xd0\xce\xc4.md", NonUTF8: true}, "gbk name")
+	add(&zip.FileHeader{Name: "over.md"}, "over")
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, skipped, err := ReadZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ArchiveLimits{MaxEntries: 3, MaxFileSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	if len(files) != 3 || paths[0] != "docs/a.md" || paths[1] != "docs/sub/b.txt" || paths[2] != "中文.md" {
+		t.Fatalf("unexpected files %v", paths)
+	}
+	if files[1].Dir() != "docs/sub" || files[1].Name() != "b.txt" || files[2].Dir() != "" {
+		t.Fatalf("unexpected dir/name %q %q %q", files[1].Dir(), files[1].Name(), files[2].Dir())
+	}
+	rc, err := files[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "alpha" {
+		t.Fatalf("unexpected content %q", data)
+	}
+
+	want := map[string]string{
+		"../evil.md": "invalid path",
+		"big.txt":    "file too large",
+		"over.md":    "too many files in archive",
+	}
+	if len(skipped) != len(want) {
+		t.Fatalf("unexpected skipped entries %+v", skipped)
+	}
+	for _, s := range skipped {
+		if want[s.Path] != s.Reason {
+			t.Fatalf("unexpected skipped entry %+v", s)
+		}
+	}
+
+	if _, _, err := ReadZip(bytes.NewReader([]byte("not a zip")), 9, ArchiveLimits{}); err == nil {
+		t.Fatal("expected error for invalid archive")
+	}
+}
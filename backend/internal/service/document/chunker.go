@@ -0,0 +1,628 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// textBlock 提取文本中的一个块：标题行，或以空行分隔的段落 / 表格 / 代码块（字节区间）
+type textBlock struct {
+	start, end int
+	level      int // 标题级别，非标题为 0
+	title      string
+}
+
+// splitBlocks 按空行切分文本，标题行单独成块；代码围栏内的空行与 # 不参与切分
+func splitBlocks(text string) []textBlock {
+	var blocks []textBlock
+	blockStart := -1
+	inFence := false
+	closeBlock := func(end int) {
+		if blockStart >= 0 {
+			blocks = append(blocks, textBlock{start: blockStart, end: end})
+			blockStart = -1
+		}
+	}
+
+	for pos := 0; pos < len(text); {
+		lineEnd := strings.IndexByte(text[pos:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += pos
+		}
+		line := strings.TrimRight(text[pos:lineEnd], "\r")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			if blockStart < 0 {
+				blockStart = pos
+			}
+			inFence = !inFence
+		case inFence:
+		case trimmed == "":
+			closeBlock(pos)
+		default:
+			if level, title := markdownHeading(trimmed); level > 0 {
+				closeBlock(pos)
+				blocks = append(blocks, textBlock{start: pos, end: pos + len(line), level: level, title: title})
+			} else if blockStart < 0 {
+				blockStart = pos
+			}
+		}
+		pos = lineEnd + 1
+	}
+	closeBlock(len(text))
+
+	// 去除块尾的空白
+	for i := range blocks {
+		blocks[i].end = blocks[i].start + len(strings.TrimRightFunc(text[blocks[i].start:blocks[i].end], unicode.IsSpace))
+	}
+	return blocks
+}
+
+// markdownHeading 解析 ATX 标题行，返回级别与标题文本
+func markdownHeading(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level >= len(line) || line[level] != ' ' {
+		return 0, ""
+	}
+	return level, strings.TrimSpace(strings.TrimRight(line[level:], "#"))
+}
+
+// pushHeading 遇到 level 级标题时更新标题栈：丢弃同级及更低级的标题，缺失的上级以空字符串占位
+func pushHeading(headings []string, level int, title string) []string {
+	if len(headings) >= level {
+		headings = headings[:level-1]
+	}
+	for len(headings) < level-1 {
+		headings = append(headings, "")
+	}
+	return append(headings, title)
+}
+
+// runeCounter 把递增的字节偏移换算为字符偏移
+type runeCounter struct {
+	text             string
+	byteOff, runeOff int
+}
+
+func (c *runeCounter) at(b int) int {
+	if b < c.byteOff {
+		c.byteOff, c.runeOff = 0, 0
+	}
+	c.runeOff += utf8.RuneCountInString(c.text[c.byteOff:b])
+	c.byteOff = b
+	return c.runeOff
+}
+
+// ChunkExtraction 按段落切分解析结果并记录位置：块不跨越页 / 幻灯片 / 工作表，
+// 遇到标题另起新块，超长段落按句子边界带重叠切分。Start/End 为字符偏移。
+func (p *Processor) ChunkExtraction(extraction *Extraction) []Chunk {
+	text := extraction.Text
+	counter := &runeCounter{text: text}
+
+	var (
+		chunks   []Chunk
+		base     []string // 分段标题（幻灯片标题 / 工作表名）
+		headings []string
+		section  *Section
+		start    = -1
+		end      int
+		size     int
+		hasBody  bool
+	)
+	path := func() []string {
+		out := append([]string{}, base...)
+		for _, h := range headings {
+			if h != "" {
+				out = append(out, h)
+			}
+		}
+		return out
+	}
+	emit := func(content string, from, to int) {
+		chunk := Chunk{
+			ID:          fmt.Sprintf("chunk-%d", len(chunks)),
+			Content:     content,
+			Metadata:    map[string]interface{}{"index": len(chunks)},
+			Start:       from,
+			End:         to,
+			HeadingPath: path(),
+		}
+		if section != nil {
+			switch section.Kind {
+			case SectionSheet:
+				chunk.Sheet = section.Title
+			default:
+				chunk.Page = section.Index
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+	flush := func() {
+		// 只有标题没有正文的块不单独成块
+		if start >= 0 && hasBody {
+			emit(text[start:end], counter.at(start), counter.at(end))
+		}
+		start, size, hasBody = -1, 0, false
+	}
+
+	for _, block := range splitBlocks(text) {
+		if s := extraction.SectionAt(block.start); s != section {
+			flush()
+			section, base, headings = s, nil, nil
+			if s != nil && s.Title != "" {
+				base = []string{s.Title}
+			}
+		}
+		// 分段标题行本身只作为元数据
+		if section != nil && block.start == section.Start {
+			continue
+		}
+
+		if block.level > 0 {
+			if hasBody {
+				flush()
+			}
+			headings = pushHeading(headings, block.level, block.title)
+		}
+
+		blockSize := utf8.RuneCountInString(text[block.start:block.end])
+		if start >= 0 && size+blockSize > p.maxChunkSize {
+			flush()
+		}
+		if block.level == 0 && blockSize > p.maxChunkSize {
+			flush()
+			p.splitLongBlock(text[block.start:block.end], counter.at(block.start), emit)
+			continue
+		}
+		if start < 0 {
+			start = block.start
+		}
+		end = block.end
+		size += blockSize
+		hasBody = hasBody || block.level == 0
+	}
+	flush()
+	return chunks
+}
+
+// splitLongBlock 将超长段落按窗口切分，窗口尽量止于句末，相邻窗口保留重叠
+func (p *Processor) splitLongBlock(block string, offset int, emit func(content string, from, to int)) {
+	runes := []rune(block)
+	for start := 0; start < len(runes); {
+		end := min(start+p.maxChunkSize, len(runes))
+		if end < len(runes) {
+			for i := end; i > start+p.minChunkSize; i-- {
+				if isSentenceEnd(runes[i-1]) {
+					end = i
+					break
+				}
+			}
+		}
+		from, to := start, end
+		for from < to && unicode.IsSpace(runes[from]) {
+			from++
+		}
+		for to > from && unicode.IsSpace(runes[to-1]) {
+			to--
+		}
+		if from < to {
+			emit(string(runes[from:to]), offset+from, offset+to)
+		}
+		if end >= len(runes) {
+			break
+		}
+		next := end - p.chunkOverlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+}
+
+func isSentenceEnd(r rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '.', '!', '?', ';', '\n':
+		return true
+	}
+	return false
+}
+
+// outlineBlock 带标题路径的文本块
+type outlineBlock struct {
+	textBlock
+	path []string // 所属标题路径（分段标题在前），标题块包含自身
+}
+
+// blockGroup 同一页 / 幻灯片 / 工作表中的块，分块不跨越分组
+type blockGroup struct {
+	section *Section
+	blocks  []outlineBlock
+}
+
+// outlineGroups 按分段对块分组并计算各块的标题路径；分段标题行本身只作为元数据
+func outlineGroups(extraction *Extraction) []blockGroup {
+	var (
+		groups   []blockGroup
+		base     []string
+		headings []string
+	)
+	for _, block := range splitBlocks(extraction.Text) {
+		section := extraction.SectionAt(block.start)
+		if len(groups) == 0 || groups[len(groups)-1].section != section {
+			groups = append(groups, blockGroup{section: section})
+			base, headings = nil, nil
+			if section != nil && section.Title != "" {
+				base = []string{section.Title}
+			}
+		}
+		if section != nil && block.start == section.Start {
+			continue
+		}
+		if block.level > 0 {
+			headings = pushHeading(headings, block.level, block.title)
+		}
+		path := append([]string{}, base...)
+		for _, h := range headings {
+			if h != "" {
+				path = append(path, h)
+			}
+		}
+		group := &groups[len(groups)-1]
+		group.blocks = append(group.blocks, outlineBlock{textBlock: block, path: path})
+	}
+	return groups
+}
+
+// chunkBuilder 收集分块并换算字符偏移
+type chunkBuilder struct {
+	text    string
+	counter *runeCounter
+	chunks  []Chunk
+}
+
+func newChunkBuilder(text string) *chunkBuilder {
+	return &chunkBuilder{text: text, counter: &runeCounter{text: text}}
+}
+
+// add 以 text[start:end]（字节区间）去除首尾空白后的内容生成分块
+func (b *chunkBuilder) add(group *blockGroup, path []string, start, end int) {
+	content := b.text[start:end]
+	trimmed := strings.TrimLeftFunc(content, unicode.IsSpace)
+	start += len(content) - len(trimmed)
+	trimmed = strings.TrimRightFunc(trimmed, unicode.IsSpace)
+	if trimmed == "" {
+		return
+	}
+	end = start + len(trimmed)
+	b.emit(group, path, trimmed, b.counter.at(start), b.counter.at(end))
+}
+
+// emit 追加分块，from / to 为字符偏移
+func (b *chunkBuilder) emit(group *blockGroup, path []string, content string, from, to int) {
+	chunk := Chunk{
+		ID:          fmt.Sprintf("chunk-%d", len(b.chunks)),
+		Content:     content,
+		Metadata:    map[string]interface{}{"index": len(b.chunks)},
+		Start:       from,
+		End:         to,
+		HeadingPath: path,
+	}
+	if group.section != nil {
+		switch group.section.Kind {
+		case SectionSheet:
+			chunk.Sheet = group.section.Title
+		default:
+			chunk.Page = group.section.Index
+		}
+	}
+	b.chunks = append(b.chunks, chunk)
+}
+
+// byteSpan 文本中的字节区间
+type byteSpan struct {
+	start, end int
+	size       float64 // 字符数或估算的 Token 数
+	path       []string
+}
+
+// tokenSpans 把区间切分为估算 Token 的最小单元：连续的 ASCII 字母数字为一个单词，
+// 其他非空白字符各自成为一个单元；与 CountTokens 一致，ASCII 约 4 字符、其他字符约 2 字符计 1 Token
+func tokenSpans(text string, start, end int, path []string) []byteSpan {
+	var spans []byteSpan
+	for pos := start; pos < end; {
+		r, size := utf8.DecodeRuneInString(text[pos:end])
+		switch {
+		case unicode.IsSpace(r):
+			pos += size
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			wordEnd := pos
+			for wordEnd < end && text[wordEnd] < utf8.RuneSelf && (unicode.IsLetter(rune(text[wordEnd])) || unicode.IsDigit(rune(text[wordEnd]))) {
+				wordEnd++
+			}
+			spans = append(spans, byteSpan{start: pos, end: wordEnd, size: float64(wordEnd-pos) / 4, path: path})
+			pos = wordEnd
+		case r < utf8.RuneSelf:
+			spans = append(spans, byteSpan{start: pos, end: pos + size, size: 0.25, path: path})
+			pos += size
+		default:
+			spans = append(spans, byteSpan{start: pos, end: pos + size, size: 0.5, path: path})
+			pos += size
+		}
+	}
+	return spans
+}
+
+// chunkByTokens 按固定 Token 窗口切分：窗口在同一分段内滑动，可跨越段落与标题，
+// 不拆开单词；标题路径取窗口起点所在的位置
+func (p *Processor) chunkByTokens(extraction *Extraction) []Chunk {
+	b := newChunkBuilder(extraction.Text)
+	limit, overlap := float64(p.chunkTokens), float64(p.tokenOverlap)
+	groups := outlineGroups(extraction)
+	for gi := range groups {
+		group := &groups[gi]
+		var units []byteSpan
+		for _, block := range group.blocks {
+			units = append(units, tokenSpans(b.text, block.start, block.end, block.path)...)
+		}
+		for i := 0; i < len(units); {
+			j, size := i, 0.0
+			for j < len(units) && (j == i || size+units[j].size <= limit) {
+				size += units[j].size
+				j++
+			}
+			b.add(group, units[i].path, units[i].start, units[j-1].end)
+			if j >= len(units) {
+				break
+			}
+			// 下一个窗口从末尾回退不超过 overlap 个 Token 处开始
+			next, back := j, 0.0
+			for next > i+1 && back+units[next-1].size <= overlap {
+				back += units[next-1].size
+				next--
+			}
+			i = next
+		}
+	}
+	return b.chunks
+}
+
+// sentenceClosers 句末标点之后仍属于本句的字符（连续标点、右引号与右括号）
+const sentenceClosers = "。！？!?…”’」』）)》】\"'"
+
+// splitSentences 把区间切分为句子：中文句末标点与换行总是断句，
+// 英文句点只在后接空白或位于结尾时断句，以免拆开小数与域名
+func splitSentences(text string, start, end int, path []string) []byteSpan {
+	var sentences []byteSpan
+	appendSentence := func(from, to int) {
+		content := text[from:to]
+		trimmed := strings.TrimLeftFunc(content, unicode.IsSpace)
+		from += len(content) - len(trimmed)
+		trimmed = strings.TrimRightFunc(trimmed, unicode.IsSpace)
+		if trimmed != "" {
+			sentences = append(sentences, byteSpan{
+				start: from,
+				end:   from + len(trimmed),
+				size:  float64(utf8.RuneCountInString(trimmed)),
+				path:  path,
+			})
+		}
+	}
+
+	from := start
+	for pos := start; pos < end; {
+		r, size := utf8.DecodeRuneInString(text[pos:end])
+		next := pos + size
+		boundary := false
+		switch r {
+		case '。', '！', '？', '；', '…', '!', '?', '\n':
+			boundary = true
+		case '.':
+			following, _ := utf8.DecodeRuneInString(text[next:end])
+			boundary = next >= end || unicode.IsSpace(following)
+		}
+		if boundary {
+			for next < end {
+				closer, n := utf8.DecodeRuneInString(text[next:end])
+				if !strings.ContainsRune(sentenceClosers, closer) {
+					break
+				}
+				next += n
+			}
+			appendSentence(from, next)
+			from = next
+		}
+		pos = next
+	}
+	if from < end {
+		appendSentence(from, end)
+	}
+	return sentences
+}
+
+// chunkBySentences 按句子聚合：块不超过 maxChunkSize 个字符，遇到标题另起新块；
+// 因长度换块时，新块以上一块末尾不超过 chunkOverlap 个字符的整句开头；超长的单句按窗口切分
+func (p *Processor) chunkBySentences(extraction *Extraction) []Chunk {
+	b := newChunkBuilder(extraction.Text)
+	groups := outlineGroups(extraction)
+	for gi := range groups {
+		group := &groups[gi]
+		var (
+			current []byteSpan
+			size    float64
+			hasBody bool
+		)
+		flush := func(carry bool) {
+			if len(current) > 0 && hasBody {
+				b.add(group, current[len(current)-1].path, current[0].start, current[len(current)-1].end)
+			}
+			var kept []byteSpan
+			size = 0
+			if carry {
+				for i := len(current) - 1; i > 0; i-- {
+					if size+current[i].size > float64(p.chunkOverlap) {
+						break
+					}
+					size += current[i].size
+					kept = append([]byteSpan{current[i]}, kept...)
+				}
+			}
+			current, hasBody = kept, len(kept) > 0
+		}
+
+		for _, block := range group.blocks {
+			if block.level > 0 {
+				flush(false)
+				current = []byteSpan{{start: block.start, end: block.end, path: block.path}}
+				size = float64(utf8.RuneCountInString(b.text[block.start:block.end]))
+				continue
+			}
+			for _, sentence := range splitSentences(b.text, block.start, block.end, block.path) {
+				if sentence.size > float64(p.maxChunkSize) {
+					flush(false)
+					p.splitLongBlock(b.text[sentence.start:sentence.end], b.counter.at(sentence.start), func(content string, from, to int) {
+						b.emit(group, sentence.path, content, from, to)
+					})
+					continue
+				}
+				if hasBody && size+sentence.size > float64(p.maxChunkSize) {
+					flush(true)
+				}
+				current = append(current, sentence)
+				size += sentence.size
+				hasBody = true
+			}
+		}
+		flush(false)
+	}
+	return b.chunks
+}
+
+// tableRows 解析 Markdown 表格块的各行；块中存在非表格行时返回 nil
+func tableRows(text string, block textBlock) []byteSpan {
+	var rows []byteSpan
+	for pos := block.start; pos < block.end; {
+		lineEnd := strings.IndexByte(text[pos:block.end], '\n')
+		if lineEnd < 0 {
+			lineEnd = block.end
+		} else {
+			lineEnd += pos
+		}
+		line := strings.TrimSpace(text[pos:lineEnd])
+		if !strings.HasPrefix(line, "|") {
+			return nil
+		}
+		rows = append(rows, byteSpan{start: pos, end: lineEnd, size: float64(utf8.RuneCountInString(line))})
+		pos = lineEnd + 1
+	}
+	return rows
+}
+
+// isTableSeparator 判断是否为表头分隔行，如 | --- | :-: |
+func isTableSeparator(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "|") && strings.Trim(line, "|-: ") == "" && strings.Contains(line, "-")
+}
+
+// chunkByTables 表格按行切分：每块以表头开头且只包含完整的行，单行超长时单独成块；
+// 非表格内容按段落聚合，遇到标题另起新块
+func (p *Processor) chunkByTables(extraction *Extraction) []Chunk {
+	b := newChunkBuilder(extraction.Text)
+	groups := outlineGroups(extraction)
+	for gi := range groups {
+		group := &groups[gi]
+		var (
+			start, end = -1, 0
+			size       int
+			hasBody    bool
+			path       []string
+		)
+		flush := func() {
+			if start >= 0 && hasBody {
+				b.add(group, path, start, end)
+			}
+			start, size, hasBody = -1, 0, false
+		}
+
+		for _, block := range group.blocks {
+			rows := tableRows(b.text, block.textBlock)
+			if block.level == 0 && len(rows) > 0 {
+				// 表格前只有标题时，标题已记录在标题路径中
+				flush()
+				p.splitTable(b, group, block, rows)
+				continue
+			}
+
+			blockSize := utf8.RuneCountInString(b.text[block.start:block.end])
+			if block.level > 0 && hasBody {
+				flush()
+			}
+			if start >= 0 && size+blockSize > p.maxChunkSize {
+				flush()
+			}
+			if block.level == 0 && blockSize > p.maxChunkSize {
+				flush()
+				p.splitLongBlock(b.text[block.start:block.end], b.counter.at(block.start), func(content string, from, to int) {
+					b.emit(group, block.path, content, from, to)
+				})
+				continue
+			}
+			if start < 0 {
+				start = block.start
+			}
+			end = block.end
+			size += blockSize
+			hasBody = hasBody || block.level == 0
+			path = block.path
+		}
+		flush()
+	}
+	return b.chunks
+}
+
+// splitTable 把表格按行分组生成分块，每块重复表头；第一块的起始偏移包含表头，其余块从首个数据行开始
+func (p *Processor) splitTable(b *chunkBuilder, group *blockGroup, block outlineBlock, rows []byteSpan) {
+	var header []byteSpan
+	if len(rows) >= 2 && isTableSeparator(b.text[rows[1].start:rows[1].end]) {
+		header, rows = rows[:2], rows[2:]
+	}
+	if len(rows) == 0 {
+		b.add(group, block.path, block.start, block.end)
+		return
+	}
+
+	headerText, headerSize := "", 0.0
+	if len(header) > 0 {
+		headerText = strings.TrimSpace(b.text[header[0].start:header[1].end]) + "\n"
+		headerSize = header[0].size + header[1].size
+	}
+	for i := 0; i < len(rows); {
+		j, size := i, headerSize
+		for j < len(rows) && (j == i || size+rows[j].size <= float64(p.maxChunkSize)) {
+			size += rows[j].size
+			j++
+		}
+		var content strings.Builder
+		content.WriteString(headerText)
+		for k := i; k < j; k++ {
+			if k > i {
+				content.WriteString("\n")
+			}
+			content.WriteString(strings.TrimSpace(b.text[rows[k].start:rows[k].end]))
+		}
+		from := rows[i].start
+		if i == 0 && len(header) > 0 {
+			from = header[0].start
+		}
+		b.emit(group, block.path, content.String(), b.counter.at(from), b.counter.at(rows[j-1].end))
+		i = j
+	}
+}
@@ -0,0 +1,202 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkExtractionTracksHeadingsAndOffsets(t *testing.T) {
+	text := "# 员工手册\n\n总则说明。\n\n## 假期\n\n### 年假\n\n年假按工龄计算。\n\n## 报销\n\n```\n# 不是标题\n\n代码块\n```"
+	p := NewProcessor(ProcessorConfig{MaxChunkSize: 200})
+	chunks := p.ChunkExtraction(&Extraction{Text: text})
+
+	want := []struct {
+		path    string
+		content string
+	}{
+		{"员工手册", "# 员工手册\n\n总则说明。"},
+		{"员工手册 > 假期 > 年假", "## 假期\n\n### 年假\n\n年假按工龄计算。"},
+		{"员工手册 > 报销", "## 报销\n\n```\n# 不是标题\n\n代码块\n```"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("expected %d chunks, got %d: %+v", len(want), len(chunks), chunks)
+	}
+	runes := []rune(text)
+	for i, w := range want {
+		chunk := chunks[i]
+		if got := strings.Join(chunk.HeadingPath, HeadingPathSeparator); got != w.path {
+			t.Errorf("chunk %d heading path = %q, want %q", i, got, w.path)
+		}
+		if chunk.Content != w.content {
+			t.Errorf("chunk %d content = %q, want %q", i, chunk.Content, w.content)
+		}
+		if string(runes[chunk.Start:chunk.End]) != chunk.Content {
+			t.Errorf("chunk %d offsets [%d,%d) do not match content", i, chunk.Start, chunk.End)
+		}
+	}
+}
+
+func TestChunkExtractionRespectsSections(t *testing.T) {
+	var out textBuilder
+	out.section(SectionPage, 1, "", "第 1 页", "第一页正文。")
+	out.section(SectionPage, 2, "", "第 2 页", strings.Repeat("很长的句子。", 40))
+	out.section(SectionSheet, 1, "销售", "工作表：销售", "| 区域 | 金额 |\n| --- | --- |\n| 华东 | 10 |")
+	extraction := out.result()
+
+	p := NewProcessor(ProcessorConfig{MaxChunkSize: 100, ChunkOverlap: 12, MinChunkSize: 20})
+	chunks := p.ChunkExtraction(extraction)
+	if len(chunks) < 4 {
+		t.Fatalf("expected long page to be split, got %d chunks", len(chunks))
+	}
+
+	runes := []rune(extraction.Text)
+	pages := map[int]int{}
+	for i, chunk := range chunks {
+		if utf8.RuneCountInString(chunk.Content) > 100 {
+			t.Errorf("chunk %d exceeds max size", i)
+		}
+		if string(runes[chunk.Start:chunk.End]) != chunk.Content {
+			t.Errorf("chunk %d offsets do not match content", i)
+		}
+		if strings.Contains(chunk.Content, "## ") {
+			t.Errorf("section heading leaked into chunk %d: %q", i, chunk.Content)
+		}
+		pages[chunk.Page]++
+	}
+	if chunks[0].Page != 1 || chunks[0].Content != "第一页正文。" || pages[2] < 2 {
+		t.Fatalf("unexpected page assignment: %+v", chunks)
+	}
+	// 相邻窗口带重叠
+	if chunks[1].End <= chunks[2].Start {
+		t.Errorf("expected overlapping windows, got [%d,%d) and [%d,%d)", chunks[1].Start, chunks[1].End, chunks[2].Start, chunks[2].End)
+	}
+	last := chunks[len(chunks)-1]
+	if last.Sheet != "销售" || last.Page != 0 || strings.Join(last.HeadingPath, "") != "销售" {
+		t.Fatalf("expected sheet chunk, got %+v", last)
+	}
+}
+
+func TestChunkByTokens(t *testing.T) {
+	text := "# Guide\n\nThe quick brown fox jumps over the lazy dog again and again.\n\n## 安装\n\n先安装依赖，再启动服务。"
+	p := NewProcessor(ProcessorConfig{ChunkTokens: 4, TokenOverlap: 2})
+	chunks := p.Chunk(&Extraction{Text: text}, ChunkToken)
+	if len(chunks) < 4 {
+		t.Fatalf("expected several windows, got %+v", chunks)
+	}
+	runes := []rune(text)
+	for i, chunk := range chunks {
+		if chunk.Strategy != ChunkToken {
+			t.Errorf("chunk %d strategy = %q", i, chunk.Strategy)
+		}
+		if string(runes[chunk.Start:chunk.End]) != chunk.Content {
+			t.Errorf("chunk %d offsets do not match content", i)
+		}
+		// 窗口不拆开单词
+		if strings.Contains(chunk.Content, "jum") && !strings.Contains(chunk.Content, "jumps") {
+			t.Errorf("chunk %d split a word: %q", i, chunk.Content)
+		}
+		if i > 0 && chunks[i-1].End <= chunk.Start {
+			t.Errorf("expected overlap between chunk %d and %d", i-1, i)
+		}
+	}
+	last := chunks[len(chunks)-1]
+	if got := strings.Join(last.HeadingPath, HeadingPathSeparator); got != "Guide > 安装" || !strings.HasSuffix(last.Content, "服务。") {
+		t.Fatalf("unexpected last chunk %+v", last)
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	text := "版本 3.5 已发布。支持 example.com 域名！你确定吗？“是的。”Next step. Done"
+	var got []string
+	for _, s := range splitSentences(text, 0, len(text), nil) {
+		got = append(got, text[s.start:s.end])
+	}
+	want := []string{"版本 3.5 已发布。", "支持 example.com 域名！", "你确定吗？", "“是的。”", "Next step.", "Done"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("sentences = %q, want %q", got, want)
+	}
+}
+
+func TestChunkBySentences(t *testing.T) {
+	text := "# 制度\n\n第一条规定内容。第二条规定内容。第三条规定内容。\n\n## 附则\n\n本制度自发布之日起施行。"
+	p := NewProcessor(ProcessorConfig{MaxChunkSize: 20, ChunkOverlap: 8})
+	chunks := p.Chunk(&Extraction{Text: text}, ChunkSentence)
+
+	want := []struct {
+		path    string
+		content string
+	}{
+		{"制度", "# 制度\n\n第一条规定内容。第二条规定内容。"},
+		{"制度", "第二条规定内容。第三条规定内容。"},
+		{"制度 > 附则", "## 附则\n\n本制度自发布之日起施行。"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("expected %d chunks, got %+v", len(want), chunks)
+	}
+	runes := []rune(text)
+	for i, w := range want {
+		if got := strings.Join(chunks[i].HeadingPath, HeadingPathSeparator); got != w.path || chunks[i].Content != w.content {
+			t.Errorf("chunk %d = %q %q, want %q %q", i, got, chunks[i].Content, w.path, w.content)
+		}
+		if string(runes[chunks[i].Start:chunks[i].End]) != chunks[i].Content {
+			t.Errorf("chunk %d offsets do not match content", i)
+		}
+	}
+}
+
+func TestChunkByTables(t *testing.T) {
+	rows := [][]string{{"区域", "金额"}}
+	for i := 0; i < 6; i++ {
+		rows = append(rows, []string{fmt.Sprintf("区域%d", i), strings.Repeat("9", i+1)})
+	}
+	var out textBuilder
+	out.section(SectionSheet, 1, "销售", "工作表：销售", "说明文字。\n\n"+markdownTable(rows))
+	extraction := out.result()
+
+	p := NewProcessor(ProcessorConfig{MaxChunkSize: 50})
+	chunks := p.Chunk(extraction, ChunkerFor(ChunkAuto, "xlsx"))
+	if len(chunks) < 3 || chunks[0].Content != "说明文字。" {
+		t.Fatalf("unexpected chunks %+v", chunks)
+	}
+	seen := 0
+	for i, chunk := range chunks[1:] {
+		if chunk.Strategy != ChunkTable || chunk.Sheet != "销售" {
+			t.Errorf("chunk %d has unexpected metadata %+v", i, chunk)
+		}
+		lines := strings.Split(chunk.Content, "\n")
+		if lines[0] != "| 区域 | 金额 |" || lines[1] != "| --- | --- |" {
+			t.Errorf("chunk %d does not start with the header: %q", i, chunk.Content)
+		}
+		for _, line := range lines[2:] {
+			if !strings.HasPrefix(line, "| 区域") || !strings.HasSuffix(line, " |") {
+				t.Errorf("chunk %d contains a partial row %q", i, line)
+			}
+			seen++
+		}
+	}
+	if seen != 6 {
+		t.Fatalf("expected every row exactly once, got %d", seen)
+	}
+}
+
+func TestChunkerFor(t *testing.T) {
+	cases := map[[2]string]string{
+		{"", "csv"}:             ChunkTable,
+		{ChunkAuto, ".XLSX"}:    ChunkTable,
+		{ChunkAuto, "pdf"}:      ChunkMarkdown,
+		{ChunkSentence, "xlsx"}: ChunkSentence,
+	}
+	for in, want := range cases {
+		if got := ChunkerFor(in[0], in[1]); got != want {
+			t.Errorf("ChunkerFor(%q, %q) = %q, want %q", in[0], in[1], got, want)
+		}
+	}
+	if _, err := NormalizeChunkStrategy("paragraph"); err != ErrUnknownChunkStrategy {
+		t.Fatalf("expected ErrUnknownChunkStrategy, got %v", err)
+	}
+	if got, _ := NormalizeChunkStrategy(" Token "); got != ChunkToken {
+		t.Fatalf("unexpected normalized strategy %q", got)
+	}
+}
@@ -0,0 +1,61 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+// HeadingPathSeparator 持久化标题路径时的分隔符
+const HeadingPathSeparator = " > "
+
+// ReplaceChunks 用新的分块替换文档已有的分块，并同步文档的 ChunkCount
+func ReplaceChunks(db *gorm.DB, documentID string, chunks []Chunk) ([]models.DocumentChunk, error) {
+	now := time.Now()
+	records := make([]models.DocumentChunk, 0, len(chunks))
+	for i, chunk := range chunks {
+		records = append(records, models.DocumentChunk{
+			ID:          models.NewUUID(),
+			DocumentID:  documentID,
+			Ordinal:     i,
+			Content:     chunk.Content,
+			TokenCount:  CountTokens(chunk.Content),
+			Page:        chunk.Page,
+			Sheet:       chunk.Sheet,
+			StartOffset: chunk.Start,
+			EndOffset:   chunk.End,
+			HeadingPath: strings.Join(chunk.HeadingPath, HeadingPathSeparator),
+			Strategy:    chunk.Strategy,
+			CreatedAt:   now,
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", documentID).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			if err := tx.CreateInBatches(records, 200).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Document{}).Where("id = ?", documentID).
+			UpdateColumn("chunk_count", len(records)).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save chunks: %w", err)
+	}
+	return records, nil
+}
+
+// DeleteChunks 删除文档的全部分块
+func DeleteChunks(db *gorm.DB, documentIDs ...string) error {
+	if len(documentIDs) == 0 {
+		return nil
+	}
+	return db.Where("document_id IN ?", documentIDs).Delete(&models.DocumentChunk{}).Error
+}
@@ -0,0 +1,143 @@
+package document
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxQueryTerms 参与检索的查询词上限
+const maxQueryTerms = 32
+
+// Passage 写入提示词的知识库片段，Marker 为其编号（从 1 开始）
+type Passage struct {
+	Marker       int     `json:"marker"`
+	ChunkID      string  `json:"chunkId"`
+	DocumentID   string  `json:"documentId"`
+	DocumentName string  `json:"documentName"`
+	Content      string  `json:"content"`
+	HeadingPath  string  `json:"headingPath"`
+	Page         int     `json:"page,omitempty"`
+	Sheet        string  `json:"sheet,omitempty"`
+	StartOffset  int     `json:"startOffset"`
+	EndOffset    int     `json:"endOffset"`
+	Score        float64 `json:"score"`
+}
+
+// Source 转为助手消息 sources 中的一项（title 供前端展示）
+func (p Passage) Source() map[string]interface{} {
+	source := map[string]interface{}{
+		"type":        "chunk",
+		"marker":      p.Marker,
+		"title":       p.DocumentName,
+		"documentId":  p.DocumentID,
+		"chunkId":     p.ChunkID,
+		"headingPath": p.HeadingPath,
+		"startOffset": p.StartOffset,
+		"endOffset":   p.EndOffset,
+		"score":       p.Score,
+	}
+	if p.Page > 0 {
+		source["page"] = p.Page
+	}
+	if p.Sheet != "" {
+		source["sheet"] = p.Sheet
+	}
+	return source
+}
+
+// queryStopwords 问句中常见、不具区分度的双字词
+var queryStopwords = map[string]bool{
+	"什么": true, "怎么": true, "如何": true, "哪些": true, "是否": true,
+	"可以": true, "需要": true, "请问": true, "一下": true, "多少": true,
+}
+
+// QueryTerms 将问题拆成检索词：拉丁字母与数字按词切分（转小写），
+// 汉字等无空格文字按相邻双字切分，单字成段时保留单字
+func QueryTerms(query string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	add := func(term string) {
+		if term == "" || seen[term] || queryStopwords[term] || len(terms) >= maxQueryTerms {
+			return
+		}
+		seen[term] = true
+		terms = append(terms, term)
+	}
+
+	var word []rune
+	var ideo []rune
+	flushWord := func() {
+		if len(word) > 1 || (len(word) == 1 && unicode.IsDigit(word[0])) {
+			add(string(word))
+		}
+		word = word[:0]
+	}
+	flushIdeo := func() {
+		if len(ideo) == 1 {
+			add(string(ideo))
+		}
+		for i := 0; i+1 < len(ideo); i++ {
+			add(string(ideo[i : i+2]))
+		}
+		ideo = ideo[:0]
+	}
+
+	for _, r := range strings.ToLower(query) {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flushWord()
+			ideo = append(ideo, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushIdeo()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushIdeo()
+		}
+	}
+	flushWord()
+	flushIdeo()
+	return terms
+}
+
+// citationPattern 匹配回答中的引用标记，如 [1]、[2, 3]、[1，4]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*[,，、]\s*\d+)*)\]`)
+
+// CitedMarkers 按首次出现顺序返回回答中使用的引用编号（去重）
+func CitedMarkers(answer string) []int {
+	seen := map[int]bool{}
+	var markers []int
+	for _, match := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		for _, field := range strings.FieldsFunc(match[1], func(r rune) bool {
+			return r == ',' || r == '，' || r == '、' || unicode.IsSpace(r)
+		}) {
+			marker, err := strconv.Atoi(field)
+			if err != nil || seen[marker] {
+				continue
+			}
+			seen[marker] = true
+			markers = append(markers, marker)
+		}
+	}
+	return markers
+}
+
+// CitedPassages 返回回答实际引用到的片段，按编号排序；不存在的编号被忽略
+func CitedPassages(answer string, passages []Passage) []Passage {
+	if len(passages) == 0 {
+		return nil
+	}
+	cited := map[int]bool{}
+	for _, marker := range CitedMarkers(answer) {
+		cited[marker] = true
+	}
+	var out []Passage
+	for _, p := range passages {
+		if cited[p.Marker] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
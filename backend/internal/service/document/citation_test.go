@@ -0,0 +1,27 @@
+package document
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryTerms(t *testing.T) {
+	got := QueryTerms("年假怎么计算？ VPN Setup 2024")
+	want := []string{"年假", "假怎", "么计", "计算", "vpn", "setup", "2024"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("QueryTerms = %q, want %q", got, want)
+	}
+}
+
+func TestCitedMarkers(t *testing.T) {
+	got := CitedMarkers("年假按工龄计算[2]，满一年 5 天[1][2]。另见 [3，5] 与 [x]。")
+	if want := []int{2, 1, 3, 5}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("CitedMarkers = %v, want %v", got, want)
+	}
+
+	passages := []Passage{{Marker: 1}, {Marker: 2}, {Marker: 3}}
+	cited := CitedPassages("见 [3] 和 [1]，[9] 不存在", passages)
+	if len(cited) != 2 || cited[0].Marker != 1 || cited[1].Marker != 3 {
+		t.Fatalf("unexpected cited passages: %+v", cited)
+	}
+}
@@ -0,0 +1,42 @@
+package document
+
+import (
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+// AccessibleSQL 文档属于用户本人，或归属用户所属的公司（作用于 documents 表的条件，两个参数均为用户 ID）。
+// 目前公司成员即公司所有者
+const AccessibleSQL = "(user_id = ? OR company_id IN (SELECT id FROM companies WHERE owner_id = ?))"
+
+// IsCompanyMember 用户是否属于该公司
+func IsCompanyMember(db *gorm.DB, userID, companyID string) bool {
+	if userID == "" || companyID == "" {
+		return false
+	}
+	var count int64
+	db.Model(&models.Company{}).Where("id = ? AND owner_id = ?", companyID, userID).Count(&count)
+	return count > 0
+}
+
+// MemberCompanyIDs 过滤出 companyIDs 中用户所属的公司，保持原有顺序
+func MemberCompanyIDs(db *gorm.DB, userID string, companyIDs []string) []string {
+	if userID == "" || len(companyIDs) == 0 {
+		return nil
+	}
+	var ids []string
+	db.Model(&models.Company{}).Where("id IN ? AND owner_id = ?", companyIDs, userID).Pluck("id", &ids)
+	member := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		member[id] = true
+	}
+	var out []string
+	for _, id := range companyIDs {
+		if member[id] {
+			out = append(out, id)
+			member[id] = false
+		}
+	}
+	return out
+}
@@ -0,0 +1,243 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 差异行类型
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// maxDiffEdits 行级编辑距离上限，超过时退化为整体替换，避免超大差异占用过多内存
+const maxDiffEdits = 2000
+
+// DiffLine 差异中的一行，行号从 1 开始，0 表示该侧不存在此行
+type DiffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"oldLine,omitempty"`
+	NewLine int    `json:"newLine,omitempty"`
+}
+
+// DiffHunk 一段连续的改动及其上下文
+type DiffHunk struct {
+	OldStart int        `json:"oldStart"`
+	OldLines int        `json:"oldLines"`
+	NewStart int        `json:"newStart"`
+	NewLines int        `json:"newLines"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// TextDiff 两段文本的行级差异
+type TextDiff struct {
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+	Hunks   []DiffHunk `json:"hunks"`
+}
+
+// Unified 输出 unified diff 格式的文本
+func (d TextDiff) Unified() string {
+	var b strings.Builder
+	for _, h := range d.Hunks {
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, line := range h.Lines {
+			switch line.Op {
+			case DiffInsert:
+				b.WriteByte('+')
+			case DiffDelete:
+				b.WriteByte('-')
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(line.Text)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// DiffText 按行比较两段文本，每段改动保留 context 行上下文
+func DiffText(oldText, newText string, context int) TextDiff {
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+	result := TextDiff{Hunks: []DiffHunk{}}
+	for _, line := range lines {
+		switch line.Op {
+		case DiffInsert:
+			result.Added++
+		case DiffDelete:
+			result.Removed++
+		}
+	}
+	result.Hunks = buildHunks(lines, max(context, 0))
+	return result
+}
+
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines 计算行级编辑脚本：先去掉公共前后缀，再用 Myers 算法比较中间部分
+func diffLines(a, b []string) []DiffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []string
+	ops = append(ops, repeatOp(DiffEqual, prefix)...)
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	ops = append(ops, repeatOp(DiffEqual, suffix)...)
+
+	lines := make([]DiffLine, 0, len(ops))
+	i, j := 0, 0
+	for _, op := range ops {
+		switch op {
+		case DiffEqual:
+			lines = append(lines, DiffLine{Op: op, Text: a[i], OldLine: i + 1, NewLine: j + 1})
+			i++
+			j++
+		case DiffDelete:
+			lines = append(lines, DiffLine{Op: op, Text: a[i], OldLine: i + 1})
+			i++
+		case DiffInsert:
+			lines = append(lines, DiffLine{Op: op, Text: b[j], NewLine: j + 1})
+			j++
+		}
+	}
+	return lines
+}
+
+func repeatOp(op string, n int) []string {
+	ops := make([]string, n)
+	for i := range ops {
+		ops[i] = op
+	}
+	return ops
+}
+
+// myers 返回把 a 变为 b 的最短编辑脚本（equal/delete/insert 序列）
+func myers(a, b []string) []string {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return append(repeatOp(DiffDelete, n), repeatOp(DiffInsert, m)...)
+	}
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	found := -1
+	for d := 0; d <= limit && found < 0; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = d
+				break
+			}
+		}
+	}
+	if found < 0 {
+		return append(repeatOp(DiffDelete, n), repeatOp(DiffInsert, m)...)
+	}
+
+	// 回溯得到编辑脚本（逆序）
+	var ops []string
+	x, y := n, m
+	for d := found; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, DiffEqual)
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, DiffInsert)
+			} else {
+				ops = append(ops, DiffDelete)
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// buildHunks 把改动行按上下文合并为若干段
+func buildHunks(lines []DiffLine, context int) []DiffHunk {
+	hunks := []DiffHunk{}
+	start, end := -1, -1
+	flush := func() {
+		if start < 0 {
+			return
+		}
+		h := DiffHunk{Lines: append([]DiffLine(nil), lines[start:end]...)}
+		for _, line := range h.Lines {
+			if line.Op != DiffInsert {
+				h.OldLines++
+				if h.OldStart == 0 {
+					h.OldStart = line.OldLine
+				}
+			}
+			if line.Op != DiffDelete {
+				h.NewLines++
+				if h.NewStart == 0 {
+					h.NewStart = line.NewLine
+				}
+			}
+		}
+		hunks = append(hunks, h)
+		start, end = -1, -1
+	}
+	for i, line := range lines {
+		if line.Op == DiffEqual {
+			continue
+		}
+		from, to := max(i-context, 0), min(i+context+1, len(lines))
+		if start >= 0 && from > end {
+			flush()
+		}
+		if start < 0 {
+			start = from
+		}
+		end = max(end, to)
+	}
+	flush()
+	return hunks
+}
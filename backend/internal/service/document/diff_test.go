@@ -0,0 +1,48 @@
+package document
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffText(t *testing.T) {
+	oldText := "# 报告\n\n第一段\n第二段\n第三段\n第四段\n第五段\n第六段\n结尾\n"
+	newText := "# 报告\n\n第一段\n第二段（修订）\n第三段\n第四段\n第五段\n第六段\n结尾\n附录\n"
+
+	diff := DiffText(oldText, newText, 1)
+	if diff.Added != 2 || diff.Removed != 1 {
+		t.Fatalf("unexpected counts: +%d -%d", diff.Added, diff.Removed)
+	}
+	want := "@@ -3,3 +3,3 @@\n" +
+		" 第一段\n-第二段\n+第二段（修订）\n 第三段\n" +
+		"@@ -9,1 +9,2 @@\n" +
+		" 结尾\n+附录\n"
+	if got := diff.Unified(); got != want {
+		t.Fatalf("unexpected unified diff:\n%s\nwant:\n%s", got, want)
+	}
+	if h := diff.Hunks[0]; h.Lines[2].Op != DiffInsert || h.Lines[2].NewLine != 4 || h.Lines[1].OldLine != 4 {
+		t.Fatalf("unexpected line numbers: %+v", h.Lines)
+	}
+}
+
+func TestDiffTextEdgeCases(t *testing.T) {
+	if diff := DiffText("a\nb\n", "a\nb", 3); len(diff.Hunks) != 0 || diff.Added+diff.Removed != 0 {
+		t.Fatalf("identical text should have no hunks: %+v", diff)
+	}
+	if diff := DiffText("", "x\ny", 3); diff.Added != 2 || diff.Unified() != "@@ -0,0 +1,2 @@\n+x\n+y\n" {
+		t.Fatalf("unexpected diff from empty text: %q", diff.Unified())
+	}
+
+	// 交错改动应得到最短编辑脚本
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+	edits := 0
+	for _, line := range diffLines(a, b) {
+		if line.Op != DiffEqual {
+			edits++
+		}
+	}
+	if edits != 5 {
+		t.Fatalf("expected 5 edits, got %d", edits)
+	}
+}
@@ -0,0 +1,326 @@
+package document
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// maxMIMEDepth 嵌套 multipart 的最大层数
+const maxMIMEDepth = 10
+
+// Email 解析后的邮件
+type Email struct {
+	Subject     string
+	From        string
+	To          string
+	Cc          string
+	Date        string // 原始 Date 头
+	MessageID   string
+	InReplyTo   string
+	Body        string // 正文纯文本；只有 HTML 正文时转换为文本
+	Attachments []Attachment
+}
+
+// Attachment 邮件附件
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Headers 保存为文档元数据的邮件头，空值省略
+func (e *Email) Headers() map[string]string {
+	headers := map[string]string{}
+	for key, value := range map[string]string{
+		"subject":   e.Subject,
+		"from":      e.From,
+		"to":        e.To,
+		"cc":        e.Cc,
+		"date":      e.Date,
+		"messageId": e.MessageID,
+		"inReplyTo": e.InReplyTo,
+	} {
+		if value != "" {
+			headers[key] = value
+		}
+	}
+	return headers
+}
+
+// wordDecoder 解码 RFC 2047 编码的邮件头，支持 GBK 等非 UTF-8 字符集
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// decodeAddresses 解码地址列表头，格式化为 "姓名 <地址>"，无法解析时按普通头解码
+func decodeAddresses(header mail.Header, key string) string {
+	raw := header.Get(key)
+	if raw == "" {
+		return ""
+	}
+	list, err := (&mail.AddressParser{WordDecoder: wordDecoder}).ParseList(raw)
+	if err != nil {
+		return decodeHeader(raw)
+	}
+	out := make([]string, len(list))
+	for i, addr := range list {
+		if addr.Name != "" {
+			out[i] = addr.Name + " <" + addr.Address + ">"
+		} else {
+			out[i] = addr.Address
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// ParseEmail 解析 RFC 822 / MIME 邮件：解码邮件头，提取正文（优先纯文本）与附件
+func ParseEmail(data []byte) (*Email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email: %w", err)
+	}
+	e := &Email{
+		Subject:   decodeHeader(msg.Header.Get("Subject")),
+		From:      decodeAddresses(msg.Header, "From"),
+		To:        decodeAddresses(msg.Header, "To"),
+		Cc:        decodeAddresses(msg.Header, "Cc"),
+		Date:      strings.TrimSpace(msg.Header.Get("Date")),
+		MessageID: strings.TrimSpace(msg.Header.Get("Message-Id")),
+		InReplyTo: strings.TrimSpace(msg.Header.Get("In-Reply-To")),
+	}
+	parts := &emailParts{}
+	if err := parts.walk(textproto.MIMEHeader(msg.Header), msg.Body, 0); err != nil {
+		return nil, err
+	}
+	e.Body = tidyLines(parts.plain)
+	if e.Body == "" && parts.html != "" {
+		e.Body = htmlText(parts.html)
+	}
+	e.Attachments = parts.attachments
+	return e, nil
+}
+
+// emailParts 遍历 MIME 结构时收集的正文与附件
+type emailParts struct {
+	plain       string
+	html        string
+	attachments []Attachment
+}
+
+func (p *emailParts) walk(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") && depth < maxMIMEDepth {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				// 结构损坏时保留已解析的部分
+				return nil
+			}
+			if err := p.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := io.ReadAll(transferDecoder(header, body))
+	if err != nil {
+		return fmt.Errorf("failed to decode email part: %w", err)
+	}
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := dispositionParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	name = decodeHeader(name)
+
+	switch {
+	case mediaType == "message/rfc822":
+		if name == "" {
+			name = "message.eml"
+		}
+		p.attachments = append(p.attachments, Attachment{Name: name, ContentType: mediaType, Data: content})
+	case disposition == "attachment" || name != "":
+		p.attachments = append(p.attachments, Attachment{Name: name, ContentType: mediaType, Data: content})
+	case mediaType == "text/plain" && p.plain == "":
+		p.plain = decodeCharset(content, params["charset"])
+	case mediaType == "text/html" && p.html == "":
+		p.html = decodeCharset(content, params["charset"])
+	}
+	return nil
+}
+
+// transferDecoder 按 Content-Transfer-Encoding 解码（multipart.Reader 已自动解码 quoted-printable）
+func transferDecoder(header textproto.MIMEHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// base64Cleaner 去除 base64 内容中的换行与空白
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func (c *base64Cleaner) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			p[kept] = b
+			kept++
+		}
+	}
+	if kept == 0 && n > 0 && err == nil {
+		return c.Read(p)
+	}
+	return kept, err
+}
+
+// decodeCharset 把指定字符集的文本转换为 UTF-8
+func decodeCharset(content []byte, label string) string {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if label != "" && label != "utf-8" && label != "us-ascii" {
+		if reader, err := charset.NewReaderLabel(label, bytes.NewReader(content)); err == nil {
+			if decoded, err := io.ReadAll(reader); err == nil {
+				content = decoded
+			}
+		}
+	}
+	return decodeText(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")))
+}
+
+// htmlText 把 HTML 正文转换为纯文本，块级元素之间换行
+func htmlText(source string) string {
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return tidyLines(source)
+	}
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(strings.Join(strings.Fields(n.Data), " "))
+			if strings.HasSuffix(n.Data, " ") {
+				b.WriteByte(' ')
+			}
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style", "head", "title":
+				return
+			case "br":
+				b.WriteByte('\n')
+				return
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "p", "div", "li", "tr", "table", "blockquote", "h1", "h2", "h3", "h4", "h5", "h6":
+				b.WriteString("\n\n")
+			case "td", "th":
+				b.WriteByte('\t')
+			}
+		}
+	}
+	walk(doc)
+	return tidyLines(b.String())
+}
+
+// mboxSeparator mbox 分隔行，形如 "From sender@example.com Mon Mar  2 10:00:00 2026"
+var mboxSeparator = regexp.MustCompile(`^From \S+ .*\d{1,2}:\d{2}`)
+
+// SplitMbox 把 mbox 文件拆分为单封邮件：以空行后（或文件开头）带有发件人与时间的 "From " 行分隔，
+// 并还原 mboxrd 格式中被转义的 ">From " 行
+func SplitMbox(data []byte) [][]byte {
+	var messages [][]byte
+	var current bytes.Buffer
+	started, blank := false, true
+	flush := func() {
+		if msg := bytes.TrimSpace(current.Bytes()); len(msg) > 0 {
+			messages = append(messages, append([]byte(nil), msg...))
+		}
+		current.Reset()
+	}
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if blank && mboxSeparator.Match(line) {
+			if started {
+				flush()
+			}
+			started, blank = true, false
+			continue
+		}
+		if !started {
+			continue
+		}
+		if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+			line = line[1:]
+		}
+		current.Write(line)
+		blank = len(bytes.TrimRight(line, "\r\n")) == 0
+	}
+	if started {
+		flush()
+	}
+	return messages
+}
+
+// extractEmail 邮件的可检索文本：主题、发件人等邮件头、正文与附件列表
+func extractEmail(data []byte) (*Extraction, error) {
+	e, err := ParseEmail(data)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	if e.Subject != "" {
+		b.WriteString("# " + e.Subject + "\n\n")
+	}
+	for _, header := range [][2]string{{"From", e.From}, {"To", e.To}, {"Cc", e.Cc}, {"Date", e.Date}} {
+		if header[1] != "" {
+			b.WriteString(header[0] + ": " + header[1] + "  \n")
+		}
+	}
+	if e.Body != "" {
+		b.WriteString("\n" + e.Body + "\n")
+	}
+	if len(e.Attachments) > 0 {
+		names := make([]string, len(e.Attachments))
+		for i, a := range e.Attachments {
+			names[i] = a.Name
+		}
+		b.WriteString("\nAttachments: " + strings.Join(names, ", ") + "\n")
+	}
+	return &Extraction{Text: strings.TrimSpace(b.String())}, nil
+}
@@ -0,0 +1,97 @@
+package document
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleEmail = "From: =?UTF-8?B?5byg5LiJ?= <zhangsan@example.com>\r\n" +
+	"To: team@example.com, Li Si <lisi@example.com>\r\n" +
+	"Subject: =?UTF-8?B?5ZGo5oql?= report\r\n" +
+	"Date: Mon, 2 Mar 2026 10:00:00 +0800\r\n" +
+	"Message-ID: <abc@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"=E6=9C=AC=E5=91=A8=E8=BF=9B=E5=B1=95=E8=A7=81=E9=99=84=E4=BB=B6=E3=80=82\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>html body</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/markdown; name=\"notes.md\"\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.md\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"IyBOb3RlcwoK\r\n" +
+	"5Lya6K6u57qq6KaB\r\n" +
+	"--outer--\r\n"
+
+func TestParseEmail(t *testing.T) {
+	e, err := ParseEmail([]byte(sampleEmail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != "周报 report" {
+		t.Fatalf("unexpected subject %q", e.Subject)
+	}
+	if e.From != "张三 <zhangsan@example.com>" || e.To != "team@example.com, Li Si <lisi@example.com>" {
+		t.Fatalf("unexpected addresses %q %q", e.From, e.To)
+	}
+	if e.Body != "本周进展见附件。" {
+		t.Fatalf("plain text body should be preferred, got %q", e.Body)
+	}
+	if len(e.Attachments) != 1 || e.Attachments[0].Name != "notes.md" || string(e.Attachments[0].Data) != "# Notes\n\n会议纪要" {
+		t.Fatalf("unexpected attachments %+v", e.Attachments)
+	}
+	headers := e.Headers()
+	if headers["messageId"] != "<abc@example.com>" || headers["date"] == "" || headers["cc"] != "" {
+		t.Fatalf("unexpected headers %v", headers)
+	}
+
+	extraction, err := Extract("eml", []byte(sampleEmail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# 周报 report", "From: 张三 <zhangsan@example.com>", "本周进展见附件。", "Attachments: notes.md"} {
+		if !strings.Contains(extraction.Text, want) {
+			t.Fatalf("extraction missing %q:\n%s", want, extraction.Text)
+		}
+	}
+}
+
+func TestParseEmailHTMLOnly(t *testing.T) {
+	data := "Subject: html\r\nContent-Type: text/html; charset=gbk\r\n\r\n<div>\xc4\xe3\xba\xc3</div><script>x()</script><p>second</p>"
+	e, err := ParseEmail([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Body != "你好\n\nsecond" {
+		t.Fatalf("unexpected body %q", e.Body)
+	}
+}
+
+func TestSplitMbox(t *testing.T) {
+	mbox := "From alice@example.com Mon Mar  2 10:00:00 2026\n" +
+		"Subject: first\n\nhello\n>From the start\n\n" +
+		"From bob@example.com Mon Mar  2 11:00:00 2026\n" +
+		"Subject: second\n\nFrom inside the body is not a separator\n"
+	messages := SplitMbox([]byte(mbox))
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+	if !strings.HasSuffix(string(messages[0]), "hello\nFrom the start") {
+		t.Fatalf("escaped From line not restored: %q", messages[0])
+	}
+	if !strings.Contains(string(messages[1]), "From inside the body") {
+		t.Fatalf("unexpected second message %q", messages[1])
+	}
+}
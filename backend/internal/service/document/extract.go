@@ -0,0 +1,194 @@
+package document
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnsupportedType 无法解析的文件类型
+	ErrUnsupportedType = errors.New("unsupported file type")
+	// ErrLegacyFormat 旧版二进制 Office 格式（doc/xls/ppt）
+	ErrLegacyFormat = errors.New("legacy office format is not supported")
+)
+
+// 分段类型
+const (
+	SectionPage  = "page"
+	SectionSlide = "slide"
+	SectionSheet = "sheet"
+)
+
+// Extraction 文档解析结果
+// Text 为保留结构的 Markdown 文本：标题转为 # 前缀，表格转为 Markdown 表格，
+// PDF 页、幻灯片与工作表以二级标题分隔；Sections 记录这些分段在 Text 中的字节区间，
+// 供分块时标注页码或工作表。
+type Extraction struct {
+	Text     string    `json:"text"`
+	Sections []Section `json:"sections,omitempty"`
+}
+
+// Section 页 / 幻灯片 / 工作表
+type Section struct {
+	Kind  string `json:"kind"`
+	Index int    `json:"index"` // 从 1 开始
+	Title string `json:"title,omitempty"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// SectionAt 返回包含字节偏移 offset 的分段，不存在时返回 nil
+func (e *Extraction) SectionAt(offset int) *Section {
+	for i := range e.Sections {
+		if offset >= e.Sections[i].Start && offset < e.Sections[i].End {
+			return &e.Sections[i]
+		}
+	}
+	return nil
+}
+
+// Extract 解析文档内容（纯 Go 实现，支持 txt/md/csv/pdf/docx/pptx/xlsx/eml）
+func Extract(fileType string, data []byte) (*Extraction, error) {
+	switch strings.ToLower(strings.TrimPrefix(fileType, ".")) {
+	case "txt", "md":
+		return &Extraction{Text: decodeText(data)}, nil
+	case "csv":
+		return extractCSV(data)
+	case "pdf":
+		return extractPDF(data)
+	case "docx":
+		return extractDOCX(data)
+	case "pptx":
+		return extractPPTX(data)
+	case "xlsx":
+		return extractXLSX(data)
+	case "eml":
+		return extractEmail(data)
+	case "doc", "xls", "ppt":
+		return nil, ErrLegacyFormat
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, fileType)
+	}
+}
+
+// decodeText 去除 BOM，并替换非法 UTF-8 字节
+func decodeText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+func extractCSV(data []byte) (*Extraction, error) {
+	reader := csv.NewReader(strings.NewReader(decodeText(data)))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse csv: %w", err)
+	}
+	return &Extraction{Text: markdownTable(rows)}, nil
+}
+
+// textBuilder 拼接分段文本并记录分段位置
+type textBuilder struct {
+	b        strings.Builder
+	sections []Section
+}
+
+func (t *textBuilder) section(kind string, index int, title, heading, body string) {
+	if t.b.Len() > 0 {
+		t.b.WriteString("\n\n")
+	}
+	start := t.b.Len()
+	t.b.WriteString("## ")
+	t.b.WriteString(heading)
+	if body != "" {
+		t.b.WriteString("\n\n")
+		t.b.WriteString(body)
+	}
+	t.sections = append(t.sections, Section{Kind: kind, Index: index, Title: title, Start: start, End: t.b.Len()})
+}
+
+func (t *textBuilder) result() *Extraction {
+	return &Extraction{Text: t.b.String(), Sections: t.sections}
+}
+
+// markdownTable 将二维表渲染为 Markdown 表格，首行作为表头；空行与末尾空列被丢弃
+func markdownTable(rows [][]string) string {
+	var kept [][]string
+	width := 0
+	for _, row := range rows {
+		last := -1
+		for i, cell := range row {
+			if strings.TrimSpace(cell) != "" {
+				last = i
+			}
+		}
+		if last < 0 {
+			continue
+		}
+		kept = append(kept, row[:last+1])
+		if last+1 > width {
+			width = last + 1
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	writeRow := func(row []string) {
+		b.WriteString("|")
+		for i := 0; i < width; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = markdownCell(row[i])
+			}
+			b.WriteString(" ")
+			b.WriteString(cell)
+			b.WriteString(" |")
+		}
+		b.WriteString("\n")
+	}
+	writeRow(kept[0])
+	b.WriteString("|")
+	b.WriteString(strings.Repeat(" --- |", width))
+	b.WriteString("\n")
+	for _, row := range kept[1:] {
+		writeRow(row)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func markdownCell(cell string) string {
+	cell = strings.TrimSpace(cell)
+	cell = strings.ReplaceAll(cell, "|", "\\|")
+	cell = strings.ReplaceAll(cell, "\r\n", "\n")
+	return strings.ReplaceAll(cell, "\n", "<br>")
+}
+
+// tidyLines 去除行尾空白并合并多余空行
+func tidyLines(text string) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\u00a0")
+		if strings.TrimSpace(line) == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
@@ -0,0 +1,204 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip create: %v", err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+const (
+	wordNS = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	drawNS = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"`
+	relNS  = `xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+)
+
+func TestExtractDOCX(t *testing.T) {
+	data := buildZip(t, map[string]string{
+		"word/styles.xml": `<w:styles ` + wordNS + `>
+			<w:style w:type="paragraph" w:styleId="1"><w:name w:val="heading 1"/></w:style>
+			<w:style w:type="paragraph" w:styleId="Sub"><w:name w:val="Custom"/><w:pPr><w:outlineLvl w:val="1"/></w:pPr></w:style>
+		</w:styles>`,
+		"word/document.xml": `<w:document ` + wordNS + `><w:body>
+			<w:p><w:pPr><w:pStyle w:val="1"/></w:pPr><w:r><w:t>员工手册</w:t></w:r></w:p>
+			<w:p><w:pPr><w:pStyle w:val="Sub"/><w:tabs><w:tab w:val="left" w:pos="720"/></w:tabs></w:pPr><w:r><w:t>假期</w:t></w:r></w:p>
+			<w:p><w:r><w:t xml:space="preserve">年假按工龄</w:t></w:r><w:r><w:t>计算。</w:t></w:r></w:p>
+			<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>满一年五天</w:t></w:r></w:p>
+			<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>满十年十天</w:t></w:r></w:p>
+			<w:tbl>
+				<w:tr><w:tc><w:p><w:r><w:t>工龄</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>天数</w:t></w:r></w:p></w:tc></w:tr>
+				<w:tr><w:tc><w:p><w:r><w:t>1|9</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>5</w:t></w:r></w:p><w:p><w:r><w:t>另计</w:t></w:r></w:p></w:tc></w:tr>
+			</w:tbl>
+		</w:body></w:document>`,
+	})
+
+	extraction, err := Extract("docx", data)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	want := "# 员工手册\n\n## 假期\n\n年假按工龄计算。\n\n- 满一年五天\n- 满十年十天\n\n" +
+		"| 工龄 | 天数 |\n| --- | --- |\n| 1\\|9 | 5<br>另计 |"
+	if extraction.Text != want {
+		t.Fatalf("unexpected docx text:\n%s", extraction.Text)
+	}
+}
+
+func TestExtractPPTX(t *testing.T) {
+	slide := func(title, body string) string {
+		return `<p:sld ` + drawNS + `><p:cSld><p:spTree>
+			<p:sp><p:nvSpPr><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>` + title + `</a:t></a:r></a:p></p:txBody></p:sp>
+			<p:sp><p:txBody><a:p><a:r><a:t>` + body + `</a:t></a:r></a:p></p:txBody></p:sp>
+		</p:spTree></p:cSld></p:sld>`
+	}
+	data := buildZip(t, map[string]string{
+		"ppt/presentation.xml": `<p:presentation ` + drawNS + ` ` + relNS + `><p:sldIdLst>
+			<p:sldId id="256" r:id="rId3"/><p:sldId id="257" r:id="rId2"/>
+		</p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId2" Target="slides/slide1.xml"/><Relationship Id="rId3" Target="slides/slide2.xml"/>
+		</Relationships>`,
+		"ppt/slides/slide1.xml": slide("路线图", "第三季度上线"),
+		"ppt/slides/slide2.xml": slide("封面", "产品规划"),
+	})
+
+	extraction, err := Extract("pptx", data)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	want := "## 幻灯片 1：封面\n\n产品规划\n\n## 幻灯片 2：路线图\n\n第三季度上线"
+	if extraction.Text != want {
+		t.Fatalf("unexpected pptx text:\n%s", extraction.Text)
+	}
+	if len(extraction.Sections) != 2 || extraction.Sections[1].Title != "路线图" {
+		t.Fatalf("unexpected sections: %+v", extraction.Sections)
+	}
+	if s := extraction.SectionAt(strings.Index(extraction.Text, "第三季度")); s == nil || s.Kind != SectionSlide || s.Index != 2 {
+		t.Fatalf("offset should map to slide 2, got %+v", s)
+	}
+}
+
+func TestExtractXLSX(t *testing.T) {
+	data := buildZip(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` + relNS + `><sheets>
+			<sheet name="销售" sheetId="1" r:id="rId1"/><sheet name="空表" sheetId="2" r:id="rId2"/>
+		</sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/>
+		</Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+			<si><t>区域</t></si><si><r><t>销</t></r><r><t>售额</t></r></si><si><t>华东</t></si>
+		</sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+			<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" t="inlineStr"><is><t>备注</t></is></c><c r="C2"><v>1200</v></c></row>
+		</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData/></worksheet>`,
+	})
+
+	extraction, err := Extract("xlsx", data)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	want := "## 工作表：销售\n\n| 区域 |  | 销售额 |\n| --- | --- | --- |\n| 华东 | 备注 | 1200 |"
+	if extraction.Text != want {
+		t.Fatalf("unexpected xlsx text:\n%s", extraction.Text)
+	}
+	if len(extraction.Sections) != 1 || extraction.Sections[0].Kind != SectionSheet || extraction.Sections[0].Title != "销售" {
+		t.Fatalf("unexpected sections: %+v", extraction.Sections)
+	}
+}
+
+func TestExtractCSVAndLegacy(t *testing.T) {
+	extraction, err := Extract("csv", []byte("\xef\xbb\xbfname,score\nalice,90\n\nbob\n"))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if want := "| name | score |\n| --- | --- |\n| alice | 90 |\n| bob |  |"; extraction.Text != want {
+		t.Fatalf("unexpected csv text:\n%s", extraction.Text)
+	}
+	if _, err := Extract("doc", nil); !errors.Is(err, ErrLegacyFormat) {
+		t.Fatalf("expected legacy format error, got %v", err)
+	}
+	if _, err := Extract("exe", nil); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected unsupported type error, got %v", err)
+	}
+}
+
+// buildPDF 按对象号顺序拼装 PDF（不写交叉引用表，解析器通过扫描对象定位）
+func buildPDF(objects []string, trailer string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	fmt.Fprintf(&b, "trailer\n%s\n%%%%EOF\n", trailer)
+	return b.Bytes()
+}
+
+func TestExtractPDF(t *testing.T) {
+	page1 := "BT /F1 12 Tf 72 720 Td [(Hello) -600 (World)] TJ 0 -14 Td (Second \\(line\\)) Tj ET"
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte("BT /F2 10 Tf 1 0 0 1 72 700 Tm <00010002> Tj <0003> Tj 0 -40 Td <0004> Tj ET"))
+	zw.Close()
+
+	cmap := "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"2 beginbfchar <0001> <5E74> <0002> <5047> endbfchar\n" +
+		"1 beginbfrange <0003> <0004> [<5929> <6570>] endbfrange\n" +
+		"endcmap CMapName currentdict /CMap defineresource pop end end"
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 7 0 R /F2 8 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(page1), page1),
+		// Length 为间接引用，解析器需回退为查找 endstream
+		"<< /Length 10 0 R /Filter /FlateDecode >>\nstream\n" + compressed.String() + "\nendstream",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /SimSun /Encoding /Identity-H /DescendantFonts [11 0 R] /ToUnicode 9 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(cmap), cmap),
+		fmt.Sprintf("%d", compressed.Len()),
+		"<< /Type /Font /Subtype /CIDFontType2 /DW 1000 >>",
+	}
+	data := buildPDF(objects, "<< /Root 1 0 R /Size 12 >>")
+
+	extraction, err := Extract("pdf", data)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	want := "## 第 1 页\n\nHello World\nSecond (line)\n\n## 第 2 页\n\n年假天\n\n数"
+	if extraction.Text != want {
+		t.Fatalf("unexpected pdf text:\n%q", extraction.Text)
+	}
+	if s := extraction.SectionAt(strings.Index(extraction.Text, "年假")); s == nil || s.Kind != SectionPage || s.Index != 2 {
+		t.Fatalf("offset should map to page 2, got %+v", s)
+	}
+
+	encrypted := buildPDF(objects, "<< /Root 1 0 R /Encrypt << /Filter /Standard >> >>")
+	if _, err := Extract("pdf", encrypted); !errors.Is(err, ErrEncryptedPDF) {
+		t.Fatalf("expected encrypted error, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package document
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+// 分面维度
+const (
+	FacetTag      = "tags"
+	FacetFileType = "fileType"
+	FacetStatus   = "status"
+	FacetFolder   = "folder"
+	FacetCompany  = "company"
+	FacetWork     = "work"
+)
+
+// facetColumns 按列分组计数的分面维度
+var facetColumns = []struct {
+	name   string
+	column string
+}{
+	{FacetFileType, "file_type"},
+	{FacetStatus, "status"},
+	{FacetFolder, "folder_id"},
+	{FacetCompany, "company_id"},
+	{FacetWork, "work_id"},
+}
+
+// Filter 文档列表与搜索的分面过滤条件：同一维度内命中任一值即可，不同维度之间同时满足
+type Filter struct {
+	Tags       []string
+	FileTypes  []string
+	Statuses   []string
+	FolderIDs  []string
+	CompanyIDs []string
+	WorkIDs    []string
+	DateFrom   string // 创建时间下限（含）
+	DateTo     string // 创建时间上限（含）
+}
+
+// SplitValues 拆分逗号分隔的过滤值，去除空白与空值
+func SplitValues(raw string) []string {
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Apply 把过滤条件加到 documents 表的查询上
+func (f Filter) Apply(q *gorm.DB) *gorm.DB {
+	return f.apply(q, "")
+}
+
+// apply 应用除 skip 维度以外的条件；计算某一维度的分面时忽略该维度自身的过滤，
+// 使已选中的维度仍能列出其他可选值
+func (f Filter) apply(q *gorm.DB, skip string) *gorm.DB {
+	if len(f.Tags) > 0 && skip != FacetTag {
+		q = q.Where(TagMatchSQL, f.Tags)
+	}
+	for _, facet := range facetColumns {
+		if values := f.values(facet.name); len(values) > 0 && skip != facet.name {
+			q = q.Where(facet.column+" IN ?", values)
+		}
+	}
+	if f.DateFrom != "" {
+		q = q.Where("created_at >= ?", f.DateFrom)
+	}
+	if f.DateTo != "" {
+		q = q.Where("created_at <= ?", f.DateTo)
+	}
+	return q
+}
+
+func (f Filter) values(facet string) []string {
+	switch facet {
+	case FacetTag:
+		return f.Tags
+	case FacetFileType:
+		return f.FileTypes
+	case FacetStatus:
+		return f.Statuses
+	case FacetFolder:
+		return f.FolderIDs
+	case FacetCompany:
+		return f.CompanyIDs
+	case FacetWork:
+		return f.WorkIDs
+	}
+	return nil
+}
+
+// FacetValue 分面取值及匹配的文档数
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Facets 各维度的取值计数，键为分面维度
+type Facets map[string][]FacetValue
+
+// ComputeFacets 统计 scope 范围内各维度的取值计数。scope 每次调用需返回新的 documents 查询；
+// 每个维度的计数应用其他维度的过滤条件，但不应用该维度自身的条件
+func ComputeFacets(db *gorm.DB, scope func() *gorm.DB, f Filter) (Facets, error) {
+	facets := Facets{}
+	for _, facet := range facetColumns {
+		values := []FacetValue{}
+		err := f.apply(scope(), facet.name).
+			Select(facet.column + " AS value, COUNT(*) AS count").
+			Where(facet.column + " <> ''").
+			Group(facet.column).
+			Order("count DESC, value ASC").
+			Scan(&values).Error
+		if err != nil {
+			return nil, err
+		}
+		facets[facet.name] = values
+	}
+
+	tags := []FacetValue{}
+	err := db.Table("document_tags").
+		Select("tag AS value, COUNT(*) AS count").
+		Where("document_id IN (?)", f.apply(scope(), FacetTag).Select("id")).
+		Group("tag").
+		Order("count DESC, value ASC").
+		Scan(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	facets[FacetTag] = tags
+	return facets, nil
+}
+
+// DocumentScope 用户的文档范围查询，trashed 为 true 时只含回收站中的文档
+func DocumentScope(db *gorm.DB, userID string, trashed bool) func() *gorm.DB {
+	return func() *gorm.DB {
+		q := db.Model(&models.Document{}).Where("user_id = ?", userID)
+		if trashed {
+			return q.Where("trashed_at IS NOT NULL")
+		}
+		return q.Where("trashed_at IS NULL")
+	}
+}
@@ -0,0 +1,147 @@
+package document
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+// ErrFolderCycle 目标父文件夹是文件夹自身或其子孙
+var ErrFolderCycle = errors.New("folder cannot be moved into itself or its descendants")
+
+// FolderNode 文件夹树节点
+type FolderNode struct {
+	models.Folder
+	DocumentCount      int64         `json:"documentCount"`      // 直接包含的文档数
+	TotalDocumentCount int64         `json:"totalDocumentCount"` // 含子文件夹的文档总数
+	Children           []*FolderNode `json:"children"`
+}
+
+// loadFolders 读取用户的全部文件夹（含回收站中的）
+func loadFolders(db *gorm.DB, userID string) (map[string]models.Folder, error) {
+	var folders []models.Folder
+	if err := db.Where("user_id = ?", userID).Find(&folders).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Folder, len(folders))
+	for _, f := range folders {
+		byID[f.ID] = f
+	}
+	return byID, nil
+}
+
+// FolderSubtree 返回 rootID 及其全部子孙文件夹的 ID（广度优先，rootID 在首位）
+func FolderSubtree(db *gorm.DB, userID, rootID string) ([]string, error) {
+	folders, err := loadFolders(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	children := map[string][]string{}
+	for _, f := range folders {
+		children[f.ParentID] = append(children[f.ParentID], f.ID)
+	}
+	ids := []string{rootID}
+	seen := map[string]bool{rootID: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// FolderPath 返回从根目录到该文件夹的路径（面包屑，最后一项为文件夹本身）；
+// 父文件夹缺失或数据中存在环时在该处截断
+func FolderPath(db *gorm.DB, userID, folderID string) ([]models.Folder, error) {
+	folders, err := loadFolders(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	var path []models.Folder
+	seen := map[string]bool{}
+	for id := folderID; id != "" && !seen[id]; {
+		f, ok := folders[id]
+		if !ok {
+			break
+		}
+		seen[id] = true
+		path = append(path, f)
+		id = f.ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
+
+// CheckFolderMove 校验把 folderID 移到 parentID 之下不会形成环；parentID 为空表示移到根目录
+func CheckFolderMove(db *gorm.DB, userID, folderID, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+	if parentID == folderID {
+		return ErrFolderCycle
+	}
+	path, err := FolderPath(db, userID, parentID)
+	if err != nil {
+		return err
+	}
+	for _, f := range path {
+		if f.ID == folderID {
+			return ErrFolderCycle
+		}
+	}
+	return nil
+}
+
+// BuildFolderTree 由文件夹列表和各文件夹的直接文档数构建树；rootID 为空时返回全部顶层文件夹，
+// 否则只返回以 rootID 为根的子树。父文件夹不在列表中的文件夹视为顶层
+func BuildFolderTree(folders []models.Folder, counts map[string]int64, rootID string) []*FolderNode {
+	nodes := make(map[string]*FolderNode, len(folders))
+	for _, f := range folders {
+		nodes[f.ID] = &FolderNode{Folder: f, DocumentCount: counts[f.ID], Children: []*FolderNode{}}
+	}
+	roots := []*FolderNode{}
+	for _, f := range folders {
+		node := nodes[f.ID]
+		parent, ok := nodes[f.ParentID]
+		if ok && f.ParentID != f.ID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	var total func(n *FolderNode, seen map[string]bool) int64
+	total = func(n *FolderNode, seen map[string]bool) int64 {
+		if seen[n.ID] {
+			return 0
+		}
+		seen[n.ID] = true
+		n.TotalDocumentCount = n.DocumentCount
+		for _, child := range n.Children {
+			n.TotalDocumentCount += total(child, seen)
+		}
+		return n.TotalDocumentCount
+	}
+	seen := map[string]bool{}
+	for _, root := range roots {
+		total(root, seen)
+	}
+
+	if rootID == "" {
+		return roots
+	}
+	if node, ok := nodes[rootID]; ok {
+		if !seen[rootID] {
+			total(node, map[string]bool{})
+		}
+		return []*FolderNode{node}
+	}
+	return []*FolderNode{}
+}
@@ -0,0 +1,641 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Office Open XML（docx / pptx / xlsx）解析：直接读取 zip 包内的 XML 部件，按令牌流提取文本与结构。
+
+type ooxmlPackage struct {
+	files map[string]*zip.File
+}
+
+func openPackage(data []byte) (*ooxmlPackage, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open office package: %w", err)
+	}
+	pkg := &ooxmlPackage{files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		pkg.files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	return pkg, nil
+}
+
+func (p *ooxmlPackage) read(name string) ([]byte, error) {
+	f, ok := p.files[name]
+	if !ok {
+		return nil, fmt.Errorf("package part not found: %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// relationships 读取部件的关系表，返回 rId → 包内路径
+func (p *ooxmlPackage) relationships(part string) map[string]string {
+	rels := map[string]string{}
+	raw, err := p.read(path.Join(path.Dir(part), "_rels", path.Base(part)+".rels"))
+	if err != nil {
+		return rels
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "Relationship" || xmlAttr(se, "TargetMode") == "External" {
+			continue
+		}
+		target := xmlAttr(se, "Target")
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(path.Dir(part), target)
+		}
+		rels[xmlAttr(se, "Id")] = target
+	}
+	return rels
+}
+
+// xmlAttr 按本地名读取属性
+func xmlAttr(se xml.StartElement, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// xmlRelAttr 读取 r:id 这类关系命名空间下的属性，避免与同名的普通属性混淆
+func xmlRelAttr(se xml.StartElement, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == local && strings.Contains(a.Name.Space, "relationships") {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// xmlTable 解析中的表格（支持嵌套）
+type xmlTable struct {
+	rows [][]string
+	row  []string
+	cell []string
+}
+
+type xmlTableStack []*xmlTable
+
+func (s *xmlTableStack) top() *xmlTable {
+	if len(*s) == 0 {
+		return nil
+	}
+	return (*s)[len(*s)-1]
+}
+
+// handle 处理表格相关的元素，返回渲染完成的最外层表格
+func (s *xmlTableStack) handle(tok xml.Token) (string, bool) {
+	switch t := tok.(type) {
+	case xml.StartElement:
+		switch t.Name.Local {
+		case "tbl":
+			*s = append(*s, &xmlTable{})
+		case "tr":
+			if top := s.top(); top != nil {
+				top.row = nil
+			}
+		case "tc":
+			if top := s.top(); top != nil {
+				top.cell = nil
+			}
+		}
+	case xml.EndElement:
+		top := s.top()
+		if top == nil {
+			return "", false
+		}
+		switch t.Name.Local {
+		case "tc":
+			top.row = append(top.row, strings.Join(top.cell, "\n"))
+		case "tr":
+			top.rows = append(top.rows, top.row)
+		case "tbl":
+			*s = (*s)[:len(*s)-1]
+			if parent := s.top(); parent != nil {
+				// 嵌套表格压平为外层单元格内的文本
+				for _, row := range top.rows {
+					parent.cell = append(parent.cell, strings.Join(row, " "))
+				}
+				return "", false
+			}
+			return markdownTable(top.rows), true
+		}
+	}
+	return "", false
+}
+
+// addParagraph 将段落文本放入当前单元格，不在表格内时返回 false
+func (s *xmlTableStack) addParagraph(text string) bool {
+	top := s.top()
+	if top == nil {
+		return false
+	}
+	if text != "" {
+		top.cell = append(top.cell, text)
+	}
+	return true
+}
+
+var headingStyleName = regexp.MustCompile(`(?i)^(?:heading|标题)\s*([1-9])$`)
+
+// docxHeadingStyles 从 styles.xml 解析标题样式，返回 styleId → 标题级别
+func docxHeadingStyles(pkg *ooxmlPackage) map[string]int {
+	levels := map[string]int{}
+	raw, err := pkg.read("word/styles.xml")
+	if err != nil {
+		return levels
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	var id, name string
+	outline := -1
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "style":
+				id, name, outline = xmlAttr(t, "styleId"), "", -1
+			case "name":
+				name = xmlAttr(t, "val")
+			case "outlineLvl":
+				if v, err := strconv.Atoi(xmlAttr(t, "val")); err == nil {
+					outline = v
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local != "style" || id == "" {
+				continue
+			}
+			switch {
+			case outline >= 0 && outline < 9:
+				levels[id] = outline + 1
+			case strings.EqualFold(name, "title"):
+				levels[id] = 1
+			default:
+				if m := headingStyleName.FindStringSubmatch(name); m != nil {
+					levels[id], _ = strconv.Atoi(m[1])
+				}
+			}
+		}
+	}
+	return levels
+}
+
+func extractDOCX(data []byte) (*Extraction, error) {
+	pkg, err := openPackage(data)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := pkg.read("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	headings := docxHeadingStyles(pkg)
+
+	var (
+		blocks   []string
+		tables   xmlTableStack
+		para     strings.Builder
+		style    string
+		outline  = -1
+		listItem bool
+		inText   bool
+		inTabs   bool
+	)
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse docx: %w", err)
+		}
+		if table, ok := tables.handle(tok); ok {
+			blocks = append(blocks, table)
+			continue
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				style, outline, listItem = "", -1, false
+			case "pStyle":
+				style = xmlAttr(t, "val")
+			case "outlineLvl":
+				if v, err := strconv.Atoi(xmlAttr(t, "val")); err == nil {
+					outline = v
+				}
+			case "numPr":
+				listItem = true
+			case "t":
+				inText = true
+			case "tabs":
+				inTabs = true
+			case "tab":
+				if !inTabs {
+					para.WriteString("\t")
+				}
+			case "br", "cr":
+				para.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "tabs":
+				inTabs = false
+			case "p":
+				text := strings.TrimSpace(para.String())
+				if tables.addParagraph(text) || text == "" {
+					continue
+				}
+				level := headings[style]
+				if outline >= 0 && outline < 9 {
+					level = outline + 1
+				}
+				switch {
+				case level > 0:
+					blocks = append(blocks, strings.Repeat("#", min(level, 6))+" "+strings.Join(strings.Fields(text), " "))
+				case listItem:
+					blocks = append(blocks, "- "+text)
+				default:
+					blocks = append(blocks, text)
+				}
+			}
+		}
+	}
+	return &Extraction{Text: joinBlocks(blocks)}, nil
+}
+
+// joinBlocks 以空行分隔块，连续的列表项之间只换行
+func joinBlocks(blocks []string) string {
+	var b strings.Builder
+	for i, block := range blocks {
+		if i > 0 {
+			if strings.HasPrefix(block, "- ") && strings.HasPrefix(blocks[i-1], "- ") {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		b.WriteString(block)
+	}
+	return b.String()
+}
+
+var numberedPart = regexp.MustCompile(`(\d+)\.xml$`)
+
+// partsByNumber 按文件名中的序号排序（slide2 在 slide10 之前）
+func partsByNumber(pkg *ooxmlPackage, prefix string) []string {
+	var parts []string
+	for name := range pkg.files {
+		if strings.HasPrefix(name, prefix) && numberedPart.MatchString(name) && !strings.Contains(strings.TrimPrefix(name, prefix), "/") {
+			parts = append(parts, name)
+		}
+	}
+	number := func(name string) int {
+		n, _ := strconv.Atoi(numberedPart.FindStringSubmatch(name)[1])
+		return n
+	}
+	sort.Slice(parts, func(i, j int) bool { return number(parts[i]) < number(parts[j]) })
+	return parts
+}
+
+// pptxSlides 按演示文稿中的放映顺序返回幻灯片部件
+func pptxSlides(pkg *ooxmlPackage) []string {
+	const part = "ppt/presentation.xml"
+	raw, err := pkg.read(part)
+	if err != nil {
+		return partsByNumber(pkg, "ppt/slides/slide")
+	}
+	rels := pkg.relationships(part)
+	var slides []string
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "sldId" {
+			if target, ok := rels[xmlRelAttr(se, "id")]; ok {
+				slides = append(slides, target)
+			}
+		}
+	}
+	if len(slides) == 0 {
+		return partsByNumber(pkg, "ppt/slides/slide")
+	}
+	return slides
+}
+
+func extractPPTX(data []byte) (*Extraction, error) {
+	pkg, err := openPackage(data)
+	if err != nil {
+		return nil, err
+	}
+	var out textBuilder
+	for i, name := range pptxSlides(pkg) {
+		raw, err := pkg.read(name)
+		if err != nil {
+			continue
+		}
+		title, body := parseSlide(raw)
+		heading := fmt.Sprintf("幻灯片 %d", i+1)
+		if title != "" {
+			heading += "：" + title
+		}
+		out.section(SectionSlide, i+1, title, heading, body)
+	}
+	return out.result(), nil
+}
+
+// parseSlide 提取幻灯片标题（标题占位符）与正文
+func parseSlide(raw []byte) (string, string) {
+	var (
+		titles  []string
+		blocks  []string
+		tables  xmlTableStack
+		shape   []string
+		isTitle bool
+		inShape bool
+		para    strings.Builder
+		inText  bool
+	)
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if table, ok := tables.handle(tok); ok {
+			blocks = append(blocks, table)
+			continue
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sp":
+				inShape, isTitle, shape = true, false, nil
+			case "ph":
+				if typ := xmlAttr(t, "type"); typ == "title" || typ == "ctrTitle" {
+					isTitle = true
+				}
+			case "p":
+				para.Reset()
+			case "t":
+				inText = true
+			case "br":
+				para.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(para.String())
+				if tables.addParagraph(text) || text == "" {
+					continue
+				}
+				if inShape {
+					shape = append(shape, text)
+				} else {
+					blocks = append(blocks, text)
+				}
+			case "sp":
+				inShape = false
+				if len(shape) == 0 {
+					continue
+				}
+				if isTitle {
+					titles = append(titles, strings.Join(strings.Fields(strings.Join(shape, " ")), " "))
+				} else {
+					blocks = append(blocks, strings.Join(shape, "\n"))
+				}
+			}
+		}
+	}
+	return strings.Join(titles, " "), strings.Join(blocks, "\n\n")
+}
+
+type xlsxSheet struct {
+	name string
+	part string
+}
+
+// xlsxSheets 按工作簿顺序返回工作表名称与部件
+func xlsxSheets(pkg *ooxmlPackage) []xlsxSheet {
+	const part = "xl/workbook.xml"
+	var sheets []xlsxSheet
+	if raw, err := pkg.read(part); err == nil {
+		rels := pkg.relationships(part)
+		decoder := xml.NewDecoder(bytes.NewReader(raw))
+		for {
+			tok, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "sheet" {
+				if target, ok := rels[xmlRelAttr(se, "id")]; ok {
+					sheets = append(sheets, xlsxSheet{name: xmlAttr(se, "name"), part: target})
+				}
+			}
+		}
+	}
+	if len(sheets) == 0 {
+		for i, name := range partsByNumber(pkg, "xl/worksheets/sheet") {
+			sheets = append(sheets, xlsxSheet{name: fmt.Sprintf("Sheet%d", i+1), part: name})
+		}
+	}
+	return sheets
+}
+
+func extractXLSX(data []byte) (*Extraction, error) {
+	pkg, err := openPackage(data)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	if raw, err := pkg.read("xl/sharedStrings.xml"); err == nil {
+		shared = parseSharedStrings(raw)
+	}
+
+	var out textBuilder
+	for i, sheet := range xlsxSheets(pkg) {
+		raw, err := pkg.read(sheet.part)
+		if err != nil {
+			continue
+		}
+		table := markdownTable(parseWorksheet(raw, shared))
+		if table == "" {
+			continue
+		}
+		out.section(SectionSheet, i+1, sheet.name, "工作表："+sheet.name, table)
+	}
+	return out.result(), nil
+}
+
+// parseSharedStrings 解析共享字符串表，富文本片段合并，忽略注音
+func parseSharedStrings(raw []byte) []string {
+	var (
+		out    []string
+		item   strings.Builder
+		inText bool
+		inPh   bool
+	)
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				item.Reset()
+			case "rPh":
+				inPh = true
+			case "t":
+				inText = !inPh
+			}
+		case xml.CharData:
+			if inText {
+				item.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "rPh":
+				inPh = false
+			case "si":
+				out = append(out, item.String())
+			}
+		}
+	}
+	return out
+}
+
+// parseWorksheet 按单元格引用定位列，返回二维表
+func parseWorksheet(raw []byte, shared []string) [][]string {
+	var (
+		rows    [][]string
+		row     []string
+		ref     string
+		typ     string
+		value   strings.Builder
+		capture bool
+		col     int
+	)
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row, col = nil, 0
+			case "c":
+				ref, typ = xmlAttr(t, "r"), xmlAttr(t, "t")
+				value.Reset()
+			case "v", "t":
+				capture = true
+			}
+		case xml.CharData:
+			if capture {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				capture = false
+			case "c":
+				if idx := columnIndex(ref); idx >= 0 {
+					col = idx
+				}
+				for len(row) < col {
+					row = append(row, "")
+				}
+				row = append(row, cellValue(typ, value.String(), shared))
+				col++
+			case "row":
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows
+}
+
+func cellValue(typ, value string, shared []string) string {
+	switch typ {
+	case "s":
+		if idx, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && idx >= 0 && idx < len(shared) {
+			return shared[idx]
+		}
+		return ""
+	case "b":
+		if strings.TrimSpace(value) == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return value
+}
+
+// columnIndex 将 "AB12" 转换为从 0 开始的列号，无法解析时返回 -1
+func columnIndex(ref string) int {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+	}
+	if n == 0 || n > 3 {
+		return -1
+	}
+	return col - 1
+}
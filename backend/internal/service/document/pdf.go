@@ -0,0 +1,598 @@
+package document
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 纯 Go 的 PDF 解析：扫描文件中的全部间接对象（兼容对象流、损坏的交叉引用表与增量更新），
+// 再按页树顺序解释每页的内容流。加密文档与没有文本层的扫描件无法提取文字。
+
+// ErrEncryptedPDF 加密的 PDF
+var ErrEncryptedPDF = errors.New("encrypted pdf is not supported")
+
+type (
+	pdfName    string
+	pdfString  string
+	pdfKeyword string
+	pdfArray   []interface{}
+	pdfDict    map[pdfName]interface{}
+)
+
+type pdfRef struct {
+	num int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte // 未解码的原始数据
+}
+
+// pdfLexer PDF 词法 / 对象解析器，同时用于文件主体与内容流
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *pdfLexer) peek(offset int) byte {
+	if l.pos+offset < len(l.data) {
+		return l.data[l.pos+offset]
+	}
+	return 0
+}
+
+// next 读取下一个对象；"]"、">>" 等结束符与内容流操作符以 pdfKeyword 返回
+func (l *pdfLexer) next() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.readName(), nil
+	case c == '(':
+		return l.readLiteral(), nil
+	case c == '<' && l.peek(1) == '<':
+		l.pos += 2
+		items, err := l.readUntil(">>")
+		return toDict(items), err
+	case c == '<':
+		return l.readHex(), nil
+	case c == '>' && l.peek(1) == '>':
+		l.pos += 2
+		return pdfKeyword(">>"), nil
+	case c == '[':
+		l.pos++
+		items, err := l.readUntil("]")
+		return pdfArray(items), err
+	case c == ']' || c == '>' || c == '{' || c == '}' || c == ')':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.readNumber(), nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	switch word := string(l.data[start:l.pos]); word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return pdfKeyword(word), nil
+	}
+}
+
+// readUntil 读取容器内的对象直到结束符，并把 "n g R" 折叠为间接引用
+func (l *pdfLexer) readUntil(end pdfKeyword) ([]interface{}, error) {
+	var items []interface{}
+	for {
+		obj, err := l.next()
+		if err != nil {
+			return items, err
+		}
+		if kw, ok := obj.(pdfKeyword); ok {
+			if kw == end {
+				return items, nil
+			}
+			if kw == "R" && len(items) >= 2 {
+				num, ok1 := items[len(items)-2].(float64)
+				_, ok2 := items[len(items)-1].(float64)
+				if ok1 && ok2 {
+					items = append(items[:len(items)-2], pdfRef{num: int(num)})
+					continue
+				}
+			}
+		}
+		items = append(items, obj)
+	}
+}
+
+func toDict(items []interface{}) pdfDict {
+	dict := pdfDict{}
+	for i := 0; i+1 < len(items); i++ {
+		key, ok := items[i].(pdfName)
+		if !ok {
+			continue
+		}
+		dict[key] = items[i+1]
+		i++
+	}
+	return dict
+}
+
+func (l *pdfLexer) readName() pdfName {
+	l.pos++
+	var b []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) || isPDFDelim(c) {
+			break
+		}
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return pdfName(b)
+}
+
+func (l *pdfLexer) readLiteral() pdfString {
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(b)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return pdfString(b)
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b)
+}
+
+func (l *pdfLexer) readHex() pdfString {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(out, digits); err != nil {
+		return ""
+	}
+	return pdfString(out)
+}
+
+func (l *pdfLexer) readNumber() float64 {
+	start := l.pos
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c != '+' && c != '-' && c != '.' && (c < '0' || c > '9') {
+			break
+		}
+		l.pos++
+	}
+	v, _ := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+	return v
+}
+
+// pdfFile 已解析的 PDF 对象表
+type pdfFile struct {
+	objects map[int]interface{}
+	trailer pdfDict
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+func parsePDF(data []byte) (*pdfFile, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a pdf file")
+	}
+	f := &pdfFile{objects: map[int]interface{}{}, trailer: pdfDict{}}
+
+	end := 0
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		if m[0] < end || (m[0] > 0 && !isPDFSpace(data[m[0]-1]) && !isPDFDelim(data[m[0]-1])) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		l := &pdfLexer{data: data, pos: m[1]}
+		obj, err := l.next()
+		if err != nil {
+			continue
+		}
+		l.skipSpace()
+		if dict, ok := obj.(pdfDict); ok && bytes.HasPrefix(data[l.pos:], []byte("stream")) {
+			obj, l.pos = readStream(data, l.pos+len("stream"), dict)
+		}
+		// 增量更新时后出现的定义覆盖先前的
+		f.objects[num] = obj
+		end = l.pos
+	}
+
+	// 旧式 trailer 与交叉引用流字典中都可能有 Root / Encrypt
+	if idx := bytes.LastIndex(data, []byte("trailer")); idx >= 0 {
+		l := &pdfLexer{data: data, pos: idx + len("trailer")}
+		if obj, err := l.next(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				f.trailer = dict
+			}
+		}
+	}
+	var streams []*pdfStream
+	for _, obj := range f.objects {
+		if s, ok := obj.(*pdfStream); ok {
+			streams = append(streams, s)
+		}
+	}
+	for _, s := range streams {
+		switch s.dict["Type"] {
+		case pdfName("ObjStm"):
+			f.loadObjectStream(s)
+		case pdfName("XRef"):
+			for _, key := range []pdfName{"Root", "Encrypt"} {
+				if _, ok := f.trailer[key]; !ok && s.dict[key] != nil {
+					f.trailer[key] = s.dict[key]
+				}
+			}
+		}
+	}
+	if f.trailer["Encrypt"] != nil {
+		return nil, ErrEncryptedPDF
+	}
+	return f, nil
+}
+
+// readStream 读取 stream 关键字之后的数据；Length 不可用时回退为查找 endstream
+func readStream(data []byte, pos int, dict pdfDict) (*pdfStream, int) {
+	if pos < len(data) && data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(data) && data[pos] == '\n' {
+		pos++
+	}
+	if n, ok := dict["Length"].(float64); ok && n >= 0 {
+		stop := pos + int(n)
+		if stop <= len(data) && bytes.HasPrefix(bytes.TrimLeft(data[stop:], " \r\n\t"), []byte("endstream")) {
+			return &pdfStream{dict: dict, data: data[pos:stop]}, stop
+		}
+	}
+	idx := bytes.Index(data[pos:], []byte("endstream"))
+	if idx < 0 {
+		return &pdfStream{dict: dict, data: data[pos:]}, len(data)
+	}
+	raw := data[pos : pos+idx]
+	switch {
+	case bytes.HasSuffix(raw, []byte("\r\n")):
+		raw = raw[:len(raw)-2]
+	case bytes.HasSuffix(raw, []byte("\n")), bytes.HasSuffix(raw, []byte("\r")):
+		raw = raw[:len(raw)-1]
+	}
+	return &pdfStream{dict: dict, data: raw}, pos + idx + len("endstream")
+}
+
+// loadObjectStream 展开对象流中的压缩对象，已有的直接定义优先
+func (f *pdfFile) loadObjectStream(s *pdfStream) {
+	data, err := f.decodeStream(s)
+	if err != nil {
+		return
+	}
+	count, _ := f.number(s.dict["N"])
+	first, _ := f.number(s.dict["First"])
+	header := &pdfLexer{data: data}
+	for i := 0; i < int(count); i++ {
+		numObj, err1 := header.next()
+		offObj, err2 := header.next()
+		num, ok1 := numObj.(float64)
+		off, ok2 := offObj.(float64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			return
+		}
+		if _, exists := f.objects[int(num)]; exists {
+			continue
+		}
+		pos := int(first) + int(off)
+		if pos < 0 || pos >= len(data) {
+			continue
+		}
+		body := &pdfLexer{data: data, pos: pos}
+		if obj, err := body.next(); err == nil {
+			f.objects[int(num)] = obj
+		}
+	}
+}
+
+func (f *pdfFile) resolve(obj interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = f.objects[ref.num]
+	}
+	return nil
+}
+
+func (f *pdfFile) dict(obj interface{}) pdfDict {
+	switch v := f.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (f *pdfFile) array(obj interface{}) pdfArray {
+	v, _ := f.resolve(obj).(pdfArray)
+	return v
+}
+
+func (f *pdfFile) number(obj interface{}) (float64, bool) {
+	v, ok := f.resolve(obj).(float64)
+	return v, ok
+}
+
+func (f *pdfFile) name(obj interface{}) pdfName {
+	v, _ := f.resolve(obj).(pdfName)
+	return v
+}
+
+// decodeStream 按 Filter 解码流数据
+func (f *pdfFile) decodeStream(s *pdfStream) ([]byte, error) {
+	var filters []pdfName
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []pdfName{v}
+	case pdfArray:
+		for _, item := range v {
+			filters = append(filters, f.name(item))
+		}
+	}
+
+	data := s.data
+	for _, filter := range filters {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data)
+		case "ASCIIHexDecode", "AHx":
+			data = []byte((&pdfLexer{data: append(append([]byte("<"), data...), '>')}).readHex())
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		default:
+			err = fmt.Errorf("unsupported pdf filter: %s", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	out, err := io.ReadAll(r)
+	// 截断的流尽量保留已解出的部分
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("failed to inflate pdf stream: %w", err)
+	}
+	return out, nil
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if idx := bytes.Index(data, []byte("~>")); idx >= 0 {
+		data = data[:idx]
+	}
+	return io.ReadAll(ascii85.NewDecoder(bytes.NewReader(data)))
+}
+
+// pdfPage 页面字典与（可能继承自父节点的）资源
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages 按页树顺序返回页面；页树损坏时退化为按对象号排列的全部 Page 对象
+func (f *pdfFile) pages() []pdfPage {
+	var pages []pdfPage
+	visited := map[int]bool{}
+	var walk func(obj interface{}, resources pdfDict, depth int)
+	walk = func(obj interface{}, resources pdfDict, depth int) {
+		if ref, ok := obj.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+		node := f.dict(obj)
+		if node == nil || depth > 64 {
+			return
+		}
+		if r := f.dict(node["Resources"]); r != nil {
+			resources = r
+		}
+		if kids := f.array(node["Kids"]); f.name(node["Type"]) != "Page" && kids != nil {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: node, resources: resources})
+	}
+
+	catalog := f.dict(f.trailer["Root"])
+	if f.name(catalog["Type"]) != "Catalog" {
+		catalog = nil
+		for _, num := range f.objectNumbers() {
+			if d := f.dict(f.objects[num]); d != nil && f.name(d["Type"]) == "Catalog" {
+				catalog = d
+			}
+		}
+	}
+	if catalog != nil {
+		walk(catalog["Pages"], nil, 0)
+	}
+	if len(pages) == 0 {
+		for _, num := range f.objectNumbers() {
+			if d, ok := f.objects[num].(pdfDict); ok && f.name(d["Type"]) == "Page" {
+				pages = append(pages, pdfPage{dict: d, resources: f.dict(d["Resources"])})
+			}
+		}
+	}
+	return pages
+}
+
+func (f *pdfFile) objectNumbers() []int {
+	nums := make([]int, 0, len(f.objects))
+	for num := range f.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// pageContent 拼接页面的全部内容流
+func (f *pdfFile) pageContent(page pdfPage) []byte {
+	var streams []interface{}
+	switch v := f.resolve(page.dict["Contents"]).(type) {
+	case *pdfStream:
+		streams = append(streams, v)
+	case pdfArray:
+		streams = v
+	}
+	var content []byte
+	for _, item := range streams {
+		s, ok := f.resolve(item).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := f.decodeStream(s)
+		if err != nil {
+			continue
+		}
+		content = append(content, data...)
+		content = append(content, '\n')
+	}
+	return content
+}
+
+func extractPDF(data []byte) (*Extraction, error) {
+	f, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+	extractor := newPDFTextExtractor(f)
+	var out textBuilder
+	for i, page := range f.pages() {
+		text := extractor.pageText(page)
+		if text == "" {
+			continue
+		}
+		out.section(SectionPage, i+1, "", fmt.Sprintf("第 %d 页", i+1), text)
+	}
+	return out.result(), nil
+}
@@ -0,0 +1,666 @@
+package document
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// PDF 文字还原：字体负责把字节码映射为 Unicode 与字宽，内容流解释器依据文本矩阵
+// 推断换行、段落与词间空格。
+
+type pdfGlyph struct {
+	text  string
+	width float64 // 千分之一字号单位
+	space bool    // 单字节码 32，适用字间距 Tw
+}
+
+type pdfFont struct {
+	composite    bool            // Type0 复合字体，码长默认 2 字节
+	utf16        bool            // Uni*-UCS2 / UTF16 预定义 CMap，码即 UTF-16BE
+	toUnicode    *pdfCMap        // ToUnicode 映射
+	encoding     *[256]string    // 简单字体的编码表
+	widths       map[int]float64 // 码（或 CID）→ 字宽
+	defaultWidth float64
+}
+
+// pdfCMap ToUnicode CMap 的码空间与映射
+type pdfCMap struct {
+	ranges []pdfCodeRange
+	chars  map[string]string
+}
+
+type pdfCodeRange struct {
+	lo, hi []byte
+}
+
+// maxBFRange 单个 bfrange 展开的上限，防止恶意文件耗尽内存
+const maxBFRange = 1 << 16
+
+func parseCMap(data []byte) *pdfCMap {
+	cmap := &pdfCMap{chars: map[string]string{}}
+	l := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		obj, err := l.next()
+		if err != nil {
+			break
+		}
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					cmap.ranges = append(cmap.ranges, pdfCodeRange{lo: []byte(lo), hi: []byte(hi)})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					cmap.chars[string(src)] = decodeUTF16(string(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				cmap.addRange([]byte(lo), bytesToInt([]byte(lo)), bytesToInt([]byte(hi)), operands[i+2])
+			}
+		}
+		operands = operands[:0]
+	}
+	return cmap
+}
+
+func (c *pdfCMap) addRange(lo []byte, from, to int, dst interface{}) {
+	if to < from || to-from > maxBFRange {
+		return
+	}
+	for code := from; code <= to; code++ {
+		key := intToBytes(code, len(lo))
+		switch d := dst.(type) {
+		case pdfString:
+			// 目标的末两个字节随码递增
+			out := []byte(d)
+			if len(out) >= 2 {
+				v := int(out[len(out)-2])<<8 | int(out[len(out)-1]) + code - from
+				out = append(append([]byte{}, out[:len(out)-2]...), byte(v>>8), byte(v))
+			}
+			c.chars[string(key)] = decodeUTF16(string(out))
+		case pdfArray:
+			if idx := code - from; idx < len(d) {
+				if s, ok := d[idx].(pdfString); ok {
+					c.chars[string(key)] = decodeUTF16(string(s))
+				}
+			}
+		}
+	}
+}
+
+// codeLength 依据码空间确定 data 开头的码长，无匹配时返回 0
+func (c *pdfCMap) codeLength(data []byte) int {
+	for _, r := range c.ranges {
+		n := len(r.lo)
+		if n > len(data) {
+			continue
+		}
+		match := true
+		for i := 0; i < n; i++ {
+			if data[i] < r.lo[i] || data[i] > r.hi[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return n
+		}
+	}
+	return 0
+}
+
+func bytesToInt(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+func intToBytes(v, n int) []byte {
+	out := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		out[i] = byte(v)
+		v >>= 8
+	}
+	return out
+}
+
+func decodeUTF16(s string) string {
+	if len(s)%2 == 1 {
+		s += "\x00"
+	}
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// decode 将字符串操作数拆分为字形
+func (font *pdfFont) decode(s []byte) []pdfGlyph {
+	glyphs := make([]pdfGlyph, 0, len(s))
+	for len(s) > 0 {
+		n := 1
+		if font.composite {
+			n = 2
+			if font.toUnicode != nil {
+				if l := font.toUnicode.codeLength(s); l > 0 {
+					n = l
+				}
+			}
+			n = min(n, len(s))
+		}
+		code := s[:n]
+		s = s[n:]
+
+		value := bytesToInt(code)
+		glyph := pdfGlyph{width: font.defaultWidth, space: n == 1 && code[0] == ' '}
+		if w, ok := font.widths[value]; ok {
+			glyph.width = w
+		}
+		if text, ok := font.toUnicode.lookup(code); ok {
+			glyph.text = text
+		} else if font.utf16 {
+			glyph.text = decodeUTF16(string(code))
+		} else if !font.composite && font.encoding != nil {
+			glyph.text = font.encoding[code[0]]
+		}
+		glyphs = append(glyphs, glyph)
+	}
+	return glyphs
+}
+
+func (c *pdfCMap) lookup(code []byte) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	text, ok := c.chars[string(code)]
+	return text, ok
+}
+
+// winAnsiEncoding 以 Latin-1 为基础，补充 0x80-0x9F 区的 CP1252 字符
+var winAnsiEncoding = func() [256]string {
+	var table [256]string
+	for i := 32; i < 256; i++ {
+		if i < 127 || i >= 160 {
+			table[i] = string(rune(i))
+		}
+	}
+	high := "€\x00‚ƒ„…†‡ˆ‰Š‹Œ\x00Ž\x00\x00‘’“”•–—˜™š›œ\x00žŸ"
+	for i, r := range []rune(high) {
+		if r != 0 {
+			table[0x80+i] = string(r)
+		}
+	}
+	table['\t'], table['\n'], table['\r'] = " ", " ", " "
+	return table
+}()
+
+// glyphNames 常见字形名，其余单字母名或 uniXXXX 形式按规则解析
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")", "asterisk": "*",
+	"plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/", "zero": "0", "one": "1",
+	"two": "2", "three": "3", "four": "4", "five": "5", "six": "6", "seven": "7", "eight": "8",
+	"nine": "9", "colon": ":", "semicolon": ";", "less": "<", "equal": "=", "greater": ">",
+	"question": "?", "at": "@", "bracketleft": "[", "backslash": "\\", "bracketright": "]",
+	"asciicircum": "^", "underscore": "_", "grave": "`", "braceleft": "{", "bar": "|",
+	"braceright": "}", "asciitilde": "~", "bullet": "•", "endash": "–", "emdash": "—",
+	"quoteleft": "‘", "quoteright": "’", "quotedblleft": "“", "quotedblright": "”",
+	"ellipsis": "…", "fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"trademark": "™", "copyright": "©", "registered": "®", "degree": "°", "section": "§",
+	"paragraph": "¶", "dagger": "†", "minus": "−", "multiply": "×", "divide": "÷",
+	"nbspace": " ", "periodcentered": "·", "Euro": "€",
+}
+
+func glyphText(name string) string {
+	if idx := strings.IndexByte(name, '.'); idx > 0 {
+		name = name[:idx]
+	}
+	if text, ok := glyphNames[name]; ok {
+		return text
+	}
+	if len(name) == 1 {
+		return name
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		hexPart := strings.TrimPrefix(name, prefix)
+		if hexPart == name || len(hexPart) < 4 || len(hexPart)%4 != 0 && prefix == "uni" {
+			continue
+		}
+		var b strings.Builder
+		step := 4
+		if prefix == "u" {
+			step = len(hexPart)
+		}
+		for i := 0; i+step <= len(hexPart); i += step {
+			v, err := strconv.ParseUint(hexPart[i:i+step], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(v)) {
+				b.Reset()
+				break
+			}
+			b.WriteRune(rune(v))
+		}
+		if b.Len() > 0 {
+			return b.String()
+		}
+	}
+	return ""
+}
+
+// pdfTextExtractor 页面文本提取器，字体按对象号缓存
+type pdfTextExtractor struct {
+	f     *pdfFile
+	fonts map[int]*pdfFont
+}
+
+func newPDFTextExtractor(f *pdfFile) *pdfTextExtractor {
+	return &pdfTextExtractor{f: f, fonts: map[int]*pdfFont{}}
+}
+
+// defaultPDFFont 未设置字体时按 WinAnsi 单字节处理
+var defaultPDFFont = &pdfFont{encoding: &winAnsiEncoding, defaultWidth: 500}
+
+func (x *pdfTextExtractor) font(resources pdfDict, name pdfName) *pdfFont {
+	ref, isRef := x.f.dict(resources["Font"])[name].(pdfRef)
+	if isRef {
+		if font, ok := x.fonts[ref.num]; ok {
+			return font
+		}
+	}
+	dict := x.f.dict(x.f.dict(resources["Font"])[name])
+	if dict == nil {
+		return defaultPDFFont
+	}
+	font := x.loadFont(dict)
+	if isRef {
+		x.fonts[ref.num] = font
+	}
+	return font
+}
+
+func (x *pdfTextExtractor) loadFont(dict pdfDict) *pdfFont {
+	f := x.f
+	font := &pdfFont{widths: map[int]float64{}}
+	if s, ok := f.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := f.decodeStream(s); err == nil {
+			font.toUnicode = parseCMap(data)
+		}
+	}
+
+	if f.name(dict["Subtype"]) == "Type0" {
+		font.composite = true
+		encoding := string(f.name(dict["Encoding"]))
+		font.utf16 = strings.HasPrefix(encoding, "Uni") && (strings.Contains(encoding, "UCS2") || strings.Contains(encoding, "UTF16"))
+		font.defaultWidth = 1000
+		if descendants := f.array(dict["DescendantFonts"]); len(descendants) > 0 {
+			cid := f.dict(descendants[0])
+			if dw, ok := f.number(cid["DW"]); ok {
+				font.defaultWidth = dw
+			}
+			x.loadCIDWidths(font, f.array(cid["W"]))
+		}
+		return font
+	}
+
+	table := winAnsiEncoding
+	var differences pdfArray
+	switch enc := f.resolve(dict["Encoding"]).(type) {
+	case pdfDict:
+		differences = f.array(enc["Differences"])
+	}
+	code := 0
+	for _, item := range differences {
+		switch v := f.resolve(item).(type) {
+		case float64:
+			code = int(v)
+		case pdfName:
+			if code >= 0 && code < 256 {
+				table[code] = glyphText(string(v))
+			}
+			code++
+		}
+	}
+	font.encoding = &table
+
+	font.defaultWidth = 500
+	if desc := f.dict(dict["FontDescriptor"]); desc != nil {
+		if w, ok := f.number(desc["MissingWidth"]); ok && w > 0 {
+			font.defaultWidth = w
+		}
+	}
+	firstChar, _ := f.number(dict["FirstChar"])
+	for i, item := range f.array(dict["Widths"]) {
+		if w, ok := f.number(item); ok {
+			font.widths[int(firstChar)+i] = w
+		}
+	}
+	// Type3 字体的字宽位于字形空间，按 FontMatrix 换算
+	if matrix := f.array(dict["FontMatrix"]); len(matrix) == 6 {
+		if scale, ok := f.number(matrix[0]); ok && scale > 0 {
+			for k, w := range font.widths {
+				font.widths[k] = w * scale * 1000
+			}
+		}
+	}
+	return font
+}
+
+// loadCIDWidths 解析 W 数组：c [w1 w2 ...] 或 cFirst cLast w
+func (x *pdfTextExtractor) loadCIDWidths(font *pdfFont, w pdfArray) {
+	for i := 0; i < len(w); {
+		first, ok := x.f.number(w[i])
+		if !ok || i+1 >= len(w) {
+			return
+		}
+		if list := x.f.array(w[i+1]); list != nil {
+			for j, item := range list {
+				if width, ok := x.f.number(item); ok {
+					font.widths[int(first)+j] = width
+				}
+			}
+			i += 2
+			continue
+		}
+		last, ok1 := x.f.number(w[i+1])
+		if i+2 >= len(w) {
+			return
+		}
+		width, ok2 := x.f.number(w[i+2])
+		if ok1 && ok2 && last >= first && last-first <= maxBFRange {
+			for c := int(first); c <= int(last); c++ {
+				font.widths[c] = width
+			}
+		}
+		i += 3
+	}
+}
+
+// pdfTextState 图形状态中与文字相关的部分（随 q/Q 保存与恢复）
+type pdfTextState struct {
+	font      *pdfFont
+	size      float64
+	charSpace float64
+	wordSpace float64
+	scale     float64
+	leading   float64
+}
+
+// pdfPageWriter 单页的输出与上一个字形的位置
+type pdfPageWriter struct {
+	out    strings.Builder
+	lastX  float64
+	lastY  float64
+	has    bool
+	recent []pdfDrawn // 最近输出的文字，用于识别伪粗体（同一文字微小偏移重绘）
+}
+
+type pdfDrawn struct {
+	text string
+	x, y float64
+}
+
+// maxRecentDrawn 伪粗体检测回看的输出数
+const maxRecentDrawn = 64
+
+// isRedraw 判断同一文字是否刚在几乎相同的位置输出过
+func (w *pdfPageWriter) isRedraw(text string, x, y, tolerance float64) bool {
+	for _, d := range w.recent {
+		if d.text == text && math.Abs(d.x-x) < tolerance && math.Abs(d.y-y) < tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// maxFormDepth 表单 XObject 的最大嵌套深度
+const maxFormDepth = 8
+
+func (x *pdfTextExtractor) pageText(page pdfPage) string {
+	w := &pdfPageWriter{}
+	x.run(w, x.f.pageContent(page), page.resources, 0, map[int]bool{})
+	return tidyLines(w.out.String())
+}
+
+func (x *pdfTextExtractor) run(w *pdfPageWriter, content []byte, resources pdfDict, depth int, forms map[int]bool) {
+	ts := pdfTextState{font: defaultPDFFont, scale: 1}
+	var stack []pdfTextState
+	tm := [6]float64{1, 0, 0, 1, 0, 0}
+	tlm := tm
+
+	moveLine := func(tx, ty float64) {
+		tlm[4] += tx*tlm[0] + ty*tlm[2]
+		tlm[5] += tx*tlm[1] + ty*tlm[3]
+		tm = tlm
+	}
+
+	l := &pdfLexer{data: content}
+	var ops []interface{}
+	num := func(i int) float64 {
+		if i < len(ops) {
+			v, _ := ops[i].(float64)
+			return v
+		}
+		return 0
+	}
+	str := func(i int) []byte {
+		if i < len(ops) {
+			s, _ := ops[i].(pdfString)
+			return []byte(s)
+		}
+		return nil
+	}
+
+	for {
+		obj, err := l.next()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			ops = append(ops, obj)
+			continue
+		}
+		switch op {
+		case "q":
+			stack = append(stack, ts)
+		case "Q":
+			if len(stack) > 0 {
+				ts = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "BT":
+			tm = [6]float64{1, 0, 0, 1, 0, 0}
+			tlm = tm
+		case "Tf":
+			if len(ops) >= 2 {
+				if name, ok := ops[len(ops)-2].(pdfName); ok {
+					ts.font = x.font(resources, name)
+				}
+				ts.size = num(len(ops) - 1)
+			}
+		case "Tc":
+			ts.charSpace = num(0)
+		case "Tw":
+			ts.wordSpace = num(0)
+		case "Tz":
+			ts.scale = num(0) / 100
+		case "TL":
+			ts.leading = num(0)
+		case "Td":
+			moveLine(num(0), num(1))
+		case "TD":
+			ts.leading = -num(1)
+			moveLine(num(0), num(1))
+		case "Tm":
+			if len(ops) >= 6 {
+				for i := range tm {
+					tm[i] = num(len(ops) - 6 + i)
+				}
+				tlm = tm
+			}
+		case "T*":
+			moveLine(0, -ts.leading)
+		case "Tj":
+			x.show(w, &ts, &tm, str(0))
+		case "'":
+			moveLine(0, -ts.leading)
+			x.show(w, &ts, &tm, str(0))
+		case "\"":
+			ts.wordSpace, ts.charSpace = num(0), num(1)
+			moveLine(0, -ts.leading)
+			x.show(w, &ts, &tm, str(2))
+		case "TJ":
+			if len(ops) == 0 {
+				break
+			}
+			items, _ := ops[0].(pdfArray)
+			for _, item := range items {
+				switch v := item.(type) {
+				case pdfString:
+					x.show(w, &ts, &tm, []byte(v))
+				case float64:
+					tx := -v / 1000 * ts.size * ts.scale
+					tm[4] += tx * tm[0]
+					tm[5] += tx * tm[1]
+				}
+			}
+		case "Do":
+			if len(ops) == 0 || depth >= maxFormDepth {
+				break
+			}
+			name, _ := ops[0].(pdfName)
+			ref, isRef := x.f.dict(resources["XObject"])[name].(pdfRef)
+			if !isRef || forms[ref.num] {
+				break
+			}
+			form, ok := x.f.resolve(ref).(*pdfStream)
+			if !ok || x.f.name(form.dict["Subtype"]) != "Form" {
+				break
+			}
+			data, err := x.f.decodeStream(form)
+			if err != nil {
+				break
+			}
+			formResources := x.f.dict(form.dict["Resources"])
+			if formResources == nil {
+				formResources = resources
+			}
+			forms[ref.num] = true
+			x.run(w, data, formResources, depth+1, forms)
+			delete(forms, ref.num)
+		case "BI":
+			skipInlineImage(l)
+		}
+		ops = ops[:0]
+	}
+}
+
+// skipInlineImage 跳过 BI ... ID <二进制数据> EI
+func skipInlineImage(l *pdfLexer) {
+	for {
+		obj, err := l.next()
+		if err != nil {
+			return
+		}
+		if kw, ok := obj.(pdfKeyword); ok && kw == "ID" {
+			break
+		}
+	}
+	l.pos++
+	for l.pos < len(l.data) {
+		idx := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if idx < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + idx
+		l.pos = at + 2
+		if at > 0 && isPDFSpace(l.data[at-1]) && (at+2 >= len(l.data) || isPDFSpace(l.data[at+2])) {
+			return
+		}
+	}
+}
+
+// show 输出字符串操作数，并据与上一字形的相对位置插入换行或空格
+func (x *pdfTextExtractor) show(w *pdfPageWriter, ts *pdfTextState, tm *[6]float64, s []byte) {
+	if len(s) == 0 {
+		return
+	}
+	sizeX := math.Abs(ts.size) * math.Hypot(tm[0], tm[1])
+	sizeY := math.Abs(ts.size) * math.Hypot(tm[2], tm[3])
+	if sizeY == 0 {
+		sizeY = 1
+	}
+
+	glyphs := ts.font.decode(s)
+	var text strings.Builder
+	for _, g := range glyphs {
+		text.WriteString(g.text)
+	}
+	x0, y0 := tm[4], tm[5]
+	sameLine := w.has && math.Abs(y0-w.lastY) <= sizeY*0.5
+	duplicate := w.isRedraw(text.String(), x0, y0, math.Max(sizeX, sizeY)*0.1)
+
+	if w.has && !duplicate {
+		dy := math.Abs(y0 - w.lastY)
+		switch {
+		case dy > sizeY*1.8:
+			w.out.WriteString("\n\n")
+		case !sameLine:
+			w.out.WriteString("\n")
+		case x0-w.lastX > sizeX*0.2 && !endsWithSpace(&w.out):
+			w.out.WriteString(" ")
+		}
+	}
+	if !duplicate {
+		w.out.WriteString(text.String())
+	}
+
+	for _, g := range glyphs {
+		advance := g.width/1000*ts.size + ts.charSpace
+		if g.space {
+			advance += ts.wordSpace
+		}
+		advance *= ts.scale
+		tm[4] += advance * tm[0]
+		tm[5] += advance * tm[1]
+	}
+	if duplicate {
+		return
+	}
+	w.lastX, w.lastY, w.has = tm[4], tm[5], true
+	if len(w.recent) == maxRecentDrawn {
+		w.recent = w.recent[1:]
+	}
+	w.recent = append(w.recent, pdfDrawn{text: text.String(), x: x0, y: y0})
+}
+
+func endsWithSpace(b *strings.Builder) bool {
+	s := b.String()
+	return s == "" || strings.HasSuffix(s, " ") || strings.HasSuffix(s, "\n")
+}
@@ -12,6 +12,8 @@ type Processor struct {
 	maxChunkSize    int // 最大块大小（字符）
 	chunkOverlap    int // 块重叠大小
 	minChunkSize    int // 最小块大小
+	chunkTokens     int // token 策略的窗口大小（Token）
+	tokenOverlap    int // token 策略相邻窗口的重叠（Token）
 }
 
 // ProcessorConfig 配置
@@ -19,13 +21,21 @@ type ProcessorConfig struct {
 	MaxChunkSize int
 	ChunkOverlap int
 	MinChunkSize int
+	ChunkTokens  int
+	TokenOverlap int
 }
 
 // Chunk 文本块
 type Chunk struct {
-	ID      string            `json:"id"`
-	Content string            `json:"content"`
-	Metadata map[string]interface{} `json:"metadata"`
+	ID          string                 `json:"id"`
+	Content     string                 `json:"content"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	Start       int                    `json:"start"` // 在提取文本中的起止字符偏移（仅 ChunkExtraction 填充）
+	End         int                    `json:"end"`
+	HeadingPath []string               `json:"headingPath,omitempty"`
+	Page        int                    `json:"page,omitempty"`
+	Sheet       string                 `json:"sheet,omitempty"`
+	Strategy    string                 `json:"strategy,omitempty"` // 生成该分块的策略（仅 Chunk 填充）
 }
 
 // NewProcessor 创建处理器
@@ -45,32 +55,32 @@ func NewProcessor(config ProcessorConfig) *Processor {
 		minChunkSize = 100 // 默认最小 100 字符
 	}
 
+	chunkTokens := config.ChunkTokens
+	if chunkTokens == 0 {
+		chunkTokens = 256 // 默认 256 Token
+	}
+
+	tokenOverlap := config.TokenOverlap
+	if tokenOverlap == 0 {
+		tokenOverlap = 32 // 默认重叠 32 Token
+	}
+
 	return &Processor{
 		maxChunkSize: maxChunkSize,
 		chunkOverlap: chunkOverlap,
 		minChunkSize: minChunkSize,
+		chunkTokens:  chunkTokens,
+		tokenOverlap: tokenOverlap,
 	}
 }
 
-// ExtractText 提取文本（支持 PDF, DOCX, TXT）
-// 实际项目中应使用专门的库：unioffice, pdfcpu 等
+// ExtractText 提取文本（支持 TXT, MD, CSV, PDF, DOCX, PPTX, XLSX），结构说明见 Extract
 func (p *Processor) ExtractText(fileType string, data []byte) (string, error) {
-	switch strings.ToLower(fileType) {
-	case "txt", "md":
-		return string(data), nil
-		
-	case "pdf":
-		// TODO: 使用 pdfcpu 或 unidoc 解析 PDF
-		// 这里返回占位文本
-		return "PDF content extraction not implemented. Use pdfcpu or unidoc library.", nil
-		
-	case "doc", "docx":
-		// TODO: 使用 unioffice 解析 Word 文档
-		return "DOCX content extraction not implemented. Use unioffice library.", nil
-		
-	default:
-		return "", fmt.Errorf("unsupported file type: %s", fileType)
+	extraction, err := Extract(fileType, data)
+	if err != nil {
+		return "", err
 	}
+	return extraction.Text, nil
 }
 
 // ChunkText 智能文本分块
@@ -247,6 +257,11 @@ func (p *Processor) ProcessDocumentFromReader(fileType string, reader io.Reader)
 
 // CountTokens 估算 Token 数量（简化版）
 func (p *Processor) CountTokens(text string) int {
+	return CountTokens(text)
+}
+
+// CountTokens 估算 Token 数量，供不持有 Processor 的调用方使用
+func CountTokens(text string) int {
 	// 简化估算：英文约 4 字符 = 1 token，中文约 1.5 字符 = 1 token
 	// 实际应使用 tiktoken 库
 	runes := []rune(text)
@@ -0,0 +1,129 @@
+package document
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+// 分块策略
+const (
+	ChunkAuto     = "auto"     // 按文件类型选择：CSV / XLSX 使用 table，其余使用 markdown
+	ChunkMarkdown = "markdown" // 按标题与段落切分
+	ChunkToken    = "token"    // 固定 Token 窗口，相邻窗口重叠
+	ChunkSentence = "sentence" // 按句子聚合，识别中英文句末标点
+	ChunkTable    = "table"    // 表格按行切分并重复表头，不拆分单行
+)
+
+// ChunkStrategies 支持的分块策略
+var ChunkStrategies = []string{ChunkAuto, ChunkMarkdown, ChunkToken, ChunkSentence, ChunkTable}
+
+// ErrUnknownChunkStrategy 不支持的分块策略
+var ErrUnknownChunkStrategy = errors.New("unknown chunk strategy")
+
+// NormalizeChunkStrategy 规范化文件夹 / 公司上配置的分块策略，空字符串表示沿用上级配置
+func NormalizeChunkStrategy(strategy string) (string, error) {
+	strategy = strings.ToLower(strings.TrimSpace(strategy))
+	if strategy == "" {
+		return "", nil
+	}
+	for _, s := range ChunkStrategies {
+		if s == strategy {
+			return strategy, nil
+		}
+	}
+	return "", ErrUnknownChunkStrategy
+}
+
+// ChunkerFor 把 auto 按文件类型解析为具体策略
+func ChunkerFor(strategy, fileType string) string {
+	if strategy != "" && strategy != ChunkAuto {
+		return strategy
+	}
+	switch strings.ToLower(strings.TrimPrefix(fileType, ".")) {
+	case "csv", "xlsx":
+		return ChunkTable
+	}
+	return ChunkMarkdown
+}
+
+// ResolveChunkStrategies 计算一批文档生效的分块策略（文档 ID -> 策略）：
+// 所在文件夹及其上级中最近的配置优先，其次为文档所属公司的配置，都未配置时按文件类型选择
+func ResolveChunkStrategies(db *gorm.DB, docs []models.Document) (map[string]string, error) {
+	folders := map[string]map[string]models.Folder{}
+	companies := map[string]string{}
+	var companyIDs []string
+	for _, doc := range docs {
+		if _, ok := folders[doc.UserID]; !ok && doc.FolderID != "" {
+			byID, err := loadFolders(db, doc.UserID)
+			if err != nil {
+				return nil, err
+			}
+			folders[doc.UserID] = byID
+		}
+		if doc.CompanyID != "" {
+			companyIDs = append(companyIDs, doc.CompanyID)
+		}
+	}
+	if len(companyIDs) > 0 {
+		var rows []models.Company
+		if err := db.Select("id", "chunk_strategy").Where("id IN ?", companyIDs).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, company := range rows {
+			companies[company.ID] = company.ChunkStrategy
+		}
+	}
+
+	resolved := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		strategy := ""
+		seen := map[string]bool{}
+		for id := doc.FolderID; id != "" && !seen[id] && strategy == ""; {
+			folder, ok := folders[doc.UserID][id]
+			if !ok {
+				break
+			}
+			seen[id] = true
+			strategy = folder.ChunkStrategy
+			id = folder.ParentID
+		}
+		if strategy == "" {
+			strategy = companies[doc.CompanyID]
+		}
+		resolved[doc.ID] = ChunkerFor(strategy, doc.FileType)
+	}
+	return resolved, nil
+}
+
+// ResolveChunkStrategy 文档生效的分块策略，规则见 ResolveChunkStrategies
+func ResolveChunkStrategy(db *gorm.DB, doc models.Document) (string, error) {
+	resolved, err := ResolveChunkStrategies(db, []models.Document{doc})
+	if err != nil {
+		return "", err
+	}
+	return resolved[doc.ID], nil
+}
+
+// Chunk 按指定策略切分解析结果，并在每个分块上记录所用策略；auto 或未知策略按 markdown 处理
+func (p *Processor) Chunk(extraction *Extraction, strategy string) []Chunk {
+	var chunks []Chunk
+	switch strategy {
+	case ChunkToken:
+		chunks = p.chunkByTokens(extraction)
+	case ChunkSentence:
+		chunks = p.chunkBySentences(extraction)
+	case ChunkTable:
+		chunks = p.chunkByTables(extraction)
+	default:
+		strategy = ChunkMarkdown
+		chunks = p.ChunkExtraction(extraction)
+	}
+	for i := range chunks {
+		chunks[i].Strategy = strategy
+	}
+	return chunks
+}
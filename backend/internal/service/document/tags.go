@@ -0,0 +1,128 @@
+package document
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+// TagMatchSQL 文档带有任一给定标签（作用于 documents 表的条件）
+const TagMatchSQL = "id IN (SELECT document_id FROM document_tags WHERE tag IN ?)"
+
+// TagCount 标签及带有该标签的文档数
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// NormalizeTags 去除标签首尾空白、空标签与重复标签，保持原有顺序
+func NormalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// metadataTags 读取元数据中的 tags
+func metadataTags(metadata models.JSON) []string {
+	var parsed struct {
+		Tags []string `json:"tags"`
+	}
+	if metadata != "" {
+		json.Unmarshal([]byte(metadata), &parsed)
+	}
+	return NormalizeTags(parsed.Tags)
+}
+
+// SetTags 替换文档标签，同时更新 DocumentTag 与元数据中的 tags
+func SetTags(db *gorm.DB, doc *models.Document, tags []string) error {
+	tags = NormalizeTags(tags)
+	metadata := map[string]interface{}{}
+	if doc.Metadata != "" {
+		json.Unmarshal([]byte(doc.Metadata), &metadata)
+	}
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["tags"] = tags
+	doc.Metadata = models.ToJSON(metadata)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := writeTags(tx, doc.ID, doc.UserID, tags); err != nil {
+			return err
+		}
+		return tx.Model(&models.Document{}).Where("id = ?", doc.ID).Updates(map[string]interface{}{
+			"metadata":   doc.Metadata,
+			"updated_at": time.Now(),
+		}).Error
+	})
+}
+
+func writeTags(tx *gorm.DB, documentID, userID string, tags []string) error {
+	if err := tx.Where("document_id = ?", documentID).Delete(&models.DocumentTag{}).Error; err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]models.DocumentTag, len(tags))
+	for i, tag := range tags {
+		rows[i] = models.DocumentTag{DocumentID: documentID, Tag: tag, UserID: userID}
+	}
+	return tx.Create(&rows).Error
+}
+
+// DeleteTags 删除文档的全部标签
+func DeleteTags(db *gorm.DB, documentIDs ...string) error {
+	if len(documentIDs) == 0 {
+		return nil
+	}
+	return db.Where("document_id IN ?", documentIDs).Delete(&models.DocumentTag{}).Error
+}
+
+// BackfillTags 把旧版本只保存在元数据中的标签写入 DocumentTag，返回处理的文档数
+func BackfillTags(db *gorm.DB) (int, error) {
+	var docs []models.Document
+	err := db.Select("id", "user_id", "metadata").
+		Where("metadata LIKE ?", `%"tags"%`).
+		Where("id NOT IN (SELECT document_id FROM document_tags)").
+		Find(&docs).Error
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, doc := range docs {
+		tags := metadataTags(doc.Metadata)
+		if len(tags) == 0 {
+			continue
+		}
+		if err := writeTags(db, doc.ID, doc.UserID, tags); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// ListTags 用户的全部标签及文档数（不含回收站中的文档），按文档数降序
+func ListTags(db *gorm.DB, userID string) ([]TagCount, error) {
+	counts := []TagCount{}
+	err := db.Table("document_tags").
+		Select("document_tags.tag AS tag, COUNT(*) AS count").
+		Joins("JOIN documents ON documents.id = document_tags.document_id").
+		Where("document_tags.user_id = ? AND documents.trashed_at IS NULL", userID).
+		Group("document_tags.tag").
+		Order("count DESC, tag ASC").
+		Scan(&counts).Error
+	return counts, err
+}
@@ -0,0 +1,150 @@
+package document
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+// ErrVersionNotFound 指定的版本不存在
+var ErrVersionNotFound = errors.New("document version not found")
+
+// HashFile 计算文件内容的 SHA-256
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// EnsureInitialVersion 为尚无版本记录的文档（版本功能上线前创建）补建当前版本
+func EnsureInitialVersion(db *gorm.DB, doc *models.Document) error {
+	var count int64
+	if err := db.Model(&models.DocumentVersion{}).Where("document_id = ?", doc.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if doc.ContentHash == "" && doc.FilePath != "" {
+		if hash, err := HashFile(doc.FilePath); err == nil {
+			doc.ContentHash = hash
+			db.Model(&models.Document{}).Where("id = ?", doc.ID).UpdateColumn("content_hash", hash)
+		}
+	}
+	if doc.Version <= 0 {
+		doc.Version = 1
+	}
+	return db.Create(&models.DocumentVersion{
+		ID:          models.NewUUID(),
+		DocumentID:  doc.ID,
+		Version:     doc.Version,
+		Name:        doc.Name,
+		FileType:    doc.FileType,
+		FileSize:    doc.FileSize,
+		FilePath:    doc.FilePath,
+		ContentHash: doc.ContentHash,
+		CreatedBy:   doc.UserID,
+		CreatedAt:   doc.CreatedAt,
+	}).Error
+}
+
+// AddVersion 追加新版本并把文档的文件字段指向该版本；version 的 DocumentID 与 Version 由此函数填写
+func AddVersion(db *gorm.DB, doc *models.Document, version models.DocumentVersion) (*models.DocumentVersion, error) {
+	if err := EnsureInitialVersion(db, doc); err != nil {
+		return nil, err
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.DocumentVersion{}).Where("document_id = ?", doc.ID).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		version.ID = models.NewUUID()
+		version.DocumentID = doc.ID
+		version.Version = latest + 1
+		if version.CreatedAt.IsZero() {
+			version.CreatedAt = time.Now()
+		}
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Document{}).Where("id = ?", doc.ID).Updates(map[string]interface{}{
+			"name":          version.Name,
+			"file_type":     version.FileType,
+			"file_size":     version.FileSize,
+			"file_path":     version.FilePath,
+			"content_hash":  version.ContentHash,
+			"version":       version.Version,
+			"error_message": "",
+			"updated_at":    version.CreatedAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc.Name = version.Name
+	doc.FileType = version.FileType
+	doc.FileSize = version.FileSize
+	doc.FilePath = version.FilePath
+	doc.ContentHash = version.ContentHash
+	doc.Version = version.Version
+	return &version, nil
+}
+
+// ListVersions 按版本号倒序列出文档的全部版本
+func ListVersions(db *gorm.DB, documentID string) ([]models.DocumentVersion, error) {
+	var versions []models.DocumentVersion
+	err := db.Where("document_id = ?", documentID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// GetVersion 获取文档的指定版本
+func GetVersion(db *gorm.DB, documentID string, version int) (*models.DocumentVersion, error) {
+	var v models.DocumentVersion
+	err := db.Where("document_id = ? AND version = ?", documentID, version).First(&v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// VersionFiles 返回文档全部版本引用的文件对象键（去重，包含当前文件）
+func VersionFiles(db *gorm.DB, doc models.Document) []string {
+	var paths []string
+	db.Model(&models.DocumentVersion{}).Where("document_id = ?", doc.ID).Distinct().Pluck("file_path", &paths)
+	seen := map[string]bool{}
+	out := make([]string, 0, len(paths)+1)
+	for _, p := range append(paths, doc.FilePath) {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// DeleteVersions 删除文档的全部版本记录
+func DeleteVersions(db *gorm.DB, documentIDs ...string) error {
+	if len(documentIDs) == 0 {
+		return nil
+	}
+	return db.Where("document_id IN ?", documentIDs).Delete(&models.DocumentVersion{}).Error
+}
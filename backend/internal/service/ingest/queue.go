@@ -0,0 +1,556 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/retrieval"
+	"rolecraft-ai/internal/service/search"
+	"rolecraft-ai/internal/service/storage"
+)
+
+// 持久化的文档入库队列：每个文档的处理记录为一条 IngestionJob，由固定数量的 worker 领取执行。
+// 阶段失败后按指数退避重试；执行中的任务定期续租，执行方退出（租约过期）后任务回到队列，从未完成的阶段继续。
+
+// 任务状态
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusRetrying  = "retrying"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled" // 被新任务取代（如上传了新版本）
+)
+
+// activeStatuses 未结束的任务状态，同一文档同时只能有一个
+var activeStatuses = []string{StatusQueued, StatusRunning, StatusRetrying}
+
+// ErrJobActive 文档已有未结束的入库任务
+var ErrJobActive = errors.New("document already has an active ingestion job")
+
+// SyncFunc 将文档同步到外部知识库，返回需合并到文档元数据的字段
+type SyncFunc func(ctx context.Context, doc models.Document) (map[string]interface{}, error)
+
+// Dependencies 各阶段使用的服务
+type Dependencies struct {
+	Processor *document.Processor
+	Retrieval *retrieval.Service
+	Index     *search.Index
+	Blobs     storage.BlobStore // 读取原文件，默认 ./uploads 下的本地存储
+	Sync      SyncFunc          // 为空时跳过同步阶段
+}
+
+// Config 队列配置，零值使用默认值
+type Config struct {
+	Workers      int           // 并发 worker 数，默认 2
+	MaxAttempts  int           // 最多失败次数，默认 5
+	BaseDelay    time.Duration // 首次重试延迟，之后每次翻倍，默认 5s
+	MaxDelay     time.Duration // 重试延迟上限，默认 5m
+	PollInterval time.Duration // 空闲时扫描到期任务的间隔，默认 2s
+	LeaseTimeout time.Duration // 执行中的任务超过该时间未续租即被重新领取，默认 2m；每 1/4 租期续租一次
+}
+
+func (c Config) withDefaults() Config {
+	if c.Workers <= 0 {
+		c.Workers = 2
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = 5 * time.Second
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = 5 * time.Minute
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = 2 * time.Second
+	}
+	if c.LeaseTimeout <= 0 {
+		c.LeaseTimeout = 2 * time.Minute
+	}
+	return c
+}
+
+// Queue 文档入库队列
+type Queue struct {
+	db        *gorm.DB
+	processor *document.Processor
+	retrieval *retrieval.Service
+	index     *search.Index
+	blobs     storage.BlobStore
+	sync      SyncFunc
+	cfg       Config
+
+	wake        chan struct{}
+	mu          sync.Mutex
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	busy        map[string]bool // 正在执行的文档，同一文档的任务不并发执行
+	lastReclaim time.Time
+}
+
+// NewQueue 创建入库队列，需调用 Start 启动 worker
+func NewQueue(db *gorm.DB, deps Dependencies, cfg Config) *Queue {
+	processor := deps.Processor
+	if processor == nil {
+		processor = document.NewProcessor(document.ProcessorConfig{})
+	}
+	index := deps.Index
+	if index == nil {
+		index = search.NewIndex(db)
+	}
+	svc := deps.Retrieval
+	if svc == nil {
+		svc = retrieval.NewService(db, index, retrieval.Config{})
+	}
+	blobs := deps.Blobs
+	if blobs == nil {
+		local, err := storage.NewLocalStore("./uploads")
+		if err != nil {
+			log.Printf("failed to open upload directory: %v", err)
+		} else {
+			blobs = local
+		}
+	}
+	return &Queue{
+		db:        db,
+		processor: processor,
+		retrieval: svc,
+		index:     index,
+		blobs:     blobs,
+		sync:      deps.Sync,
+		cfg:       cfg.withDefaults(),
+		wake:      make(chan struct{}, 1),
+		busy:      map[string]bool{},
+	}
+}
+
+// Start 恢复租约已过期的任务并启动 worker；重复调用无效
+func (q *Queue) Start(parent context.Context) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(parent)
+	q.cancel = cancel
+
+	if err := q.recover(); err != nil {
+		log.Printf("ingestion queue recovery failed: %v", err)
+	}
+	q.lastReclaim = time.Now()
+	for i := 0; i < q.cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+}
+
+// Stop 停止 worker 并等待执行中的阶段退出；被中断的任务回到队列
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	cancel := q.cancel
+	q.cancel = nil
+	q.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		q.wg.Wait()
+	}
+}
+
+// recover 把租约已过期的执行中任务放回队列，并为没有任务、仍处于处理中的文档补建任务。
+// 其他实例仍在执行（持续续租）的任务不受影响
+func (q *Queue) recover() error {
+	if _, err := q.reclaim(); err != nil {
+		return err
+	}
+
+	var orphans []models.Document
+	if err := q.db.Select("id", "user_id").
+		Where("status IN ?", []string{"pending", "processing"}).
+		Where("NOT EXISTS (SELECT 1 FROM ingestion_jobs j WHERE j.document_id = documents.id AND j.status IN ?)", activeStatuses).
+		Find(&orphans).Error; err != nil {
+		return err
+	}
+	for _, doc := range orphans {
+		if _, err := q.Enqueue(doc.ID, doc.UserID); err != nil && !errors.Is(err, ErrJobActive) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reclaim 把租约已过期的执行中任务放回队列，返回放回的任务数
+func (q *Queue) reclaim() (int64, error) {
+	now := time.Now()
+	result := q.db.Model(&models.IngestionJob{}).
+		Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", StatusRunning, now.Add(-q.cfg.LeaseTimeout)).
+		Updates(map[string]interface{}{"status": StatusQueued, "next_run_at": now, "heartbeat_at": nil, "updated_at": now})
+	return result.RowsAffected, result.Error
+}
+
+// reclaimDue 距上次回收超过半个租期时回收过期任务，使其他实例退出后遗留的任务无需重启即可继续
+func (q *Queue) reclaimDue() {
+	q.mu.Lock()
+	due := time.Since(q.lastReclaim) >= q.cfg.LeaseTimeout/2
+	if due {
+		q.lastReclaim = time.Now()
+	}
+	q.mu.Unlock()
+	if !due {
+		return
+	}
+	if n, err := q.reclaim(); err != nil {
+		log.Printf("ingestion queue reclaim failed: %v", err)
+	} else if n > 0 {
+		log.Printf("ingestion queue reclaimed %d jobs with expired leases", n)
+	}
+}
+
+// Enqueue 为文档创建入库任务并将文档置为处理中；已有未结束的任务时返回 ErrJobActive
+func (q *Queue) Enqueue(documentID, userID string) (*models.IngestionJob, error) {
+	return q.enqueue(documentID, userID, false, newStages())
+}
+
+// Restart 取消文档未结束的任务并重新入库，用于文件内容变化（如新版本）后；
+// 执行中的任务在当前阶段结束后停止，新任务待其退出后才会开始
+func (q *Queue) Restart(documentID, userID string) (*models.IngestionJob, error) {
+	return q.enqueue(documentID, userID, true, newStages())
+}
+
+// Rechunk 按文档当前生效的分块策略重新分块并向量化，不重建全文索引、不重新同步；
+// 已有未结束的任务时返回 ErrJobActive
+func (q *Queue) Rechunk(documentID, userID string) (*models.IngestionJob, error) {
+	return q.enqueue(documentID, userID, false, rechunkStages())
+}
+
+func (q *Queue) enqueue(documentID, userID string, supersede bool, stages []StageState) (*models.IngestionJob, error) {
+	now := time.Now()
+	job := &models.IngestionJob{
+		ID:          models.NewUUID(),
+		DocumentID:  documentID,
+		UserID:      userID,
+		Status:      StatusQueued,
+		Stage:       StageNames[0],
+		Stages:      models.ToJSON(stages),
+		MaxAttempts: q.cfg.MaxAttempts,
+		NextRunAt:   &now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if supersede {
+			if err := tx.Model(&models.IngestionJob{}).
+				Where("document_id = ? AND status IN ?", documentID, activeStatuses).
+				Updates(map[string]interface{}{
+					"status":      StatusCanceled,
+					"last_error":  "superseded by a newer job",
+					"finished_at": now,
+					"next_run_at": nil,
+					"updated_at":  now,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		var active int64
+		if err := tx.Model(&models.IngestionJob{}).
+			Where("document_id = ? AND status IN ?", documentID, activeStatuses).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrJobActive
+		}
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Document{}).Where("id = ?", documentID).Updates(map[string]interface{}{
+			"status":        "processing",
+			"error_message": "",
+			"updated_at":    now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// LatestJob 返回文档最近一次入库任务，没有时返回 nil
+func (q *Queue) LatestJob(documentID string) (*models.IngestionJob, error) {
+	var job models.IngestionJob
+	err := q.db.Where("document_id = ?", documentID).Order("created_at DESC").First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Remove 删除文档的全部入库任务；执行中的任务会在当前阶段结束后停止
+func (q *Queue) Remove(documentIDs ...string) error {
+	return DeleteJobs(q.db, documentIDs...)
+}
+
+// DeleteJobs 删除文档的入库任务，db 可以是调用方的事务
+func DeleteJobs(db *gorm.DB, documentIDs ...string) error {
+	if len(documentIDs) == 0 {
+		return nil
+	}
+	return db.Where("document_id IN ?", documentIDs).Delete(&models.IngestionJob{}).Error
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	defer q.wg.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		q.reclaimDue()
+		job, err := q.claim()
+		if err != nil {
+			log.Printf("ingestion queue claim failed: %v", err)
+		}
+		if job != nil {
+			q.execute(ctx, job)
+			q.release(job.DocumentID)
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(q.cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// claim 领取一个到期的任务，通过条件更新避免多个 worker 重复领取；领取后文档标记为执行中，需调用 release
+func (q *Queue) claim() (*models.IngestionJob, error) {
+	now := time.Now()
+	var candidates []models.IngestionJob
+	if err := q.db.Where("status IN ? AND (next_run_at IS NULL OR next_run_at <= ?)", []string{StatusQueued, StatusRetrying}, now).
+		Order("next_run_at ASC, created_at ASC").
+		Limit(10).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range candidates {
+		job := &candidates[i]
+		if q.busy[job.DocumentID] {
+			continue
+		}
+		updates := map[string]interface{}{"status": StatusRunning, "heartbeat_at": now, "updated_at": now}
+		if job.StartedAt == nil {
+			updates["started_at"] = now
+		}
+		result := q.db.Model(&models.IngestionJob{}).
+			Where("id = ? AND status = ?", job.ID, job.Status).
+			Updates(updates)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			q.busy[job.DocumentID] = true
+			job.Status = StatusRunning
+			if job.StartedAt == nil {
+				job.StartedAt = &now
+			}
+			return job, nil
+		}
+	}
+	return nil, nil
+}
+
+func (q *Queue) release(documentID string) {
+	q.mu.Lock()
+	delete(q.busy, documentID)
+	q.mu.Unlock()
+	q.notify()
+}
+
+// heartbeat 定期续租，直到 stop 关闭
+func (q *Queue) heartbeat(jobID string, stop <-chan struct{}) {
+	ticker := time.NewTicker(q.cfg.LeaseTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := q.db.Model(&models.IngestionJob{}).
+				Where("id = ? AND status = ?", jobID, StatusRunning).
+				Update("heartbeat_at", time.Now()).Error; err != nil {
+				log.Printf("ingestion job %s: failed to renew lease: %v", jobID, err)
+			}
+		}
+	}
+}
+
+// execute 依次执行未完成的阶段，执行期间持续续租
+func (q *Queue) execute(ctx context.Context, job *models.IngestionJob) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go q.heartbeat(job.ID, stop)
+
+	var doc models.Document
+	if err := q.db.First(&doc, "id = ?", job.DocumentID).Error; err != nil {
+		q.finish(job, nil, StatusFailed, "document not found")
+		return
+	}
+	r := &run{job: job, doc: doc, stages: Stages(job)}
+
+	for i := range r.stages {
+		stage := &r.stages[i]
+		if stage.done() {
+			continue
+		}
+		if ctx.Err() != nil {
+			q.save(job, r.stages, map[string]interface{}{"status": StatusQueued, "next_run_at": time.Now()})
+			return
+		}
+		started := time.Now()
+		stage.Status = StageRunning
+		stage.Attempts++
+		stage.Error = ""
+		stage.StartedAt = &started
+		stage.FinishedAt = nil
+		job.Stage = stage.Name
+		if !q.save(job, r.stages, nil) {
+			return // 任务已被删除
+		}
+
+		err := q.runStage(ctx, r, stage.Name)
+		finished := time.Now()
+		switch {
+		case err == nil:
+			stage.Status = StageCompleted
+		case errors.Is(err, errSkip):
+			stage.Status = StageSkipped
+		case ctx.Err() != nil:
+			// 服务停止：放回队列，不计入失败次数
+			stage.Status = StagePending
+			stage.Attempts--
+			stage.StartedAt = nil
+			q.save(job, r.stages, map[string]interface{}{"status": StatusQueued, "next_run_at": finished})
+			return
+		default:
+			stage.Status = StageFailed
+			stage.Error = err.Error()
+			stage.FinishedAt = &finished
+			q.fail(job, r.stages, stage.Name, err)
+			return
+		}
+		stage.FinishedAt = &finished
+		if !q.save(job, r.stages, nil) {
+			return
+		}
+	}
+	q.finish(job, r.stages, StatusCompleted, "")
+}
+
+// save 持久化阶段状态及额外字段，任务已被删除或取消时返回 false
+func (q *Queue) save(job *models.IngestionJob, stages []StageState, extra map[string]interface{}) bool {
+	updates := map[string]interface{}{
+		"stage":      job.Stage,
+		"stages":     models.ToJSON(stages),
+		"updated_at": time.Now(),
+	}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	result := q.db.Model(&models.IngestionJob{}).Where("id = ? AND status <> ?", job.ID, StatusCanceled).Updates(updates)
+	if result.Error != nil {
+		log.Printf("ingestion job %s: failed to save progress: %v", job.ID, result.Error)
+		return true
+	}
+	return result.RowsAffected > 0
+}
+
+// fail 记录阶段失败：可重试时按指数退避安排下次执行，否则任务与文档均标记为失败
+func (q *Queue) fail(job *models.IngestionJob, stages []StageState, stage string, err error) {
+	job.Attempts++
+	message := fmt.Sprintf("%s: %v", stage, err)
+	if IsPermanent(err) || job.Attempts >= job.MaxAttempts {
+		q.finish(job, stages, StatusFailed, message)
+		return
+	}
+	next := time.Now().Add(q.backoff(job.Attempts))
+	q.save(job, stages, map[string]interface{}{
+		"status":      StatusRetrying,
+		"attempts":    job.Attempts,
+		"last_error":  message,
+		"next_run_at": next,
+	})
+	log.Printf("ingestion job %s: %s, retrying at %s", job.ID, message, next.Format(time.RFC3339))
+}
+
+// backoff 第 attempt 次失败后的重试延迟
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.cfg.BaseDelay
+	for i := 1; i < attempt && delay < q.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, q.cfg.MaxDelay)
+}
+
+// finish 结束任务并同步文档状态
+func (q *Queue) finish(job *models.IngestionJob, stages []StageState, status, message string) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      status,
+		"attempts":    job.Attempts,
+		"finished_at": now,
+		"next_run_at": nil,
+	}
+	if message != "" {
+		updates["last_error"] = message
+	}
+	if stages == nil {
+		stages = Stages(job)
+	}
+	if !q.save(job, stages, updates) {
+		return
+	}
+
+	docStatus := "completed"
+	if status == StatusFailed {
+		docStatus = "failed"
+		log.Printf("ingestion job %s failed: %s", job.ID, message)
+	}
+	q.db.Model(&models.Document{}).Where("id = ?", job.DocumentID).Updates(map[string]interface{}{
+		"status":        docStatus,
+		"error_message": message,
+		"updated_at":    now,
+	})
+}
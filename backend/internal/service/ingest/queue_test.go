@@ -0,0 +1,251 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/storage"
+)
+
+func setupQueue(t *testing.T, deps Dependencies) (*gorm.DB, *Queue) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Document{}, &models.DocumentChunk{}, &models.IngestionJob{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if deps.Blobs == nil {
+		blobs, err := storage.NewLocalStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		deps.Blobs = blobs
+	}
+	q := NewQueue(db, deps, Config{BaseDelay: 10 * time.Millisecond, PollInterval: 10 * time.Millisecond, MaxAttempts: 3})
+	if err := q.index.Ensure(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(q.Stop)
+	return db, q
+}
+
+func createDocument(t *testing.T, q *Queue, id, content string) models.Document {
+	t.Helper()
+	key := id + ".md"
+	if content != "" {
+		if err := q.blobs.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), "text/markdown"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := models.Document{ID: id, UserID: "u1", Name: key, FileType: "md", FilePath: key, Status: "processing"}
+	if err := q.db.Create(&doc).Error; err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func waitJob(t *testing.T, q *Queue, documentID, status string) *models.IngestionJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.LatestJob(documentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job != nil && job.Status == status {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	job, _ := q.LatestJob(documentID)
+	t.Fatalf("job for %s did not reach %s: %+v", documentID, status, job)
+	return nil
+}
+
+func stageMap(job *models.IngestionJob) map[string]StageState {
+	out := map[string]StageState{}
+	for _, s := range Stages(job) {
+		out[s.Name] = s
+	}
+	return out
+}
+
+func TestQueueRunsStages(t *testing.T) {
+	db, q := setupQueue(t, Dependencies{})
+	doc := createDocument(t, q, "handbook", "# 员工手册\n\n总则说明。\n\n## 假期\n\n年假按工龄计算。\n")
+	if _, err := q.Enqueue(doc.ID, doc.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(doc.ID, doc.UserID); !errors.Is(err, ErrJobActive) {
+		t.Fatalf("expected ErrJobActive, got %v", err)
+	}
+	q.Start(context.Background())
+
+	job := waitJob(t, q, doc.ID, StatusCompleted)
+	stages := stageMap(job)
+	for name, want := range map[string]string{
+		StageExtract: StageCompleted,
+		StageChunk:   StageCompleted,
+		StageEmbed:   StageSkipped, // 未配置向量化服务
+		StageIndex:   StageCompleted,
+		StageSync:    StageSkipped, // 未配置 AnythingLLM
+	} {
+		if stages[name].Status != want {
+			t.Errorf("stage %s: got %s, want %s", name, stages[name].Status, want)
+		}
+	}
+	if Progress(job) != 100 || job.FinishedAt == nil {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	var stored models.Document
+	db.First(&stored, "id = ?", doc.ID)
+	if stored.Status != "completed" || stored.ChunkCount != 2 || stored.Metadata != `{"processingMode":"local"}` {
+		t.Fatalf("unexpected document: %+v", stored)
+	}
+}
+
+func TestQueueRetriesWithBackoff(t *testing.T) {
+	calls := 0
+	sync := func(ctx context.Context, doc models.Document) (map[string]interface{}, error) {
+		calls++
+		if calls < 3 {
+			return nil, errors.New("anythingllm unavailable")
+		}
+		return map[string]interface{}{"anythingLLMFileId": "f1"}, nil
+	}
+	_, q := setupQueue(t, Dependencies{Sync: sync})
+	doc := createDocument(t, q, "retry", "正文内容。")
+	if _, err := q.Enqueue(doc.ID, doc.UserID); err != nil {
+		t.Fatal(err)
+	}
+	q.Start(context.Background())
+
+	job := waitJob(t, q, doc.ID, StatusCompleted)
+	stages := stageMap(job)
+	if job.Attempts != 2 || stages[StageSync].Attempts != 3 {
+		t.Fatalf("expected two failed attempts before success, got job=%d sync=%d", job.Attempts, stages[StageSync].Attempts)
+	}
+	if stages[StageExtract].Attempts != 1 || stages[StageChunk].Attempts != 1 {
+		t.Fatalf("completed stages should not be re-run: %+v", stages)
+	}
+	if job.LastError != "sync: anythingllm unavailable" {
+		t.Fatalf("unexpected last error %q", job.LastError)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := &Queue{cfg: Config{BaseDelay: 10 * time.Millisecond, MaxDelay: 25 * time.Millisecond}.withDefaults()}
+	for attempt, want := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 25 * time.Millisecond, 10: 25 * time.Millisecond} {
+		if got := q.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestQueueFailures(t *testing.T) {
+	sync := func(ctx context.Context, doc models.Document) (map[string]interface{}, error) {
+		return nil, errors.New("connection refused")
+	}
+	db, q := setupQueue(t, Dependencies{Sync: sync})
+	missing := createDocument(t, q, "missing", "")
+	flaky := createDocument(t, q, "flaky", "正文内容。")
+	for _, doc := range []models.Document{missing, flaky} {
+		if _, err := q.Enqueue(doc.ID, doc.UserID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Start(context.Background())
+
+	// 文件缺失不可重试，直接失败
+	job := waitJob(t, q, missing.ID, StatusFailed)
+	if job.Attempts != 1 || job.Stage != StageExtract || Progress(job) != 0 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	var stored models.Document
+	db.First(&stored, "id = ?", missing.ID)
+	if stored.Status != "failed" || stored.ErrorMessage != "extract: file not found" {
+		t.Fatalf("unexpected document: %+v", stored)
+	}
+
+	// 可重试的错误达到上限后失败
+	job = waitJob(t, q, flaky.ID, StatusFailed)
+	if job.Attempts != 3 || stageMap(job)[StageSync].Status != StageFailed || Progress(job) != 80 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+}
+
+func TestQueueResumesAfterRestart(t *testing.T) {
+	db, q := setupQueue(t, Dependencies{})
+	interrupted := createDocument(t, q, "interrupted", "# 标题\n\n正文内容。\n")
+	orphan := createDocument(t, q, "orphan", "没有任务的文档。")
+
+	// 模拟进程在分块阶段退出：解析已完成，任务仍为 running
+	stages := newStages()
+	stages[0].Status, stages[0].Attempts = StageCompleted, 1
+	stages[1].Status, stages[1].Attempts = StageRunning, 1
+	job := models.IngestionJob{
+		ID: "job-1", DocumentID: interrupted.ID, UserID: "u1", Status: StatusRunning,
+		Stage: StageChunk, Stages: models.ToJSON(stages), MaxAttempts: 3,
+	}
+	if err := db.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	q.Start(context.Background())
+
+	resumed := waitJob(t, q, interrupted.ID, StatusCompleted)
+	if resumed.ID != "job-1" {
+		t.Fatalf("expected the interrupted job to resume, got %s", resumed.ID)
+	}
+	got := stageMap(resumed)
+	if got[StageExtract].Attempts != 1 || got[StageChunk].Attempts != 2 || got[StageIndex].Status != StageCompleted {
+		t.Fatalf("unexpected stages: %+v", got)
+	}
+	var chunks int64
+	db.Model(&models.DocumentChunk{}).Where("document_id = ?", interrupted.ID).Count(&chunks)
+	if chunks == 0 {
+		t.Fatalf("expected chunks after resume")
+	}
+
+	// 处理中但没有任务的文档会补建任务
+	waitJob(t, q, orphan.ID, StatusCompleted)
+}
+
+func TestQueueLeases(t *testing.T) {
+	db, q := setupQueue(t, Dependencies{})
+	q.cfg.LeaseTimeout = 200 * time.Millisecond
+	doc := createDocument(t, q, "leased", "# 标题\n\n正文内容。\n")
+
+	// 其他实例正在执行且仍在续租的任务不会被领取
+	now := time.Now()
+	job := models.IngestionJob{
+		ID: "job-leased", DocumentID: doc.ID, UserID: "u1", Status: StatusRunning,
+		Stage: StageExtract, Stages: models.ToJSON(newStages()), MaxAttempts: 3, HeartbeatAt: &now,
+	}
+	if err := db.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	q.Start(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	current, _ := q.LatestJob(doc.ID)
+	if current.Status != StatusRunning || stageMap(current)[StageExtract].Attempts != 0 {
+		t.Fatalf("job with a live lease should not be taken over: %+v", current)
+	}
+
+	// 租约过期后任务回到队列并由本实例完成
+	done := waitJob(t, q, doc.ID, StatusCompleted)
+	if done.ID != job.ID || stageMap(done)[StageExtract].Attempts != 1 {
+		t.Fatalf("expected the expired job to be resumed, got %+v", done)
+	}
+}
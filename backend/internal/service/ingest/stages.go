@@ -0,0 +1,257 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/storage"
+)
+
+// 入库阶段，按顺序执行
+const (
+	StageExtract = "extract" // 解析文件正文
+	StageChunk   = "chunk"   // 分块并持久化
+	StageEmbed   = "embed"   // 分块向量化
+	StageIndex   = "index"   // 写入全文检索索引
+	StageSync    = "sync"    // 同步到 AnythingLLM
+)
+
+// StageNames 阶段执行顺序
+var StageNames = []string{StageExtract, StageChunk, StageEmbed, StageIndex, StageSync}
+
+// 阶段状态
+const (
+	StagePending   = "pending"
+	StageRunning   = "running"
+	StageCompleted = "completed"
+	StageSkipped   = "skipped" // 不适用（如未配置向量化服务），视为完成
+	StageFailed    = "failed"
+)
+
+// StageState 单个阶段的执行状态
+type StageState struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+func (s StageState) done() bool {
+	return s.Status == StageCompleted || s.Status == StageSkipped
+}
+
+func newStages() []StageState {
+	stages := make([]StageState, len(StageNames))
+	for i, name := range StageNames {
+		stages[i] = StageState{Name: name, Status: StagePending}
+	}
+	return stages
+}
+
+// rechunkStages 重新分块只需解析、分块与向量化；全文索引与外部同步不受分块影响，直接跳过
+func rechunkStages() []StageState {
+	stages := newStages()
+	for i := range stages {
+		switch stages[i].Name {
+		case StageIndex, StageSync:
+			stages[i].Status = StageSkipped
+		}
+	}
+	return stages
+}
+
+// Stages 解析任务的阶段状态；缺失的阶段补为 pending
+func Stages(job *models.IngestionJob) []StageState {
+	stages := newStages()
+	if job == nil || job.Stages == "" {
+		return stages
+	}
+	var saved []StageState
+	if err := job.Stages.FromJSON(&saved); err != nil {
+		return stages
+	}
+	for i := range stages {
+		for _, s := range saved {
+			if s.Name == stages[i].Name {
+				stages[i] = s
+			}
+		}
+	}
+	return stages
+}
+
+// Progress 按已完成的阶段计算进度百分比，执行中的阶段计一半
+func Progress(job *models.IngestionJob) int {
+	if job == nil {
+		return 0
+	}
+	if job.Status == StatusCompleted {
+		return 100
+	}
+	stages := Stages(job)
+	done := 0.0
+	for _, s := range stages {
+		switch {
+		case s.done():
+			done++
+		case s.Status == StageRunning:
+			done += 0.5
+		}
+	}
+	return int(math.Round(done / float64(len(stages)) * 100))
+}
+
+// errSkip 阶段不适用于当前文档
+var errSkip = errors.New("stage skipped")
+
+// permanentError 重试也无法成功的错误（如文件缺失、格式损坏），直接判定失败
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记错误不可重试
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent 判断错误是否不可重试
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// run 单次执行的上下文；解析结果只在本次执行内缓存，恢复执行时由需要的阶段重新解析
+type run struct {
+	job        *models.IngestionJob
+	doc        models.Document
+	stages     []StageState
+	extraction *document.Extraction
+}
+
+func (r *run) stage(name string) StageState {
+	for _, s := range r.stages {
+		if s.Name == name {
+			return s
+		}
+	}
+	return StageState{Name: name}
+}
+
+// extract 读取并解析文件；旧版 Office 等无法解析的格式返回 errSkip
+func (r *run) extract(ctx context.Context, blobs storage.BlobStore) (*document.Extraction, error) {
+	if r.extraction != nil {
+		return r.extraction, nil
+	}
+	if r.doc.FilePath == "" || blobs == nil {
+		return nil, Permanent(fmt.Errorf("file not found"))
+	}
+	data, err := storage.ReadAll(ctx, blobs, r.doc.FilePath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			return nil, Permanent(fmt.Errorf("file not found"))
+		}
+		return nil, err
+	}
+	extraction, err := document.Extract(r.doc.FileType, data)
+	switch {
+	case errors.Is(err, document.ErrLegacyFormat), errors.Is(err, document.ErrUnsupportedType):
+		return nil, errSkip
+	case err != nil:
+		return nil, Permanent(err)
+	}
+	r.extraction = extraction
+	return extraction, nil
+}
+
+// runStage 执行单个阶段
+func (q *Queue) runStage(ctx context.Context, r *run, name string) error {
+	switch name {
+	case StageExtract:
+		_, err := r.extract(ctx, q.blobs)
+		return err
+
+	case StageChunk:
+		if r.stage(StageExtract).Status == StageSkipped {
+			return errSkip
+		}
+		extraction, err := r.extract(ctx, q.blobs)
+		if err != nil {
+			return err
+		}
+		strategy, err := document.ResolveChunkStrategy(q.db, r.doc)
+		if err != nil {
+			return err
+		}
+		_, err = q.retrieval.StoreChunks(ctx, r.doc.UserID, r.doc.ID, q.processor.Chunk(extraction, strategy))
+		return err
+
+	case StageEmbed:
+		if r.stage(StageChunk).Status == StageSkipped || !q.retrieval.Dense() {
+			return errSkip
+		}
+		return q.retrieval.EmbedDocument(ctx, r.doc.UserID, r.doc.ID)
+
+	case StageIndex:
+		if r.stage(StageExtract).Status == StageSkipped {
+			return errSkip
+		}
+		extraction, err := r.extract(ctx, q.blobs)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(extraction.Text) == "" {
+			return errSkip
+		}
+		return q.index.IndexDocumentText(r.doc.ID, extraction.Text)
+
+	case StageSync:
+		if q.sync == nil {
+			if err := q.mergeMetadata(r.doc.ID, map[string]interface{}{"processingMode": "local"}); err != nil {
+				return err
+			}
+			return errSkip
+		}
+		metadata, err := q.sync(ctx, r.doc)
+		if err != nil {
+			return err
+		}
+		return q.mergeMetadata(r.doc.ID, metadata)
+	}
+	return Permanent(fmt.Errorf("unknown stage %q", name))
+}
+
+// mergeMetadata 合并字段到文档元数据
+func (q *Queue) mergeMetadata(documentID string, values map[string]interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	var doc models.Document
+	if err := q.db.Select("id", "metadata").First(&doc, "id = ?", documentID).Error; err != nil {
+		return err
+	}
+	existing := map[string]interface{}{}
+	if doc.Metadata != "" {
+		json.Unmarshal([]byte(doc.Metadata), &existing)
+	}
+	if existing == nil {
+		existing = map[string]interface{}{}
+	}
+	for k, v := range values {
+		existing[k] = v
+	}
+	return q.db.Model(&models.Document{}).Where("id = ?", documentID).
+		UpdateColumn("metadata", models.ToJSON(existing)).Error
+}
@@ -0,0 +1,178 @@
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// TokensPerUnit 价格计量单位：每百万 Token
+const TokensPerUnit = 1000000
+
+// Price 单个模型的价格（每百万 Token）
+type Price struct {
+	Model     string  `json:"model"`
+	Input     float64 `json:"input"`     // 输入（prompt）
+	Output    float64 `json:"output"`    // 输出（completion）
+	Embedding float64 `json:"embedding"` // 向量化
+}
+
+// Cost 按输入 / 输出 / 向量化 Token 计算成本
+func (p Price) Cost(inputTokens, outputTokens, embeddingTokens int64) float64 {
+	return (float64(inputTokens)*p.Input +
+		float64(outputTokens)*p.Output +
+		float64(embeddingTokens)*p.Embedding) / TokensPerUnit
+}
+
+// Catalog 模型价格目录，支持按公司覆盖
+type Catalog struct {
+	Currency  string             `json:"currency"`
+	Default   Price              `json:"default"` // 未收录模型的价格
+	Models    []Price            `json:"models"`
+	Companies map[string][]Price `json:"companies,omitempty"` // companyId -> 覆盖价格
+}
+
+// DefaultCatalog 内置价格目录（按公开标价折算人民币，仅供估算）
+func DefaultCatalog() *Catalog {
+	return &Catalog{
+		Currency: "CNY",
+		Default:  Price{Model: "default", Input: 3.6, Output: 14.4, Embedding: 0.144},
+		Models: []Price{
+			{Model: "gpt-4o", Input: 18, Output: 72},
+			{Model: "gpt-4o-mini", Input: 1.08, Output: 4.32},
+			{Model: "gpt-4.1", Input: 14.4, Output: 57.6},
+			{Model: "gpt-4.1-mini", Input: 2.88, Output: 11.52},
+			{Model: "gpt-3.5-turbo", Input: 3.6, Output: 10.8},
+			{Model: "claude-3.5-sonnet", Input: 21.6, Output: 108},
+			{Model: "claude-sonnet-4", Input: 21.6, Output: 108},
+			{Model: "claude-3-haiku", Input: 1.8, Output: 9},
+			{Model: "gemini-2.5-pro", Input: 9, Output: 72},
+			{Model: "gemini-2.5-flash", Input: 2.16, Output: 18},
+			{Model: "gemini-3-flash-preview", Input: 3.6, Output: 21.6},
+			{Model: "deepseek-chat", Input: 2, Output: 8},
+			{Model: "deepseek-r1", Input: 4, Output: 16},
+			{Model: "text-embedding-3-small", Embedding: 0.144},
+			{Model: "text-embedding-3-large", Embedding: 0.936},
+			{Model: "text-embedding-ada-002", Embedding: 0.72},
+			{Model: "mock", Input: 0, Output: 0},
+		},
+	}
+}
+
+// LoadCatalog 从 JSON 文件加载价格目录，并合并到内置目录之上。
+// path 为空时返回内置目录。
+func LoadCatalog(path string) (*Catalog, error) {
+	catalog := DefaultCatalog()
+	if strings.TrimSpace(path) == "" {
+		return catalog, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing catalog: %w", err)
+	}
+	var override Catalog
+	if err := json.Unmarshal(data, &override); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing catalog: %w", err)
+	}
+
+	if strings.TrimSpace(override.Currency) != "" {
+		catalog.Currency = strings.TrimSpace(override.Currency)
+	}
+	if override.Default != (Price{}) {
+		catalog.Default = override.Default
+		catalog.Default.Model = "default"
+	}
+	catalog.Models = mergePrices(catalog.Models, override.Models)
+	if len(override.Companies) > 0 {
+		catalog.Companies = map[string][]Price{}
+		for companyID, prices := range override.Companies {
+			catalog.Companies[companyID] = mergePrices(nil, prices)
+		}
+	}
+	return catalog, nil
+}
+
+// Lookup 返回模型在指定公司下生效的价格
+// 匹配顺序：公司覆盖 > 全局目录；完整 ID > 去掉厂商前缀 > 最长前缀；均未命中时使用默认价格。
+func (c *Catalog) Lookup(companyID, model string) Price {
+	name := normalizeModel(model)
+	if strings.HasSuffix(name, ":free") {
+		return Price{Model: model}
+	}
+	if companyID != "" {
+		if price, ok := match(c.Companies[companyID], name); ok {
+			return price
+		}
+	}
+	if price, ok := match(c.Models, name); ok {
+		return price
+	}
+	return c.Default
+}
+
+// ForCompany 返回公司视角下的完整价格列表（已应用覆盖），按模型名排序
+func (c *Catalog) ForCompany(companyID string) []Price {
+	prices := mergePrices(nil, c.Models)
+	if companyID != "" {
+		prices = mergePrices(prices, c.Companies[companyID])
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Model < prices[j].Model })
+	return prices
+}
+
+func match(prices []Price, name string) (Price, bool) {
+	if name == "" || len(prices) == 0 {
+		return Price{}, false
+	}
+	short := name
+	if idx := strings.LastIndex(short, "/"); idx >= 0 {
+		short = short[idx+1:]
+	}
+
+	var best Price
+	bestLen := -1
+	for _, price := range prices {
+		key := normalizeModel(price.Model)
+		if key == name {
+			return price, true
+		}
+		keyShort := key
+		if idx := strings.LastIndex(keyShort, "/"); idx >= 0 {
+			keyShort = keyShort[idx+1:]
+		}
+		if keyShort == short {
+			return price, true
+		}
+		if strings.HasPrefix(short, keyShort) && len(keyShort) > bestLen {
+			best, bestLen = price, len(keyShort)
+		}
+	}
+	return best, bestLen > 0
+}
+
+func mergePrices(base, overrides []Price) []Price {
+	merged := make([]Price, 0, len(base)+len(overrides))
+	index := map[string]int{}
+	for _, list := range [][]Price{base, overrides} {
+		for _, price := range list {
+			key := normalizeModel(price.Model)
+			if key == "" {
+				continue
+			}
+			if idx, ok := index[key]; ok {
+				merged[idx] = price
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, price)
+		}
+	}
+	return merged
+}
+
+func normalizeModel(model string) string {
+	return strings.ToLower(strings.TrimSpace(model))
+}
@@ -0,0 +1,80 @@
+package pricing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	catalog := DefaultCatalog()
+
+	cases := map[string]float64{
+		"gpt-4o":                           18,
+		"openai/gpt-4o":                    18,
+		"openai/gpt-4o-mini":               1.08,
+		"gpt-4o-2024-08-06":                18,
+		"anthropic/claude-3.5-sonnet":      21.6,
+		"deepseek/deepseek-chat-v3.1:free": 0,
+		"mock-v1":                          0,
+		"some-unknown-model":               catalog.Default.Input,
+	}
+	for model, want := range cases {
+		if got := catalog.Lookup("", model).Input; got != want {
+			t.Fatalf("Lookup(%q).Input = %v, want %v", model, got, want)
+		}
+	}
+}
+
+func TestPriceCost(t *testing.T) {
+	price := Price{Input: 2, Output: 8, Embedding: 0.5}
+	if got := price.Cost(500000, 250000, 2000000); got != 4 {
+		t.Fatalf("Cost = %v, want 4", got)
+	}
+}
+
+func TestLoadCatalogMergesOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	content := `{
+		"currency": "USD",
+		"models": [{"model": "gpt-4o", "input": 2.5, "output": 10}, {"model": "my-model", "input": 1, "output": 2}],
+		"companies": {"c1": [{"model": "gpt-4o", "input": 1, "output": 4}]}
+	}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write catalog: %v", err)
+	}
+
+	catalog, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatalf("load catalog: %v", err)
+	}
+	if catalog.Currency != "USD" {
+		t.Fatalf("currency = %q", catalog.Currency)
+	}
+	if got := catalog.Lookup("", "gpt-4o").Input; got != 2.5 {
+		t.Fatalf("global override not applied: %v", got)
+	}
+	if got := catalog.Lookup("c1", "openai/gpt-4o").Input; got != 1 {
+		t.Fatalf("company override not applied: %v", got)
+	}
+	if got := catalog.Lookup("c2", "gpt-4o").Input; got != 2.5 {
+		t.Fatalf("other company should use global price: %v", got)
+	}
+	if got := catalog.Lookup("", "deepseek-chat").Input; got != 2 {
+		t.Fatalf("builtin price lost after merge: %v", got)
+	}
+
+	var found bool
+	for _, price := range catalog.ForCompany("c1") {
+		if price.Model == "gpt-4o" {
+			found = price.Input == 1
+		}
+	}
+	if !found {
+		t.Fatalf("ForCompany should apply company overrides")
+	}
+
+	if _, err := LoadCatalog(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
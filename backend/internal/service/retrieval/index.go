@@ -0,0 +1,222 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/vectorstore"
+)
+
+// embedBatchSize 单次向量化请求的分块数
+const embedBatchSize = 64
+
+// 向量化用途，记录在 EmbeddingUsage.Purpose
+const (
+	embedPurposeDocument = "document"
+	embedPurposeQuery    = "query"
+)
+
+// IndexDocument 替换文档的分块（全文索引由触发器同步），启用向量检索时同时重建分块向量。
+// 向量化失败时分块已保存，返回错误供调用方记录。
+func (s *Service) IndexDocument(ctx context.Context, userID, documentID string, chunks []document.Chunk) ([]models.DocumentChunk, error) {
+	records, err := s.StoreChunks(ctx, userID, documentID, chunks)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.EmbedDocument(ctx, userID, documentID); err != nil {
+		return records, err
+	}
+	return records, nil
+}
+
+// StoreChunks 替换文档的分块，并删除旧分块的向量
+func (s *Service) StoreChunks(ctx context.Context, userID, documentID string, chunks []document.Chunk) ([]models.DocumentChunk, error) {
+	var previous []string
+	if s.Dense() {
+		s.db.Model(&models.DocumentChunk{}).Where("document_id = ?", documentID).Pluck("id", &previous)
+	}
+	records, err := document.ReplaceChunks(s.db, documentID, chunks)
+	if err != nil {
+		return nil, err
+	}
+	s.removeVectors(ctx, map[string][]string{s.documentCollection(userID, documentID): previous})
+	return records, nil
+}
+
+// EmbedDocument 为文档当前的全部分块生成并写入向量（同 ID 覆盖写入，可重复执行）；未启用向量检索时不做任何事
+func (s *Service) EmbedDocument(ctx context.Context, userID, documentID string) error {
+	if !s.Dense() {
+		return nil
+	}
+	var records []models.DocumentChunk
+	if err := s.db.Where("document_id = ?", documentID).Order("ordinal ASC").Find(&records).Error; err != nil {
+		return err
+	}
+	companyID := s.documentCompany(documentID)
+	collection := vectorCollection(userID, companyID)
+	usage := models.EmbeddingUsage{UserID: userID, CompanyID: companyID, DocumentID: documentID, Purpose: embedPurposeDocument}
+	for start := 0; start < len(records); start += embedBatchSize {
+		batch := records[start:min(start+embedBatchSize, len(records))]
+		texts := make([]string, len(batch))
+		for i, record := range batch {
+			texts[i] = record.Content
+			if record.HeadingPath != "" {
+				texts[i] = record.HeadingPath + "\n" + record.Content
+			}
+		}
+		vectors, err := s.embed(ctx, usage, texts)
+		if err != nil {
+			return fmt.Errorf("failed to embed chunks: %w", err)
+		}
+		if len(vectors) != len(batch) {
+			return fmt.Errorf("failed to embed chunks: expected %d vectors, got %d", len(batch), len(vectors))
+		}
+		for i, record := range batch {
+			metadata := map[string]interface{}{"documentId": documentID, "ordinal": record.Ordinal}
+			if err := s.vectors.Insert(ctx, collection, record.ID, vectors[i], metadata); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// embed 向量化文本；Embedder 报告用量时按 usage 中的归属记录 Token 用量，记录失败不影响向量化结果
+func (s *Service) embed(ctx context.Context, usage models.EmbeddingUsage, texts []string) ([][]float32, error) {
+	metered, ok := s.embedder.(UsageEmbedder)
+	if !ok {
+		return s.embedder.EmbedBatch(ctx, texts)
+	}
+	vectors, reported, err := metered.EmbedBatchUsage(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if reported.Tokens > 0 {
+		usage.ID = models.NewUUID()
+		usage.ModelID = reported.Model
+		usage.Tokens = reported.Tokens
+		if err := s.db.Create(&usage).Error; err != nil {
+			log.Printf("failed to record embedding usage: %v", err)
+		}
+	}
+	return vectors, nil
+}
+
+// RemoveDocuments 删除文档的分块及其向量
+func (s *Service) RemoveDocuments(ctx context.Context, userID string, documentIDs ...string) error {
+	if len(documentIDs) == 0 {
+		return nil
+	}
+	vectors := s.DocumentVectors(userID, documentIDs...)
+	if err := document.DeleteChunks(s.db, documentIDs...); err != nil {
+		return err
+	}
+	s.removeVectors(ctx, vectors)
+	return nil
+}
+
+// DocumentVectors 文档分块的向量 ID，按集合分组；须在删除文档记录前读取（公司文档的集合由文档记录决定），
+// 供调用方在自己的事务中删除分块后用 RemoveVectors 清理。未启用向量检索时返回 nil
+func (s *Service) DocumentVectors(userID string, documentIDs ...string) map[string][]string {
+	if !s.Dense() || len(documentIDs) == 0 {
+		return nil
+	}
+	return s.chunkVectors(userID, documentIDs)
+}
+
+// RemoveVectors 删除 DocumentVectors 返回的向量
+func (s *Service) RemoveVectors(ctx context.Context, vectors map[string][]string) {
+	s.removeVectors(ctx, vectors)
+}
+
+// removeVectors 删除向量，键为集合名
+func (s *Service) removeVectors(ctx context.Context, vectors map[string][]string) {
+	if !s.Dense() {
+		return
+	}
+	for collection, chunkIDs := range vectors {
+		for _, id := range chunkIDs {
+			s.vectors.Delete(ctx, collection, id)
+		}
+	}
+}
+
+// vectorCollection 归属公司的文档向量写入公司集合，供公司成员共同检索；其余写入上传者的集合
+func vectorCollection(userID, companyID string) string {
+	if companyID != "" {
+		return vectorstore.CompanyCollection(companyID)
+	}
+	return vectorstore.UserCollection(userID)
+}
+
+// documentCollection 文档向量所在的集合
+func (s *Service) documentCollection(userID, documentID string) string {
+	return vectorCollection(userID, s.documentCompany(documentID))
+}
+
+// documentCompany 文档所属的公司，个人文档或文档不存在时为空
+func (s *Service) documentCompany(documentID string) string {
+	var companyIDs []string
+	s.db.Model(&models.Document{}).Where("id = ?", documentID).Limit(1).Pluck("company_id", &companyIDs)
+	if len(companyIDs) == 0 {
+		return ""
+	}
+	return companyIDs[0]
+}
+
+// chunkVectors 文档分块的向量 ID，按所在集合分组
+func (s *Service) chunkVectors(userID string, documentIDs []string) map[string][]string {
+	var rows []struct {
+		ID        string
+		CompanyID string
+	}
+	s.db.Table("document_chunks AS c").
+		Select("c.id, COALESCE(d.company_id, '') AS company_id").
+		Joins("LEFT JOIN documents d ON d.id = c.document_id").
+		Where("c.document_id IN ?", documentIDs).
+		Scan(&rows)
+	vectors := map[string][]string{}
+	for _, row := range rows {
+		collection := vectorCollection(userID, row.CompanyID)
+		vectors[collection] = append(vectors[collection], row.ID)
+	}
+	return vectors
+}
+
+// MoveCompanyVectors 把旧版本写入上传者集合的公司文档向量移到公司集合，返回移动的向量数；
+// 需在打开向量库之前执行
+func MoveCompanyVectors(db *gorm.DB) (int64, error) {
+	var rows []struct {
+		ID        string
+		CompanyID string
+	}
+	err := db.Table("document_chunks AS c").
+		Select("c.id, d.company_id").
+		Joins("JOIN documents d ON d.id = c.document_id").
+		Where("d.company_id <> ''").
+		Where("c.id IN (SELECT ref_id FROM vector_records WHERE collection LIKE ?)", vectorstore.UserCollection("")+"%").
+		Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+	byCompany := map[string][]string{}
+	for _, row := range rows {
+		byCompany[row.CompanyID] = append(byCompany[row.CompanyID], row.ID)
+	}
+	var moved int64
+	for companyID, ids := range byCompany {
+		result := db.Model(&models.VectorRecord{}).
+			Where("collection LIKE ? AND ref_id IN ?", vectorstore.UserCollection("")+"%", ids).
+			Update("collection", vectorstore.CompanyCollection(companyID))
+		if result.Error != nil {
+			return moved, result.Error
+		}
+		moved += result.RowsAffected
+	}
+	return moved, nil
+}
@@ -0,0 +1,117 @@
+package retrieval
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/service/search"
+)
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// keywordSearch 关键词召回：优先用 FTS5 BM25；FTS5 不可用或查询含短词（如中文双字词）时，
+// 用 LIKE 预筛候选分块后在内存中按 BM25 打分（文档频率基于候选集合统计）
+func (s *Service) keywordSearch(userID string, terms []string, scope *gorm.DB, limit int) ([]ranked, error) {
+	if s.index != nil {
+		matches, err := s.index.MatchChunks(userID, terms, scope, limit)
+		if err == nil {
+			list := make([]ranked, len(matches))
+			for i, m := range matches {
+				list[i] = ranked{chunkID: m.ChunkID, score: m.Score}
+			}
+			return list, nil
+		}
+		if !errors.Is(err, search.ErrNoMatch) {
+			return nil, err
+		}
+	}
+	return s.scanSearch(terms, scope, limit)
+}
+
+// maxScanCandidates LIKE 预筛后参与打分的分块上限
+const maxScanCandidates = 2000
+
+func (s *Service) scanSearch(terms []string, scope *gorm.DB, limit int) ([]ranked, error) {
+	conds := make([]string, len(terms))
+	args := make([]interface{}, 0, len(terms)*3)
+	for i, term := range terms {
+		conds[i] = `(c.content LIKE ? ESCAPE '\' OR c.heading_path LIKE ? ESCAPE '\' OR d.name LIKE ? ESCAPE '\')`
+		pattern := "%" + escapeLike(term) + "%"
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	var candidates []chunkRow
+	err := s.chunkQuery().
+		Where("c.document_id IN (?)", scope).
+		Where(strings.Join(conds, " OR "), args...).
+		Order("d.updated_at DESC").Limit(maxScanCandidates).
+		Scan(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// 统计词频、文档频率与平均长度；文档名与标题路径一并计入
+	tf := make([][]int, len(candidates))
+	lengths := make([]float64, len(candidates))
+	df := make([]int, len(terms))
+	total := 0.0
+	for i, c := range candidates {
+		text := strings.ToLower(c.DocumentName + "\n" + c.HeadingPath + "\n" + c.Content)
+		tf[i] = make([]int, len(terms))
+		for j, term := range terms {
+			if n := strings.Count(text, term); n > 0 {
+				tf[i][j] = n
+				df[j]++
+			}
+		}
+		lengths[i] = float64(utf8.RuneCountInString(text))
+		total += lengths[i]
+	}
+	n := float64(len(candidates))
+	avg := math.Max(total/n, 1)
+
+	list := make([]ranked, 0, len(candidates))
+	for i, c := range candidates {
+		score := 0.0
+		for j := range terms {
+			if tf[i][j] == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[j])+0.5)/(float64(df[j])+0.5))
+			freq := float64(tf[i][j])
+			score += idf * freq * (bm25K1 + 1) / (freq + bm25K1*(1-bm25B+bm25B*lengths[i]/avg))
+		}
+		if score > 0 {
+			list = append(list, ranked{chunkID: c.ID, score: math.Round(score*1e4) / 1e4})
+		}
+	}
+	order := make(map[string]int, len(candidates))
+	for _, c := range candidates {
+		order[c.ID] = c.Ordinal
+	}
+	sort.SliceStable(list, func(a, b int) bool {
+		if list[a].score != list[b].score {
+			return list[a].score > list[b].score
+		}
+		return order[list[a].chunkID] < order[list[b].chunkID]
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(term)
+}
@@ -0,0 +1,119 @@
+package retrieval
+
+import (
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/document"
+)
+
+// 知识来源绑定类型
+const (
+	BindingFolder   = "folder"   // 文件夹（含子文件夹）
+	BindingDocument = "document" // 指定文档
+	BindingTag      = "tag"      // 带有该标签的文档
+	BindingCompany  = "company"  // 公司知识库（归属该公司的文档）
+)
+
+// BindingTypes 支持的绑定类型
+var BindingTypes = []string{BindingFolder, BindingDocument, BindingTag, BindingCompany}
+
+// Scope 多个知识来源的并集：文档属于任一文件夹（含子文件夹）、是任一指定文档、
+// 带任一标签或归属任一公司即在范围内
+type Scope struct {
+	FolderIDs   []string
+	DocumentIDs []string
+	Tags        []string
+	CompanyIDs  []string
+}
+
+// Empty 没有任何来源
+func (s *Scope) Empty() bool {
+	return s == nil || len(s.FolderIDs)+len(s.DocumentIDs)+len(s.Tags)+len(s.CompanyIDs) == 0
+}
+
+// ScopeFromBindings 由角色的知识绑定构建检索范围，没有有效绑定时返回 nil
+func ScopeFromBindings(bindings []models.RoleKnowledgeBinding) *Scope {
+	scope := &Scope{}
+	for _, b := range bindings {
+		if b.Target == "" {
+			continue
+		}
+		switch b.Type {
+		case BindingFolder:
+			scope.FolderIDs = append(scope.FolderIDs, b.Target)
+		case BindingDocument:
+			scope.DocumentIDs = append(scope.DocumentIDs, b.Target)
+		case BindingTag:
+			scope.Tags = append(scope.Tags, b.Target)
+		case BindingCompany:
+			scope.CompanyIDs = append(scope.CompanyIDs, b.Target)
+		}
+	}
+	if scope.Empty() {
+		return nil
+	}
+	return scope
+}
+
+// RoleBindings 按创建顺序读取角色的知识绑定
+func RoleBindings(db *gorm.DB, roleID string) ([]models.RoleKnowledgeBinding, error) {
+	bindings := []models.RoleKnowledgeBinding{}
+	if roleID == "" {
+		return bindings, nil
+	}
+	err := db.Where("role_id = ?", roleID).Order("created_at ASC").Find(&bindings).Error
+	return bindings, err
+}
+
+// RoleScope 角色知识绑定对应的检索范围，角色没有绑定时返回 nil
+func RoleScope(db *gorm.DB, roleID string) (*Scope, error) {
+	bindings, err := RoleBindings(db, roleID)
+	if err != nil {
+		return nil, err
+	}
+	return ScopeFromBindings(bindings), nil
+}
+
+// memberCompanies 范围中用户所属的公司
+func (s *Scope) memberCompanies(db *gorm.DB, userID string) []string {
+	if s == nil {
+		return nil
+	}
+	return document.MemberCompanyIDs(db, userID, s.CompanyIDs)
+}
+
+// condition 范围对应的查询条件；范围为空时不匹配任何文档
+func (s *Scope) condition(db *gorm.DB, userID string) *gorm.DB {
+	cond := db.Where("1 = 0")
+	if s == nil {
+		return cond
+	}
+	if len(s.FolderIDs) > 0 {
+		var folders []string
+		seen := map[string]bool{}
+		for _, id := range s.FolderIDs {
+			subtree, err := document.FolderSubtree(db, userID, id)
+			if err != nil {
+				subtree = []string{id}
+			}
+			for _, f := range subtree {
+				if !seen[f] {
+					seen[f] = true
+					folders = append(folders, f)
+				}
+			}
+		}
+		cond = cond.Or("folder_id IN ?", folders)
+	}
+	if len(s.DocumentIDs) > 0 {
+		cond = cond.Or("id IN ?", s.DocumentIDs)
+	}
+	if len(s.Tags) > 0 {
+		cond = cond.Or(document.TagMatchSQL, s.Tags)
+	}
+	if len(s.CompanyIDs) > 0 {
+		cond = cond.Or("company_id IN ?", s.CompanyIDs)
+	}
+	return cond
+}
@@ -0,0 +1,424 @@
+package retrieval
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/ai"
+	"rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/search"
+	"rolecraft-ai/internal/service/vectorstore"
+)
+
+// 混合检索：关键词（FTS5 BM25，不可用时退化为 LIKE 预筛 + 内存 BM25）与向量检索分别召回分块，
+// 再按倒数排名融合（RRF）合并。未配置向量化服务时仅使用关键词检索。
+
+const (
+	// rrfK 倒数排名融合的平滑常数
+	rrfK = 60
+	// minCandidates 每路召回的最少候选数
+	minCandidates = 50
+	// maxDenseCandidates 向量召回时每个集合最多取出的候选数
+	maxDenseCandidates = 2000
+
+	defaultLimit       = 20
+	maxLimit           = 100
+	defaultPerDocument = 3
+)
+
+// Embedder 文本向量化，ai.EmbeddingClient 实现了该接口
+type Embedder interface {
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// UsageEmbedder 能返回 Token 用量的 Embedder（ai.EmbeddingClient 实现了该接口），其用量写入 EmbeddingUsage 供成本统计
+type UsageEmbedder interface {
+	EmbedBatchUsage(ctx context.Context, texts []string) ([][]float32, ai.EmbeddingUsage, error)
+}
+
+// Config 向量检索配置，任一为空时只做关键词检索
+type Config struct {
+	Embedder Embedder
+	Vectors  ai.VectorStore
+}
+
+// DenseConfig 按 OpenAI Key 构建向量检索配置，向量写入共享的内置向量库；Key 为空时返回空配置
+func DenseConfig(db *gorm.DB, apiKey string) Config {
+	if strings.TrimSpace(apiKey) == "" {
+		return Config{}
+	}
+	store, err := vectorstore.Shared(db)
+	if err != nil {
+		log.Printf("vector store unavailable, falling back to keyword retrieval: %v", err)
+		return Config{}
+	}
+	return Config{
+		Embedder: ai.NewEmbeddingClient(ai.EmbeddingConfig{APIKey: strings.TrimSpace(apiKey)}),
+		Vectors:  store,
+	}
+}
+
+// Filters 检索范围过滤，空值表示不限
+type Filters struct {
+	FolderID          string
+	IncludeSubfolders bool // FolderID 非空时同时检索其子文件夹
+	FileType          string
+	CompanyID         string
+	Tags              []string // 命中任一标签即可
+	Sources           *Scope   // 非空时只检索其中任一来源的文档（如角色绑定的知识库）
+}
+
+// Request 检索请求
+type Request struct {
+	UserID      string
+	Query       string
+	Filters     Filters
+	Limit       int // 返回的分块数，默认 20，最多 100
+	PerDocument int // 按文档分组时每个文档保留的分块数，默认 3
+}
+
+// Hit 分块命中结果
+type Hit struct {
+	ChunkID      string  `json:"chunkId"`
+	DocumentID   string  `json:"documentId"`
+	DocumentName string  `json:"documentName"`
+	FileType     string  `json:"fileType"`
+	FolderID     string  `json:"folderId"`
+	Ordinal      int     `json:"ordinal"`
+	Content      string  `json:"content"`
+	HeadingPath  string  `json:"headingPath"`
+	Page         int     `json:"page,omitempty"`
+	Sheet        string  `json:"sheet,omitempty"`
+	StartOffset  int     `json:"startOffset"`
+	EndOffset    int     `json:"endOffset"`
+	Score        float64 `json:"score"`                  // RRF 融合分，越大越相关
+	KeywordRank  int     `json:"keywordRank,omitempty"`  // 关键词结果中的名次（从 1 开始），0 表示未命中
+	KeywordScore float64 `json:"keywordScore,omitempty"` // BM25
+	VectorRank   int     `json:"vectorRank,omitempty"`
+	VectorScore  float64 `json:"vectorScore,omitempty"` // 余弦相似度
+	Snippet      string  `json:"snippet"`               // 命中位置附近的高亮片段，已转义的 HTML 片段
+}
+
+// Passage 转为带编号的提示词片段
+func (h Hit) Passage(marker int) document.Passage {
+	return document.Passage{
+		Marker:       marker,
+		ChunkID:      h.ChunkID,
+		DocumentID:   h.DocumentID,
+		DocumentName: h.DocumentName,
+		Content:      h.Content,
+		HeadingPath:  h.HeadingPath,
+		Page:         h.Page,
+		Sheet:        h.Sheet,
+		StartOffset:  h.StartOffset,
+		EndOffset:    h.EndOffset,
+		Score:        h.Score,
+	}
+}
+
+// DocumentHits 同一文档的命中分块
+type DocumentHits struct {
+	DocumentID   string  `json:"documentId"`
+	DocumentName string  `json:"documentName"`
+	FileType     string  `json:"fileType"`
+	FolderID     string  `json:"folderId"`
+	Score        float64 `json:"score"` // 文档内最佳分块的融合分
+	Chunks       []Hit   `json:"chunks"`
+}
+
+// Result 检索结果
+type Result struct {
+	Chunks      []Hit          `json:"chunks"`    // 按融合分排序
+	Documents   []DocumentHits `json:"documents"` // 按文档分组，顺序同最佳分块
+	KeywordHits int            `json:"keywordHits"`
+	VectorHits  int            `json:"vectorHits"`
+}
+
+// Service 分块检索服务
+type Service struct {
+	db       *gorm.DB
+	index    *search.Index
+	embedder Embedder
+	vectors  ai.VectorStore
+}
+
+// NewService 创建检索服务
+func NewService(db *gorm.DB, index *search.Index, cfg Config) *Service {
+	return &Service{db: db, index: index, embedder: cfg.Embedder, vectors: cfg.Vectors}
+}
+
+// Dense 返回是否启用了向量检索
+func (s *Service) Dense() bool {
+	return s.embedder != nil && s.vectors != nil
+}
+
+// ranked 单路召回结果中的一项
+type ranked struct {
+	chunkID string
+	score   float64
+}
+
+// Search 混合检索分块并按文档分组
+func (s *Service) Search(ctx context.Context, req Request) (*Result, error) {
+	result := &Result{Chunks: []Hit{}, Documents: []DocumentHits{}}
+	terms := document.QueryTerms(req.Query)
+	if len(terms) == 0 {
+		return result, nil
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	candidates := max(limit*4, minCandidates)
+	scope := s.documentScope(req.UserID, req.Filters)
+
+	keyword, err := s.keywordSearch(req.UserID, terms, scope, candidates)
+	if err != nil {
+		return nil, err
+	}
+	var dense []ranked
+	if s.Dense() {
+		// 向量检索失败不影响关键词结果
+		if dense, err = s.denseSearch(ctx, req.UserID, req.Query, scope, candidates); err != nil {
+			log.Printf("dense retrieval failed: %v", err)
+		}
+	}
+	result.KeywordHits, result.VectorHits = len(keyword), len(dense)
+
+	// 倒数排名融合
+	hits := map[string]*Hit{}
+	var order []string
+	merge := func(list []ranked, apply func(h *Hit, rank int, score float64)) {
+		for i, item := range list {
+			h := hits[item.chunkID]
+			if h == nil {
+				h = &Hit{ChunkID: item.chunkID}
+				hits[item.chunkID] = h
+				order = append(order, item.chunkID)
+			}
+			h.Score += 1.0 / float64(rrfK+i+1)
+			apply(h, i+1, item.score)
+		}
+	}
+	merge(keyword, func(h *Hit, rank int, score float64) { h.KeywordRank, h.KeywordScore = rank, score })
+	merge(dense, func(h *Hit, rank int, score float64) { h.VectorRank, h.VectorScore = rank, score })
+	if len(order) == 0 {
+		return result, nil
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		ha, hb := hits[order[a]], hits[order[b]]
+		if ha.Score != hb.Score {
+			return ha.Score > hb.Score
+		}
+		return ha.KeywordScore > hb.KeywordScore
+	})
+	if len(order) > limit {
+		order = order[:limit]
+	}
+
+	rows, err := s.loadChunks(order, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range order {
+		row, ok := rows[id]
+		if !ok {
+			continue // 检索期间被删除
+		}
+		h := hits[id]
+		row.fill(h)
+		h.Snippet = search.Snippet(h.Content, terms)
+		result.Chunks = append(result.Chunks, *h)
+	}
+	result.Documents = groupByDocument(result.Chunks, req.PerDocument)
+	return result, nil
+}
+
+// groupByDocument 按文档分组，文档顺序取其最佳分块的名次
+func groupByDocument(chunks []Hit, perDocument int) []DocumentHits {
+	if perDocument <= 0 {
+		perDocument = defaultPerDocument
+	}
+	groups := []DocumentHits{}
+	index := map[string]int{}
+	for _, h := range chunks {
+		i, ok := index[h.DocumentID]
+		if !ok {
+			i = len(groups)
+			index[h.DocumentID] = i
+			groups = append(groups, DocumentHits{
+				DocumentID:   h.DocumentID,
+				DocumentName: h.DocumentName,
+				FileType:     h.FileType,
+				FolderID:     h.FolderID,
+				Score:        h.Score,
+			})
+		}
+		if len(groups[i].Chunks) < perDocument {
+			groups[i].Chunks = append(groups[i].Chunks, h)
+		}
+	}
+	return groups
+}
+
+// documentScope 返回检索范围内文档 ID 的子查询（不含回收站中的文档）
+func (s *Service) documentScope(userID string, f Filters) *gorm.DB {
+	q := s.db.Model(&models.Document{}).Select("id").
+		Where("status = ? AND trashed_at IS NULL", "completed")
+	// 绑定的公司知识库包含公司内其他成员上传的文档，前提是用户属于该公司
+	if companies := f.Sources.memberCompanies(s.db, userID); len(companies) > 0 {
+		q = q.Where("(user_id = ? OR company_id IN ?)", userID, companies)
+	} else {
+		q = q.Where("user_id = ?", userID)
+	}
+	switch {
+	case f.FolderID != "" && f.IncludeSubfolders:
+		folders, err := document.FolderSubtree(s.db, userID, f.FolderID)
+		if err != nil {
+			folders = []string{f.FolderID}
+		}
+		q = q.Where("folder_id IN ?", folders)
+	case f.FolderID != "":
+		q = q.Where("folder_id = ?", f.FolderID)
+	}
+	if f.FileType != "" {
+		q = q.Where("LOWER(file_type) = ?", strings.ToLower(strings.TrimPrefix(f.FileType, ".")))
+	}
+	if f.CompanyID != "" {
+		q = q.Where("company_id = ?", f.CompanyID)
+	}
+	if len(f.Tags) > 0 {
+		q = q.Where(document.TagMatchSQL, f.Tags)
+	}
+	if f.Sources != nil {
+		q = q.Where(f.Sources.condition(s.db, userID))
+	}
+	return q
+}
+
+// Documents 返回范围内最近更新的已完成文档，用于没有命中分块时列出可参考的文档
+func (s *Service) Documents(userID string, f Filters, limit int) ([]models.Document, error) {
+	var docs []models.Document
+	err := s.db.Where("id IN (?)", s.documentScope(userID, f)).
+		Order("updated_at DESC").Limit(limit).Find(&docs).Error
+	return docs, err
+}
+
+// chunkRow 分块及其所属文档的字段
+type chunkRow struct {
+	ID           string
+	DocumentID   string
+	DocumentName string
+	FileType     string
+	FolderID     string
+	Ordinal      int
+	Content      string
+	HeadingPath  string
+	Page         int
+	Sheet        string
+	StartOffset  int
+	EndOffset    int
+}
+
+func (r chunkRow) fill(h *Hit) {
+	h.DocumentID = r.DocumentID
+	h.DocumentName = r.DocumentName
+	h.FileType = r.FileType
+	h.FolderID = r.FolderID
+	h.Ordinal = r.Ordinal
+	h.Content = r.Content
+	h.HeadingPath = r.HeadingPath
+	h.Page = r.Page
+	h.Sheet = r.Sheet
+	h.StartOffset = r.StartOffset
+	h.EndOffset = r.EndOffset
+}
+
+func (s *Service) chunkQuery() *gorm.DB {
+	return s.db.Table("document_chunks AS c").
+		Select("c.id, c.document_id, d.name AS document_name, d.file_type, d.folder_id, c.ordinal, c.content, c.heading_path, c.page, c.sheet, c.start_offset, c.end_offset").
+		Joins("JOIN documents d ON d.id = c.document_id")
+}
+
+// loadChunks 按 ID 读取分块，scope 非空时只保留范围内的文档
+func (s *Service) loadChunks(ids []string, scope *gorm.DB) (map[string]chunkRow, error) {
+	rows := map[string]chunkRow{}
+	if len(ids) == 0 {
+		return rows, nil
+	}
+	q := s.chunkQuery().Where("c.id IN ?", ids)
+	if scope != nil {
+		q = q.Where("c.document_id IN (?)", scope)
+	}
+	var list []chunkRow
+	if err := q.Scan(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range list {
+		rows[row.ID] = row
+	}
+	return rows, nil
+}
+
+// denseSearch 向量召回：在用户集合及范围内文档所属公司的集合中检索，合并后按范围过滤。
+// 向量库不支持按范围过滤，范围较窄时全局最相近的向量可能都在范围外，因此逐步扩大每个集合的召回数，
+// 直到范围内的命中达到 limit、集合已全部取出或达到 maxDenseCandidates。
+func (s *Service) denseSearch(ctx context.Context, userID, query string, scope *gorm.DB, limit int) ([]ranked, error) {
+	vectors, err := s.embed(ctx, models.EmbeddingUsage{UserID: userID, Purpose: embedPurposeQuery}, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) == 0 {
+		return nil, nil
+	}
+	collections := []string{vectorstore.UserCollection(userID)}
+	var companies []string
+	s.db.Model(&models.Document{}).Distinct("company_id").
+		Where("id IN (?) AND company_id <> ''", scope).Pluck("company_id", &companies)
+	for _, companyID := range companies {
+		collections = append(collections, vectorstore.CompanyCollection(companyID))
+	}
+
+	for fetch := limit; ; fetch *= 4 {
+		fetch = min(fetch, maxDenseCandidates)
+		var results []ai.SearchResult
+		exhausted := true
+		for _, collection := range collections {
+			found, err := s.vectors.Search(ctx, collection, vectors[0], fetch)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) >= fetch {
+				exhausted = false
+			}
+			results = append(results, found...)
+		}
+		sort.SliceStable(results, func(a, b int) bool { return results[a].Score > results[b].Score })
+		ids := make([]string, len(results))
+		for i, r := range results {
+			ids[i] = r.ID
+		}
+		rows, err := s.loadChunks(ids, scope)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]ranked, 0, min(len(rows), limit))
+		for _, r := range results {
+			if _, ok := rows[r.ID]; ok && len(list) < limit {
+				list = append(list, ranked{chunkID: r.ID, score: float64(r.Score)})
+			}
+		}
+		if len(list) >= limit || exhausted || fetch >= maxDenseCandidates {
+			return list, nil
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/ai"
+	"rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/search"
+	"rolecraft-ai/internal/service/vectorstore"
+)
+
+// topicEmbedder 按主题词生成向量，近义词落在同一维度，用于模拟语义召回
+type topicEmbedder struct{ calls int }
+
+var topics = [][]string{
+	{"假期", "年假", "休假", "vacation", "holiday"},
+	{"报销", "发票", "expense"},
+	{"vpn", "网络"},
+}
+
+func (e *topicEmbedder) EmbedBatch(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		text = strings.ToLower(text)
+		vector := make([]float32, len(topics)+1)
+		vector[len(topics)] = 0.05
+		for dim, words := range topics {
+			for _, word := range words {
+				if strings.Contains(text, word) {
+					vector[dim] = 1
+				}
+			}
+		}
+		out[i] = vector
+	}
+	return out, nil
+}
+
+// meteredEmbedder 在 topicEmbedder 基础上按字符数报告 Token 用量
+type meteredEmbedder struct{ topicEmbedder }
+
+func (e *meteredEmbedder) EmbedBatchUsage(ctx context.Context, texts []string) ([][]float32, ai.EmbeddingUsage, error) {
+	vectors, err := e.EmbedBatch(ctx, texts)
+	usage := ai.EmbeddingUsage{Model: "text-embedding-3-small"}
+	for _, text := range texts {
+		usage.Tokens += len(text)
+	}
+	return vectors, usage, err
+}
+
+func setupService(t *testing.T, dense bool) (*gorm.DB, *Service) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Document{}, &models.DocumentChunk{}, &models.VectorRecord{}, &models.Folder{}, &models.DocumentTag{}, &models.Company{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	index := search.NewIndex(db)
+	if err := index.Ensure(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{}
+	if dense {
+		store, err := vectorstore.Open(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg = Config{Embedder: &topicEmbedder{}, Vectors: store}
+	}
+	return db, NewService(db, index, cfg)
+}
+
+func addDocument(t *testing.T, db *gorm.DB, s *Service, doc models.Document, contents ...string) {
+	t.Helper()
+	doc.Status = "completed"
+	if err := db.Create(&doc).Error; err != nil {
+		t.Fatal(err)
+	}
+	chunks := make([]document.Chunk, len(contents))
+	for i, content := range contents {
+		chunks[i] = document.Chunk{Content: content}
+	}
+	if _, err := s.IndexDocument(context.Background(), doc.UserID, doc.ID, chunks); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func chunkDocs(hits []Hit) []string {
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.DocumentID
+	}
+	return ids
+}
+
+func TestSearchKeywordWithFilters(t *testing.T) {
+	db, s := setupService(t, false)
+	ctx := context.Background()
+	addDocument(t, db, s, models.Document{ID: "handbook", UserID: "u1", Name: "员工手册.md", FileType: "md", FolderID: "hr",
+		Metadata: models.JSON(`{"tags":["制度"]}`)},
+		"年假按工龄计算，满一年享有 5 天年假。", "报销需在 30 天内提交。", "年假可以拆分使用。")
+	if _, err := document.BackfillTags(db); err != nil {
+		t.Fatal(err)
+	}
+	addDocument(t, db, s, models.Document{ID: "it", UserID: "u1", Name: "IT 指南.pdf", FileType: "pdf", FolderID: "it", CompanyID: "acme"},
+		"VPN 账号由 IT 部门开通，年假期间同样可用。")
+	addDocument(t, db, s, models.Document{ID: "other", UserID: "u2", Name: "他人.md", FileType: "md"}, "年假 15 天。")
+	db.Create(&[]models.Folder{{ID: "ops", UserID: "u1"}, {ID: "it", UserID: "u1", ParentID: "ops"}, {ID: "hr", UserID: "u1"}})
+
+	result, err := s.Search(ctx, Request{UserID: "u1", Query: "年假怎么计算", PerDocument: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkDocs(result.Chunks); len(got) != 3 || got[0] != "handbook" {
+		t.Fatalf("unexpected chunk ranking: %v", got)
+	}
+	if len(result.Documents) != 2 || result.Documents[0].DocumentID != "handbook" || len(result.Documents[0].Chunks) != 1 {
+		t.Fatalf("unexpected grouping: %+v", result.Documents)
+	}
+	top := result.Chunks[0]
+	if top.KeywordRank != 1 || top.VectorRank != 0 || top.DocumentName != "员工手册.md" || !strings.Contains(top.Snippet, "<mark>年假</mark>") {
+		t.Fatalf("unexpected top hit: %+v", top)
+	}
+	if result.VectorHits != 0 {
+		t.Fatalf("dense retrieval should be disabled")
+	}
+
+	cases := []struct {
+		name    string
+		filters Filters
+		want    string
+	}{
+		{"folder", Filters{FolderID: "it"}, "it"},
+		{"subfolders", Filters{FolderID: "ops", IncludeSubfolders: true}, "it"},
+		{"type", Filters{FileType: ".PDF"}, "it"},
+		{"company", Filters{CompanyID: "acme"}, "it"},
+		{"tags", Filters{Tags: []string{"制度", "不存在"}}, "handbook"},
+		{"source folder", Filters{Sources: &Scope{FolderIDs: []string{"ops"}}}, "it"},
+		{"source tag", Filters{Sources: &Scope{Tags: []string{"制度"}}}, "handbook"},
+	}
+	for _, tc := range cases {
+		result, err := s.Search(ctx, Request{UserID: "u1", Query: "年假", Filters: tc.filters})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Documents) != 1 || result.Documents[0].DocumentID != tc.want {
+			t.Errorf("%s filter: got %+v", tc.name, result.Documents)
+		}
+	}
+
+	// 多个知识来源取并集，空范围不匹配任何文档
+	sources := ScopeFromBindings([]models.RoleKnowledgeBinding{
+		{Type: BindingDocument, Target: "handbook"},
+		{Type: BindingCompany, Target: "acme"},
+		{Type: BindingDocument, Target: "other"},
+	})
+	result, err = s.Search(ctx, Request{UserID: "u1", Query: "年假", Filters: Filters{Sources: sources}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Documents) != 2 {
+		t.Fatalf("expected union of sources, got %+v", result.Documents)
+	}
+	if docs, err := s.Documents("u1", Filters{Sources: &Scope{}}, 8); err != nil || len(docs) != 0 {
+		t.Fatalf("empty scope should match nothing, got %v %v", docs, err)
+	}
+	if ScopeFromBindings(nil) != nil {
+		t.Fatal("expected nil scope without bindings")
+	}
+
+	// 回收站中的文档不参与检索
+	db.Model(&models.Document{}).Where("id = ?", "handbook").Update("trashed_at", time.Now())
+	result, err = s.Search(ctx, Request{UserID: "u1", Query: "年假"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Documents) != 1 || result.Documents[0].DocumentID != "it" {
+		t.Fatalf("trashed document should be excluded, got %+v", result.Documents)
+	}
+
+	// 文档名同样参与关键词匹配
+	result, err = s.Search(ctx, Request{UserID: "u1", Query: "guide 指南"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Documents) != 1 || result.Documents[0].DocumentID != "it" {
+		t.Fatalf("expected name match, got %+v", result.Documents)
+	}
+}
+
+func TestSearchCompanySources(t *testing.T) {
+	db, s := setupService(t, false)
+	ctx := context.Background()
+	db.Create(&models.Company{ID: "acme", OwnerID: "u1", Name: "Acme"})
+	addDocument(t, db, s, models.Document{ID: "shared", UserID: "u2", Name: "公司制度.md", CompanyID: "acme"}, "年假按工龄计算。")
+	addDocument(t, db, s, models.Document{ID: "private", UserID: "u2", Name: "私人.md"}, "年假 15 天。")
+
+	// 公司知识库包含公司内其他成员上传的文档，但不含其私人文档
+	sources := &Scope{CompanyIDs: []string{"acme"}}
+	result, err := s.Search(ctx, Request{UserID: "u1", Query: "年假", Filters: Filters{Sources: sources}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkDocs(result.Chunks); len(got) != 1 || got[0] != "shared" {
+		t.Fatalf("expected company document, got %v", got)
+	}
+	if docs, err := s.Documents("u1", Filters{Sources: sources}, 8); err != nil || len(docs) != 1 || docs[0].ID != "shared" {
+		t.Fatalf("expected company document in scope, got %v %v", docs, err)
+	}
+
+	// 不属于该公司的用户绑定同一公司时只能检索自己的文档
+	result, err = s.Search(ctx, Request{UserID: "u3", Query: "年假", Filters: Filters{Sources: sources}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Chunks) != 0 {
+		t.Fatalf("non-member should not see company documents, got %v", chunkDocs(result.Chunks))
+	}
+}
+
+func TestDenseSearchCompanyCollection(t *testing.T) {
+	db, s := setupService(t, true)
+	ctx := context.Background()
+	db.Create(&models.Company{ID: "acme", OwnerID: "u1", Name: "Acme"})
+	addDocument(t, db, s, models.Document{ID: "policy", UserID: "u2", Name: "policy.md", CompanyID: "acme"},
+		"Vacation days accrue monthly.")
+	addDocument(t, db, s, models.Document{ID: "notes", UserID: "u1", Name: "notes.md"}, "Holiday plans.")
+
+	// 公司文档的向量写入公司集合
+	store := s.vectors.(*vectorstore.Store)
+	if got := store.Count(vectorstore.CompanyCollection("acme")); got != 1 {
+		t.Fatalf("expected company vector, got %d", got)
+	}
+	if got := store.Count(vectorstore.UserCollection("u2")); got != 0 {
+		t.Fatalf("company vectors should not be in the uploader collection, got %d", got)
+	}
+
+	// "holiday" 只能通过向量召回公司文档
+	result, err := s.Search(ctx, Request{UserID: "u1", Query: "holiday", Filters: Filters{Sources: &Scope{CompanyIDs: []string{"acme"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkDocs(result.Chunks); len(got) != 1 || got[0] != "policy" || result.Chunks[0].VectorRank == 0 {
+		t.Fatalf("expected company document from dense retrieval, got %+v", result.Chunks)
+	}
+
+	if err := s.RemoveDocuments(ctx, "u2", "policy"); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Count(vectorstore.CompanyCollection("acme")); got != 0 {
+		t.Fatalf("expected company vectors to be removed, got %d", got)
+	}
+}
+
+func TestDenseSearchNarrowScope(t *testing.T) {
+	db, s := setupService(t, true)
+	// 范围外有大量比目标更相近的向量，超出单次召回数
+	contents := make([]string, 120)
+	for i := range contents {
+		contents[i] = fmt.Sprintf("Holiday note %d.", i)
+	}
+	addDocument(t, db, s, models.Document{ID: "notes", UserID: "u1", Name: "notes.md", FolderID: "misc"}, contents...)
+	addDocument(t, db, s, models.Document{ID: "policy", UserID: "u1", Name: "policy.md", FolderID: "hr"},
+		"Vacation and expense rules.")
+
+	result, err := s.Search(context.Background(), Request{UserID: "u1", Query: "holiday", Limit: 5, Filters: Filters{FolderID: "hr"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkDocs(result.Chunks); len(got) != 1 || got[0] != "policy" || result.Chunks[0].VectorRank != 1 {
+		t.Fatalf("expected in-scope document from dense retrieval, got %+v", result.Chunks)
+	}
+}
+
+func TestEmbeddingUsageRecorded(t *testing.T) {
+	db, s := setupService(t, true)
+	if err := db.AutoMigrate(&models.EmbeddingUsage{}); err != nil {
+		t.Fatal(err)
+	}
+	s.embedder = &meteredEmbedder{}
+	addDocument(t, db, s, models.Document{ID: "policy", UserID: "u2", Name: "policy.md", CompanyID: "acme"}, "Vacation days.")
+	if _, err := s.Search(context.Background(), Request{UserID: "u1", Query: "holiday"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var usages []models.EmbeddingUsage
+	db.Order("purpose").Find(&usages)
+	if len(usages) != 2 {
+		t.Fatalf("expected document and query usage, got %+v", usages)
+	}
+	doc, query := usages[0], usages[1]
+	if doc.Purpose != embedPurposeDocument || doc.UserID != "u2" || doc.CompanyID != "acme" || doc.DocumentID != "policy" ||
+		doc.ModelID != "text-embedding-3-small" || doc.Tokens != len("Vacation days.") {
+		t.Fatalf("unexpected document usage: %+v", doc)
+	}
+	if query.Purpose != embedPurposeQuery || query.UserID != "u1" || query.Tokens != len("holiday") {
+		t.Fatalf("unexpected query usage: %+v", query)
+	}
+}
+
+func TestMoveCompanyVectors(t *testing.T) {
+	db, _ := setupService(t, false)
+	db.Create(&models.Document{ID: "policy", UserID: "u1", CompanyID: "acme"})
+	db.Create(&models.Document{ID: "notes", UserID: "u1"})
+	db.Create(&[]models.DocumentChunk{{ID: "c1", DocumentID: "policy"}, {ID: "c2", DocumentID: "notes"}})
+	db.Create(&[]models.VectorRecord{
+		{Collection: vectorstore.UserCollection("u1"), RefID: "c1", Dim: 1, Vector: []byte{0, 0, 128, 63}},
+		{Collection: vectorstore.UserCollection("u1"), RefID: "c2", Dim: 1, Vector: []byte{0, 0, 128, 63}},
+	})
+
+	moved, err := MoveCompanyVectors(db)
+	if err != nil || moved != 1 {
+		t.Fatalf("expected 1 moved vector, got %d %v", moved, err)
+	}
+	var collections []string
+	db.Model(&models.VectorRecord{}).Order("ref_id").Pluck("collection", &collections)
+	if len(collections) != 2 || collections[0] != vectorstore.CompanyCollection("acme") || collections[1] != vectorstore.UserCollection("u1") {
+		t.Fatalf("unexpected collections: %v", collections)
+	}
+	if moved, _ := MoveCompanyVectors(db); moved != 0 {
+		t.Fatalf("migration should be idempotent, moved %d", moved)
+	}
+}
+
+func TestSearchFusesKeywordAndVectorResults(t *testing.T) {
+	db, s := setupService(t, true)
+	ctx := context.Background()
+	addDocument(t, db, s, models.Document{ID: "policy", UserID: "u1", Name: "policy.md"},
+		"Vacation days accrue monthly.", "Expense reports are due within 30 days.")
+	addDocument(t, db, s, models.Document{ID: "faq", UserID: "u1", Name: "faq.md"},
+		"Holiday requests go through the portal.", "Holiday schedule for the office.")
+
+	// "holiday" 仅在 faq 中出现；policy 的休假分块只能通过向量召回
+	result, err := s.Search(ctx, Request{UserID: "u1", Query: "holiday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.KeywordHits != 2 || result.VectorHits == 0 {
+		t.Fatalf("expected both channels to contribute, got keyword=%d vector=%d", result.KeywordHits, result.VectorHits)
+	}
+	var vacation *Hit
+	for i, h := range result.Chunks {
+		if strings.HasPrefix(h.Content, "Vacation") {
+			vacation = &result.Chunks[i]
+		}
+	}
+	if vacation == nil || vacation.KeywordRank != 0 || vacation.VectorRank == 0 {
+		t.Fatalf("expected vacation chunk from dense retrieval only, got %+v", result.Chunks)
+	}
+	top := result.Chunks[0]
+	if top.DocumentID != "faq" || top.KeywordRank == 0 || top.VectorRank == 0 {
+		t.Fatalf("expected chunk found by both channels first, got %+v", top)
+	}
+	if top.Score <= vacation.Score {
+		t.Fatalf("fused score should reward agreement: %v <= %v", top.Score, vacation.Score)
+	}
+
+	// 重新分块替换旧向量，删除文档同时删除向量
+	store := s.vectors.(*vectorstore.Store)
+	collection := vectorstore.UserCollection("u1")
+	if got := store.Count(collection); got != 4 {
+		t.Fatalf("expected 4 vectors, got %d", got)
+	}
+	if _, err := s.IndexDocument(ctx, "u1", "faq", []document.Chunk{{Content: "Holiday requests only."}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Count(collection); got != 3 {
+		t.Fatalf("expected stale vectors to be replaced, got %d", got)
+	}
+	if err := s.RemoveDocuments(ctx, "u1", "policy", "faq"); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Count(collection); got != 0 {
+		t.Fatalf("expected vectors to be removed, got %d", got)
+	}
+	var chunks int64
+	db.Model(&models.DocumentChunk{}).Count(&chunks)
+	if chunks != 0 {
+		t.Fatalf("expected chunks to be removed, got %d", chunks)
+	}
+}
@@ -0,0 +1,682 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 全文检索索引由两张表组成：
+//   - search_entries：普通表，记录每条索引的来源（消息 / 会话标题与概要 / 文档 / 文档分块）及用于过滤的元数据；
+//   - search_index：以 search_entries.id 为 rowid 的 FTS5 表（trigram 分词，兼容中文），存放标题与正文。
+// 消息、会话、文档、分块的增删改通过触发器同步；文档正文需提取后由 IndexDocumentText 写入。
+// 分块以"文档名 + 标题路径"为标题，正文为分块内容。
+// SQLite 未编译 FTS5（缺少 sqlite_fts5 构建标签）时，search_index 退化为普通表并使用 LIKE 匹配；
+// 之后以支持 FTS5 的构建启动时，普通表自动转换为 FTS5 表。
+
+const (
+	KindMessage  = "message"
+	KindSession  = "session"
+	KindDocument = "document"
+	KindChunk    = "chunk"
+)
+
+// trigram 分词至少需要 3 个字符，更短的词改用 LIKE 匹配
+const minMatchRunes = 3
+
+// 高亮结果（Hit.Title、Hit.Snippet 及 Highlight、Snippet 的返回值）是 HTML 片段：原文已做 HTML 转义，
+// 只有 <mark></mark> 是标记，客户端可直接按 HTML 渲染
+const (
+	highlightOpen  = "<mark>"
+	highlightClose = "</mark>"
+	snippetRunes   = 80
+)
+
+// FTS5 的 highlight()/snippet() 不会转义原文，先用私用区字符占位，转义后再替换为 <mark>
+const (
+	matchOpen  = "\ue000"
+	matchClose = "\ue001"
+)
+
+var matchMarkup = strings.NewReplacer(matchOpen, highlightOpen, matchClose, highlightClose)
+
+// markup 转义 FTS5 返回的文本，并把占位符替换为高亮标记
+func markup(text string) string {
+	return matchMarkup.Replace(html.EscapeString(text))
+}
+
+// Options 检索条件
+type Options struct {
+	UserID   string
+	Query    string
+	Kinds    []string   // 为空时检索全部来源
+	Role     string     // 仅匹配该角色的消息
+	From     *time.Time // 创建时间下限（含）
+	To       *time.Time // 创建时间上限（不含）
+	Archived *bool      // 按会话归档状态过滤，nil 表示不限
+	Limit    int
+}
+
+// Hit 单条命中结果
+type Hit struct {
+	Kind      string    `json:"kind"`
+	RefID     string    `json:"refId"`
+	SessionID string    `json:"sessionId,omitempty"`
+	MessageID string    `json:"messageId,omitempty"` // 消息锚点，用于定位到会话中的具体消息
+	Role      string    `json:"role,omitempty"`
+	Title     string    `json:"title,omitempty"`   // 高亮后的标题（HTML 片段）
+	Snippet   string    `json:"snippet,omitempty"` // 高亮后的片段（HTML 片段）
+	Score     float64   `json:"score"`             // 越大越相关
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Index 全文检索索引
+type Index struct {
+	db *gorm.DB
+
+	once    sync.Once
+	err     error
+	fts     bool
+	indexed map[string]bool // 已建立同步触发器的表
+	mu      sync.Mutex
+}
+
+// NewIndex 创建全文检索索引，表与触发器在首次使用时建立
+func NewIndex(db *gorm.DB) *Index {
+	return &Index{db: db, indexed: map[string]bool{}}
+}
+
+// Ensure 建立索引表、同步触发器，并在首次建表时回填已有数据
+func (i *Index) Ensure() error {
+	i.once.Do(func() {
+		i.err = i.setup()
+	})
+	if i.err != nil {
+		return i.err
+	}
+	// 来源表可能晚于索引创建（如测试中按需迁移），每次补建缺失的触发器
+	return i.ensureTriggers()
+}
+
+// FTS 返回是否启用了 FTS5
+func (i *Index) FTS() bool {
+	_ = i.Ensure()
+	return i.fts
+}
+
+func (i *Index) setup() error {
+	var existing string
+	i.db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'search_index'").Scan(&existing)
+	created := existing == ""
+
+	if err := i.db.Exec(`CREATE TABLE IF NOT EXISTS search_entries (
+		id INTEGER PRIMARY KEY,
+		kind TEXT NOT NULL,
+		ref_id TEXT NOT NULL,
+		session_id TEXT NOT NULL DEFAULT '',
+		owner_id TEXT NOT NULL DEFAULT '',
+		role TEXT NOT NULL DEFAULT '',
+		created_at DATETIME,
+		UNIQUE(kind, ref_id)
+	)`).Error; err != nil {
+		return fmt.Errorf("failed to create search entries: %w", err)
+	}
+	for _, stmt := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_search_entries_owner ON search_entries(owner_id, kind, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_search_entries_session ON search_entries(session_id)",
+	} {
+		if err := i.db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to create search entries index: %w", err)
+		}
+	}
+
+	if created {
+		// 探测 FTS5 是否可用，失败属预期情况，不输出错误日志
+		probe := i.db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+		err := probe.Exec("CREATE VIRTUAL TABLE search_index USING fts5(" + ftsColumns + ")").Error
+		if err == nil {
+			i.fts = true
+		} else if err := i.db.Exec("CREATE TABLE search_index (id INTEGER PRIMARY KEY, title TEXT NOT NULL DEFAULT '', body TEXT NOT NULL DEFAULT '')").Error; err != nil {
+			return fmt.Errorf("failed to create search index: %w", err)
+		}
+	} else {
+		i.fts = strings.Contains(strings.ToLower(existing), "fts5")
+		if !i.fts {
+			upgraded, err := i.upgradeToFTS()
+			if err != nil {
+				return err
+			}
+			i.fts = upgraded
+		}
+	}
+
+	if err := i.ensureTriggers(); err != nil {
+		return err
+	}
+	if created {
+		return i.Rebuild()
+	}
+	return nil
+}
+
+// ftsColumns FTS5 索引表的列定义
+const ftsColumns = "title, body, tokenize = 'trigram'"
+
+// upgradeToFTS 未启用 FTS5 时建立的普通索引表在 FTS5 可用后重建为 FTS5 表，返回是否已转换。
+// 已索引的内容原样迁移（文档提取的正文只保存在索引中，Rebuild 无法恢复）。
+func (i *Index) upgradeToFTS() (bool, error) {
+	probe := i.db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	if err := probe.Exec("CREATE VIRTUAL TABLE temp.search_index_probe USING fts5(body)").Error; err != nil {
+		return false, nil
+	}
+	if err := i.db.Exec("DROP TABLE temp.search_index_probe").Error; err != nil {
+		return false, fmt.Errorf("failed to probe fts5: %w", err)
+	}
+	err := i.db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			"CREATE TEMP TABLE search_index_plain AS SELECT id, title, body FROM search_index",
+			"DROP TABLE search_index",
+			"CREATE VIRTUAL TABLE search_index USING fts5(" + ftsColumns + ")",
+			"INSERT INTO search_index (rowid, title, body) SELECT id, title, body FROM temp.search_index_plain",
+			"DROP TABLE temp.search_index_plain",
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to upgrade search index to fts5: %w", err)
+	}
+	return true, nil
+}
+
+// triggers 各来源表的同步触发器
+var triggers = map[string][]string{
+	"messages": {
+		`CREATE TRIGGER search_messages_ai AFTER INSERT ON messages BEGIN
+			INSERT OR IGNORE INTO search_entries (kind, ref_id, session_id, owner_id, role, created_at)
+			VALUES ('message', new.id, COALESCE(new.session_id, ''),
+				COALESCE((SELECT user_id FROM chat_sessions WHERE id = new.session_id), ''),
+				COALESCE(new.role, ''), new.created_at);
+			INSERT OR REPLACE INTO search_index (rowid, title, body)
+			VALUES ((SELECT id FROM search_entries WHERE kind = 'message' AND ref_id = new.id), '', COALESCE(new.content, ''));
+		END`,
+		`CREATE TRIGGER search_messages_au AFTER UPDATE OF content, role ON messages BEGIN
+			UPDATE search_entries SET role = COALESCE(new.role, '') WHERE kind = 'message' AND ref_id = new.id;
+			UPDATE search_index SET body = COALESCE(new.content, '')
+			WHERE rowid = (SELECT id FROM search_entries WHERE kind = 'message' AND ref_id = new.id);
+		END`,
+		`CREATE TRIGGER search_messages_ad AFTER DELETE ON messages BEGIN
+			DELETE FROM search_index WHERE rowid = (SELECT id FROM search_entries WHERE kind = 'message' AND ref_id = old.id);
+			DELETE FROM search_entries WHERE kind = 'message' AND ref_id = old.id;
+		END`,
+	},
+	"chat_sessions": {
+		`CREATE TRIGGER search_sessions_ai AFTER INSERT ON chat_sessions BEGIN
+			INSERT OR IGNORE INTO search_entries (kind, ref_id, session_id, owner_id, created_at)
+			VALUES ('session', new.id, new.id, COALESCE(new.user_id, ''), new.created_at);
+			INSERT OR REPLACE INTO search_index (rowid, title, body)
+			VALUES ((SELECT id FROM search_entries WHERE kind = 'session' AND ref_id = new.id), COALESCE(new.title, ''), COALESCE(new.summary, ''));
+		END`,
+		`CREATE TRIGGER search_sessions_au AFTER UPDATE OF title, summary ON chat_sessions BEGIN
+			UPDATE search_index SET title = COALESCE(new.title, ''), body = COALESCE(new.summary, '')
+			WHERE rowid = (SELECT id FROM search_entries WHERE kind = 'session' AND ref_id = new.id);
+		END`,
+		`CREATE TRIGGER search_sessions_ad AFTER DELETE ON chat_sessions BEGIN
+			DELETE FROM search_index WHERE rowid = (SELECT id FROM search_entries WHERE kind = 'session' AND ref_id = old.id);
+			DELETE FROM search_entries WHERE kind = 'session' AND ref_id = old.id;
+		END`,
+	},
+	"documents": {
+		`CREATE TRIGGER search_documents_ai AFTER INSERT ON documents BEGIN
+			INSERT OR IGNORE INTO search_entries (kind, ref_id, owner_id, created_at)
+			VALUES ('document', new.id, COALESCE(new.user_id, ''), new.created_at);
+			INSERT OR REPLACE INTO search_index (rowid, title, body)
+			VALUES ((SELECT id FROM search_entries WHERE kind = 'document' AND ref_id = new.id), COALESCE(new.name, ''), '');
+		END`,
+		`CREATE TRIGGER search_documents_au AFTER UPDATE OF name ON documents BEGIN
+			UPDATE search_index SET title = COALESCE(new.name, '')
+			WHERE rowid = (SELECT id FROM search_entries WHERE kind = 'document' AND ref_id = new.id);
+		END`,
+		`CREATE TRIGGER search_documents_ad AFTER DELETE ON documents BEGIN
+			DELETE FROM search_index WHERE rowid = (SELECT id FROM search_entries WHERE kind = 'document' AND ref_id = old.id);
+			DELETE FROM search_entries WHERE kind = 'document' AND ref_id = old.id;
+		END`,
+	},
+	"document_chunks": {
+		`CREATE TRIGGER search_chunks_ai AFTER INSERT ON document_chunks BEGIN
+			INSERT OR IGNORE INTO search_entries (kind, ref_id, owner_id, created_at)
+			VALUES ('chunk', new.id, COALESCE((SELECT user_id FROM documents WHERE id = new.document_id), ''), new.created_at);
+			INSERT OR REPLACE INTO search_index (rowid, title, body)
+			VALUES ((SELECT id FROM search_entries WHERE kind = 'chunk' AND ref_id = new.id),
+				TRIM(COALESCE((SELECT name FROM documents WHERE id = new.document_id), '') || ' ' || COALESCE(new.heading_path, '')),
+				COALESCE(new.content, ''));
+		END`,
+		`CREATE TRIGGER search_chunks_ad AFTER DELETE ON document_chunks BEGIN
+			DELETE FROM search_index WHERE rowid = (SELECT id FROM search_entries WHERE kind = 'chunk' AND ref_id = old.id);
+			DELETE FROM search_entries WHERE kind = 'chunk' AND ref_id = old.id;
+		END`,
+		`CREATE TRIGGER search_chunks_rename AFTER UPDATE OF name ON documents BEGIN
+			UPDATE search_index SET title = TRIM(COALESCE(new.name, '') || ' ' || COALESCE(
+				(SELECT c.heading_path FROM search_entries e JOIN document_chunks c ON c.id = e.ref_id WHERE e.id = search_index.rowid), ''))
+			WHERE rowid IN (SELECT e.id FROM search_entries e JOIN document_chunks c ON c.id = e.ref_id
+				WHERE e.kind = 'chunk' AND c.document_id = new.id);
+		END`,
+	},
+}
+
+// backfill 触发器建立后补齐来源表中尚未索引的行（索引表早于该来源建立时）
+var backfill = map[string][]string{
+	"document_chunks": {
+		`INSERT INTO search_entries (kind, ref_id, owner_id, created_at)
+		SELECT 'chunk', c.id, COALESCE(d.user_id, ''), c.created_at FROM document_chunks c LEFT JOIN documents d ON d.id = c.document_id
+		WHERE NOT EXISTS (SELECT 1 FROM search_entries e WHERE e.kind = 'chunk' AND e.ref_id = c.id)`,
+		`INSERT INTO search_index (rowid, title, body)
+		SELECT e.id, TRIM(COALESCE(d.name, '') || ' ' || COALESCE(c.heading_path, '')), COALESCE(c.content, '')
+		FROM search_entries e JOIN document_chunks c ON c.id = e.ref_id LEFT JOIN documents d ON d.id = c.document_id
+		WHERE e.kind = 'chunk' AND e.id NOT IN (SELECT rowid FROM search_index)`,
+	},
+}
+
+func (i *Index) ensureTriggers() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for table, stmts := range triggers {
+		if i.indexed[table] || !i.db.Migrator().HasTable(table) {
+			continue
+		}
+		// 消息触发器需要读取会话所属用户，分块触发器需要读取文档名称与所属用户
+		if table == "messages" && !i.db.Migrator().HasTable("chat_sessions") {
+			continue
+		}
+		if table == "document_chunks" && !i.db.Migrator().HasTable("documents") {
+			continue
+		}
+		// 每次启动按当前定义重建触发器（同一事务内，不会漏掉并发写入），保证表结构变化后同步逻辑随之更新
+		err := i.db.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range stmts {
+				name := strings.Fields(stmt)[2]
+				if err := tx.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			for _, stmt := range backfill[table] {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create search triggers on %s: %w", table, err)
+		}
+		i.indexed[table] = true
+	}
+	return nil
+}
+
+// Rebuild 清空并按现有消息、会话、文档、分块重建索引（文档仅回填名称，正文待重新提取）
+func (i *Index) Rebuild() error {
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		stmts := []string{"DELETE FROM search_index", "DELETE FROM search_entries"}
+		if tx.Migrator().HasTable("chat_sessions") {
+			stmts = append(stmts,
+				`INSERT INTO search_entries (kind, ref_id, session_id, owner_id, created_at)
+				SELECT 'session', id, id, COALESCE(user_id, ''), created_at FROM chat_sessions`,
+				`INSERT INTO search_index (rowid, title, body)
+				SELECT e.id, COALESCE(s.title, ''), COALESCE(s.summary, '') FROM search_entries e JOIN chat_sessions s ON s.id = e.ref_id WHERE e.kind = 'session'`,
+			)
+			if tx.Migrator().HasTable("messages") {
+				stmts = append(stmts,
+					`INSERT INTO search_entries (kind, ref_id, session_id, owner_id, role, created_at)
+					SELECT 'message', m.id, COALESCE(m.session_id, ''), COALESCE(s.user_id, ''), COALESCE(m.role, ''), m.created_at
+					FROM messages m LEFT JOIN chat_sessions s ON s.id = m.session_id`,
+					`INSERT INTO search_index (rowid, title, body)
+					SELECT e.id, '', COALESCE(m.content, '') FROM search_entries e JOIN messages m ON m.id = e.ref_id WHERE e.kind = 'message'`,
+				)
+			}
+		}
+		if tx.Migrator().HasTable("documents") {
+			stmts = append(stmts,
+				`INSERT INTO search_entries (kind, ref_id, owner_id, created_at)
+				SELECT 'document', id, COALESCE(user_id, ''), created_at FROM documents`,
+				`INSERT INTO search_index (rowid, title, body)
+				SELECT e.id, COALESCE(d.name, ''), '' FROM search_entries e JOIN documents d ON d.id = e.ref_id WHERE e.kind = 'document'`,
+			)
+			if tx.Migrator().HasTable("document_chunks") {
+				stmts = append(stmts,
+					`INSERT INTO search_entries (kind, ref_id, owner_id, created_at)
+					SELECT 'chunk', c.id, COALESCE(d.user_id, ''), c.created_at FROM document_chunks c LEFT JOIN documents d ON d.id = c.document_id`,
+					`INSERT INTO search_index (rowid, title, body)
+					SELECT e.id, TRIM(COALESCE(d.name, '') || ' ' || COALESCE(c.heading_path, '')), COALESCE(c.content, '')
+					FROM search_entries e JOIN document_chunks c ON c.id = e.ref_id LEFT JOIN documents d ON d.id = c.document_id
+					WHERE e.kind = 'chunk'`,
+				)
+			}
+		}
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("failed to rebuild search index: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// IndexDocumentText 写入文档提取出的正文
+func (i *Index) IndexDocumentText(documentID, text string) error {
+	if err := i.Ensure(); err != nil {
+		return err
+	}
+	err := i.db.Exec(`UPDATE search_index SET body = ?
+		WHERE rowid = (SELECT id FROM search_entries WHERE kind = 'document' AND ref_id = ?)`, text, documentID).Error
+	if err != nil {
+		return fmt.Errorf("failed to index document text: %w", err)
+	}
+	return nil
+}
+
+// ErrNoMatch FTS5 不可用或查询词过短，无法用 MATCH 检索
+var ErrNoMatch = errors.New("full-text match unavailable")
+
+// ChunkMatch 分块全文检索命中
+type ChunkMatch struct {
+	ChunkID string
+	Score   float64 // BM25，越大越相关
+}
+
+// MatchChunks 用 FTS5 在用户的分块中检索（词之间为 OR），按 BM25 排序返回。
+// documents 为可选的文档 ID 子查询，给出时按其限定范围（可包含公司内其他成员的文档），不再按用户过滤；
+// FTS5 不可用或存在不足 3 个字符的词时返回 ErrNoMatch。
+func (i *Index) MatchChunks(userID string, terms []string, documents *gorm.DB, limit int) ([]ChunkMatch, error) {
+	if err := i.Ensure(); err != nil {
+		return nil, err
+	}
+	if !i.fts || len(terms) == 0 {
+		return nil, ErrNoMatch
+	}
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < minMatchRunes {
+			return nil, ErrNoMatch
+		}
+	}
+
+	phrases := make([]string, len(terms))
+	for idx, term := range terms {
+		phrases[idx] = matchExpr([]string{term})
+	}
+	sql := `SELECT e.ref_id AS chunk_id, -bm25(search_index, 2.0, 1.0) AS score
+		FROM search_index JOIN search_entries e ON e.id = search_index.rowid
+		WHERE search_index MATCH ? AND e.kind = 'chunk'`
+	args := []interface{}{strings.Join(phrases, " OR ")}
+	if documents != nil {
+		sql += " AND e.ref_id IN (SELECT id FROM document_chunks WHERE document_id IN (?))"
+		args = append(args, documents)
+	} else {
+		sql += " AND e.owner_id = ?"
+		args = append(args, userID)
+	}
+	sql += " ORDER BY score DESC LIMIT ?"
+	args = append(args, limit)
+
+	var matches []ChunkMatch
+	if err := i.db.Raw(sql, args...).Scan(&matches).Error; err != nil {
+		return nil, fmt.Errorf("failed to match chunks: %w", err)
+	}
+	return matches, nil
+}
+
+// Search 按条件检索，FTS5 可用时按 BM25 排序，否则按时间倒序
+func (i *Index) Search(opts Options) ([]Hit, error) {
+	if err := i.Ensure(); err != nil {
+		return nil, err
+	}
+	terms := Terms(opts.Query)
+	if len(terms) == 0 {
+		return []Hit{}, nil
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	useMatch := i.fts
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < minMatchRunes {
+			useMatch = false
+		}
+	}
+
+	var (
+		selects []string
+		where   []string
+		args    []interface{}
+		order   string
+	)
+	if useMatch {
+		selects = []string{
+			"highlight(search_index, 0, ?, ?) AS title",
+			"snippet(search_index, 1, ?, ?, '…', 32) AS snippet",
+			"-bm25(search_index, 4.0, 1.0) AS score",
+		}
+		args = append(args, matchOpen, matchClose, matchOpen, matchClose)
+		where = append(where, "search_index MATCH ?")
+		args = append(args, matchExpr(terms))
+		order = "score DESC, e.created_at DESC"
+	} else {
+		selects = []string{"search_index.title AS title", "search_index.body AS snippet", "0 AS score"}
+		for _, term := range terms {
+			pattern := "%" + escapeLike(term) + "%"
+			where = append(where, `(search_index.title LIKE ? ESCAPE '\' OR search_index.body LIKE ? ESCAPE '\')`)
+			args = append(args, pattern, pattern)
+		}
+		order = "e.created_at DESC"
+	}
+
+	where = append(where, "e.owner_id = ?")
+	args = append(args, opts.UserID)
+	if len(opts.Kinds) > 0 {
+		where = append(where, "e.kind IN ?")
+		args = append(args, opts.Kinds)
+	}
+	if opts.Role != "" {
+		where = append(where, "e.kind = 'message' AND e.role = ?")
+		args = append(args, opts.Role)
+	}
+	if opts.From != nil {
+		where = append(where, "e.created_at >= ?")
+		args = append(args, *opts.From)
+	}
+	if opts.To != nil {
+		where = append(where, "e.created_at < ?")
+		args = append(args, *opts.To)
+	}
+	join := ""
+	if opts.Archived != nil {
+		join = " LEFT JOIN chat_sessions s ON s.id = e.session_id"
+		archived := "COALESCE(CASE WHEN json_valid(s.model_config) THEN json_extract(s.model_config, '$.isArchived') END, 0)"
+		if *opts.Archived {
+			where = append(where, "e.session_id <> '' AND "+archived+" = 1")
+		} else {
+			where = append(where, "(e.session_id = '' OR "+archived+" = 0)")
+		}
+	}
+
+	sql := "SELECT e.kind, e.ref_id, e.session_id, e.role, e.created_at, " + strings.Join(selects, ", ") +
+		" FROM search_index JOIN search_entries e ON e.id = search_index.rowid" + join +
+		" WHERE " + strings.Join(where, " AND ") +
+		" ORDER BY " + order + " LIMIT ?"
+	args = append(args, limit)
+
+	var rows []struct {
+		Kind      string
+		RefID     string
+		SessionID string
+		Role      string
+		CreatedAt time.Time
+		Title     string
+		Snippet   string
+		Score     float64
+	}
+	if err := i.db.Raw(sql, args...).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, row := range rows {
+		hit := Hit{
+			Kind:      row.Kind,
+			RefID:     row.RefID,
+			SessionID: row.SessionID,
+			Role:      row.Role,
+			Title:     row.Title,
+			Snippet:   row.Snippet,
+			Score:     row.Score,
+			CreatedAt: row.CreatedAt,
+		}
+		if useMatch {
+			hit.Title = markup(row.Title)
+			hit.Snippet = markup(row.Snippet)
+		} else {
+			hit.Title = Highlight(row.Title, terms)
+			hit.Snippet = Snippet(row.Snippet, terms)
+		}
+		if hit.Kind == KindMessage {
+			hit.MessageID = hit.RefID
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// Terms 按空白拆分查询词并去重
+func Terms(query string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// matchExpr 将每个词作为短语，多个词之间为 AND
+func matchExpr(terms []string) string {
+	quoted := make([]string, len(terms))
+	for idx, term := range terms {
+		quoted[idx] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(term)
+}
+
+// Highlight 转义文本并为其中出现的查询词加上高亮标记（不区分大小写），返回 HTML 片段
+func Highlight(text string, terms []string) string {
+	ranges := matchRanges(text, terms)
+	if len(ranges) == 0 {
+		return html.EscapeString(text)
+	}
+	var b strings.Builder
+	last := 0
+	for _, r := range ranges {
+		b.WriteString(html.EscapeString(text[last:r[0]]))
+		b.WriteString(highlightOpen)
+		b.WriteString(html.EscapeString(text[r[0]:r[1]]))
+		b.WriteString(highlightClose)
+		last = r[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// Snippet 截取首个命中位置附近的片段并高亮，返回 HTML 片段
+func Snippet(text string, terms []string) string {
+	ranges := matchRanges(text, terms)
+	if len(ranges) == 0 {
+		return html.EscapeString(truncateRunes(text, snippetRunes))
+	}
+	// 命中位置前保留约四分之一的上下文
+	runes := []rune(text)
+	from := utf8.RuneCountInString(text[:ranges[0][0]]) - snippetRunes/4
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetRunes
+	if to > len(runes) {
+		to = len(runes)
+	}
+	result := Highlight(string(runes[from:to]), terms)
+	if from > 0 {
+		result = "…" + result
+	}
+	if to < len(runes) {
+		result += "…"
+	}
+	return result
+}
+
+// matchRanges 返回查询词在文本中的字节区间（已合并重叠部分），不区分大小写
+func matchRanges(text string, terms []string) [][2]int {
+	haystack := strings.ToLower(text)
+	foldCase := len(haystack) == len(text) // 大小写转换改变字节长度时退化为区分大小写匹配
+	if !foldCase {
+		haystack = text
+	}
+	var ranges [][2]int
+	for _, term := range terms {
+		needle := term
+		if foldCase {
+			needle = strings.ToLower(term)
+		}
+		if needle == "" {
+			continue
+		}
+		for offset := 0; ; {
+			idx := strings.Index(haystack[offset:], needle)
+			if idx < 0 {
+				break
+			}
+			start := offset + idx
+			ranges = append(ranges, [2]int{start, start + len(needle)})
+			offset = start + len(needle)
+		}
+	}
+	sort.Slice(ranges, func(a, b int) bool { return ranges[a][0] < ranges[b][0] })
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1] {
+			if r[1] > merged[n-1][1] {
+				merged[n-1][1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func truncateRunes(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + "…"
+}
@@ -0,0 +1,289 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+func setupSearchDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.ChatSession{}, &models.Message{}, &models.Document{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestIndexBackfillsAndFollowsWrites(t *testing.T) {
+	db := setupSearchDB(t)
+	now := time.Now()
+
+	// 建索引前已存在的数据通过回填进入索引
+	db.Create(&models.ChatSession{ID: "s1", UserID: "u1", Title: "季度营销复盘", CreatedAt: now})
+	db.Create(&models.Message{ID: "m1", SessionID: "s1", Role: "user", Content: "帮我整理 Kubernetes 部署清单", CreatedAt: now})
+
+	index := NewIndex(db)
+	if err := index.Ensure(); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	t.Logf("fts5 enabled: %v", index.FTS())
+
+	hits, err := index.Search(Options{UserID: "u1", Query: "kubernetes"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 1 || hits[0].MessageID != "m1" || hits[0].SessionID != "s1" {
+		t.Fatalf("expected backfilled message hit, got %+v", hits)
+	}
+	if !strings.Contains(hits[0].Snippet, "<mark>") {
+		t.Fatalf("expected highlighted snippet, got %q", hits[0].Snippet)
+	}
+
+	// 插入、更新、删除经触发器同步
+	db.Create(&models.Message{ID: "m2", SessionID: "s1", Role: "assistant", Content: "部署清单如下：namespace、deployment、service", CreatedAt: now})
+	db.Model(&models.Message{}).Where("id = ?", "m1").Update("content", "帮我整理 Helm 发布流程")
+	db.Model(&models.ChatSession{}).Where("id = ?", "s1").Update("title", "部署清单讨论")
+
+	hits, _ = index.Search(Options{UserID: "u1", Query: "部署清单"})
+	kinds := map[string]bool{}
+	for _, hit := range hits {
+		kinds[hit.Kind+":"+hit.RefID] = true
+	}
+	if !kinds["message:m2"] || !kinds["session:s1"] || kinds["message:m1"] {
+		t.Fatalf("index out of sync after writes: %v", kinds)
+	}
+
+	// 会话概要与标题一起索引
+	db.Model(&models.ChatSession{}).Where("id = ?", "s1").Update("summary", "讨论了灰度发布策略")
+	hits, _ = index.Search(Options{UserID: "u1", Query: "灰度发布"})
+	if len(hits) != 1 || hits[0].Kind != KindSession || !strings.Contains(hits[0].Snippet, "<mark>") {
+		t.Fatalf("expected session summary hit, got %+v", hits)
+	}
+
+	db.Delete(&models.Message{ID: "m2"})
+	hits, _ = index.Search(Options{UserID: "u1", Query: "namespace"})
+	if len(hits) != 0 {
+		t.Fatalf("deleted message still indexed: %+v", hits)
+	}
+
+	// 其他用户不可见
+	hits, _ = index.Search(Options{UserID: "u2", Query: "helm"})
+	if len(hits) != 0 {
+		t.Fatalf("expected no hits for other user, got %+v", hits)
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	db := setupSearchDB(t)
+	index := NewIndex(db)
+	if err := index.Ensure(); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now()
+	db.Create(&models.ChatSession{ID: "active", UserID: "u1", Title: "进行中", CreatedAt: old})
+	db.Create(&models.ChatSession{ID: "archived", UserID: "u1", Title: "已归档", ModelConfig: `{"isArchived":true}`, CreatedAt: old})
+	db.Create(&models.Message{ID: "a-user", SessionID: "active", Role: "user", Content: "预算表怎么做", CreatedAt: old})
+	db.Create(&models.Message{ID: "a-bot", SessionID: "active", Role: "assistant", Content: "预算表可以按月拆分", CreatedAt: recent})
+	db.Create(&models.Message{ID: "z-bot", SessionID: "archived", Role: "assistant", Content: "旧的预算表模板", CreatedAt: recent})
+
+	ids := func(opts Options) map[string]bool {
+		opts.UserID = "u1"
+		opts.Query = "预算表"
+		hits, err := index.Search(opts)
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		found := map[string]bool{}
+		for _, hit := range hits {
+			found[hit.RefID] = true
+		}
+		return found
+	}
+
+	if found := ids(Options{Role: "assistant"}); len(found) != 2 || found["a-user"] {
+		t.Fatalf("role filter: %v", found)
+	}
+	from := time.Now().Add(-time.Hour)
+	if found := ids(Options{From: &from}); len(found) != 2 || found["a-user"] {
+		t.Fatalf("date filter: %v", found)
+	}
+	archived, active := true, false
+	if found := ids(Options{Archived: &archived}); len(found) != 1 || !found["z-bot"] {
+		t.Fatalf("archived filter: %v", found)
+	}
+	if found := ids(Options{Archived: &active}); len(found) != 2 || found["z-bot"] {
+		t.Fatalf("active filter: %v", found)
+	}
+}
+
+func TestDocumentText(t *testing.T) {
+	db := setupSearchDB(t)
+	index := NewIndex(db)
+	if err := index.Ensure(); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+
+	db.Create(&models.Document{ID: "d1", UserID: "u1", Name: "员工手册.pdf", CreatedAt: time.Now()})
+	if err := index.IndexDocumentText("d1", "年假天数按工龄计算，满一年享有五天带薪年假。"); err != nil {
+		t.Fatalf("index text: %v", err)
+	}
+
+	hits, err := index.Search(Options{UserID: "u1", Query: "带薪年假", Kinds: []string{KindDocument}})
+	if err != nil || len(hits) != 1 || hits[0].RefID != "d1" {
+		t.Fatalf("expected document text hit, got %+v (%v)", hits, err)
+	}
+	// 短于 trigram 长度的词走 LIKE 匹配
+	hits, _ = index.Search(Options{UserID: "u1", Query: "手册", Kinds: []string{KindDocument}})
+	if len(hits) != 1 || hits[0].Title != "员工<mark>手册</mark>.pdf" {
+		t.Fatalf("expected short query to match name, got %+v", hits)
+	}
+
+	db.Delete(&models.Document{ID: "d1"})
+	hits, _ = index.Search(Options{UserID: "u1", Query: "带薪年假"})
+	if len(hits) != 0 {
+		t.Fatalf("deleted document still indexed: %+v", hits)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("前文", 40) + "Alpha 命中" + strings.Repeat("后文", 60)
+	snippet := Snippet(text, []string{"alpha"})
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Fatalf("expected ellipsis on both sides: %q", snippet)
+	}
+	if !strings.Contains(snippet, "<mark>Alpha</mark>") {
+		t.Fatalf("expected case-insensitive highlight: %q", snippet)
+	}
+}
+
+func TestHighlightEscapesHTML(t *testing.T) {
+	if got := Highlight(`<img src=x onerror="alert(1)"> alert`, []string{"alert"}); got !=
+		`&lt;img src=x onerror=&#34;<mark>alert</mark>(1)&#34;&gt; <mark>alert</mark>` {
+		t.Fatalf("unexpected highlight: %q", got)
+	}
+	if got := Snippet("<b>plain</b>", []string{"missing"}); got != "&lt;b&gt;plain&lt;/b&gt;" {
+		t.Fatalf("unexpected snippet: %q", got)
+	}
+
+	// FTS5 与 LIKE 两条路径的结果都经过转义
+	db := setupSearchDB(t)
+	index := NewIndex(db)
+	if err := index.Ensure(); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	db.Create(&models.ChatSession{ID: "s1", UserID: "u1", Title: "<script>x</script>", CreatedAt: time.Now()})
+	db.Create(&models.Message{ID: "m1", SessionID: "s1", Role: "user", Content: "<script>steal()</script> payload", CreatedAt: time.Now()})
+	for _, query := range []string{"payload", "pa"} {
+		hits, err := index.Search(Options{UserID: "u1", Query: query, Kinds: []string{KindMessage}})
+		if err != nil || len(hits) != 1 {
+			t.Fatalf("expected one hit for %q, got %+v (%v)", query, hits, err)
+		}
+		if strings.Contains(hits[0].Snippet, "<script>") || !strings.Contains(hits[0].Snippet, "&lt;/script&gt;") ||
+			!strings.Contains(hits[0].Snippet, "<mark>") {
+			t.Fatalf("expected escaped snippet for %q, got %q", query, hits[0].Snippet)
+		}
+	}
+}
+
+func TestIndexUpgradesPlainTable(t *testing.T) {
+	db := setupSearchDB(t)
+	// 模拟未启用 FTS5 时建立的索引，其中包含只保存在索引中的文档正文
+	for _, stmt := range []string{
+		"CREATE TABLE search_index (id INTEGER PRIMARY KEY, title TEXT NOT NULL DEFAULT '', body TEXT NOT NULL DEFAULT '')",
+		`CREATE TABLE search_entries (id INTEGER PRIMARY KEY, kind TEXT NOT NULL, ref_id TEXT NOT NULL, session_id TEXT NOT NULL DEFAULT '',
+			owner_id TEXT NOT NULL DEFAULT '', role TEXT NOT NULL DEFAULT '', created_at DATETIME, UNIQUE(kind, ref_id))`,
+		"INSERT INTO search_entries (id, kind, ref_id, owner_id, created_at) VALUES (1, 'document', 'd1', 'u1', CURRENT_TIMESTAMP)",
+		"INSERT INTO search_index (id, title, body) VALUES (1, '员工手册.pdf', '年假天数按工龄计算')",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	index := NewIndex(db)
+	if err := index.Ensure(); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	var sql string
+	db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'search_index'").Scan(&sql)
+	if index.FTS() != strings.Contains(strings.ToLower(sql), "fts5") {
+		t.Fatalf("fts flag %v does not match table %q", index.FTS(), sql)
+	}
+	t.Logf("fts5 enabled: %v", index.FTS())
+
+	hits, err := index.Search(Options{UserID: "u1", Query: "年假天数"})
+	if err != nil || len(hits) != 1 || hits[0].RefID != "d1" {
+		t.Fatalf("expected migrated document text hit, got %+v (%v)", hits, err)
+	}
+	// 新写入的数据经触发器同步到转换后的索引
+	db.Create(&models.ChatSession{ID: "s1", UserID: "u1", Title: "季度营销复盘", CreatedAt: time.Now()})
+	if hits, _ := index.Search(Options{UserID: "u1", Query: "营销复盘"}); len(hits) != 1 || hits[0].RefID != "s1" {
+		t.Fatalf("expected new session hit, got %+v", hits)
+	}
+}
+
+func TestMatchChunks(t *testing.T) {
+	db := setupSearchDB(t)
+	index := NewIndex(db)
+	if err := index.Ensure(); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	db.Create(&models.Document{ID: "d1", UserID: "u1", Name: "runbook.md"})
+	db.Create(&models.Document{ID: "d2", UserID: "u2", Name: "notes.md"})
+
+	// 分块表晚于索引建立：补建触发器时回填已有分块
+	if err := db.AutoMigrate(&models.DocumentChunk{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db.Create(&models.DocumentChunk{ID: "c1", DocumentID: "d1", Content: "Kubernetes deployment checklist", HeadingPath: "Ops"})
+	db.Create(&models.DocumentChunk{ID: "c2", DocumentID: "d2", Content: "Kubernetes notes"})
+	if err := index.Ensure(); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	db.Create(&models.DocumentChunk{ID: "c3", DocumentID: "d1", Content: "Rollback steps", HeadingPath: "Ops"})
+
+	if !index.FTS() {
+		if _, err := index.MatchChunks("u1", []string{"kubernetes"}, nil, 10); err != ErrNoMatch {
+			t.Fatalf("expected ErrNoMatch without fts5, got %v", err)
+		}
+		return
+	}
+	match := func(terms ...string) []string {
+		matches, err := index.MatchChunks("u1", terms, nil, 10)
+		if err != nil {
+			t.Fatalf("match: %v", err)
+		}
+		ids := make([]string, len(matches))
+		for i, m := range matches {
+			ids[i] = m.ChunkID
+		}
+		return ids
+	}
+	if got := match("kubernetes"); len(got) != 1 || got[0] != "c1" {
+		t.Fatalf("expected backfilled chunk of u1, got %v", got)
+	}
+	if got := match("rollback", "missing"); len(got) != 1 || got[0] != "c3" {
+		t.Fatalf("expected OR match on new chunk, got %v", got)
+	}
+	// 文档改名后分块标题同步
+	db.Model(&models.Document{}).Where("id = ?", "d1").Update("name", "playbook.md")
+	if got := match("playbook"); len(got) != 2 {
+		t.Fatalf("expected renamed title on both chunks, got %v", got)
+	}
+	if _, err := index.MatchChunks("u1", []string{"k8"}, nil, 10); err != ErrNoMatch {
+		t.Fatalf("expected ErrNoMatch for short term, got %v", err)
+	}
+}
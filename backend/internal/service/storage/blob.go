@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// 上传文件的存储后端。文档记录中保存对象键（如 "3f2a….pdf"），读写均经由 BlobStore，
+// 可在本地目录与 S3 兼容的对象存储（AWS S3、MinIO 等）之间切换。
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey 对象键为空或越出存储根目录
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Info 对象信息
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Object 打开的对象，支持 Seek，可直接交给 http.ServeContent 处理 Range 请求
+type Object interface {
+	io.ReadSeekCloser
+	Info() Info
+}
+
+// BlobStore 对象存储
+type BlobStore interface {
+	// Put 写入对象，size 未知时传 -1；写入完成前读取方看不到不完整的内容
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open 打开对象用于读取，不存在时返回 ErrNotFound
+	Open(ctx context.Context, key string) (Object, error)
+	// Stat 返回对象信息，不存在时返回 ErrNotFound
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+}
+
+// ReadAll 读取对象的全部内容
+func ReadAll(ctx context.Context, store BlobStore, key string) ([]byte, error) {
+	obj, err := store.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}
+
+// FromEnv 按环境变量创建存储：
+// STORAGE_BACKEND=s3 时使用 S3 兼容存储（S3_ENDPOINT、S3_REGION、S3_BUCKET、S3_ACCESS_KEY_ID、
+// S3_SECRET_ACCESS_KEY、S3_PREFIX，S3_FORCE_PATH_STYLE=true 使用路径风格地址），
+// 默认使用 UPLOAD_DIR（默认 ./uploads）下的本地目录
+func FromEnv() (BlobStore, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND"))); backend {
+	case "", "local":
+		uploadDir := os.Getenv("UPLOAD_DIR")
+		if uploadDir == "" {
+			uploadDir = "./uploads"
+		}
+		return NewLocalStore(uploadDir)
+	case "s3", "minio":
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			Prefix:    os.Getenv("S3_PREFIX"),
+			PathStyle: os.Getenv("S3_FORCE_PATH_STYLE") == "true" || backend == "minio",
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
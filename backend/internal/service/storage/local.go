@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore 本地目录存储，对象键为相对根目录的路径
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore 创建本地存储，根目录不存在时自动创建
+func NewLocalStore(root string) (*LocalStore, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{root: abs}, nil
+}
+
+// Root 存储根目录
+func (s *LocalStore) Root() string {
+	return s.root
+}
+
+// path 对象键对应的文件路径。早期的文档记录保存的是包含上传目录的文件路径（如 "uploads/x.pdf"），
+// 位于根目录内时按原路径读取；任何越出根目录的键都会被拒绝
+func (s *LocalStore) path(key string) (string, error) {
+	if strings.TrimSpace(key) == "" {
+		return "", ErrInvalidKey
+	}
+	path := filepath.Join(s.root, filepath.FromSlash(key))
+	if legacy, err := filepath.Abs(key); err == nil && (filepath.IsAbs(key) || s.contains(legacy)) {
+		path = legacy
+	}
+	if !s.contains(path) {
+		return "", ErrInvalidKey
+	}
+	return path, nil
+}
+
+func (s *LocalStore) contains(path string) bool {
+	rel, err := filepath.Rel(s.root, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Put 先写入同目录下的临时文件，完成后重命名为目标文件
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Open 打开本地文件
+func (s *LocalStore) Open(ctx context.Context, key string) (Object, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if stat.IsDir() {
+		f.Close()
+		return nil, ErrNotFound
+	}
+	return &localObject{File: f, info: Info{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}}, nil
+}
+
+// Stat 返回本地文件信息
+func (s *LocalStore) Stat(ctx context.Context, key string) (Info, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return Info{}, notFound(err)
+	}
+	if stat.IsDir() {
+		return Info{}, ErrNotFound
+	}
+	return Info{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+// Delete 删除本地文件
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+type localObject struct {
+	*os.File
+	info Info
+}
+
+func (o *localObject) Info() Info {
+	return o.info
+}
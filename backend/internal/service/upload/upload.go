@@ -0,0 +1,453 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/storage"
+)
+
+// 分片上传：客户端创建会话后按固定大小逐片上传（每片附带 SHA-256 校验和，可重复上传以断点续传），
+// 全部分片到齐后按序合并为一个文件，再交给调用方登记为文档。超过有效期未完成的会话由后台清理。
+
+// 会话状态
+const (
+	StatusUploading  = "uploading"  // 接收分片
+	StatusAssembling = "assembling" // 正在合并
+	StatusCompleted  = "completed"  // 已生成文档
+)
+
+var (
+	// ErrSessionNotFound 会话不存在或已过期
+	ErrSessionNotFound = errors.New("upload session not found")
+	// ErrInvalidSession 创建会话的参数无效
+	ErrInvalidSession = errors.New("invalid upload session")
+	// ErrInvalidPart 分片序号超出范围
+	ErrInvalidPart = errors.New("invalid part number")
+	// ErrPartSize 分片大小与会话约定不符
+	ErrPartSize = errors.New("part size does not match the session")
+	// ErrChecksumRequired 分片缺少 SHA-256 校验和
+	ErrChecksumRequired = errors.New("part checksum is required")
+	// ErrChecksumMismatch 内容与校验和不一致
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrIncomplete 仍有分片未上传
+	ErrIncomplete = errors.New("upload is incomplete")
+	// ErrNotUploading 会话正在合并或已完成，不再接收分片
+	ErrNotUploading = errors.New("upload session is not accepting changes")
+)
+
+// Config 分片上传配置，零值使用默认值
+type Config struct {
+	ChunkSize     int64         // 默认分片大小，默认 8MB
+	MaxFileSize   int64         // 单个文件上限，默认 2GB
+	MaxParts      int           // 分片数上限，默认 10000
+	TTL           time.Duration // 会话有效期，每次上传分片后顺延，默认 24h
+	SweepInterval time.Duration // 清理过期会话的间隔，默认 10m
+}
+
+func (c Config) withDefaults() Config {
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = 8 << 20
+	}
+	if c.MaxFileSize <= 0 {
+		c.MaxFileSize = 2 << 30
+	}
+	if c.MaxParts <= 0 {
+		c.MaxParts = 10000
+	}
+	if c.TTL <= 0 {
+		c.TTL = 24 * time.Hour
+	}
+	if c.SweepInterval <= 0 {
+		c.SweepInterval = 10 * time.Minute
+	}
+	return c
+}
+
+// Manager 管理分片上传会话
+type Manager struct {
+	db    *gorm.DB
+	blobs storage.BlobStore
+	cfg   Config
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager 创建分片上传管理器，需调用 Start 启动过期会话清理
+func NewManager(db *gorm.DB, blobs storage.BlobStore, cfg Config) *Manager {
+	return &Manager{db: db, blobs: blobs, cfg: cfg.withDefaults()}
+}
+
+// InitRequest 创建会话的参数
+type InitRequest struct {
+	UserID    string
+	FileName  string
+	FileSize  int64
+	ChunkSize int64  // 为 0 时使用 Config.ChunkSize
+	Checksum  string // 整个文件的 SHA-256（可选）
+	FolderID  string
+	CompanyID string
+	WorkID    string
+}
+
+// Init 创建上传会话
+func (m *Manager) Init(req InitRequest) (*models.UploadSession, error) {
+	if strings.TrimSpace(req.FileName) == "" {
+		return nil, fmt.Errorf("%w: fileName is required", ErrInvalidSession)
+	}
+	if req.FileSize <= 0 {
+		return nil, fmt.Errorf("%w: fileSize must be positive", ErrInvalidSession)
+	}
+	if req.FileSize > m.cfg.MaxFileSize {
+		return nil, fmt.Errorf("%w: file exceeds %d bytes", ErrInvalidSession, m.cfg.MaxFileSize)
+	}
+	chunkSize := req.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = m.cfg.ChunkSize
+	}
+	parts := (req.FileSize + chunkSize - 1) / chunkSize
+	if parts > int64(m.cfg.MaxParts) {
+		return nil, fmt.Errorf("%w: chunkSize too small, at most %d parts allowed", ErrInvalidSession, m.cfg.MaxParts)
+	}
+	checksum := strings.ToLower(strings.TrimSpace(req.Checksum))
+	if checksum != "" && !validChecksum(checksum) {
+		return nil, fmt.Errorf("%w: checksum must be a hex encoded SHA-256", ErrInvalidSession)
+	}
+
+	session := models.UploadSession{
+		ID:         models.NewUUID(),
+		UserID:     req.UserID,
+		FileName:   req.FileName,
+		FileSize:   req.FileSize,
+		ChunkSize:  chunkSize,
+		TotalParts: int(parts),
+		Checksum:   checksum,
+		FolderID:   req.FolderID,
+		CompanyID:  req.CompanyID,
+		WorkID:     req.WorkID,
+		Status:     StatusUploading,
+		ExpiresAt:  time.Now().Add(m.cfg.TTL),
+	}
+	if err := m.db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Get 读取用户的上传会话；未完成且已过期的会话视为不存在
+func (m *Manager) Get(id, userID string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	if err := m.db.Where("id = ? AND user_id = ?", id, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if session.Status != StatusCompleted && time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+// Parts 按序号返回已上传的分片
+func (m *Manager) Parts(sessionID string) ([]models.UploadPart, error) {
+	parts := []models.UploadPart{}
+	err := m.db.Where("session_id = ?", sessionID).Order("number ASC").Find(&parts).Error
+	return parts, err
+}
+
+// PartSize 第 number 个分片应有的大小
+func PartSize(session *models.UploadSession, number int) int64 {
+	if number == session.TotalParts {
+		return session.FileSize - int64(session.TotalParts-1)*session.ChunkSize
+	}
+	return session.ChunkSize
+}
+
+// PutPart 保存一个分片并校验大小与 SHA-256；同一序号重复上传时覆盖之前的内容
+func (m *Manager) PutPart(ctx context.Context, session *models.UploadSession, number int, r io.Reader, checksum string) (*models.UploadPart, error) {
+	if session.Status != StatusUploading {
+		return nil, ErrNotUploading
+	}
+	if number < 1 || number > session.TotalParts {
+		return nil, ErrInvalidPart
+	}
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if checksum == "" {
+		return nil, ErrChecksumRequired
+	}
+	if !validChecksum(checksum) {
+		return nil, ErrChecksumMismatch
+	}
+
+	size := PartSize(session, number)
+	key := partKey(session.ID, number)
+	hasher := sha256.New()
+	counter := &countingReader{r: io.TeeReader(io.LimitReader(r, size), hasher)}
+	if err := m.blobs.Put(ctx, key, counter, size, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+	var extra [1]byte
+	if n, _ := io.ReadFull(r, extra[:]); counter.n != size || n > 0 {
+		m.discardPart(ctx, session.ID, number)
+		return nil, fmt.Errorf("%w: part %d must be %d bytes", ErrPartSize, number, size)
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != checksum {
+		m.discardPart(ctx, session.ID, number)
+		return nil, ErrChecksumMismatch
+	}
+
+	part := models.UploadPart{SessionID: session.ID, Number: number, Size: size, Checksum: checksum, CreatedAt: time.Now()}
+	if err := m.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&part).Error; err != nil {
+		return nil, err
+	}
+	session.ExpiresAt = time.Now().Add(m.cfg.TTL)
+	m.db.Model(&models.UploadSession{}).Where("id = ?", session.ID).Update("expires_at", session.ExpiresAt)
+	return &part, nil
+}
+
+// RegisterFunc 把合并后的文件登记为文档，返回文档 ID
+type RegisterFunc func(hash string) (string, error)
+
+// Complete 按序合并全部分片写入 key，校验整个文件的 SHA-256 后调用 register 登记文档，
+// 成功后删除分片并把会话标记为完成；失败时会话回到上传状态，可以补传分片后重试
+func (m *Manager) Complete(ctx context.Context, session *models.UploadSession, key string, register RegisterFunc) error {
+	if session.Status != StatusUploading {
+		return ErrNotUploading
+	}
+	parts, err := m.Parts(session.ID)
+	if err != nil {
+		return err
+	}
+	if len(parts) != session.TotalParts {
+		return fmt.Errorf("%w: %d of %d parts uploaded", ErrIncomplete, len(parts), session.TotalParts)
+	}
+
+	// 通过状态切换抢占会话，避免重复合并
+	claim := m.db.Model(&models.UploadSession{}).Where("id = ? AND status = ?", session.ID, StatusUploading).
+		Update("status", StatusAssembling)
+	if claim.Error != nil {
+		return claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return ErrNotUploading
+	}
+	release := func() {
+		m.db.Model(&models.UploadSession{}).Where("id = ?", session.ID).Update("status", StatusUploading)
+	}
+
+	keys := make([]string, len(parts))
+	for i, part := range parts {
+		keys[i] = partKey(session.ID, part.Number)
+	}
+	hasher := sha256.New()
+	reader := &partsReader{ctx: ctx, blobs: m.blobs, keys: keys}
+	err = m.blobs.Put(ctx, key, io.TeeReader(reader, hasher), session.FileSize, "")
+	reader.Close()
+	if err != nil {
+		release()
+		return err
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	if session.Checksum != "" && hash != session.Checksum {
+		m.blobs.Delete(ctx, key)
+		release()
+		return ErrChecksumMismatch
+	}
+
+	documentID, err := register(hash)
+	if err != nil {
+		release()
+		return err
+	}
+
+	m.removeParts(ctx, session.ID)
+	// 完成的会话再保留一个有效期，重复提交完成请求时返回同一文档
+	session.Status = StatusCompleted
+	session.DocumentID = documentID
+	session.ExpiresAt = time.Now().Add(m.cfg.TTL)
+	return m.db.Model(&models.UploadSession{}).Where("id = ?", session.ID).Updates(map[string]interface{}{
+		"status":      session.Status,
+		"document_id": session.DocumentID,
+		"expires_at":  session.ExpiresAt,
+	}).Error
+}
+
+// Abort 取消会话并删除已上传的分片
+func (m *Manager) Abort(ctx context.Context, session *models.UploadSession) error {
+	if session.Status == StatusAssembling {
+		return ErrNotUploading
+	}
+	return m.remove(ctx, session.ID)
+}
+
+// Sweep 清理过期的会话及其分片，返回清理的会话数；合并中断（超过一个有效期仍在合并）的会话同样清理
+func (m *Manager) Sweep(ctx context.Context) (int, error) {
+	now := time.Now()
+	var ids []string
+	err := m.db.Model(&models.UploadSession{}).
+		Where("expires_at < ? AND (status <> ? OR updated_at < ?)", now, StatusAssembling, now.Add(-m.cfg.TTL)).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := m.remove(ctx, id); err != nil {
+			log.Printf("failed to remove upload session %s: %v", id, err)
+			continue
+		}
+		removed++
+	}
+	return removed, ctx.Err()
+}
+
+// Start 启动过期会话清理；重复调用无效
+func (m *Manager) Start(parent context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(parent)
+	m.cancel = cancel
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.cfg.SweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := m.Sweep(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("upload session sweep failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止清理并等待当前清理结束
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	cancel := m.cancel
+	m.cancel = nil
+	m.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		m.wg.Wait()
+	}
+}
+
+// remove 删除会话、分片记录与分片文件
+func (m *Manager) remove(ctx context.Context, sessionID string) error {
+	if err := m.removeParts(ctx, sessionID); err != nil {
+		return err
+	}
+	return m.db.Where("id = ?", sessionID).Delete(&models.UploadSession{}).Error
+}
+
+func (m *Manager) removeParts(ctx context.Context, sessionID string) error {
+	parts, err := m.Parts(sessionID)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if err := m.blobs.Delete(ctx, partKey(sessionID, part.Number)); err != nil {
+			return err
+		}
+	}
+	return m.db.Where("session_id = ?", sessionID).Delete(&models.UploadPart{}).Error
+}
+
+// discardPart 删除校验失败的分片，客户端需要重新上传
+func (m *Manager) discardPart(ctx context.Context, sessionID string, number int) {
+	m.blobs.Delete(ctx, partKey(sessionID, number))
+	m.db.Where("session_id = ? AND number = ?", sessionID, number).Delete(&models.UploadPart{})
+}
+
+// partKey 分片在文件存储中的对象键
+func partKey(sessionID string, number int) string {
+	return fmt.Sprintf("parts/%s/%05d", sessionID, number)
+}
+
+func validChecksum(checksum string) bool {
+	if len(checksum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(checksum)
+	return err == nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// partsReader 依次读取各分片，同一时间只打开一个分片
+type partsReader struct {
+	ctx   context.Context
+	blobs storage.BlobStore
+	keys  []string
+	cur   storage.Object
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.cur == nil {
+			if len(p.keys) == 0 {
+				return 0, io.EOF
+			}
+			obj, err := p.blobs.Open(p.ctx, p.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			p.cur, p.keys = obj, p.keys[1:]
+		}
+		n, err := p.cur.Read(b)
+		if err == io.EOF {
+			p.cur.Close()
+			p.cur = nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.cur != nil {
+		err := p.cur.Close()
+		p.cur = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/storage"
+)
+
+func setupManager(t *testing.T) (*gorm.DB, *storage.LocalStore, *Manager) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.UploadSession{}, &models.UploadPart{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, blobs, NewManager(db, blobs, Config{TTL: time.Hour})
+}
+
+func sum(data string) string {
+	s := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(s[:])
+}
+
+func TestResumableUpload(t *testing.T) {
+	db, blobs, m := setupManager(t)
+	ctx := context.Background()
+	const content = "0123456789abcdefghij-tail"
+
+	if _, err := m.Init(InitRequest{UserID: "u1", FileName: "a.md", FileSize: 0}); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("expected ErrInvalidSession, got %v", err)
+	}
+	if _, err := m.Init(InitRequest{UserID: "u1", FileName: "a.md", FileSize: 1 << 20, ChunkSize: 1}); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("too many parts should be rejected, got %v", err)
+	}
+	session, err := m.Init(InitRequest{UserID: "u1", FileName: "a.md", FileSize: int64(len(content)), ChunkSize: 10, Checksum: sum(content)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.TotalParts != 3 || PartSize(session, 3) != 5 {
+		t.Fatalf("unexpected session %+v", session)
+	}
+	if _, err := m.Get(session.ID, "u2"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("other users must not see the session, got %v", err)
+	}
+
+	parts := []string{content[:10], content[10:20], content[20:]}
+	// 校验和错误、大小不符与越界序号都被拒绝
+	if _, err := m.PutPart(ctx, session, 1, strings.NewReader(parts[0]), sum("other")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := m.PutPart(ctx, session, 1, strings.NewReader(parts[0]), ""); !errors.Is(err, ErrChecksumRequired) {
+		t.Fatalf("expected ErrChecksumRequired, got %v", err)
+	}
+	if _, err := m.PutPart(ctx, session, 1, strings.NewReader(parts[0]+"x"), sum(parts[0]+"x")); !errors.Is(err, ErrPartSize) {
+		t.Fatalf("expected ErrPartSize for oversized part, got %v", err)
+	}
+	if _, err := m.PutPart(ctx, session, 3, strings.NewReader("tai"), sum("tai")); !errors.Is(err, ErrPartSize) {
+		t.Fatalf("expected ErrPartSize for short part, got %v", err)
+	}
+	if _, err := m.PutPart(ctx, session, 4, strings.NewReader("x"), sum("x")); !errors.Is(err, ErrInvalidPart) {
+		t.Fatalf("expected ErrInvalidPart, got %v", err)
+	}
+
+	// 分片可以乱序上传，缺片时无法完成
+	for _, n := range []int{3, 1} {
+		if _, err := m.PutPart(ctx, session, n, strings.NewReader(parts[n-1]), sum(parts[n-1])); err != nil {
+			t.Fatalf("part %d: %v", n, err)
+		}
+	}
+	register := func(hash string) (string, error) { t.Fatal("register must not be called"); return "", nil }
+	if err := m.Complete(ctx, session, "doc.md", register); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("expected ErrIncomplete, got %v", err)
+	}
+	uploaded, _ := m.Parts(session.ID)
+	if len(uploaded) != 2 || uploaded[0].Number != 1 || uploaded[1].Number != 3 {
+		t.Fatalf("unexpected parts %+v", uploaded)
+	}
+
+	// 重复上传同一分片覆盖之前的内容
+	for i := 0; i < 2; i++ {
+		if _, err := m.PutPart(ctx, session, 2, strings.NewReader(parts[1]), sum(parts[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var registered string
+	err = m.Complete(ctx, session, "doc.md", func(hash string) (string, error) {
+		registered = hash
+		return "doc-1", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered != sum(content) {
+		t.Fatalf("unexpected hash %s", registered)
+	}
+	data, err := storage.ReadAll(ctx, blobs, "doc.md")
+	if err != nil || string(data) != content {
+		t.Fatalf("unexpected assembled file %q %v", data, err)
+	}
+	stored, err := m.Get(session.ID, "u1")
+	if err != nil || stored.Status != StatusCompleted || stored.DocumentID != "doc-1" {
+		t.Fatalf("unexpected session %+v %v", stored, err)
+	}
+	var remaining int64
+	db.Model(&models.UploadPart{}).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("parts not removed: %d", remaining)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(blobs.Root(), "parts", session.ID)); len(entries) != 0 {
+		t.Fatalf("part files not removed: %v", entries)
+	}
+	if err := m.Complete(ctx, stored, "doc2.md", register); !errors.Is(err, ErrNotUploading) {
+		t.Fatalf("completed session must not be assembled again, got %v", err)
+	}
+}
+
+func TestCompleteChecksumMismatch(t *testing.T) {
+	_, blobs, m := setupManager(t)
+	ctx := context.Background()
+	session, err := m.Init(InitRequest{UserID: "u1", FileName: "a.md", FileSize: 4, Checksum: sum("other")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.PutPart(ctx, session, 1, strings.NewReader("data"), sum("data")); err != nil {
+		t.Fatal(err)
+	}
+	err = m.Complete(ctx, session, "doc.md", func(string) (string, error) { return "doc-1", nil })
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := blobs.Stat(ctx, "doc.md"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("assembled file should be removed, got %v", err)
+	}
+	// 会话回到上传状态，可以重新上传
+	stored, _ := m.Get(session.ID, "u1")
+	if stored.Status != StatusUploading {
+		t.Fatalf("unexpected status %s", stored.Status)
+	}
+}
+
+func TestSweepExpiredSessions(t *testing.T) {
+	db, blobs, m := setupManager(t)
+	ctx := context.Background()
+	expired, _ := m.Init(InitRequest{UserID: "u1", FileName: "old.md", FileSize: 4})
+	active, _ := m.Init(InitRequest{UserID: "u1", FileName: "new.md", FileSize: 4})
+	for _, s := range []*models.UploadSession{expired, active} {
+		if _, err := m.PutPart(ctx, s, 1, strings.NewReader("data"), sum("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Model(&models.UploadSession{}).Where("id = ?", expired.ID).Update("expires_at", time.Now().Add(-time.Minute))
+
+	if _, err := m.Get(expired.ID, "u1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expired session should not be found, got %v", err)
+	}
+	removed, err := m.Sweep(ctx)
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 removed session, got %d %v", removed, err)
+	}
+	if _, err := blobs.Stat(ctx, partKey(expired.ID, 1)); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expired part should be removed, got %v", err)
+	}
+	if _, err := blobs.Stat(ctx, partKey(active.ID, 1)); err != nil {
+		t.Fatalf("active part should be kept: %v", err)
+	}
+	var sessions int64
+	db.Model(&models.UploadSession{}).Count(&sessions)
+	if sessions != 1 {
+		t.Fatalf("expected 1 remaining session, got %d", sessions)
+	}
+}
@@ -0,0 +1,346 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// HNSW（Hierarchical Navigable Small World）近似最近邻索引，使用余弦相似度。
+// 向量插入时归一化，相似度即点积。删除采用墓碑标记，墓碑过多时由上层重建。
+
+const (
+	defaultM              = 16
+	defaultEfConstruction = 200
+	defaultEfSearch       = 64
+)
+
+type hnswNode struct {
+	id        string
+	vector    []float32
+	neighbors [][]int32 // 每层的邻居
+	deleted   bool
+}
+
+type hnswIndex struct {
+	dim            int
+	m              int
+	m0             int // 第 0 层的最大邻居数
+	efConstruction int
+	efSearch       int
+	levelMult      float64
+	rng            *rand.Rand
+
+	nodes    []hnswNode
+	byID     map[string]int32
+	entry    int32
+	maxLevel int
+	deleted  int
+}
+
+func newHNSW(dim int) *hnswIndex {
+	return &hnswIndex{
+		dim:            dim,
+		m:              defaultM,
+		m0:             defaultM * 2,
+		efConstruction: defaultEfConstruction,
+		efSearch:       defaultEfSearch,
+		levelMult:      1 / math.Log(defaultM),
+		rng:            rand.New(rand.NewSource(1)),
+		byID:           map[string]int32{},
+		entry:          -1,
+	}
+}
+
+// live 返回未删除的节点数
+func (h *hnswIndex) live() int {
+	return len(h.nodes) - h.deleted
+}
+
+// add 插入向量；同 ID 已存在时先删除旧向量
+func (h *hnswIndex) add(id string, vector []float32) {
+	h.remove(id)
+
+	level := int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+	idx := int32(len(h.nodes))
+	node := hnswNode{id: id, vector: normalize(vector), neighbors: make([][]int32, level+1)}
+	h.nodes = append(h.nodes, node)
+	h.byID[id] = idx
+
+	if h.entry < 0 {
+		h.entry = idx
+		h.maxLevel = level
+		return
+	}
+
+	cur := h.entry
+	for l := h.maxLevel; l > level; l-- {
+		cur = h.greedy(node.vector, cur, l)
+	}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(node.vector, []int32{cur}, h.efConstruction, l)
+		maxConn := h.m
+		if l == 0 {
+			maxConn = h.m0
+		}
+		selected := h.selectNeighbors(candidates, h.m)
+		h.nodes[idx].neighbors[l] = selected
+		for _, nb := range selected {
+			h.connect(nb, idx, l, maxConn)
+		}
+		if len(candidates) > 0 {
+			cur = candidates[0].idx
+		}
+	}
+	if level > h.maxLevel {
+		h.maxLevel = level
+		h.entry = idx
+	}
+}
+
+// remove 以墓碑方式删除向量，返回是否存在
+func (h *hnswIndex) remove(id string) bool {
+	idx, ok := h.byID[id]
+	if !ok {
+		return false
+	}
+	delete(h.byID, id)
+	h.nodes[idx].deleted = true
+	h.deleted++
+	return true
+}
+
+// compact 丢弃墓碑节点重建索引
+func (h *hnswIndex) compact() *hnswIndex {
+	rebuilt := newHNSW(h.dim)
+	for _, node := range h.nodes {
+		if !node.deleted {
+			rebuilt.add(node.id, node.vector)
+		}
+	}
+	return rebuilt
+}
+
+// search 返回与查询向量最相似的 topK 个未删除节点（相似度降序）
+func (h *hnswIndex) search(query []float32, topK int) []scored {
+	if h.entry < 0 || topK <= 0 || h.live() == 0 {
+		return nil
+	}
+	query = normalize(query)
+
+	cur := h.entry
+	for l := h.maxLevel; l > 0; l-- {
+		cur = h.greedy(query, cur, l)
+	}
+	ef := h.efSearch
+	if topK > ef {
+		ef = topK
+	}
+	// 墓碑会占用候选名额，按比例放大搜索宽度
+	if h.deleted > 0 {
+		ef += ef * h.deleted / len(h.nodes)
+	}
+	candidates := h.searchLayer(query, []int32{cur}, ef, 0)
+
+	results := make([]scored, 0, topK)
+	for _, c := range candidates {
+		if h.nodes[c.idx].deleted {
+			continue
+		}
+		results = append(results, c)
+		if len(results) == topK {
+			break
+		}
+	}
+	return results
+}
+
+// exact 暴力检索，小集合下比 HNSW 更准确
+func (h *hnswIndex) exact(query []float32, topK int) []scored {
+	query = normalize(query)
+	results := make([]scored, 0, h.live())
+	for i := range h.nodes {
+		if h.nodes[i].deleted {
+			continue
+		}
+		results = append(results, scored{idx: int32(i), score: dot(query, h.nodes[i].vector)})
+	}
+	sort.Slice(results, func(a, b int) bool { return results[a].score > results[b].score })
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+func (h *hnswIndex) greedy(query []float32, cur int32, level int) int32 {
+	best := dot(query, h.nodes[cur].vector)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range h.neighborsAt(cur, level) {
+			if score := dot(query, h.nodes[nb].vector); score > best {
+				best, cur, changed = score, nb, true
+			}
+		}
+	}
+	return cur
+}
+
+// searchLayer 在单层内做束搜索，返回按相似度降序的候选
+func (h *hnswIndex) searchLayer(query []float32, entries []int32, ef, level int) []scored {
+	visited := map[int32]bool{}
+	candidates := &maxHeap{}
+	results := &minHeap{}
+	for _, e := range entries {
+		visited[e] = true
+		s := scored{idx: e, score: dot(query, h.nodes[e].vector)}
+		heap.Push(candidates, s)
+		heap.Push(results, s)
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(scored)
+		if results.Len() >= ef && c.score < (*results)[0].score {
+			break
+		}
+		for _, nb := range h.neighborsAt(c.idx, level) {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			s := scored{idx: nb, score: dot(query, h.nodes[nb].vector)}
+			if results.Len() < ef || s.score > (*results)[0].score {
+				heap.Push(candidates, s)
+				heap.Push(results, s)
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	out := make([]scored, results.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(results).(scored)
+	}
+	return out
+}
+
+// selectNeighbors 启发式选邻：优先保留彼此不相近的候选，使图在各方向上都可达
+func (h *hnswIndex) selectNeighbors(candidates []scored, m int) []int32 {
+	selected := make([]int32, 0, m)
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		keep := true
+		for _, s := range selected {
+			if dot(h.nodes[c.idx].vector, h.nodes[s].vector) > c.score {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c.idx)
+		}
+	}
+	// 启发式筛选过严时用最近的候选补足
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		if !containsIdx(selected, c.idx) {
+			selected = append(selected, c.idx)
+		}
+	}
+	return selected
+}
+
+// connect 为已有节点添加反向连接，超出上限时保留最相似的邻居
+func (h *hnswIndex) connect(from, to int32, level, maxConn int) {
+	if level >= len(h.nodes[from].neighbors) {
+		return
+	}
+	neighbors := append(h.nodes[from].neighbors[level], to)
+	if len(neighbors) > maxConn {
+		base := h.nodes[from].vector
+		ranked := make([]scored, len(neighbors))
+		for i, nb := range neighbors {
+			ranked[i] = scored{idx: nb, score: dot(base, h.nodes[nb].vector)}
+		}
+		sort.Slice(ranked, func(a, b int) bool { return ranked[a].score > ranked[b].score })
+		neighbors = h.selectNeighbors(ranked, maxConn)
+	}
+	h.nodes[from].neighbors[level] = neighbors
+}
+
+func (h *hnswIndex) neighborsAt(idx int32, level int) []int32 {
+	if level >= len(h.nodes[idx].neighbors) {
+		return nil
+	}
+	return h.nodes[idx].neighbors[level]
+}
+
+type scored struct {
+	idx   int32
+	score float32
+}
+
+type maxHeap []scored
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(scored)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+type minHeap []scored
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(scored)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func containsIdx(list []int32, idx int32) bool {
+	for _, v := range list {
+		if v == idx {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	out := make([]float32, len(vector))
+	if sum == 0 {
+		return out
+	}
+	norm := float32(1 / math.Sqrt(sum))
+	for i, v := range vector {
+		out[i] = v * norm
+	}
+	return out
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
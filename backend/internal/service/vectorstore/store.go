@@ -0,0 +1,289 @@
+package vectorstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/ai"
+)
+
+// 内置向量库：向量以 BLOB 形式持久化在 SQLite，启动时按集合重建内存 HNSW 索引。
+// 适用于单机部署，无需外部向量数据库。
+
+const (
+	// exactSearchLimit 集合不超过该规模时直接暴力检索（结果精确且足够快）
+	exactSearchLimit = 1000
+	// compactMinDeleted 墓碑数超过该值且多于存活节点时重建索引
+	compactMinDeleted = 128
+	loadBatchSize     = 500
+)
+
+// UserCollection 用户私有知识的集合名
+func UserCollection(userID string) string {
+	return "user/" + userID
+}
+
+// CompanyCollection 公司共享知识的集合名
+func CompanyCollection(companyID string) string {
+	return "company/" + companyID
+}
+
+// Store 基于 SQLite + HNSW 的向量库，实现 ai.VectorStore
+type Store struct {
+	db          *gorm.DB
+	mu          sync.RWMutex
+	collections map[string]*collection
+}
+
+type collection struct {
+	mu    sync.RWMutex
+	index *hnswIndex
+}
+
+var _ ai.VectorStore = (*Store)(nil)
+
+// Open 创建向量库，并从数据库加载全部向量重建索引
+func Open(db *gorm.DB) (*Store, error) {
+	s := &Store{db: db, collections: map[string]*collection{}}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+var (
+	sharedMu sync.Mutex
+	shared   = map[*sql.DB]*Store{}
+)
+
+// Shared 返回同一数据库连接池上共享的向量库，首次调用时加载索引。
+// 多个处理器各自持有的 Store 内存索引互不可见，写入与检索须使用同一实例。
+func Shared(db *gorm.DB) (*Store, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if s := shared[sqlDB]; s != nil {
+		return s, nil
+	}
+	s, err := Open(db)
+	if err != nil {
+		return nil, err
+	}
+	shared[sqlDB] = s
+	return s, nil
+}
+
+func (s *Store) load() error {
+	var records []models.VectorRecord
+	result := s.db.Order("collection ASC, created_at ASC").FindInBatches(&records, loadBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, record := range records {
+			vector, err := decodeVector(record.Vector, record.Dim)
+			if err != nil {
+				return fmt.Errorf("invalid vector %s/%s: %w", record.Collection, record.RefID, err)
+			}
+			c := s.collection(record.Collection, record.Dim, true)
+			if c.index.dim != record.Dim {
+				return fmt.Errorf("vector %s/%s has dimension %d, collection expects %d", record.Collection, record.RefID, record.Dim, c.index.dim)
+			}
+			c.index.add(record.RefID, vector)
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to load vectors: %w", result.Error)
+	}
+	return nil
+}
+
+// collection 返回集合，create 为 true 时按维度创建
+func (s *Store) collection(name string, dim int, create bool) *collection {
+	s.mu.RLock()
+	c := s.collections[name]
+	s.mu.RUnlock()
+	if c != nil || !create {
+		return c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c = s.collections[name]; c == nil {
+		c = &collection{index: newHNSW(dim)}
+		s.collections[name] = c
+	}
+	return c
+}
+
+// Insert 写入或覆盖向量；同一集合内维度必须一致
+func (s *Store) Insert(ctx context.Context, collectionName string, id string, vector []float32, metadata map[string]interface{}) error {
+	if collectionName == "" || id == "" {
+		return fmt.Errorf("collection and id are required")
+	}
+	if len(vector) == 0 {
+		return fmt.Errorf("empty vector")
+	}
+	c := s.collection(collectionName, len(vector), true)
+	c.mu.RLock()
+	dim := c.index.dim
+	c.mu.RUnlock()
+	if dim != len(vector) {
+		return fmt.Errorf("vector dimension mismatch: collection %s expects %d, got %d", collectionName, dim, len(vector))
+	}
+
+	meta := models.JSON("{}")
+	if metadata != nil {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode metadata: %w", err)
+		}
+		meta = models.JSON(data)
+	}
+	now := time.Now()
+	record := models.VectorRecord{
+		Collection: collectionName,
+		RefID:      id,
+		Dim:        len(vector),
+		Vector:     encodeVector(vector),
+		Metadata:   meta,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "collection"}, {Name: "ref_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"dim", "vector", "metadata", "updated_at"}),
+	}).Create(&record).Error; err != nil {
+		return fmt.Errorf("failed to save vector: %w", err)
+	}
+
+	c.mu.Lock()
+	c.index.add(id, vector)
+	c.mu.Unlock()
+	return nil
+}
+
+// Search 返回集合内与查询向量余弦相似度最高的 topK 条结果
+func (s *Store) Search(ctx context.Context, collectionName string, queryVector []float32, topK int) ([]ai.SearchResult, error) {
+	c := s.collection(collectionName, 0, false)
+	if c == nil || topK <= 0 {
+		return []ai.SearchResult{}, nil
+	}
+
+	c.mu.RLock()
+	if c.index.dim != len(queryVector) {
+		c.mu.RUnlock()
+		return nil, fmt.Errorf("vector dimension mismatch: collection %s expects %d, got %d", collectionName, c.index.dim, len(queryVector))
+	}
+	var hits []scored
+	if c.index.live() <= exactSearchLimit {
+		hits = c.index.exact(queryVector, topK)
+	} else {
+		hits = c.index.search(queryVector, topK)
+	}
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = c.index.nodes[hit.idx].id
+	}
+	c.mu.RUnlock()
+
+	if len(ids) == 0 {
+		return []ai.SearchResult{}, nil
+	}
+
+	// 元数据只为命中结果从数据库读取，避免常驻内存
+	var records []models.VectorRecord
+	if err := s.db.WithContext(ctx).Select("ref_id", "metadata").
+		Where("collection = ? AND ref_id IN ?", collectionName, ids).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load vector metadata: %w", err)
+	}
+	metadata := make(map[string]map[string]interface{}, len(records))
+	for _, record := range records {
+		var meta map[string]interface{}
+		if record.Metadata != "" {
+			_ = json.Unmarshal([]byte(record.Metadata), &meta)
+		}
+		metadata[record.RefID] = meta
+	}
+
+	results := make([]ai.SearchResult, 0, len(hits))
+	for i, hit := range hits {
+		meta, ok := metadata[ids[i]]
+		if !ok {
+			// 并发删除
+			continue
+		}
+		results = append(results, ai.SearchResult{ID: ids[i], Score: hit.score, Metadata: meta})
+	}
+	return results, nil
+}
+
+// Delete 删除集合内的向量
+func (s *Store) Delete(ctx context.Context, collectionName string, id string) error {
+	if err := s.db.WithContext(ctx).Where("collection = ? AND ref_id = ?", collectionName, id).
+		Delete(&models.VectorRecord{}).Error; err != nil {
+		return fmt.Errorf("failed to delete vector: %w", err)
+	}
+	c := s.collection(collectionName, 0, false)
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.index.remove(id) && c.index.deleted > compactMinDeleted && c.index.deleted > c.index.live() {
+		c.index = c.index.compact()
+	}
+	return nil
+}
+
+// DeleteCollection 删除整个集合
+func (s *Store) DeleteCollection(ctx context.Context, collectionName string) error {
+	if err := s.db.WithContext(ctx).Where("collection = ?", collectionName).
+		Delete(&models.VectorRecord{}).Error; err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	s.mu.Lock()
+	delete(s.collections, collectionName)
+	s.mu.Unlock()
+	return nil
+}
+
+// Count 返回集合内的向量数
+func (s *Store) Count(collectionName string) int {
+	c := s.collection(collectionName, 0, false)
+	if c == nil {
+		return 0
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.index.live()
+}
+
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, len(vector)*4)
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte, dim int) ([]float32, error) {
+	if len(buf) != dim*4 || dim == 0 {
+		return nil, fmt.Errorf("expected %d bytes, got %d", dim*4, len(buf))
+	}
+	vector := make([]float32, dim)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector, nil
+}
@@ -0,0 +1,132 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+)
+
+func setupStoreDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.VectorRecord{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestStorePersistsAndRebuilds(t *testing.T) {
+	ctx := context.Background()
+	db := setupStoreDB(t)
+	store, err := Open(db)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	userA, company := UserCollection("a"), CompanyCollection("c1")
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(store.Insert(ctx, userA, "north", []float32{0, 1, 0}, map[string]interface{}{"content": "north"}))
+	must(store.Insert(ctx, userA, "east", []float32{1, 0, 0}, map[string]interface{}{"content": "east"}))
+	must(store.Insert(ctx, company, "shared", []float32{0, 1, 0}, nil))
+
+	results, err := store.Search(ctx, userA, []float32{0.1, 0.9, 0}, 1)
+	must(err)
+	if len(results) != 1 || results[0].ID != "north" || results[0].Metadata["content"] != "north" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if store.Count(company) != 1 || store.Count(UserCollection("b")) != 0 {
+		t.Fatalf("collections must be isolated")
+	}
+
+	if err := store.Insert(ctx, userA, "bad", []float32{1, 0}, nil); err == nil {
+		t.Fatalf("expected dimension mismatch error")
+	}
+
+	// 覆盖与删除同样持久化，重新打开后索引一致
+	must(store.Insert(ctx, userA, "east", []float32{0, 0, 1}, map[string]interface{}{"content": "up"}))
+	must(store.Delete(ctx, userA, "north"))
+
+	reopened, err := Open(db)
+	must(err)
+	if reopened.Count(userA) != 1 || reopened.Count(company) != 1 {
+		t.Fatalf("expected rebuilt counts, got %d/%d", reopened.Count(userA), reopened.Count(company))
+	}
+	results, err = reopened.Search(ctx, userA, []float32{0, 0, 1}, 5)
+	must(err)
+	if len(results) != 1 || results[0].ID != "east" || results[0].Metadata["content"] != "up" || results[0].Score < 0.99 {
+		t.Fatalf("unexpected results after reopen: %+v", results)
+	}
+
+	must(reopened.DeleteCollection(ctx, company))
+	if reopened.Count(company) != 0 {
+		t.Fatalf("collection not deleted")
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const (
+		dim     = 24
+		size    = 2000
+		queries = 50
+		topK    = 10
+	)
+	rng := rand.New(rand.NewSource(42))
+	randomVector := func() []float32 {
+		v := make([]float32, dim)
+		for i := range v {
+			v[i] = float32(rng.NormFloat64())
+		}
+		return v
+	}
+
+	index := newHNSW(dim)
+	for i := 0; i < size; i++ {
+		index.add(fmt.Sprintf("v%d", i), randomVector())
+	}
+	// 删除一部分，检验墓碑不会出现在结果中
+	for i := 0; i < size; i += 10 {
+		index.remove(fmt.Sprintf("v%d", i))
+	}
+
+	hit, total := 0, 0
+	for q := 0; q < queries; q++ {
+		query := randomVector()
+		truth := map[int32]bool{}
+		for _, s := range index.exact(query, topK) {
+			truth[s.idx] = true
+		}
+		for _, s := range index.search(query, topK) {
+			if index.nodes[s.idx].deleted {
+				t.Fatalf("deleted node returned")
+			}
+			if truth[s.idx] {
+				hit++
+			}
+		}
+		total += topK
+	}
+	if recall := float64(hit) / float64(total); recall < 0.9 {
+		t.Fatalf("recall too low: %.2f", recall)
+	}
+
+	compacted := index.compact()
+	if compacted.live() != index.live() || compacted.deleted != 0 {
+		t.Fatalf("compact should drop tombstones: %d/%d", compacted.live(), compacted.deleted)
+	}
+}
@@ -0,0 +1,170 @@
+package webimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrInvalidURL 地址不是合法的 http/https URL
+	ErrInvalidURL = errors.New("invalid url: only absolute http and https urls are supported")
+	// ErrBlockedAddress 目标地址位于内网、回环或链路本地网段
+	ErrBlockedAddress = errors.New("url resolves to a private or local network address")
+	// ErrTooLarge 响应体超过大小上限
+	ErrTooLarge = errors.New("response body too large")
+	// ErrUnsupportedContent 无法提取正文的内容类型
+	ErrUnsupportedContent = errors.New("unsupported content type")
+)
+
+// FetcherConfig 抓取配置，零值使用默认值
+type FetcherConfig struct {
+	Timeout      time.Duration // 单次请求超时，默认 30s
+	MaxBytes     int64         // 响应体大小上限，默认 10MB
+	MaxRedirects int           // 最多跟随的重定向次数，默认 5
+	UserAgent    string
+	AllowPrivate bool // 允许访问内网地址（仅用于测试或内网部署）
+}
+
+func (c FetcherConfig) withDefaults() FetcherConfig {
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Second
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = 10 * 1024 * 1024
+	}
+	if c.MaxRedirects <= 0 {
+		c.MaxRedirects = 5
+	}
+	if c.UserAgent == "" {
+		c.UserAgent = "RoleCraft-Importer/1.0"
+	}
+	return c
+}
+
+// Resource 抓取到的原始内容
+type Resource struct {
+	URL         string // 跟随重定向后的最终地址
+	ContentType string
+	Charset     string
+	Body        []byte
+}
+
+// Fetcher HTTP 抓取器；默认拒绝解析到内网地址的请求（含重定向后的地址），防止 SSRF
+type Fetcher struct {
+	client *http.Client
+	cfg    FetcherConfig
+}
+
+// NewFetcher 创建抓取器
+func NewFetcher(cfg FetcherConfig) *Fetcher {
+	cfg = cfg.withDefaults()
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !cfg.AllowPrivate {
+		// 在连接建立前检查实际拨号的 IP，DNS 重绑定也无法绕过
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Fetcher{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > cfg.MaxRedirects {
+					return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+				}
+				if _, err := ParseURL(req.URL.String()); err != nil {
+					return err
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// blockedIP 回环、内网、链路本地、组播与未指定地址
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// ParseURL 校验并规范化导入地址：只接受带主机名的 http/https 地址，去掉片段
+func ParseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+	u.Fragment = ""
+	return u, nil
+}
+
+// Fetch 抓取地址内容
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Resource, error) {
+	u, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.cfg.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,text/plain;q=0.8,*/*;q=0.5")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			return nil, ErrBlockedAddress
+		}
+		return nil, fmt.Errorf("fetch %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("fetch %s: unexpected status %d", u, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.cfg.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", u, err)
+	}
+	if int64(len(body)) > f.cfg.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	res := &Resource{URL: resp.Request.URL.String(), Body: body}
+	res.ContentType, res.Charset = parseContentType(resp.Header.Get("Content-Type"), body)
+	return res, nil
+}
+
+// parseContentType 解析 Content-Type，缺失时按内容嗅探
+func parseContentType(header string, body []byte) (string, string) {
+	if header == "" {
+		header = http.DetectContentType(body)
+	}
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(header, ";")[0])), ""
+	}
+	return mediaType, params["charset"]
+}
@@ -0,0 +1,429 @@
+package webimport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/document"
+	"rolecraft-ai/internal/service/storage"
+)
+
+// 网页导入：抓取页面（或 sitemap 中的全部页面），提取正文转为 Markdown 文件后作为普通文档入库。
+// 设置了刷新间隔的文档由后台定期重新抓取，内容变化时生成新版本并重新入库。
+
+// ErrNoContent 页面中没有可提取的正文
+var ErrNoContent = errors.New("no readable content found")
+
+// Ingester 把文档加入入库队列，由 ingest.Queue 实现
+type Ingester interface {
+	Enqueue(documentID, userID string) (*models.IngestionJob, error)
+	Restart(documentID, userID string) (*models.IngestionJob, error)
+}
+
+// Config 导入配置，零值使用默认值
+type Config struct {
+	Blobs         storage.BlobStore // 保存 Markdown 文件的存储，默认 ./uploads 下的本地存储
+	MaxPages      int               // 单个 sitemap 最多导入的页面数，默认 50
+	CheckInterval time.Duration     // 扫描到期刷新文档的间隔，默认 1m
+	Fetcher       FetcherConfig
+}
+
+func (c Config) withDefaults() Config {
+	if c.Blobs == nil {
+		if local, err := storage.NewLocalStore("./uploads"); err == nil {
+			c.Blobs = local
+		}
+	}
+	if c.MaxPages <= 0 {
+		c.MaxPages = 50
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = time.Minute
+	}
+	return c
+}
+
+// maxSitemaps 单次导入最多读取的 sitemap 文件数（含索引中的子 sitemap）
+const maxSitemaps = 10
+
+// Request 导入请求
+type Request struct {
+	URL             string
+	UserID          string
+	CompanyID       string
+	WorkID          string
+	FolderID        string
+	RefreshInterval int  // 自动重新抓取间隔（分钟），0 表示不刷新
+	Sitemap         bool // 强制按 sitemap 解析，默认根据响应内容识别
+	MaxPages        int  // 覆盖 Config.MaxPages
+}
+
+// Failure 导入失败的页面
+type Failure struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// Result 导入结果
+type Result struct {
+	Documents []models.Document `json:"documents"`
+	Failed    []Failure         `json:"failed"`
+}
+
+// Importer 网页导入与定期刷新
+type Importer struct {
+	db      *gorm.DB
+	ingest  Ingester
+	fetcher *Fetcher
+	cfg     Config
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewImporter 创建导入器，需调用 Start 启动定期刷新
+func NewImporter(db *gorm.DB, ingest Ingester, cfg Config) *Importer {
+	cfg = cfg.withDefaults()
+	return &Importer{
+		db:      db,
+		ingest:  ingest,
+		fetcher: NewFetcher(cfg.Fetcher),
+		cfg:     cfg,
+	}
+}
+
+// Start 启动后台刷新；重复调用无效
+func (im *Importer) Start(parent context.Context) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(parent)
+	im.cancel = cancel
+
+	im.wg.Add(1)
+	go func() {
+		defer im.wg.Done()
+		ticker := time.NewTicker(im.cfg.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := im.RefreshDue(ctx); err != nil {
+					log.Printf("web import refresh failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台刷新并等待当前刷新结束
+func (im *Importer) Stop() {
+	im.mu.Lock()
+	cancel := im.cancel
+	im.cancel = nil
+	im.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		im.wg.Wait()
+	}
+}
+
+// Import 导入网页或 sitemap。单个页面失败时返回错误；sitemap 中的页面失败记录在 Result.Failed 中
+func (im *Importer) Import(ctx context.Context, req Request) (*Result, error) {
+	u, err := ParseURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	res, err := im.fetcher.Fetch(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Documents: []models.Document{}, Failed: []Failure{}}
+	if !req.Sitemap && !IsSitemap(res) {
+		doc, err := im.importPage(ctx, req, u.String(), res)
+		if err != nil {
+			return nil, err
+		}
+		result.Documents = append(result.Documents, *doc)
+		return result, nil
+	}
+
+	limit := req.MaxPages
+	if limit <= 0 || limit > im.cfg.MaxPages {
+		limit = im.cfg.MaxPages
+	}
+	pages, err := im.sitemapPages(ctx, res, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range pages {
+		doc, err := im.importPage(ctx, req, page, nil)
+		if err != nil {
+			result.Failed = append(result.Failed, Failure{URL: page, Error: err.Error()})
+			continue
+		}
+		result.Documents = append(result.Documents, *doc)
+	}
+	return result, nil
+}
+
+// sitemapPages 展开 sitemap（含 sitemap 索引），返回去重后的页面地址
+func (im *Importer) sitemapPages(ctx context.Context, root *Resource, limit int) ([]string, error) {
+	var pages []string
+	seenPages := map[string]bool{}
+	seenMaps := map[string]bool{root.URL: true}
+	queue := []*Resource{root}
+
+	for read := 0; len(queue) > 0 && read < maxSitemaps && len(pages) < limit; read++ {
+		res := queue[0]
+		queue = queue[1:]
+		sitemap, err := ParseSitemap(res.Body)
+		if err != nil {
+			if read == 0 {
+				return nil, fmt.Errorf("parse sitemap: %w", err)
+			}
+			log.Printf("skip sitemap %s: %v", res.URL, err)
+			continue
+		}
+		for _, loc := range sitemap.URLs {
+			if u, err := ParseURL(loc); err == nil && !seenPages[u.String()] && len(pages) < limit {
+				seenPages[u.String()] = true
+				pages = append(pages, u.String())
+			}
+		}
+		for _, loc := range sitemap.Sitemaps {
+			if seenMaps[loc] || len(seenMaps) >= maxSitemaps {
+				continue
+			}
+			seenMaps[loc] = true
+			child, err := im.fetcher.Fetch(ctx, loc)
+			if err != nil {
+				log.Printf("skip sitemap %s: %v", loc, err)
+				continue
+			}
+			queue = append(queue, child)
+		}
+	}
+	return pages, nil
+}
+
+// fetchPage 抓取并提取页面正文；res 不为空时直接使用已抓取的内容
+func (im *Importer) fetchPage(ctx context.Context, pageURL string, res *Resource) (*Page, error) {
+	if res == nil {
+		var err error
+		if res, err = im.fetcher.Fetch(ctx, pageURL); err != nil {
+			return nil, err
+		}
+	}
+	page, err := ToMarkdown(res)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(page.Markdown) == "" {
+		return nil, ErrNoContent
+	}
+	return page, nil
+}
+
+// importPage 导入单个页面；同一用户已导入过该地址时更新已有文档（内容变化时生成新版本）
+func (im *Importer) importPage(ctx context.Context, req Request, pageURL string, res *Resource) (*models.Document, error) {
+	page, err := im.fetchPage(ctx, pageURL, res)
+	if err != nil {
+		return nil, err
+	}
+	content := []byte(page.Markdown)
+	hash := contentHash(content)
+	now := time.Now()
+
+	var existing models.Document
+	err = im.db.Where("user_id = ? AND source_url = ? AND trashed_at IS NULL", req.UserID, pageURL).
+		Order("created_at ASC").First(&existing).Error
+	if err == nil {
+		existing.RefreshInterval = max(req.RefreshInterval, 0)
+		if _, err := im.update(ctx, &existing, page, content, hash, now); err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	id := models.NewUUID()
+	filePath, err := im.writeFile(ctx, id, content)
+	if err != nil {
+		return nil, err
+	}
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"sourceUrl": page.URL,
+		"title":     page.Title,
+	})
+	doc := models.Document{
+		ID:              id,
+		UserID:          req.UserID,
+		CompanyID:       req.CompanyID,
+		WorkID:          req.WorkID,
+		FolderID:        req.FolderID,
+		Name:            fileName(page.Title),
+		FileType:        "md",
+		FilePath:        filePath,
+		FileSize:        int64(len(content)),
+		ContentHash:     hash,
+		Version:         1,
+		Status:          "processing",
+		Metadata:        models.JSON(metadata),
+		SourceURL:       pageURL,
+		RefreshInterval: max(req.RefreshInterval, 0),
+		LastFetchedAt:   &now,
+		NextRefreshAt:   nextRefresh(req.RefreshInterval, now),
+		CreatedAt:       now,
+	}
+	if err := im.db.Create(&doc).Error; err != nil {
+		im.cfg.Blobs.Delete(ctx, filePath)
+		return nil, err
+	}
+	if err := document.EnsureInitialVersion(im.db, &doc); err != nil {
+		log.Printf("failed to record initial version of document %s: %v", doc.ID, err)
+	}
+	if _, err := im.ingest.Enqueue(doc.ID, doc.UserID); err != nil {
+		log.Printf("failed to enqueue document %s: %v", doc.ID, err)
+	}
+	return &doc, nil
+}
+
+// update 记录一次抓取：内容变化时写入新文件、追加版本并重新入库；同时更新刷新计划
+func (im *Importer) update(ctx context.Context, doc *models.Document, page *Page, content []byte, hash string, now time.Time) (bool, error) {
+	changed := hash != doc.ContentHash
+	if changed {
+		filePath, err := im.writeFile(ctx, models.NewUUID(), content)
+		if err != nil {
+			return false, err
+		}
+		if _, err := document.AddVersion(im.db, doc, models.DocumentVersion{
+			Name:        fileName(page.Title),
+			FileType:    "md",
+			FileSize:    int64(len(content)),
+			FilePath:    filePath,
+			ContentHash: hash,
+			CreatedBy:   doc.UserID,
+			CreatedAt:   now,
+		}); err != nil {
+			im.cfg.Blobs.Delete(ctx, filePath)
+			return false, err
+		}
+		if _, err := im.ingest.Restart(doc.ID, doc.UserID); err != nil {
+			log.Printf("failed to enqueue document %s: %v", doc.ID, err)
+		}
+		doc.Status = "processing"
+	}
+
+	doc.LastFetchedAt = &now
+	doc.NextRefreshAt = nextRefresh(doc.RefreshInterval, now)
+	err := im.db.Model(&models.Document{}).Where("id = ?", doc.ID).Updates(map[string]interface{}{
+		"refresh_interval": doc.RefreshInterval,
+		"last_fetched_at":  doc.LastFetchedAt,
+		"next_refresh_at":  doc.NextRefreshAt,
+	}).Error
+	return changed, err
+}
+
+// Refresh 重新抓取文档的来源地址，返回内容是否变化；抓取失败时在下一个间隔后重试
+func (im *Importer) Refresh(ctx context.Context, doc models.Document) (bool, error) {
+	if doc.SourceURL == "" {
+		return false, ErrInvalidURL
+	}
+	now := time.Now()
+	page, err := im.fetchPage(ctx, doc.SourceURL, nil)
+	if err != nil {
+		im.db.Model(&models.Document{}).Where("id = ?", doc.ID).
+			Update("next_refresh_at", nextRefresh(doc.RefreshInterval, now))
+		return false, err
+	}
+	content := []byte(page.Markdown)
+	return im.update(ctx, &doc, page, content, contentHash(content), now)
+}
+
+// RefreshDue 刷新所有到期的文档，返回内容发生变化的文档数
+func (im *Importer) RefreshDue(ctx context.Context) (int, error) {
+	var docs []models.Document
+	err := im.db.Where("source_url <> '' AND refresh_interval > 0 AND next_refresh_at <= ? AND trashed_at IS NULL", time.Now()).
+		Order("next_refresh_at ASC").Find(&docs).Error
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, doc := range docs {
+		if ctx.Err() != nil {
+			break
+		}
+		ok, err := im.Refresh(ctx, doc)
+		if err != nil {
+			log.Printf("failed to refresh document %s from %s: %v", doc.ID, doc.SourceURL, err)
+			continue
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, ctx.Err()
+}
+
+// writeFile 保存 Markdown 文件，返回对象键
+func (im *Importer) writeFile(ctx context.Context, id string, content []byte) (string, error) {
+	if im.cfg.Blobs == nil {
+		return "", errors.New("file storage is not configured")
+	}
+	key := id + ".md"
+	if err := im.cfg.Blobs.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/markdown"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func nextRefresh(minutes int, now time.Time) *time.Time {
+	if minutes <= 0 {
+		return nil
+	}
+	next := now.Add(time.Duration(minutes) * time.Minute)
+	return &next
+}
+
+// fileName 由页面标题生成文档名，去掉文件名中不允许的字符
+func fileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+	if name == "" {
+		name = "untitled"
+	}
+	return name + ".md"
+}
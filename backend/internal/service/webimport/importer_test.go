@@ -0,0 +1,230 @@
+package webimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"rolecraft-ai/internal/models"
+	"rolecraft-ai/internal/service/storage"
+)
+
+// fakeIngester 记录入队调用
+type fakeIngester struct {
+	mu        sync.Mutex
+	enqueued  []string
+	restarted []string
+}
+
+func (f *fakeIngester) Enqueue(documentID, userID string) (*models.IngestionJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enqueued = append(f.enqueued, documentID)
+	return &models.IngestionJob{DocumentID: documentID}, nil
+}
+
+func (f *fakeIngester) Restart(documentID, userID string) (*models.IngestionJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.restarted = append(f.restarted, documentID)
+	return &models.IngestionJob{DocumentID: documentID}, nil
+}
+
+// site 可在测试中修改页面内容的本地站点
+type site struct {
+	mu    sync.Mutex
+	pages map[string]string
+}
+
+func (s *site) set(path, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[path] = body
+}
+
+func (s *site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	body, ok := s.pages[r.URL.Path]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Path == "/sitemap.xml" || r.URL.Path == "/sitemap-docs.xml" {
+		w.Header().Set("Content-Type", "application/xml")
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	fmt.Fprint(w, body)
+}
+
+func setupImporter(t *testing.T, allowPrivate bool) (*gorm.DB, *Importer, *fakeIngester) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Document{}, &models.DocumentVersion{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingest := &fakeIngester{}
+	im := NewImporter(db, ingest, Config{
+		Blobs:   blobs,
+		Fetcher: FetcherConfig{AllowPrivate: allowPrivate},
+	})
+	return db, im, ingest
+}
+
+func article(title, body string) string {
+	return "<html><head><title>" + title + "</title></head><body><nav>导航</nav><article><h1>" + title +
+		"</h1><p>" + body + "</p></article></body></html>"
+}
+
+func TestImportPageAndRefresh(t *testing.T) {
+	s := &site{pages: map[string]string{"/guide": article("使用指南", "第一版内容")}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	db, im, ingest := setupImporter(t, true)
+	ctx := context.Background()
+
+	result, err := im.Import(ctx, Request{URL: server.URL + "/guide#intro", UserID: "u1", FolderID: "f1", RefreshInterval: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Documents) != 1 {
+		t.Fatalf("expected 1 document, got %+v", result)
+	}
+	doc := result.Documents[0]
+	if doc.SourceURL != server.URL+"/guide" || doc.Name != "使用指南.md" || doc.FileType != "md" || doc.FolderID != "f1" {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+	if doc.NextRefreshAt == nil || doc.NextRefreshAt.Sub(*doc.LastFetchedAt) != time.Hour {
+		t.Fatalf("unexpected refresh schedule %v %v", doc.LastFetchedAt, doc.NextRefreshAt)
+	}
+	content, err := storage.ReadAll(ctx, im.cfg.Blobs, doc.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "# 使用指南\n\n第一版内容\n" {
+		t.Fatalf("unexpected file content %q", content)
+	}
+	if len(ingest.enqueued) != 1 || ingest.enqueued[0] != doc.ID {
+		t.Fatalf("document not enqueued: %v", ingest.enqueued)
+	}
+
+	// 再次导入相同内容时复用已有文档，不生成新版本
+	again, err := im.Import(ctx, Request{URL: server.URL + "/guide", UserID: "u1", RefreshInterval: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Documents[0].ID != doc.ID || again.Documents[0].Version != 1 || len(ingest.restarted) != 0 {
+		t.Fatalf("unchanged page should not create a version: %+v %v", again.Documents[0], ingest.restarted)
+	}
+
+	// 未到期时不刷新
+	if changed, err := im.RefreshDue(ctx); err != nil || changed != 0 {
+		t.Fatalf("expected nothing due, got %d %v", changed, err)
+	}
+
+	// 到期后重新抓取，内容变化生成新版本并重新入库
+	s.set("/guide", article("使用指南", "第二版内容"))
+	db.Model(&models.Document{}).Where("id = ?", doc.ID).Update("next_refresh_at", time.Now().Add(-time.Minute))
+	if changed, err := im.RefreshDue(ctx); err != nil || changed != 1 {
+		t.Fatalf("expected 1 changed document, got %d %v", changed, err)
+	}
+	var refreshed models.Document
+	db.First(&refreshed, "id = ?", doc.ID)
+	if refreshed.Version != 2 || refreshed.ContentHash == doc.ContentHash || !refreshed.NextRefreshAt.After(time.Now()) {
+		t.Fatalf("unexpected refreshed document %+v", refreshed)
+	}
+	if len(ingest.restarted) != 1 {
+		t.Fatalf("document not re-ingested: %v", ingest.restarted)
+	}
+	var versions int64
+	db.Model(&models.DocumentVersion{}).Where("document_id = ?", doc.ID).Count(&versions)
+	if versions != 2 {
+		t.Fatalf("expected 2 versions, got %d", versions)
+	}
+
+	// 内容未变化时只更新抓取时间
+	if changed, err := im.Refresh(ctx, refreshed); err != nil || changed {
+		t.Fatalf("expected unchanged refresh, got %v %v", changed, err)
+	}
+
+	// 来源失效时返回错误，并在下一个间隔后重试
+	s.mu.Lock()
+	delete(s.pages, "/guide")
+	s.mu.Unlock()
+	if _, err := im.Refresh(ctx, refreshed); err == nil {
+		t.Fatal("expected error for missing page")
+	}
+}
+
+func TestImportSitemap(t *testing.T) {
+	s := &site{pages: map[string]string{
+		"/a": article("页面 A", "A 的内容"),
+		"/b": article("页面 B", "B 的内容"),
+	}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	s.set("/sitemap.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>`+server.URL+`/sitemap-docs.xml</loc></sitemap>
+</sitemapindex>`)
+	s.set("/sitemap-docs.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>`+server.URL+`/a</loc></url>
+  <url><loc>`+server.URL+`/b</loc></url>
+  <url><loc>`+server.URL+`/a</loc></url>
+  <url><loc>`+server.URL+`/missing</loc></url>
+</urlset>`)
+	_, im, ingest := setupImporter(t, true)
+
+	result, err := im.Import(context.Background(), Request{URL: server.URL + "/sitemap.xml", UserID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Documents) != 2 || len(result.Failed) != 1 || result.Failed[0].URL != server.URL+"/missing" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.Documents[0].NextRefreshAt != nil || len(ingest.enqueued) != 2 {
+		t.Fatalf("unexpected documents %+v", result.Documents)
+	}
+
+	limited, err := im.Import(context.Background(), Request{URL: server.URL + "/sitemap.xml", UserID: "u2", MaxPages: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limited.Documents) != 1 {
+		t.Fatalf("expected 1 document with maxPages, got %+v", limited)
+	}
+}
+
+func TestImportRejectsUnsafeURLs(t *testing.T) {
+	server := httptest.NewServer(&site{pages: map[string]string{"/": article("内网", "内容")}})
+	defer server.Close()
+	_, im, _ := setupImporter(t, false)
+
+	if _, err := im.Import(context.Background(), Request{URL: server.URL + "/", UserID: "u1"}); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("expected ErrBlockedAddress, got %v", err)
+	}
+	for _, raw := range []string{"file:///etc/passwd", "ftp://example.com/a", "/relative", ""} {
+		if _, err := im.Import(context.Background(), Request{URL: raw, UserID: "u1"}); !errors.Is(err, ErrInvalidURL) {
+			t.Fatalf("%q: expected ErrInvalidURL, got %v", raw, err)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package webimport
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// Page 提取出的网页正文
+type Page struct {
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Markdown string `json:"markdown"`
+}
+
+// ToMarkdown 把抓取结果转为 Markdown：HTML 提取正文，纯文本与 Markdown 原样保留
+func ToMarkdown(res *Resource) (*Page, error) {
+	base, err := url.Parse(res.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case res.ContentType == "text/html" || res.ContentType == "application/xhtml+xml":
+		contentType := res.ContentType
+		if res.Charset != "" {
+			contentType += "; charset=" + res.Charset
+		}
+		reader, err := charset.NewReader(bytes.NewReader(res.Body), contentType)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := html.Parse(reader)
+		if err != nil {
+			return nil, err
+		}
+		title, markdown := Readable(doc, base)
+		if title == "" {
+			title = titleFromURL(base)
+		}
+		return &Page{URL: res.URL, Title: title, Markdown: markdown}, nil
+	case res.ContentType == "text/plain" || res.ContentType == "text/markdown" || res.ContentType == "text/x-markdown":
+		text := string(bytes.TrimPrefix(res.Body, []byte("\xef\xbb\xbf")))
+		if !utf8.ValidString(text) {
+			text = strings.ToValidUTF8(text, "�")
+		}
+		return &Page{URL: res.URL, Title: titleFromURL(base), Markdown: strings.TrimSpace(text) + "\n"}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContent, res.ContentType)
+	}
+}
+
+// titleFromURL 没有标题时以地址的最后一段（或主机名）作为标题
+func titleFromURL(u *url.URL) string {
+	name := strings.Trim(path.Base(strings.TrimSuffix(u.Path, "/")), "/.")
+	if name == "" {
+		return u.Host
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+// Readable 提取 HTML 文档的标题与正文 Markdown：优先使用 main / article 元素，
+// 否则选择段落文字最多的容器；导航、页眉页脚、脚本等非正文元素被忽略
+func Readable(doc *html.Node, base *url.URL) (string, string) {
+	title := pageTitle(doc)
+	c := &converter{base: base}
+	blocks := c.blocks(mainContent(doc))
+	if title != "" && (len(blocks) == 0 || !strings.HasPrefix(blocks[0], "#")) {
+		blocks = append([]string{"# " + title}, blocks...)
+	}
+	if title == "" && len(blocks) > 0 && strings.HasPrefix(blocks[0], "# ") {
+		title = strings.TrimPrefix(blocks[0], "# ")
+	}
+	if len(blocks) == 0 {
+		return title, ""
+	}
+	return title, strings.Join(blocks, "\n\n") + "\n"
+}
+
+// pageTitle 依次取 og:title、<title>、第一个 <h1>
+func pageTitle(doc *html.Node) string {
+	if meta := findFirst(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Meta && attr(n, "property") == "og:title" && attr(n, "content") != ""
+	}); meta != nil {
+		return collapseSpaces(attr(meta, "content"))
+	}
+	for _, a := range []atom.Atom{atom.Title, atom.H1} {
+		if n := findFirst(doc, func(n *html.Node) bool { return n.DataAtom == a }); n != nil {
+			if t := collapseSpaces(textContent(n)); t != "" {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// mainContent 选出正文所在的元素
+func mainContent(doc *html.Node) *html.Node {
+	if n := findFirst(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Main || attr(n, "role") == "main"
+	}); n != nil {
+		return n
+	}
+	var articles []*html.Node
+	walk(doc, func(n *html.Node) bool {
+		if n.Type == html.ElementNode && skipped(n) {
+			return false
+		}
+		if n.DataAtom == atom.Article {
+			articles = append(articles, n)
+			return false
+		}
+		return true
+	})
+	if len(articles) == 1 {
+		return articles[0]
+	}
+
+	// 按段落文字长度给父元素与祖父元素打分
+	scores := map[*html.Node]int{}
+	var best *html.Node
+	walk(doc, func(n *html.Node) bool {
+		if n.Type == html.ElementNode && skipped(n) {
+			return false
+		}
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre {
+			return true
+		}
+		length := utf8.RuneCountInString(collapseSpaces(textContent(n)))
+		if length < 20 || n.Parent == nil {
+			return false
+		}
+		for i, ancestor := 0, n.Parent; i < 2 && ancestor != nil; i, ancestor = i+1, ancestor.Parent {
+			scores[ancestor] += length / (i + 1)
+			if best == nil || scores[ancestor] > scores[best] {
+				best = ancestor
+			}
+		}
+		return false
+	})
+	if best != nil {
+		return best
+	}
+	if body := findFirst(doc, func(n *html.Node) bool { return n.DataAtom == atom.Body }); body != nil {
+		return body
+	}
+	return doc
+}
+
+// skipTags 不属于正文的元素
+var skipTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Select: true, atom.Input: true, atom.Textarea: true,
+	atom.Iframe: true, atom.Svg: true, atom.Canvas: true, atom.Object: true, atom.Embed: true,
+	atom.Head: true, atom.Dialog: true,
+}
+
+// boilerplatePattern class 或 id 中表示边栏、评论、广告等非正文区域的关键字
+var boilerplatePattern = regexp.MustCompile(`(?i)(^|[\s_-])(sidebar|comments?|advert\w*|ads?|cookies?|share|social|popup|modal|newsletter|breadcrumbs?|related|menu)($|[\s_-])`)
+
+func skipped(n *html.Node) bool {
+	if skipTags[n.DataAtom] {
+		return true
+	}
+	if _, hidden := attrOK(n, "hidden"); hidden || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	if style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", ""); strings.Contains(style, "display:none") {
+		return true
+	}
+	if n.DataAtom == atom.Main || n.DataAtom == atom.Article || n.DataAtom == atom.Body {
+		return false
+	}
+	return boilerplatePattern.MatchString(attr(n, "class")) || boilerplatePattern.MatchString(attr(n, "id"))
+}
+
+// blockTags 块级元素，其余元素按行内内容处理
+var blockTags = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Center: true, atom.Dd: true,
+	atom.Details: true, atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Fieldset: true,
+	atom.Figcaption: true, atom.Figure: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true, atom.Hr: true, atom.Li: true, atom.Main: true,
+	atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true, atom.Summary: true,
+	atom.Table: true, atom.Ul: true, atom.Body: true, atom.Html: true,
+}
+
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// converter HTML 转 Markdown；块级内容以字符串切片返回，由调用方决定缩进与前缀
+type converter struct {
+	base *url.URL
+}
+
+// blocks 渲染节点的子节点，连续的行内内容合并为一个段落
+func (c *converter) blocks(n *html.Node) []string {
+	var out []string
+	var inline strings.Builder
+	flush := func() {
+		if text := normalizeInline(inline.String()); text != "" {
+			out = append(out, text)
+		}
+		inline.Reset()
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && skipped(child) {
+			continue
+		}
+		if child.Type == html.ElementNode && blockTags[child.DataAtom] {
+			flush()
+			out = append(out, c.block(child)...)
+			continue
+		}
+		inline.WriteString(c.inline(child))
+	}
+	flush()
+	return out
+}
+
+func (c *converter) block(n *html.Node) []string {
+	if level, ok := headingLevels[n.DataAtom]; ok {
+		text := strings.ReplaceAll(normalizeInline(c.inlineChildren(n)), "\n", " ")
+		if text == "" {
+			return nil
+		}
+		return []string{strings.Repeat("#", level) + " " + text}
+	}
+
+	switch n.DataAtom {
+	case atom.Pre:
+		code := strings.Trim(textContent(n), "\n")
+		if strings.TrimSpace(code) == "" {
+			return nil
+		}
+		lang := ""
+		if inner := findFirst(n, func(m *html.Node) bool { return m.DataAtom == atom.Code }); inner != nil {
+			for _, class := range strings.Fields(attr(inner, "class")) {
+				if l, ok := strings.CutPrefix(class, "language-"); ok {
+					lang = l
+					break
+				}
+			}
+		}
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return []string{fence + lang + "\n" + code + "\n" + fence}
+	case atom.Ul, atom.Ol:
+		return c.list(n)
+	case atom.Blockquote:
+		inner := c.blocks(n)
+		if len(inner) == 0 {
+			return nil
+		}
+		lines := strings.Split(strings.Join(inner, "\n\n"), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return []string{strings.Join(lines, "\n")}
+	case atom.Table:
+		if table := c.table(n); table != "" {
+			return []string{table}
+		}
+		return nil
+	case atom.Hr:
+		return []string{"---"}
+	default:
+		return c.blocks(n)
+	}
+}
+
+// list 渲染列表，嵌套内容缩进到列表标记之后
+func (c *converter) list(n *html.Node) []string {
+	var items []string
+	index := 1
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li || skipped(li) {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", index)
+		}
+		index++
+		content := c.blocks(li)
+		if len(content) == 0 {
+			continue
+		}
+		lines := strings.Split(strings.Join(content, "\n"), "\n")
+		indent := strings.Repeat(" ", len(marker))
+		for i := range lines {
+			if i == 0 {
+				lines[i] = marker + lines[i]
+			} else if lines[i] != "" {
+				lines[i] = indent + lines[i]
+			}
+		}
+		items = append(items, strings.Join(lines, "\n"))
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return []string{strings.Join(items, "\n")}
+}
+
+// table 渲染为 Markdown 表格，第一行作为表头
+func (c *converter) table(n *html.Node) string {
+	var rows [][]string
+	walk(n, func(m *html.Node) bool {
+		if m != n && m.DataAtom == atom.Table {
+			return false
+		}
+		if m.DataAtom != atom.Tr {
+			return true
+		}
+		var row []string
+		for cell := m.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+				text := strings.ReplaceAll(normalizeInline(c.inlineChildren(cell)), "\n", " ")
+				row = append(row, strings.ReplaceAll(text, "|", `\|`))
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+		return false
+	})
+	if len(rows) == 0 {
+		return ""
+	}
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	var b strings.Builder
+	writeRow := func(row []string) {
+		b.WriteString("|")
+		for i := 0; i < width; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			b.WriteString(" " + cell + " |")
+		}
+		b.WriteString("\n")
+	}
+	writeRow(rows[0])
+	b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (c *converter) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && skipped(child) {
+			continue
+		}
+		b.WriteString(c.inline(child))
+	}
+	return b.String()
+}
+
+// inline 渲染行内内容；源码中的空白折叠为空格，<br> 保留为换行
+func (c *converter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return whitespacePattern.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return "\n"
+	case atom.Strong, atom.B:
+		return wrapInline(c.inlineChildren(n), "**")
+	case atom.Em, atom.I:
+		return wrapInline(c.inlineChildren(n), "*")
+	case atom.Del, atom.S:
+		return wrapInline(c.inlineChildren(n), "~~")
+	case atom.Code, atom.Kbd, atom.Samp:
+		code := collapseSpaces(textContent(n))
+		if code == "" {
+			return ""
+		}
+		fence := "`"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + code + fence
+	case atom.A:
+		text := c.inlineChildren(n)
+		href := c.resolve(attr(n, "href"))
+		if href == "" || strings.TrimSpace(text) == "" {
+			return text
+		}
+		lead, inner, trail := splitSpaces(text)
+		return lead + "[" + inner + "](" + href + ")" + trail
+	case atom.Img:
+		src := c.resolve(attr(n, "src"))
+		if src == "" {
+			return ""
+		}
+		return "![" + collapseSpaces(attr(n, "alt")) + "](" + src + ")"
+	default:
+		if blockTags[n.DataAtom] {
+			// 行内上下文中的块级元素（如表格单元格中的 <p>）按空格分隔
+			return " " + strings.Join(c.blocks(n), " ") + " "
+		}
+		return c.inlineChildren(n)
+	}
+}
+
+// resolve 把链接转为绝对地址，忽略页内锚点与脚本链接
+func (c *converter) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if c.base != nil {
+		u = c.base.ResolveReference(u)
+	}
+	switch u.Scheme {
+	case "http", "https", "mailto":
+		return u.String()
+	default:
+		return ""
+	}
+}
+
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+// normalizeInline 逐行折叠空白并去掉空行
+func normalizeInline(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = collapseSpaces(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// wrapInline 用 marker 包裹内容，首尾空白留在标记之外
+func wrapInline(s, marker string) string {
+	lead, inner, trail := splitSpaces(s)
+	if inner == "" {
+		return s
+	}
+	return lead + marker + inner + marker + trail
+}
+
+func splitSpaces(s string) (string, string, string) {
+	inner := strings.TrimSpace(s)
+	if inner == "" {
+		return s, "", ""
+	}
+	start := strings.Index(s, inner)
+	return s[:start], inner, s[start+len(inner):]
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(m *html.Node) bool {
+		if m.Type == html.TextNode {
+			b.WriteString(m.Data)
+		}
+		return m.DataAtom != atom.Script && m.DataAtom != atom.Style
+	})
+	return b.String()
+}
+
+// walk 先序遍历，visit 返回 false 时不进入子节点
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walk(child, visit)
+	}
+}
+
+func findFirst(n *html.Node, match func(*html.Node) bool) *html.Node {
+	var found *html.Node
+	walk(n, func(m *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if m.Type == html.ElementNode && match(m) {
+			found = m
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func attr(n *html.Node, key string) string {
+	value, _ := attrOK(n, key)
+	return value
+}
+
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,87 @@
+package webimport
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestToMarkdownExtractsMainContent(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html><head><title>站点 | 部署指南</title><meta property="og:title" content="部署指南"><style>p{color:red}</style></head>
+<body>
+  <header><nav><a href="/">首页</a> <a href="/docs">文档</a></nav></header>
+  <div class="layout">
+    <div class="sidebar"><p>这是侧边栏中的一段推荐阅读文字，不应出现在正文中。</p></div>
+    <div class="content">
+      <h1>部署指南</h1>
+      <p>本文介绍如何在 <strong>生产环境</strong> 中部署服务，详见
+         <a href="../install#top">安装说明</a>。</p>
+      <h2>准备</h2>
+      <ul><li>安装 Docker</li><li>配置 <code>DATABASE_URL</code><ul><li>支持 SQLite</li></ul></li></ul>
+      <pre><code class="language-bash">docker compose up -d
+docker ps</code></pre>
+      <table><tr><th>参数</th><th>说明</th></tr><tr><td>PORT</td><td>监听端口<br>默认 8080</td></tr></table>
+      <blockquote><p>注意：请先备份数据。</p></blockquote>
+      <script>track()</script>
+    </div>
+    <div id="comments"><p>第一条评论：写得很好，非常有帮助，感谢分享经验。</p></div>
+  </div>
+  <footer><p>版权所有 © 2024 示例公司，保留所有权利。</p></footer>
+</body></html>`
+
+	got, err := ToMarkdown(&Resource{URL: "https://example.com/docs/deploy", ContentType: "text/html", Body: []byte(page)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# 部署指南\n\n" +
+		"本文介绍如何在 **生产环境** 中部署服务，详见 [安装说明](https://example.com/install#top)。\n\n" +
+		"## 准备\n\n" +
+		"- 安装 Docker\n- 配置 `DATABASE_URL`\n  - 支持 SQLite\n\n" +
+		"```bash\ndocker compose up -d\ndocker ps\n```\n\n" +
+		"| 参数 | 说明 |\n| --- | --- |\n| PORT | 监听端口 默认 8080 |\n\n" +
+		"> 注意：请先备份数据。\n"
+	if got.Markdown != want {
+		t.Fatalf("unexpected markdown:\n%s\nwant:\n%s", got.Markdown, want)
+	}
+	if got.Title != "部署指南" {
+		t.Fatalf("unexpected title %q", got.Title)
+	}
+}
+
+func TestToMarkdownFallbacks(t *testing.T) {
+	// 没有正文标题时以页面标题开头，<main> 优先于段落打分
+	page := `<html><head><title>更新日志</title></head><body>
+		<div><p>这是页面其他位置的一段很长很长很长很长的说明文字内容。</p></div>
+		<main><p>v1.2 修复了登录问题。</p></main></body></html>`
+	got, err := ToMarkdown(&Resource{URL: "https://example.com/changelog", ContentType: "text/html", Body: []byte(page)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Markdown != "# 更新日志\n\nv1.2 修复了登录问题。\n" {
+		t.Fatalf("unexpected markdown %q", got.Markdown)
+	}
+
+	// 纯文本原样保留，以路径最后一段作为标题
+	got, err = ToMarkdown(&Resource{URL: "https://example.com/notes/readme.txt", ContentType: "text/plain", Body: []byte("  第一行\n第二行\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "readme.txt" || got.Markdown != "第一行\n第二行\n" {
+		t.Fatalf("unexpected page %+v", got)
+	}
+
+	// GBK 编码的页面按声明的字符集解码
+	gbk := []byte("<html><body><p>\xd6\xd0\xce\xc4\xc4\xda\xc8\xdd</p></body></html>")
+	got, err = ToMarkdown(&Resource{URL: "https://example.com/", ContentType: "text/html", Charset: "gbk", Body: gbk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got.Markdown, "中文内容") || got.Title != "example.com" {
+		t.Fatalf("unexpected page %+v", got)
+	}
+
+	if _, err := ToMarkdown(&Resource{URL: "https://example.com/a.png", ContentType: "image/png"}); !errors.Is(err, ErrUnsupportedContent) {
+		t.Fatalf("expected ErrUnsupportedContent, got %v", err)
+	}
+}
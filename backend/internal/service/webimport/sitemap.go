@@ -0,0 +1,55 @@
+package webimport
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// Sitemap 解析后的 sitemap：URLs 为页面地址，Sitemaps 为 sitemap 索引中的子 sitemap 地址
+type Sitemap struct {
+	URLs     []string
+	Sitemaps []string
+}
+
+type sitemapXML struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// IsSitemap 判断抓取结果是否为 XML sitemap（urlset 或 sitemapindex）
+func IsSitemap(res *Resource) bool {
+	if !strings.Contains(res.ContentType, "xml") || res.ContentType == "application/xhtml+xml" {
+		return false
+	}
+	head := res.Body
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	return bytes.Contains(head, []byte("<urlset")) || bytes.Contains(head, []byte("<sitemapindex"))
+}
+
+// ParseSitemap 解析 sitemap 协议的 XML，忽略空地址
+func ParseSitemap(data []byte) (*Sitemap, error) {
+	var doc sitemapXML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	sitemap := &Sitemap{}
+	for _, u := range doc.URLs {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			sitemap.URLs = append(sitemap.URLs, loc)
+		}
+	}
+	for _, s := range doc.Sitemaps {
+		if loc := strings.TrimSpace(s.Loc); loc != "" {
+			sitemap.Sitemaps = append(sitemap.Sitemaps, loc)
+		}
+	}
+	return sitemap, nil
+}
@@ -0,0 +1,265 @@
+package workspace
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxScheduleDays 查找下一次触发时间的最大天数，超过则认为表达式永远不会触发（如 2 月 30 日）
+const maxScheduleDays = 366 * 5
+
+// CronSchedule 标准 5 段 cron 表达式：分 时 日 月 周。
+// 支持 *、列表、范围、步长、月份与星期名称（7 也表示周日），以及 @hourly/@daily/@weekly/@monthly/@yearly；
+// 日字段额外支持 L 表示每月最后一天。日与周同时限定时满足其一即可（与 Vixie cron 相同）
+type CronSchedule struct {
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	lastDay  bool // 日字段含 L
+	domStar  bool
+	dowStar  bool
+	hourStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: weekdayNames}
+)
+
+var weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron 解析 cron 表达式
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q, expected 5 fields", expr)
+	}
+
+	s := &CronSchedule{}
+	var err error
+	if s.minute, _, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, s.hourStar, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	domExpr := fields[2]
+	var parts []string
+	for _, part := range strings.Split(domExpr, ",") {
+		if strings.EqualFold(part, "L") {
+			s.lastDay = true
+			continue
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) > 0 {
+		if s.dom, s.domStar, err = domField.parse(strings.Join(parts, ",")); err != nil {
+			return nil, err
+		}
+	}
+	if s.month, _, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, s.dowStar, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	// 7 与 0 都表示周日
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// parse 解析单个字段，返回取值位图以及字段是否为 *
+func (f cronField) parse(expr string) (uint64, bool, error) {
+	var set uint64
+	star := expr == "*" || expr == "?"
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, false, fmt.Errorf("invalid step in %s field: %q", f.name, part)
+			}
+			rangeExpr, step = part[:i], n
+		}
+
+		var lo, hi int
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+			lo, hi = f.min, f.max
+			if f.name == dowField.name {
+				hi = 6
+			}
+		case strings.Contains(rangeExpr, "-"):
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, false, err
+			}
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, false, err
+			}
+			if lo > hi {
+				return 0, false, fmt.Errorf("invalid range in %s field: %q", f.name, part)
+			}
+		default:
+			v, err := f.value(rangeExpr)
+			if err != nil {
+				return 0, false, err
+			}
+			lo, hi = v, v
+			// "5/15" 表示从 5 开始每 15 个单位
+			if step > 1 {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, star, nil
+}
+
+func (f cronField) value(raw string) (int, error) {
+	if v, ok := f.names[strings.ToLower(raw)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value in %s field: %q (expected %d-%d)", f.name, raw, f.min, f.max)
+	}
+	return v, nil
+}
+
+// matchDay 日期（按当地日历）是否满足日、月、周字段
+func (s *CronSchedule) matchDay(date time.Time) bool {
+	if s.month&(1<<uint(date.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(date.Day())) != 0 || (s.lastDay && date.AddDate(0, 0, 1).Day() == 1)
+	dowMatch := s.dow&(1<<uint(date.Weekday())) != 0
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dowMatch
+	case s.dowStar:
+		return domMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next 返回 after 之后的第一次触发时间，按 loc 的当地时间匹配。
+// 夏令时开始时被跳过的时刻在跳变后立即触发；夏令时结束时重复的时刻，
+// 小时字段为 * 的表达式两次都触发，指定了小时的表达式只在第一次触发
+func (s *CronSchedule) Next(after time.Time, loc *time.Location) (time.Time, bool) {
+	local := after.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	hours := bitValues(s.hour)
+	minutes := bitValues(s.minute)
+	for i := 0; i < maxScheduleDays; i++ {
+		date := start.AddDate(0, 0, i)
+		if !s.matchDay(date) {
+			continue
+		}
+		var candidates []time.Time
+		for _, h := range hours {
+			for _, m := range minutes {
+				instants := resolveWallTime(date.Year(), date.Month(), date.Day(), h, m, loc)
+				if !s.hourStar {
+					instants = instants[:1]
+				}
+				for _, t := range instants {
+					if t.After(after) {
+						candidates = append(candidates, t)
+					}
+				}
+			}
+		}
+		if len(candidates) > 0 {
+			sort.Slice(candidates, func(a, b int) bool { return candidates[a].Before(candidates[b]) })
+			return candidates[0], true
+		}
+	}
+	return time.Time{}, false
+}
+
+func bitValues(set uint64) []int {
+	values := make([]int, 0, bits.OnesCount64(set))
+	for set != 0 {
+		v := bits.TrailingZeros64(set)
+		values = append(values, v)
+		set &^= 1 << uint(v)
+	}
+	return values
+}
+
+// resolveWallTime 当地时间对应的时刻：通常只有一个；夏令时开始时不存在的时刻返回跳变时刻；
+// 夏令时结束时重复出现的时刻按先后返回两个
+func resolveWallTime(year int, month time.Month, day, hour, minute int, loc *time.Location) []time.Time {
+	wall := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	t := time.Date(year, month, day, hour, minute, 0, 0, loc)
+	start, end := t.ZoneBounds()
+	if !wallClock(t).Equal(wall) {
+		if wallClock(t).After(wall) && !start.IsZero() {
+			return []time.Time{start}
+		}
+		if !end.IsZero() {
+			return []time.Time{end}
+		}
+		return []time.Time{t}
+	}
+
+	instants := []time.Time{t}
+	if !start.IsZero() {
+		_, offset := start.Add(-time.Second).Zone()
+		if alt := wall.Add(-time.Duration(offset) * time.Second); alt.Before(start) && wallClock(alt.In(loc)).Equal(wall) {
+			instants = []time.Time{alt.In(loc), t}
+		}
+	}
+	if !end.IsZero() {
+		_, offset := end.Zone()
+		if alt := wall.Add(-time.Duration(offset) * time.Second); !alt.Before(end) && wallClock(alt.In(loc)).Equal(wall) {
+			instants = append(instants, alt.In(loc))
+		}
+	}
+	return instants
+}
+
+// wallClock 把当地时间表示为同样读数的 UTC 时间，便于比较
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
@@ -0,0 +1,91 @@
+package workspace
+
+import (
+	"testing"
+	"time"
+)
+
+func nextRuns(t *testing.T, expr string, loc *time.Location, after time.Time, n int) []string {
+	t.Helper()
+	s, err := ParseCron(expr)
+	if err != nil {
+		t.Fatalf("parse %q: %v", expr, err)
+	}
+	var out []string
+	for i := 0; i < n; i++ {
+		next, ok := s.Next(after, loc)
+		if !ok {
+			t.Fatalf("%q never fires after %v", expr, after)
+		}
+		out = append(out, next.Format("2006-01-02 15:04 MST"))
+		after = next
+	}
+	return out
+}
+
+func assertRuns(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "*/15 9-17 * * 1-5", "0 0 1,15,L * *", "5/20 * * jan-mar SUN,sat", "0 12 * * 7", "@weekly"} {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("%q: unexpected error %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	after := time.Date(2026, 1, 30, 10, 0, 0, 0, shanghai) // 周五
+
+	// 工作日每天 9:00 与 17:30
+	assertRuns(t, nextRuns(t, "0,30 9,17 * * mon-fri", shanghai, after, 3),
+		"2026-01-30 17:00 CST", "2026-01-30 17:30 CST", "2026-02-02 09:00 CST")
+	// 每月最后一天（含闰年 2 月）
+	assertRuns(t, nextRuns(t, "0 18 L * *", shanghai, time.Date(2028, 1, 31, 19, 0, 0, 0, shanghai), 3),
+		"2028-02-29 18:00 CST", "2028-03-31 18:00 CST", "2028-04-30 18:00 CST")
+	// 日与周同时限定时满足其一即可
+	assertRuns(t, nextRuns(t, "0 8 1 * sun", shanghai, after, 3),
+		"2026-02-01 08:00 CST", "2026-02-08 08:00 CST", "2026-02-15 08:00 CST")
+	// 31 日只在有 31 日的月份触发
+	assertRuns(t, nextRuns(t, "0 0 31 * *", shanghai, after, 2),
+		"2026-01-31 00:00 CST", "2026-03-31 00:00 CST")
+
+	never, _ := ParseCron("0 0 30 2 *")
+	if _, ok := never.Next(after, shanghai); ok {
+		t.Fatalf("February 30th must never fire")
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	// 夏令时开始（3 月 8 日 2:00 跳到 3:00）：被跳过的 2:30 在跳变时触发，之后恢复 2:30
+	assertRuns(t, nextRuns(t, "30 2 * * *", newYork, time.Date(2026, 3, 7, 12, 0, 0, 0, newYork), 3),
+		"2026-03-08 03:00 EDT", "2026-03-09 02:30 EDT", "2026-03-10 02:30 EDT")
+	// 夏令时结束（11 月 1 日 1:00-2:00 重复）：指定小时的任务只运行一次
+	assertRuns(t, nextRuns(t, "30 1 * * *", newYork, time.Date(2026, 10, 31, 12, 0, 0, 0, newYork), 2),
+		"2026-11-01 01:30 EDT", "2026-11-02 01:30 EST")
+	// 小时为 * 的任务在重复的一小时内两次都运行，跳过的一小时不运行
+	assertRuns(t, nextRuns(t, "*/30 * * * *", newYork, time.Date(2026, 11, 1, 0, 40, 0, 0, newYork), 5),
+		"2026-11-01 01:00 EDT", "2026-11-01 01:30 EDT", "2026-11-01 01:00 EST", "2026-11-01 01:30 EST", "2026-11-01 02:00 EST")
+	assertRuns(t, nextRuns(t, "*/30 * * * *", newYork, time.Date(2026, 3, 8, 1, 10, 0, 0, newYork), 3),
+		"2026-03-08 01:30 EST", "2026-03-08 03:00 EDT", "2026-03-08 03:30 EDT")
+}
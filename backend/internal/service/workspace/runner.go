@@ -152,6 +152,13 @@ func (r *Runner) ExecuteClaimed(ctx context.Context, work *models.Work, triggerS
 		}
 		run.FinalAnswer = sanitizeText(result.FinalAnswer)
 		run.Confidence = result.Confidence
+		run.PromptTokens, run.CompletionTokens, run.TokensUsed = result.TotalUsage()
+		for _, step := range result.Steps {
+			if step.Model != "" {
+				run.ModelID = step.Model
+				break
+			}
+		}
 		run.Trace = models.ToJSON(tracePayload)
 
 		work.ResultSummary = run.Summary
@@ -342,10 +349,15 @@ func sanitizeSteps(steps []collab.AgentStep) []collab.AgentStep {
 			continue
 		}
 		out = append(out, collab.AgentStep{
-			Agent:      agent,
-			Purpose:    purpose,
-			Output:     output,
-			DurationMs: step.DurationMs,
+			Agent:            agent,
+			Purpose:          purpose,
+			Output:           output,
+			DurationMs:       step.DurationMs,
+			PromptTokens:     step.PromptTokens,
+			CompletionTokens: step.CompletionTokens,
+			TokensUsed:       step.TokensUsed,
+			Model:            step.Model,
+			Provider:         step.Provider,
 		})
 	}
 	if len(out) == 0 {
@@ -54,26 +54,14 @@ func ComputeNextRunAt(triggerType, triggerValue, timezone string, now time.Time)
 			return nil, fmt.Errorf("invalid once triggerValue: %w", err)
 		}
 		return &parsed, nil
-	case "daily":
-		if value == "" {
-			return nil, fmt.Errorf("triggerValue required when triggerType=daily (HH:MM)")
-		}
-		parts := strings.Split(value, ":")
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid daily triggerValue, expected HH:MM")
-		}
-		hour, err := strconv.Atoi(parts[0])
-		if err != nil || hour < 0 || hour > 23 {
-			return nil, fmt.Errorf("invalid daily hour")
-		}
-		minute, err := strconv.Atoi(parts[1])
-		if err != nil || minute < 0 || minute > 59 {
-			return nil, fmt.Errorf("invalid daily minute")
+	case "daily", "weekly", "monthly", "cron":
+		schedule, err := ParseTrigger(mode, value)
+		if err != nil {
+			return nil, err
 		}
-		base := now.In(location)
-		next := time.Date(base.Year(), base.Month(), base.Day(), hour, minute, 0, 0, location)
-		if !next.After(base) {
-			next = next.Add(24 * time.Hour)
+		next, ok := schedule.Next(now, location)
+		if !ok {
+			return nil, fmt.Errorf("%s trigger never fires", mode)
 		}
 		return &next, nil
 	case "interval_hours":
@@ -91,6 +79,101 @@ func ComputeNextRunAt(triggerType, triggerValue, timezone string, now time.Time)
 	}
 }
 
+// ParseTrigger 把日历类触发配置转换为 cron 表达式：
+// daily "HH:MM"；weekly "星期列表 HH:MM"（如 "mon,fri 09:00"，也可用 0-7 表示）；
+// monthly "日期列表 HH:MM"（如 "1,15 09:00"，last 表示每月最后一天，当月没有的日期跳过）；cron 为 5 段表达式
+func ParseTrigger(triggerType, triggerValue string) (*CronSchedule, error) {
+	mode := strings.TrimSpace(triggerType)
+	value := strings.TrimSpace(triggerValue)
+	if value == "" {
+		switch mode {
+		case "daily":
+			return nil, fmt.Errorf("triggerValue required when triggerType=daily (HH:MM)")
+		case "weekly":
+			return nil, fmt.Errorf("triggerValue required when triggerType=weekly (e.g. mon,fri 09:00)")
+		case "monthly":
+			return nil, fmt.Errorf("triggerValue required when triggerType=monthly (e.g. 1,last 09:00)")
+		}
+		return nil, fmt.Errorf("triggerValue required when triggerType=%s", mode)
+	}
+
+	switch mode {
+	case "daily":
+		hour, minute, err := parseClock(mode, value)
+		if err != nil {
+			return nil, err
+		}
+		return ParseCron(fmt.Sprintf("%d %d * * *", minute, hour))
+	case "weekly", "monthly":
+		fields := strings.Fields(value)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid %s triggerValue, expected \"<days> HH:MM\"", mode)
+		}
+		hour, minute, err := parseClock(mode, fields[1])
+		if err != nil {
+			return nil, err
+		}
+		days := strings.ToLower(fields[0])
+		if mode == "weekly" {
+			if strings.ContainsAny(days, "*/") {
+				return nil, fmt.Errorf("invalid weekly days %q", fields[0])
+			}
+			return ParseCron(fmt.Sprintf("%d %d * * %s", minute, hour, days))
+		}
+		list := strings.Split(days, ",")
+		for i, day := range list {
+			if day == "last" {
+				list[i] = "L"
+			} else if _, err := strconv.Atoi(day); err != nil && !strings.Contains(day, "-") {
+				return nil, fmt.Errorf("invalid monthly days %q", fields[0])
+			}
+		}
+		return ParseCron(fmt.Sprintf("%d %d %s * *", minute, hour, strings.Join(list, ",")))
+	case "cron":
+		return ParseCron(value)
+	}
+	return nil, fmt.Errorf("unsupported triggerType: %s", mode)
+}
+
+// parseClock 解析 HH:MM
+func parseClock(mode, value string) (int, int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid %s triggerValue, expected HH:MM", mode)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("invalid %s hour", mode)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid %s minute", mode)
+	}
+	return hour, minute, nil
+}
+
+// PreviewRuns 返回 now 之后最多 count 次触发时间（按触发配置的时区表示），用于保存前检查计划
+func PreviewRuns(triggerType, triggerValue, timezone string, now time.Time, count int) ([]time.Time, error) {
+	runs := []time.Time{}
+	next, err := ComputeNextRunAt(triggerType, triggerValue, timezone, now)
+	if err != nil || next == nil {
+		return runs, err
+	}
+	if strings.TrimSpace(triggerType) == "once" {
+		if next.After(now) {
+			runs = append(runs, *next)
+		}
+		return runs, nil
+	}
+	for next != nil && len(runs) < count {
+		runs = append(runs, *next)
+		if next, err = ComputeNextRunAt(triggerType, triggerValue, timezone, *next); err != nil {
+			break
+		}
+	}
+	return runs, nil
+}
+
 // DefaultAsyncStatus 触发类型对应的默认异步状态。
 func DefaultAsyncStatus(triggerType string) string {
 	switch strings.TrimSpace(triggerType) {
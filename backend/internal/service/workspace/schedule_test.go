@@ -44,3 +44,82 @@ func TestDefaultAsyncStatus(t *testing.T) {
 		t.Fatalf("expected scheduled for daily, got %s", got)
 	}
 }
+
+func TestComputeNextRunAt_CalendarTriggers(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	now := time.Date(2026, 1, 30, 10, 0, 0, 0, shanghai) // 周五
+
+	cases := []struct {
+		triggerType, triggerValue string
+		want                      time.Time
+	}{
+		{"daily", "09:00", time.Date(2026, 1, 31, 9, 0, 0, 0, shanghai)},
+		{"weekly", "mon,fri 09:30", time.Date(2026, 2, 2, 9, 30, 0, 0, shanghai)},
+		{"weekly", "5 18:00", time.Date(2026, 1, 30, 18, 0, 0, 0, shanghai)},
+		{"monthly", "1,15 08:00", time.Date(2026, 2, 1, 8, 0, 0, 0, shanghai)},
+		{"monthly", "last 20:00", time.Date(2026, 1, 31, 20, 0, 0, 0, shanghai)},
+		{"cron", "0 9 * * 1-5", time.Date(2026, 2, 2, 9, 0, 0, 0, shanghai)},
+	}
+	for _, tc := range cases {
+		next, err := ComputeNextRunAt(tc.triggerType, tc.triggerValue, "Asia/Shanghai", now)
+		if err != nil {
+			t.Fatalf("%s %q: unexpected err: %v", tc.triggerType, tc.triggerValue, err)
+		}
+		if next == nil || !next.Equal(tc.want) {
+			t.Fatalf("%s %q: expected %v, got %v", tc.triggerType, tc.triggerValue, tc.want, next)
+		}
+	}
+
+	for _, tc := range [][2]string{{"weekly", ""}, {"weekly", "funday 09:00"}, {"weekly", "mon"}, {"weekly", "*/2 09:00"},
+		{"monthly", "32 09:00"}, {"monthly", "first 09:00"}, {"cron", "0 9 * *"}, {"cron", "0 0 30 2 *"}} {
+		if _, err := ComputeNextRunAt(tc[0], tc[1], "Asia/Shanghai", now); err == nil {
+			t.Fatalf("%s %q: expected validation err", tc[0], tc[1])
+		}
+	}
+}
+
+func TestComputeNextRunAt_DailyAcrossDST(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	// 3 月 29 日夏令时开始，当天只有 23 小时，仍在当地 09:00 运行
+	now := time.Date(2026, 3, 28, 10, 0, 0, 0, time.UTC)
+	next, err := ComputeNextRunAt("daily", "09:00", "Europe/Berlin", now)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := next.Format("2006-01-02 15:04 MST"); got != "2026-03-29 09:00 CEST" {
+		t.Fatalf("expected 09:00 local time, got %s", got)
+	}
+}
+
+func TestPreviewRuns(t *testing.T) {
+	now := time.Date(2026, 1, 30, 10, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	runs, err := PreviewRuns("monthly", "last 09:00", "Asia/Shanghai", now, 3)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := []string{"2026-01-31", "2026-02-28", "2026-03-31"}
+	if len(runs) != len(want) {
+		t.Fatalf("expected %d runs, got %v", len(want), runs)
+	}
+	for i, run := range runs {
+		if got := run.Format("2006-01-02"); got != want[i] || run.Hour() != 9 {
+			t.Fatalf("run %d: expected %s 09:00, got %v", i, want[i], run)
+		}
+	}
+
+	runs, _ = PreviewRuns("interval_hours", "6", "Asia/Shanghai", now, 4)
+	if len(runs) != 4 || runs[3].Sub(now) != 24*time.Hour {
+		t.Fatalf("unexpected interval runs %v", runs)
+	}
+	if runs, _ := PreviewRuns("once", "2026-01-01 09:00", "Asia/Shanghai", now, 5); len(runs) != 0 {
+		t.Fatalf("past once trigger should not fire, got %v", runs)
+	}
+	if runs, err := PreviewRuns("manual", "", "Asia/Shanghai", now, 5); err != nil || len(runs) != 0 {
+		t.Fatalf("manual trigger has no runs, got %v %v", runs, err)
+	}
+	if _, err := PreviewRuns("cron", "bad", "Asia/Shanghai", now, 5); err == nil {
+		t.Fatalf("expected error for invalid cron")
+	}
+}
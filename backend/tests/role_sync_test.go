@@ -23,7 +23,7 @@ func TestRoleAnythingLLMSync(t *testing.T) {
 	assert.NoError(t, err)
 
 	// 自动迁移
-	err = db.AutoMigrate(&models.Role{})
+	err = db.AutoMigrate(&models.Role{}, &models.RoleKnowledgeBinding{})
 	assert.NoError(t, err)
 
 	// 加载配置
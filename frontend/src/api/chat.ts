@@ -8,6 +8,9 @@ export interface ChatSession {
   title: string;
   mode: 'quick' | 'task';
   modelConfig?: Record<string, any>;
+  titleSource?: 'user' | 'auto';
+  summary?: string;
+  summarizedAt?: string;
   createdAt: string;
   updatedAt: string;
 }
@@ -29,6 +32,33 @@ const parseModelConfig = (value: unknown): Record<string, any> | undefined => {
   return undefined;
 };
 
+// 全文检索命中的消息片段
+export interface SearchMatch {
+  kind: 'message' | 'session';
+  refId: string;
+  sessionId?: string;
+  messageId?: string;
+  role?: string;
+  snippet?: string;
+  score: number;
+  createdAt: string;
+}
+
+export interface SessionSearchResult extends ChatSession {
+  highlightedTitle?: string;
+  highlightedSummary?: string;
+  score: number;
+  matches: SearchMatch[];
+}
+
+export interface SessionSearchFilters {
+  role?: 'user' | 'assistant' | 'system';
+  from?: string;
+  to?: string;
+  archived?: boolean;
+  limit?: number;
+}
+
 const normalizeSession = (session: any): ChatSession => ({
   ...session,
   modelConfig: parseModelConfig(session?.modelConfig),
@@ -41,6 +71,10 @@ export interface Message {
   role: 'user' | 'assistant' | 'system';
   content: string;
   sources?: MessageMeta;
+  parentId?: string;
+  siblingIndex?: number;
+  siblingCount?: number;
+  status?: 'interrupted' | string;
   createdAt: string;
 }
 
@@ -50,6 +84,23 @@ export interface MessageMeta {
   thoughts?: string[];
 }
 
+// 回答中 [n] 引用标记对应的知识库片段
+export interface Citation {
+  marker: number;
+  documentId: string;
+  documentName: string;
+  chunkId: string;
+  headingPath: string;
+  page?: number;
+  sheet?: string;
+  startOffset: number;
+  endOffset: number;
+  score: number;
+  passage: string;
+  highlighted: string;
+  stale: boolean;
+}
+
 interface StreamWithThinkingHandlers {
   onThinking?: (content: string) => void;
   onChunk: (chunk: string) => void;
@@ -414,6 +465,7 @@ export const chatApi = {
     oldRoleId: string;
     newRoleId: string;
     newRoleName: string;
+    knowledgeScope: string;
   }> => {
     try {
       const response = await client.post<ApiResponse<{
@@ -421,6 +473,7 @@ export const chatApi = {
         oldRoleId: string;
         newRoleId: string;
         newRoleName: string;
+        knowledgeScope: string;
       }>>(`/chat-sessions/${sessionId}/switch-role`, { roleId });
       return response.data.data;
     } catch (error) {
@@ -497,10 +550,10 @@ export const chatApi = {
   },
 
   // 搜索会话
-  search: async (query: string): Promise<ChatSession[]> => {
+  search: async (query: string, filters: SessionSearchFilters = {}): Promise<SessionSearchResult[]> => {
     try {
-      const response = await client.post<ApiResponse<ChatSession[]>>('/chat-sessions/search', { query });
-      return (response.data.data || []).map(normalizeSession);
+      const response = await client.post<ApiResponse<SessionSearchResult[]>>('/chat-sessions/search', { query, ...filters });
+      return (response.data.data || []).map((item) => ({ ...item, ...normalizeSession(item) }));
     } catch (error) {
       throw handleApiError(error);
     }
@@ -536,6 +589,51 @@ export const chatApi = {
     }
   },
 
+  // 中止进行中的回复生成（已生成部分会保存并标记为 interrupted）
+  cancelGeneration: async (sessionId: string, messageId?: string): Promise<{ cancelled: boolean }> => {
+    try {
+      const response = await client.post<ApiResponse<{ cancelled: boolean }>>(
+        `/chat/${sessionId}/cancel`,
+        messageId ? { messageId } : undefined
+      );
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 获取消息的全部分支（重新生成 / 编辑产生）
+  listSiblings: async (sessionId: string, messageId: string): Promise<{
+    siblings: Message[];
+    activeId: string;
+  }> => {
+    try {
+      const response = await client.get<ApiResponse<{
+        siblings: Message[];
+        activeId: string;
+      }>>(`/chat/${sessionId}/messages/${messageId}/siblings`);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 切换到包含指定消息的分支，返回新的活动路径
+  activateBranch: async (sessionId: string, messageId: string): Promise<{
+    activeLeafId: string;
+    messages: Message[];
+  }> => {
+    try {
+      const response = await client.post<ApiResponse<{
+        activeLeafId: string;
+        messages: Message[];
+      }>>(`/chat/${sessionId}/messages/${messageId}/activate`);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
   // 点赞/点踩
   rateMessage: async (messageId: string, rating: 'up' | 'down'): Promise<{
     messageId: string;
@@ -552,6 +650,22 @@ export const chatApi = {
     }
   },
 
+  // 获取回答中引用标记对应的原文片段
+  getCitations: async (messageId: string): Promise<{
+    messageId: string;
+    citations: Citation[];
+  }> => {
+    try {
+      const response = await client.get<ApiResponse<{
+        messageId: string;
+        citations: Citation[];
+      }>>(`/chat/messages/${messageId}/citations`);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
   // 删除会话
   deleteSession: async (sessionId: string): Promise<void> => {
     try {
@@ -1,11 +1,13 @@
 import type { ApiResponse } from './client';
 import client, { handleApiError } from './client';
+import type { ChunkStrategy } from './document';
 
 export interface Company {
   id: string;
   ownerId: string;
   name: string;
   description?: string;
+  chunkStrategy?: ChunkStrategy; // 公司文档的默认分块策略
   createdAt: string;
   updatedAt: string;
 }
@@ -76,7 +78,7 @@ export const companyApi = {
     }
   },
 
-  create: async (payload: { name: string; description?: string }): Promise<Company> => {
+  create: async (payload: { name: string; description?: string; chunkStrategy?: ChunkStrategy }): Promise<Company> => {
     try {
       const res = await client.post<ApiResponse<Company>>('/companies', payload);
       return res.data.data;
@@ -10,25 +10,290 @@ export interface Document {
   filePath: string;
   status: 'pending' | 'processing' | 'completed' | 'failed';
   chunkCount?: number;
+  contentHash?: string;
+  version?: number;
+  duplicate?: boolean; // 上传内容与已有文档相同，返回的是已有文档
+  parentId?: string; // 父文档 ID，如邮件附件所属的邮件
+  sourceUrl?: string; // 从网页导入时的来源地址
+  refreshInterval?: number; // 自动重新抓取间隔（分钟）
+  lastFetchedAt?: string;
+  nextRefreshAt?: string;
   createdAt: string;
 }
 
+// 压缩包或邮件上传时未导入的条目
+export interface SkippedEntry {
+  path: string;
+  reason: string;
+}
+
+export interface ArchiveUploadResult {
+  documents: Document[];
+  skipped: SkippedEntry[];
+}
+
+// 网页导入
+export interface ImportUrlRequest {
+  url: string;
+  folderId?: string;
+  refreshInterval?: number; // 分钟，0 表示不自动刷新
+  sitemap?: boolean; // 强制按 sitemap 解析
+  maxPages?: number;
+}
+
+export interface ImportUrlResult {
+  documents: Document[];
+  failed: { url: string; error: string }[];
+}
+
+// 文档版本
+export interface DocumentVersion {
+  id: string;
+  documentId: string;
+  version: number;
+  name: string;
+  fileType: string;
+  fileSize: number;
+  contentHash: string;
+  restoredFrom?: number;
+  createdBy: string;
+  createdAt: string;
+}
+
+export interface DocumentVersionList {
+  documentId: string;
+  currentVersion: number;
+  versions: DocumentVersion[];
+}
+
+// 版本差异中的一行
+export interface DocumentDiffLine {
+  op: 'equal' | 'insert' | 'delete';
+  text: string;
+  oldLine?: number;
+  newLine?: number;
+}
+
+export interface DocumentDiffHunk {
+  oldStart: number;
+  oldLines: number;
+  newStart: number;
+  newLines: number;
+  lines: DocumentDiffLine[];
+}
+
+export interface DocumentVersionDiff {
+  from: DocumentVersion;
+  to: DocumentVersion;
+  added: number;
+  removed: number;
+  hunks: DocumentDiffHunk[];
+  unified: string;
+}
+
+// 分块策略：auto 按文件类型选择（CSV / XLSX 为 table，其余为 markdown）
+export type ChunkStrategy = 'auto' | 'markdown' | 'token' | 'sentence' | 'table';
+
 export interface Folder {
   id: string;
   name: string;
   parentId?: string;
   documentCount?: number;
+  trashedAt?: string;
+  chunkStrategy?: ChunkStrategy; // 未设置时沿用上级文件夹或公司配置
   createdAt: string;
 }
 
+// 文件夹树节点（documentCount 为直接包含的文档数，totalDocumentCount 含子文件夹）
+export interface FolderNode extends Folder {
+  documentCount: number;
+  totalDocumentCount: number;
+  children: FolderNode[];
+}
+
+export interface FolderTree {
+  folders: FolderNode[];
+  unfiledDocCount: number;
+}
+
+export interface TrashedFolder extends Folder {
+  folderCount: number;
+  documentCount: number;
+}
+
+export interface DeleteFolderOptions {
+  mode?: 'trash' | 'permanent';
+  documents?: 'include' | 'move';
+}
+
+// 检索命中的分块（score 为关键词与向量结果的融合分）
+export interface DocumentChunkHit {
+  chunkId: string;
+  documentId: string;
+  documentName: string;
+  ordinal: number;
+  content: string;
+  headingPath: string;
+  page?: number;
+  sheet?: string;
+  startOffset: number;
+  endOffset: number;
+  score: number;
+  keywordRank?: number;
+  keywordScore?: number;
+  vectorRank?: number;
+  vectorScore?: number;
+  snippet: string;
+}
+
+export interface DocumentSearchHit extends Document {
+  highlightedName?: string;
+  snippet?: string;
+  textScore?: number;
+  similarity?: number;
+  chunks?: DocumentChunkHit[];
+}
+
+// 分面计数：键为 tags/fileType/status/folder/company/work
+export interface FacetValue {
+  value: string;
+  count: number;
+}
+
+export type DocumentFacets = Record<string, FacetValue[]>;
+
+export interface TagCount {
+  tag: string;
+  count: number;
+}
+
+// 分面过滤条件，多个取值以逗号分隔
+export interface DocumentListParams {
+  status?: string;
+  type?: string;
+  folder?: string;
+  tags?: string;
+  companyId?: string;
+  workId?: string;
+  dateFrom?: string;
+  dateTo?: string;
+  trashed?: boolean;
+}
+
 export interface DocumentSearchResult {
   query: string;
-  documents: Document[];
+  documents: DocumentSearchHit[];
   total: number;
+  facets?: DocumentFacets;
   searchTimeMs: number;
+  keywordHits: number;
   vectorResults: number;
 }
 
+// 文档分块（偏移为提取文本中的字符位置）
+export interface DocumentChunk {
+  id: string;
+  documentId: string;
+  ordinal: number;
+  content: string;
+  tokenCount: number;
+  page?: number;
+  sheet?: string;
+  startOffset: number;
+  endOffset: number;
+  headingPath: string;
+  strategy: ChunkStrategy | '';
+  createdAt: string;
+}
+
+export interface RechunkRequest {
+  ids?: string[];
+  folderId?: string; // 含子文件夹
+  companyId?: string;
+  strategy?: Exclude<ChunkStrategy, 'auto'>;
+  outdated?: boolean;
+}
+
+export interface RechunkResult {
+  queued: string[];
+  skipped: string[]; // 已在处理中的文档
+}
+
+export interface DocumentChunkPage {
+  documentId: string;
+  total: number;
+  offset: number;
+  limit: number;
+  chunks: DocumentChunk[];
+}
+
+// 入库阶段状态
+export interface IngestionStage {
+  name: 'extract' | 'chunk' | 'embed' | 'index' | 'sync';
+  status: 'pending' | 'running' | 'completed' | 'skipped' | 'failed';
+  attempts: number;
+  error?: string;
+  startedAt?: string;
+  finishedAt?: string;
+}
+
+// 入库任务
+export interface IngestionJob {
+  id: string;
+  status: 'queued' | 'running' | 'retrying' | 'completed' | 'failed';
+  stage: IngestionStage['name'];
+  stages: IngestionStage[];
+  attempts: number;
+  maxAttempts: number;
+  lastError: string;
+  nextRunAt: string | null;
+  startedAt: string | null;
+  finishedAt: string | null;
+}
+
+// 分片上传会话
+export interface UploadSession {
+  id: string;
+  fileName: string;
+  fileSize: number;
+  chunkSize: number;
+  totalParts: number;
+  status: 'uploading' | 'assembling' | 'completed';
+  documentId?: string;
+  expiresAt: string;
+  uploadedParts: number[];
+}
+
+export interface InitUploadRequest {
+  fileName: string;
+  fileSize: number;
+  chunkSize?: number;
+  checksum?: string; // 整个文件的 SHA-256（可选）
+  folderId?: string;
+  companyId?: string;
+  workId?: string;
+}
+
+export interface ResumableUploadOptions {
+  folderId?: string;
+  companyId?: string;
+  workId?: string;
+  chunkSize?: number;
+  onProgress?: (uploadedBytes: number, totalBytes: number) => void;
+}
+
+// 分片内容的 SHA-256（十六进制）
+const sha256Hex = async (blob: Blob): Promise<string> => {
+  const digest = await crypto.subtle.digest('SHA-256', await blob.arrayBuffer());
+  return Array.from(new Uint8Array(digest))
+    .map((b) => b.toString(16).padStart(2, '0'))
+    .join('');
+};
+
+// 同一文件的上传会话保存在 localStorage 中，页面刷新或断线后继续上传
+const resumableKey = (file: File, folderId?: string) =>
+  `resumable-upload:${folderId || ''}:${file.name}:${file.size}:${file.lastModified}`;
+
 // 文档状态类型
 export interface DocumentStatus {
   id: string;
@@ -36,16 +301,13 @@ export interface DocumentStatus {
   progress: number; // 0-100, -1 for failed
   message: string;
   updatedAt: string;
+  job?: IngestionJob;
 }
 
 // 文档 API
 export const documentApi = {
   // 获取文档列表
-  list: async (params?: {
-    status?: string;
-    type?: string;
-    folder?: string;
-  }): Promise<Document[]> => {
+  list: async (params?: DocumentListParams): Promise<Document[]> => {
     try {
       const response = await client.get<ApiResponse<Document[]>>('/documents', { params });
       return response.data.data;
@@ -54,6 +316,26 @@ export const documentApi = {
     }
   },
 
+  // 获取文档列表及分面计数
+  listWithFacets: async (params?: DocumentListParams): Promise<{ documents: Document[]; facets: DocumentFacets }> => {
+    try {
+      const response = await client.get<ApiResponse<Document[]> & { facets: DocumentFacets }>('/documents', { params });
+      return { documents: response.data.data, facets: response.data.facets ?? {} };
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 全部标签及文档数
+  listTags: async (): Promise<TagCount[]> => {
+    try {
+      const response = await client.get<ApiResponse<TagCount[]>>('/documents/tags');
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
   // 上传文档
   upload: async (file: File): Promise<Document> => {
     try {
@@ -88,6 +370,128 @@ export const documentApi = {
     }
   },
 
+  // 上传 zip、eml 或 mbox：展开为文件夹与文档，返回生成的文档及跳过的条目
+  uploadArchive: async (file: File, folderId?: string): Promise<ArchiveUploadResult> => {
+    try {
+      const formData = new FormData();
+      formData.append('file', file);
+      if (folderId) formData.append('folderId', folderId);
+
+      const response = await client.post<ApiResponse<Document | Document[]> & { skipped?: SkippedEntry[] }>(
+        '/documents',
+        formData,
+        { headers: { 'Content-Type': 'multipart/form-data' } }
+      );
+      const data = response.data.data;
+      return {
+        documents: Array.isArray(data) ? data : [data],
+        skipped: response.data.skipped ?? [],
+      };
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 创建分片上传会话
+  initUpload: async (payload: InitUploadRequest): Promise<UploadSession> => {
+    try {
+      const response = await client.post<ApiResponse<UploadSession>>('/documents/uploads', payload);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 查询分片上传会话（含已上传的分片序号）
+  getUpload: async (id: string): Promise<UploadSession> => {
+    try {
+      const response = await client.get<ApiResponse<UploadSession>>(`/documents/uploads/${id}`);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 上传一个分片
+  uploadPart: async (id: string, number: number, chunk: Blob): Promise<void> => {
+    try {
+      await client.put(`/documents/uploads/${id}/parts/${number}`, chunk, {
+        headers: {
+          'Content-Type': 'application/octet-stream',
+          'X-Checksum-SHA256': await sha256Hex(chunk),
+        },
+      });
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 合并分片生成文档
+  completeUpload: async (id: string): Promise<Document> => {
+    try {
+      const response = await client.post<ApiResponse<Document>>(`/documents/uploads/${id}/complete`);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 取消分片上传
+  abortUpload: async (id: string): Promise<void> => {
+    try {
+      await client.delete(`/documents/uploads/${id}`);
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 分片上传大文件：复用未过期的会话，只上传缺少的分片
+  uploadResumable: async (file: File, options: ResumableUploadOptions = {}): Promise<Document> => {
+    const key = resumableKey(file, options.folderId);
+    let session: UploadSession | null = null;
+    const savedId = localStorage.getItem(key);
+    if (savedId) {
+      session = await documentApi.getUpload(savedId).catch(() => null);
+    }
+    if (!session || session.status !== 'uploading') {
+      session = await documentApi.initUpload({
+        fileName: file.name,
+        fileSize: file.size,
+        chunkSize: options.chunkSize,
+        folderId: options.folderId,
+        companyId: options.companyId,
+        workId: options.workId,
+      });
+      localStorage.setItem(key, session.id);
+    }
+
+    const uploaded = new Set(session.uploadedParts);
+    let uploadedBytes = 0;
+    for (let number = 1; number <= session.totalParts; number++) {
+      const start = (number - 1) * session.chunkSize;
+      const chunk = file.slice(start, Math.min(start + session.chunkSize, file.size));
+      if (!uploaded.has(number)) {
+        await documentApi.uploadPart(session.id, number, chunk);
+      }
+      uploadedBytes += chunk.size;
+      options.onProgress?.(uploadedBytes, file.size);
+    }
+
+    const doc = await documentApi.completeUpload(session.id);
+    localStorage.removeItem(key);
+    return doc;
+  },
+
+  // 导入网页或 sitemap
+  importUrl: async (payload: ImportUrlRequest): Promise<ImportUrlResult> => {
+    try {
+      const response = await client.post<ApiResponse<ImportUrlResult>>('/documents/import-url', payload);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
   // 获取文档详情
   get: async (id: string): Promise<Document> => {
     try {
@@ -108,6 +512,67 @@ export const documentApi = {
     }
   },
 
+  // 获取文档分块
+  getChunks: async (id: string, params?: { offset?: number; limit?: number }): Promise<DocumentChunkPage> => {
+    try {
+      const response = await client.get<ApiResponse<DocumentChunkPage>>(`/documents/${id}/chunks`, { params });
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 获取版本历史
+  listVersions: async (id: string): Promise<DocumentVersionList> => {
+    try {
+      const response = await client.get<ApiResponse<DocumentVersionList>>(`/documents/${id}/versions`);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 比较两个版本（默认比较当前版本与上一版本）
+  diffVersions: async (id: string, params?: { from?: number; to?: number }): Promise<DocumentVersionDiff> => {
+    try {
+      const response = await client.get<ApiResponse<DocumentVersionDiff>>(`/documents/${id}/versions/diff`, { params });
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 恢复到指定版本（生成新版本）
+  restoreVersion: async (id: string, version: number): Promise<{ document: Document; version: DocumentVersion }> => {
+    try {
+      const response = await client.post<ApiResponse<{ document: Document; version: DocumentVersion }>>(
+        `/documents/${id}/versions/${version}/restore`
+      );
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 重新处理文档
+  reprocess: async (id: string): Promise<void> => {
+    try {
+      await client.post(`/documents/${id}/reprocess`);
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 按当前分块策略重新分块：outdated 只处理策略已变化的文档，strategy 只处理由该策略生成分块的文档
+  rechunk: async (payload: RechunkRequest): Promise<RechunkResult> => {
+    try {
+      const response = await client.post<ApiResponse<RechunkResult>>('/documents/rechunk', payload);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
   // 删除文档
   delete: async (id: string): Promise<void> => {
     try {
@@ -177,18 +642,72 @@ export const documentApi = {
     }
   },
 
-  createFolder: async (name: string, parentId?: string): Promise<Folder> => {
+  createFolder: async (name: string, parentId?: string, chunkStrategy?: ChunkStrategy): Promise<Folder> => {
+    try {
+      const response = await client.post<ApiResponse<Folder>>('/folders', {
+        name,
+        parentId: parentId || '',
+        chunkStrategy: chunkStrategy || '',
+      });
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  updateFolder: async (
+    id: string,
+    payload: { name?: string; parentId?: string; chunkStrategy?: ChunkStrategy | '' }
+  ): Promise<Folder> => {
     try {
-      const response = await client.post<ApiResponse<Folder>>('/folders', { name, parentId: parentId || '' });
+      const response = await client.put<ApiResponse<Folder>>(`/folders/${id}`, payload);
       return response.data.data;
     } catch (error) {
       throw handleApiError(error);
     }
   },
 
-  deleteFolder: async (id: string): Promise<void> => {
+  getFolderTree: async (rootId?: string): Promise<FolderTree> => {
     try {
-      await client.delete(`/folders/${id}`);
+      const response = await client.get<ApiResponse<FolderTree>>('/folders/tree', {
+        params: rootId ? { root: rootId } : undefined,
+      });
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  getFolderPath: async (id: string): Promise<Folder[]> => {
+    try {
+      const response = await client.get<ApiResponse<Folder[]>>(`/folders/${id}/path`);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  deleteFolder: async (id: string, options?: DeleteFolderOptions): Promise<void> => {
+    try {
+      await client.delete(`/folders/${id}`, { params: options });
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  listTrashedFolders: async (): Promise<TrashedFolder[]> => {
+    try {
+      const response = await client.get<ApiResponse<TrashedFolder[]>>('/folders/trash');
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  restoreFolder: async (id: string): Promise<Folder> => {
+    try {
+      const response = await client.post<ApiResponse<Folder>>(`/folders/${id}/restore`);
+      return response.data.data;
     } catch (error) {
       throw handleApiError(error);
     }
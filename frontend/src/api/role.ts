@@ -13,11 +13,32 @@ export interface Role {
   systemPrompt: string;
   welcomeMessage: string;
   modelConfig?: Record<string, any>;
+  knowledgeBindings?: RoleKnowledgeBinding[];
   isTemplate: boolean;
   createdAt: string;
   updatedAt: string;
 }
 
+// 角色知识绑定：文件夹（含子文件夹）、文档、标签或公司知识库
+export type KnowledgeBindingType = 'folder' | 'document' | 'tag' | 'company';
+
+export interface KnowledgeBinding {
+  type: KnowledgeBindingType;
+  target: string;
+}
+
+export interface RoleKnowledgeBinding extends KnowledgeBinding {
+  id: string;
+  roleId: string;
+  createdAt: string;
+}
+
+// 带名称的知识绑定，missing 表示目标已不存在
+export interface KnowledgeBindingView extends KnowledgeBinding {
+  name: string;
+  missing?: boolean;
+}
+
 // 创建角色请求
 export interface CreateRoleRequest {
   name: string;
@@ -27,6 +48,7 @@ export interface CreateRoleRequest {
   systemPrompt: string;
   welcomeMessage?: string;
   modelConfig?: Record<string, any>;
+  knowledgeBindings?: KnowledgeBinding[];
 }
 
 export interface InstallRoleRequest {
@@ -108,6 +130,26 @@ export const roleApi = {
     }
   },
 
+  // 获取角色的知识绑定
+  getKnowledge: async (id: string): Promise<KnowledgeBindingView[]> => {
+    try {
+      const response = await client.get<ApiResponse<KnowledgeBindingView[]>>(`/roles/${id}/knowledge`);
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
+  // 替换角色的知识绑定
+  updateKnowledge: async (id: string, bindings: KnowledgeBinding[]): Promise<KnowledgeBindingView[]> => {
+    try {
+      const response = await client.put<ApiResponse<KnowledgeBindingView[]>>(`/roles/${id}/knowledge`, { bindings });
+      return response.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
   // 删除角色
   delete: async (id: string): Promise<void> => {
     try {
@@ -11,7 +11,7 @@ export interface WorkspaceTask {
   status: 'todo' | 'in_progress' | 'done' | string;
   priority: 'low' | 'medium' | 'high' | string;
   roleId?: string;
-  triggerType?: 'manual' | 'once' | 'daily' | 'interval_hours' | string;
+  triggerType?: 'manual' | 'once' | 'daily' | 'weekly' | 'monthly' | 'cron' | 'interval_hours' | string;
   triggerValue?: string;
   timezone?: string;
   nextRunAt?: string;
@@ -168,6 +168,20 @@ export const workApi = {
     }
   },
 
+  previewSchedule: async (payload: {
+    triggerType: string;
+    triggerValue?: string;
+    timezone?: string;
+    count?: number;
+  }): Promise<{ timezone: string; runs: string[] }> => {
+    try {
+      const res = await client.post<ApiResponse<{ timezone: string; runs: string[] }>>(`${WORKSPACE_BASE}/schedule/preview`, payload);
+      return res.data.data;
+    } catch (error) {
+      throw handleApiError(error);
+    }
+  },
+
   create: async (payload: WorkspacePayload): Promise<WorkspaceTask> => {
     try {
       const res = await client.post<ApiResponse<WorkspaceTask>>(WORKSPACE_BASE, payload);
@@ -270,6 +270,7 @@ const Message: React.FC<MessageProps> = ({
                         (typeof item?.title === 'string' && item.title) ||
                         (typeof item?.name === 'string' && item.name) ||
                         `来源 ${index + 1}`;
+                      const marker = typeof item?.marker === 'number' ? `[${item.marker}] ` : '';
                       const url =
                         (typeof item?.url === 'string' && item.url) ||
                         (typeof item?.link === 'string' && item.link) ||
@@ -278,10 +279,10 @@ const Message: React.FC<MessageProps> = ({
                         <li key={`${title}-${index}`}>
                           {url ? (
                             <a href={url} target="_blank" rel="noopener noreferrer">
-                              {title}
+                              {marker}{title}
                             </a>
                           ) : (
-                            <span>{title}</span>
+                            <span>{marker}{title}</span>
                           )}
                         </li>
                       );
@@ -535,6 +535,7 @@ const ChatWebUI: React.FC<ChatWebUIProps> = ({ initialRoleId }) => {
             title="选择知识库"
           >
             <option value="none">无知识库</option>
+            <option value="role">角色知识库</option>
             <option value="all">全部文档</option>
             {knowledgeFolders.map((folder) => (
               <option key={folder.id} value={`folder:${folder.id}`}>
@@ -498,11 +498,11 @@ export const KnowledgeBase: FC = () => {
   };
 
   const deleteFolder = async (folderId: string) => {
-    if (!token || !confirm('确定要删除这个文件夹吗？')) return;
+    if (!token || !confirm('确定要将这个文件夹（含子文件夹和其中的文档）移入回收站吗？')) return;
 
     try {
       await documentApi.deleteFolder(folderId);
-      await loadFolders();
+      await Promise.all([loadFolders(), loadDocuments()]);
       setOperationError('');
     } catch (err: any) {
       console.error('Failed to delete folder:', err);
@@ -733,7 +733,7 @@ export const KnowledgeBase: FC = () => {
             <input
               ref={fileInputRef}
               type="file"
-              accept=".pdf,.doc,.docx,.xls,.xlsx,.ppt,.pptx,.csv,.txt,.md"
+              accept=".pdf,.doc,.docx,.xls,.xlsx,.ppt,.pptx,.csv,.txt,.md,.zip,.eml,.mbox"
               multiple
               onChange={handleFileSelect}
               disabled={uploading}
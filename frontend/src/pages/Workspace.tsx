@@ -19,6 +19,9 @@ const clipText = (value?: string, limit = 200) => {
 
 const triggerValueHint = (triggerType: string) => {
   if (triggerType === 'daily') return '例如 09:00';
+  if (triggerType === 'weekly') return '例如 mon,fri 09:00';
+  if (triggerType === 'monthly') return '例如 1,15 09:00 或 last 20:00';
+  if (triggerType === 'cron') return '例如 0 9 * * 1-5';
   if (triggerType === 'interval_hours') return '例如 4（每 4 小时）';
   if (triggerType === 'once') return '例如 2026-03-01T09:00:00+08:00';
   return 'manual 模式可留空';
@@ -513,6 +516,9 @@ export const WorkspacePage = () => {
               <option value="manual">手动执行</option>
               <option value="once">定时一次</option>
               <option value="daily">每日定时</option>
+              <option value="weekly">每周定时</option>
+              <option value="monthly">每月定时</option>
+              <option value="cron">Cron 表达式</option>
               <option value="interval_hours">每 N 小时</option>
             </select>
             <input
@@ -68,7 +68,7 @@ if [ -f .env ]; then
     source .env
     set +a
 fi
-nohup go run cmd/server/main.go > logs/server.log 2>&1 &
+nohup go run -tags sqlite_fts5 cmd/server/main.go > logs/server.log 2>&1 &
 BACKEND_PID=$!
 echo $BACKEND_PID > /tmp/rolecraft-backend.pid
 echo "   ✅ 后端已启动 (PID: $BACKEND_PID)"